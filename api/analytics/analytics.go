@@ -0,0 +1,340 @@
+package analytics
+
+import (
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"how-much-do-i-owe/database"
+	"math"
+	"strconv"
+	"time"
+)
+
+const (
+	// maxBuckets The most buckets one request can ask for
+	maxBuckets = 520
+	// defaultBuckets How many buckets there are when the range isn't given,
+	// ending with the current one
+	defaultBuckets = 12
+	// topPayers How many payers are listed
+	topPayers = 10
+)
+
+// analytics The user's share of the expenses they took part in, in a range of
+// days in their time zone from From up to To, settlements left out. Total is
+// what the expenses came to in full.
+type analytics struct {
+	Bucket         string          `json:"bucket"`
+	From           string          `json:"from"`
+	To             string          `json:"to"`
+	TimeZone       string          `json:"timeZone"`
+	Expenses       int             `json:"expenses"`
+	Share          float64         `json:"share"`
+	Total          float64         `json:"total"`
+	AverageExpense float64         `json:"averageExpense"`
+	AverageShare   float64         `json:"averageShare"`
+	Buckets        []bucketTotal   `json:"buckets"`
+	Categories     []categoryTotal `json:"categories"`
+	Groups         []groupTotal    `json:"groups"`
+	Contacts       []contactTotal  `json:"contacts"`
+	TopPayers      []payerTotal    `json:"topPayers"`
+}
+
+// bucketTotal A week, month or year from Start. Every bucket in the range is
+// listed, empty ones too.
+type bucketTotal struct {
+	Start    string  `json:"start"`
+	Expenses int     `json:"expenses"`
+	Share    float64 `json:"share"`
+	Total    float64 `json:"total"`
+}
+
+type categoryTotal struct {
+	Category string  `json:"category"`
+	Expenses int     `json:"expenses"`
+	Share    float64 `json:"share"`
+}
+
+// groupTotal Expenses in a group, or in none when GroupID is null
+type groupTotal struct {
+	GroupID  *int    `json:"groupId"`
+	Name     string  `json:"name"`
+	Expenses int     `json:"expenses"`
+	Share    float64 `json:"share"`
+}
+
+// contactTotal The user's share of the expenses someone else paid or took
+// part in. An expense with several people counts for each of them.
+type contactTotal struct {
+	ID       string  `json:"id"`
+	Name     string  `json:"name"`
+	Expenses int     `json:"expenses"`
+	Share    float64 `json:"share"`
+}
+
+// payerTotal Who paid for the expenses: Paid is what the expenses came to in
+// full, Share the part of them that was the user's
+type payerTotal struct {
+	ID       string  `json:"id"`
+	Name     string  `json:"name"`
+	Expenses int     `json:"expenses"`
+	Paid     float64 `json:"paid"`
+	Share    float64 `json:"share"`
+}
+
+// Routes All the routes created by the package nested in
+// api/v1/*
+func Routes(r *gin.RouterGroup, db *database.DB) {
+	r.GET("/analytics", getAnalytics(db))
+}
+
+// filter Narrows every query to the user's rollups in the range, and a group
+// and category when they're set
+const filter = ` WHERE r.user_id=$1 AND r.day >= $2::date AND r.day < $3::date
+    AND ($4::integer IS NULL OR r.group_id=$4) AND ($5::text IS NULL OR r.category=$5)`
+
+// truncate The first day of the bucket day is in. Weeks start on Monday.
+func truncate(bucket string, day time.Time) time.Time {
+	day = time.Date(day.Year(), day.Month(), day.Day(), 0, 0, 0, 0, time.UTC)
+	switch bucket {
+	case "week":
+		return day.AddDate(0, 0, -(int(day.Weekday())+6)%7)
+	case "year":
+		return time.Date(day.Year(), 1, 1, 0, 0, 0, 0, time.UTC)
+	}
+	return time.Date(day.Year(), day.Month(), 1, 0, 0, 0, 0, time.UTC)
+}
+
+// next The first day of the bucket after the one that starts on start
+func next(bucket string, start time.Time) time.Time {
+	switch bucket {
+	case "week":
+		return start.AddDate(0, 0, 7)
+	case "year":
+		return start.AddDate(1, 0, 0)
+	}
+	return start.AddDate(0, 1, 0)
+}
+
+// series Every bucket from the one from is in up to to, with the totals in got
+// by their start
+func series(bucket string, from time.Time, to time.Time, got map[string]bucketTotal) []bucketTotal {
+	buckets := []bucketTotal{}
+	for start := truncate(bucket, from); start.Before(to); start = next(bucket, start) {
+		b, ok := got[start.Format("2006-01-02")]
+		if !ok {
+			b = bucketTotal{Start: start.Format("2006-01-02")}
+		}
+		buckets = append(buckets, b)
+	}
+	return buckets
+}
+
+// dateRange The days from and to in the request, in the user's time zone.
+// When to is left out the range ends with the bucket today is in, and when
+// from is it has defaultBuckets buckets.
+func dateRange(bucket string, fromParam string, toParam string, today time.Time) (time.Time, time.Time, error) {
+	to := next(bucket, truncate(bucket, today))
+	var from time.Time
+	var err error
+	if toParam != "" {
+		if to, err = time.Parse("2006-01-02", toParam); err != nil {
+			return from, to, fmt.Errorf("to must be a date, YYYY-MM-DD")
+		}
+	}
+	if fromParam != "" {
+		if from, err = time.Parse("2006-01-02", fromParam); err != nil {
+			return from, to, fmt.Errorf("from must be a date, YYYY-MM-DD")
+		}
+	} else {
+		from = truncate(bucket, to.AddDate(0, 0, -1))
+		for i := 1; i < defaultBuckets; i++ {
+			from = truncate(bucket, from.AddDate(0, 0, -1))
+		}
+	}
+	if !from.Before(to) {
+		return from, to, fmt.Errorf("from must be before to")
+	}
+	count := 0
+	for start := truncate(bucket, from); start.Before(to); start = next(bucket, start) {
+		if count++; count > maxBuckets {
+			return from, to, fmt.Errorf("the range can have at most %d buckets, use a bigger bucket", maxBuckets)
+		}
+	}
+	return from, to, nil
+}
+
+// getAnalytics What the user spent, by week, month or year and broken down by
+// category, group, contact and payer. Served from the user's rollups, which
+// are built the first time they ask.
+func getAnalytics(db *database.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.GetString("UserID")
+		bucket := c.DefaultQuery("bucket", "month")
+		if bucket != "week" && bucket != "month" && bucket != "year" {
+			c.JSON(400, "bucket must be week, month or year")
+			return
+		}
+		var groupID *int
+		if c.Query("groupId") != "" {
+			id, err := strconv.Atoi(c.Query("groupId"))
+			if err != nil {
+				c.JSON(400, "Invalid group ID")
+				return
+			}
+			groupID = &id
+		}
+		var category *string
+		if v, ok := c.GetQuery("category"); ok {
+			if v == "uncategorized" {
+				v = ""
+			}
+			category = &v
+		}
+
+		var timeZone string
+		err := db.Db.QueryRow("SELECT COALESCE((SELECT time_zone FROM notification_setting WHERE user_id=$1), 'UTC')",
+			userID).Scan(&timeZone)
+		if err != nil {
+			database.RespondErr(err, c)
+			return
+		}
+		location, err := time.LoadLocation(timeZone)
+		if err != nil {
+			timeZone, location = "UTC", time.UTC
+		}
+		from, to, err := dateRange(bucket, c.Query("from"), c.Query("to"), time.Now().In(location))
+		if err != nil {
+			c.JSON(400, err.Error())
+			return
+		}
+		if err = ensure(db, userID, timeZone); err != nil {
+			database.RespondErr(err, c)
+			return
+		}
+
+		a := analytics{Bucket: bucket, From: from.Format("2006-01-02"), To: to.Format("2006-01-02"), TimeZone: timeZone}
+		if err = a.load(db, userID, groupID, category); err != nil {
+			database.RespondErr(err, c)
+			return
+		}
+
+		c.JSON(200, a)
+	}
+}
+
+// load Adds up the rollups in the range of a
+func (a *analytics) load(db *database.DB, userID string, groupID *int, category *string) error {
+	args := []interface{}{userID, a.From, a.To, groupID, category}
+	err := db.Db.QueryRow(`SELECT COALESCE(sum(expenses), 0), COALESCE(sum(share), 0), COALESCE(sum(total), 0)
+							FROM spending_rollup r`+filter, args...).Scan(&a.Expenses, &a.Share, &a.Total)
+	if err != nil {
+		return err
+	}
+	a.Share, a.Total = round(a.Share), round(a.Total)
+	if a.Expenses > 0 {
+		a.AverageExpense, a.AverageShare = round(a.Total/float64(a.Expenses)), round(a.Share/float64(a.Expenses))
+	}
+
+	got := make(map[string]bucketTotal)
+	err = each(db, `SELECT to_char(date_trunc($6::text, r.day::timestamp), 'YYYY-MM-DD'), sum(expenses), sum(share), sum(total)
+						FROM spending_rollup r`+filter+` GROUP BY 1`, append(args, a.Bucket), func(scan func(...interface{}) error) error {
+		var b bucketTotal
+		if err := scan(&b.Start, &b.Expenses, &b.Share, &b.Total); err != nil {
+			return err
+		}
+		b.Share, b.Total = round(b.Share), round(b.Total)
+		got[b.Start] = b
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	from, _ := time.Parse("2006-01-02", a.From)
+	to, _ := time.Parse("2006-01-02", a.To)
+	a.Buckets = series(a.Bucket, from, to, got)
+
+	a.Categories = []categoryTotal{}
+	err = each(db, `SELECT r.category, sum(expenses), sum(share) FROM spending_rollup r`+filter+`
+						GROUP BY r.category ORDER BY 3 DESC, 1`, args, func(scan func(...interface{}) error) error {
+		var t categoryTotal
+		if err := scan(&t.Category, &t.Expenses, &t.Share); err != nil {
+			return err
+		}
+		t.Share = round(t.Share)
+		a.Categories = append(a.Categories, t)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	a.Groups = []groupTotal{}
+	err = each(db, `SELECT r.group_id, COALESCE(g.name, ''), sum(expenses), sum(share) FROM spending_rollup r
+						LEFT JOIN expense_group g ON g.id = r.group_id`+filter+`
+						GROUP BY r.group_id, g.name ORDER BY 4 DESC, 2`, args, func(scan func(...interface{}) error) error {
+		var t groupTotal
+		if err := scan(&t.GroupID, &t.Name, &t.Expenses, &t.Share); err != nil {
+			return err
+		}
+		t.Share = round(t.Share)
+		a.Groups = append(a.Groups, t)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	a.Contacts = []contactTotal{}
+	err = each(db, `SELECT r.contact_id, COALESCE(NULLIF(c.nickname, ''), a.name, ''), sum(expenses), sum(share)
+						FROM contact_spending_rollup r
+						LEFT JOIN account a ON a.id = r.contact_id
+						LEFT JOIN contact c ON c.user_id = r.user_id AND c.contact_id = r.contact_id`+filter+`
+						GROUP BY r.contact_id, a.name, c.nickname ORDER BY 4 DESC, 2`, args, func(scan func(...interface{}) error) error {
+		var t contactTotal
+		if err := scan(&t.ID, &t.Name, &t.Expenses, &t.Share); err != nil {
+			return err
+		}
+		t.Share = round(t.Share)
+		a.Contacts = append(a.Contacts, t)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	a.TopPayers = []payerTotal{}
+	return each(db, `SELECT r.payer_id, COALESCE(NULLIF(c.nickname, ''), a.name, ''), sum(expenses), sum(total), sum(share)
+						FROM spending_rollup r
+						LEFT JOIN account a ON a.id = r.payer_id
+						LEFT JOIN contact c ON c.user_id = r.user_id AND c.contact_id = r.payer_id`+filter+`
+						GROUP BY r.payer_id, a.name, c.nickname ORDER BY 4 DESC, 2 LIMIT `+strconv.Itoa(topPayers),
+		args, func(scan func(...interface{}) error) error {
+			var t payerTotal
+			if err := scan(&t.ID, &t.Name, &t.Expenses, &t.Paid, &t.Share); err != nil {
+				return err
+			}
+			t.Paid, t.Share = round(t.Paid), round(t.Share)
+			a.TopPayers = append(a.TopPayers, t)
+			return nil
+		})
+}
+
+// each Runs query and calls row for every row it returns
+func each(db *database.DB, query string, args []interface{}, row func(scan func(...interface{}) error) error) error {
+	queryRows, err := db.Db.Query(query, args...)
+	if err != nil {
+		return err
+	}
+	defer queryRows.Close()
+	for queryRows.Next() {
+		if err = row(queryRows.Scan); err != nil {
+			return err
+		}
+	}
+	return queryRows.Err()
+}
+
+// round Rounds to the cent
+func round(amount float64) float64 {
+	return math.Round(amount*100) / 100
+}
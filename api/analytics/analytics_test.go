@@ -0,0 +1,74 @@
+package analytics
+
+import (
+	"testing"
+	"time"
+)
+
+func date(s string) time.Time {
+	t, _ := time.Parse("2006-01-02", s)
+	return t
+}
+
+func TestTruncate(t *testing.T) {
+	tests := []struct {
+		bucket, day, want, next string
+	}{
+		{"week", "2024-03-06", "2024-03-04", "2024-03-11"},
+		{"week", "2024-03-04", "2024-03-04", "2024-03-11"},
+		{"week", "2024-03-10", "2024-03-04", "2024-03-11"},
+		{"week", "2024-01-02", "2024-01-01", "2024-01-08"},
+		{"month", "2024-02-29", "2024-02-01", "2024-03-01"},
+		{"month", "2023-12-31", "2023-12-01", "2024-01-01"},
+		{"year", "2024-07-15", "2024-01-01", "2025-01-01"},
+	}
+	for _, test := range tests {
+		start := truncate(test.bucket, date(test.day))
+		if got := start.Format("2006-01-02"); got != test.want {
+			t.Errorf("the %s of %s starts on %s, want %s", test.bucket, test.day, got, test.want)
+		}
+		if got := next(test.bucket, start).Format("2006-01-02"); got != test.next {
+			t.Errorf("the %s after %s starts on %s, want %s", test.bucket, test.want, got, test.next)
+		}
+	}
+}
+
+func TestSeries(t *testing.T) {
+	got := map[string]bucketTotal{"2024-02-01": {Start: "2024-02-01", Expenses: 2, Share: 12.5, Total: 30}}
+	buckets := series("month", date("2024-01-15"), date("2024-04-01"), got)
+	if len(buckets) != 3 {
+		t.Fatalf("got %v, want January to March", buckets)
+	}
+	for i, start := range []string{"2024-01-01", "2024-02-01", "2024-03-01"} {
+		if buckets[i].Start != start {
+			t.Errorf("bucket %d starts on %s, want %s", i, buckets[i].Start, start)
+		}
+	}
+	if buckets[1] != got["2024-02-01"] || buckets[0].Expenses != 0 || buckets[2].Share != 0 {
+		t.Errorf("got %v", buckets)
+	}
+}
+
+func TestDateRange(t *testing.T) {
+	today := time.Date(2024, 3, 6, 23, 30, 0, 0, time.UTC)
+	from, to, err := dateRange("month", "", "", today)
+	if err != nil || from != date("2023-04-01") || to != date("2024-04-01") {
+		t.Errorf("the default range is %v to %v (%v), want the 12 months up to March 2024", from, to, err)
+	}
+	from, to, err = dateRange("week", "", "2024-03-04", today)
+	if err != nil || from != date("2023-12-11") || to != date("2024-03-04") {
+		t.Errorf("got %v to %v (%v), want the 12 weeks before March 4", from, to, err)
+	}
+	from, to, err = dateRange("year", "2020-06-01", "", today)
+	if err != nil || from != date("2020-06-01") || to != date("2025-01-01") {
+		t.Errorf("got %v to %v (%v)", from, to, err)
+	}
+	for _, bad := range [][2]string{{"2024-03-01", "2024-03-01"}, {"March", ""}, {"", "2024-3-1"}, {"1990-01-01", "2024-01-01"}} {
+		if _, _, err = dateRange("week", bad[0], bad[1], today); err == nil {
+			t.Errorf("from %q to %q should be rejected", bad[0], bad[1])
+		}
+	}
+	if _, _, err = dateRange("month", "1990-01-01", "2024-01-01", today); err != nil {
+		t.Errorf("34 years of months should be allowed: %v", err)
+	}
+}
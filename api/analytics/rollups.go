@@ -0,0 +1,122 @@
+package analytics
+
+import (
+	"database/sql"
+	"fmt"
+	"github.com/lib/pq"
+	"how-much-do-i-owe/database"
+	"time"
+)
+
+// rollupScope Which rows of the rollups a statement works on: those of the
+// users in $1 that have rollups, and when $2 isn't null only the days, in
+// each user's time zone, that the times in $2 fall on
+const rollupScope = `s.user_id = ANY($1) AND ($2::timestamptz[] IS NULL
+    OR %s IN (SELECT (times AT TIME ZONE s.time_zone)::date FROM unnest($2::timestamptz[]) times))`
+
+// rollupStatements Replace the rollups in the scope with what the ledger adds
+// up to now
+var rollupStatements = []string{
+	`DELETE FROM spending_rollup r USING analytics_state s WHERE r.user_id = s.user_id AND ` + scope("r.day"),
+	`DELETE FROM contact_spending_rollup r USING analytics_state s WHERE r.user_id = s.user_id AND ` + scope("r.day"),
+	`INSERT INTO spending_rollup (user_id, day, category, group_id, payer_id, expenses, share, total)
+    SELECT s.user_id, (t.timestamp AT TIME ZONE s.time_zone)::date, t.category, t.group_id, t.payer,
+           count(*), sum(tp.dollar_share), sum(totals.amount)
+    FROM analytics_state s
+    JOIN transaction_participants tp ON tp.user_id = s.user_id
+    JOIN transaction t ON t.id = tp.transaction_id AND t.split_type <> 'settlement'
+    CROSS JOIN LATERAL (SELECT sum(dollar_share) AS amount FROM transaction_participants WHERE transaction_id = t.id) totals
+    WHERE ` + scope("(t.timestamp AT TIME ZONE s.time_zone)::date") + `
+    GROUP BY 1, 2, 3, 4, 5`,
+	`INSERT INTO contact_spending_rollup (user_id, day, category, group_id, contact_id, expenses, share)
+    SELECT s.user_id, (t.timestamp AT TIME ZONE s.time_zone)::date, t.category, t.group_id, others.id,
+           count(*), sum(tp.dollar_share)
+    FROM analytics_state s
+    JOIN transaction_participants tp ON tp.user_id = s.user_id
+    JOIN transaction t ON t.id = tp.transaction_id AND t.split_type <> 'settlement'
+    CROSS JOIN LATERAL (SELECT user_id AS id FROM transaction_participants WHERE transaction_id = t.id
+                        UNION SELECT t.payer) others
+    WHERE others.id <> s.user_id AND ` + scope("(t.timestamp AT TIME ZONE s.time_zone)::date") + `
+    GROUP BY 1, 2, 3, 4, 5`,
+}
+
+func scope(day string) string {
+	return fmt.Sprintf(rollupScope, day)
+}
+
+// Refresh Brings the rollups of users up to date for the days times fall on,
+// after a change to transactions that involve them at those times. Pass the
+// time of a transaction before and after a change, and everyone who was in
+// it before and after. Users without rollups are left alone, theirs are
+// built when they first ask for analytics. Run it in the transaction that
+// makes the change, so the rollups change with the ledger.
+func Refresh(db database.Querier, users []string, times []time.Time) error {
+	locked, err := lock(db, users)
+	if err != nil || len(locked) == 0 {
+		return err
+	}
+	formatted := make([]string, len(times))
+	for i, t := range times {
+		formatted[i] = t.Format(time.RFC3339Nano)
+	}
+	return run(db, locked, pq.StringArray(formatted))
+}
+
+// lock Locks the analytics state of those of users that have rollups, in a
+// fixed order so concurrent refreshes can't deadlock. Until the transaction
+// ends other refreshes of their rollups wait, and then see the change.
+func lock(db database.Querier, users []string) ([]string, error) {
+	queryRows, err := db.Query("SELECT user_id FROM analytics_state WHERE user_id = ANY($1) ORDER BY user_id FOR UPDATE",
+		pq.Array(users))
+	if err != nil {
+		return nil, err
+	}
+	defer queryRows.Close()
+	var locked []string
+	for queryRows.Next() {
+		var id string
+		if err = queryRows.Scan(&id); err != nil {
+			return nil, err
+		}
+		locked = append(locked, id)
+	}
+	return locked, queryRows.Err()
+}
+
+func run(db database.Querier, users []string, times interface{}) error {
+	for _, statement := range rollupStatements {
+		if _, err := db.Exec(statement, pq.Array(users), times); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ensure Makes sure userID has rollups in timeZone, building them from the
+// whole ledger when they have none yet or they were built in another time
+// zone
+func ensure(db *database.DB, userID string, timeZone string) error {
+	var current string
+	err := db.Db.QueryRow("SELECT time_zone FROM analytics_state WHERE user_id=$1", userID).Scan(&current)
+	if err == nil && current == timeZone {
+		return nil
+	}
+	if err != nil && err != sql.ErrNoRows {
+		return err
+	}
+
+	tx, err := db.Db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	_, err = tx.Exec(`INSERT INTO analytics_state (user_id, time_zone) VALUES ($1, $2)
+						ON CONFLICT (user_id) DO UPDATE SET time_zone=$2, built_at=now()`, userID, timeZone)
+	if err != nil {
+		return err
+	}
+	if err = run(tx, []string{userID}, nil); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,362 @@
+package budgets
+
+import (
+	"database/sql"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+	"how-much-do-i-owe/api/groups"
+	"how-much-do-i-owe/api/transactions"
+	"how-much-do-i-owe/database"
+	"how-much-do-i-owe/money"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Periods of a budget
+const (
+	Monthly = "monthly"
+	Range   = "range"
+)
+
+const (
+	maxThresholds = 5
+	maxThreshold  = 1000
+)
+
+var defaultThresholds = []int{80, 100}
+
+// budget What a group means to spend on a category, or on everything when
+// Category is null, each month or from From up to To. Members are alerted
+// when spending reaches each of the Thresholds, percentages of Amount.
+//
+// The rest is the status of the current period, or of the range: Spent is
+// what the group's expenses in it came to, settlements left out, and Share
+// is the user's part of that. Reached are the thresholds spending reached.
+type budget struct {
+	ID          int        `json:"id"`
+	GroupID     int        `json:"groupId"`
+	Group       string     `json:"group"`
+	Name        string     `json:"name"`
+	Category    *string    `json:"category"`
+	Amount      float64    `json:"amount"`
+	Period      string     `json:"period"`
+	From        *time.Time `json:"from"`
+	To          *time.Time `json:"to"`
+	TimeZone    string     `json:"timeZone"`
+	Thresholds  []int      `json:"thresholds"`
+	CreatedAt   time.Time  `json:"createdAt"`
+	PeriodStart time.Time  `json:"periodStart"`
+	PeriodEnd   time.Time  `json:"periodEnd"`
+	Active      bool       `json:"active"`
+	Spent       float64    `json:"spent"`
+	Share       float64    `json:"share"`
+	Remaining   float64    `json:"remaining"`
+	Percent     float64    `json:"percent"`
+	Reached     []int      `json:"reached"`
+}
+
+// budgetRequest Creates a budget or replaces one. TimeZone is when the months
+// of a monthly budget start, the user's own by default.
+type budgetRequest struct {
+	Name       string     `json:"name"`
+	Category   *string    `json:"category"`
+	Amount     float64    `json:"amount"`
+	Period     string     `json:"period"`
+	From       *time.Time `json:"from"`
+	To         *time.Time `json:"to"`
+	TimeZone   string     `json:"timeZone"`
+	Thresholds []int      `json:"thresholds"`
+}
+
+// Routes All the routes created by the package nested in
+// api/v1/*
+func Routes(r *gin.RouterGroup, db *database.DB) {
+	r.GET("/budgets", getBudgets(db))
+	r.GET("/group/:id/budgets", getGroupBudgets(db))
+	r.PUT("/group/:id/budget", createBudget(db))
+	r.GET("/budget/:id", getBudget(db))
+	r.PATCH("/budget/:id", replaceBudget(db))
+	r.DELETE("/budget/:id", deleteBudget(db))
+}
+
+// validate Fills in the defaults of a request and says why it isn't valid
+func (req *budgetRequest) validate() error {
+	req.Name = strings.TrimSpace(req.Name)
+	if len(req.Name) > 100 {
+		return errors.New("name can be at most 100 characters")
+	}
+	if req.Category != nil {
+		category := strings.ToLower(strings.TrimSpace(*req.Category))
+		req.Category = &category
+		valid := false
+		for _, c := range transactions.Categories {
+			valid = valid || c == category
+		}
+		if !valid {
+			return errors.New("category must be one of " + strings.Join(transactions.Categories, ", ") + ", or null for every expense")
+		}
+	}
+	if req.Amount <= 0 || req.Amount >= 1e12 {
+		return errors.New("amount must be more than 0")
+	}
+	req.Amount = float64(money.ToCents(req.Amount)) / 100
+	if req.Period == "" {
+		req.Period = Monthly
+	}
+	switch req.Period {
+	case Monthly:
+		if req.From != nil || req.To != nil {
+			return errors.New("from and to are only for range budgets")
+		}
+	case Range:
+		if req.From == nil || req.To == nil || !req.From.Before(*req.To) {
+			return errors.New("a range budget needs from before to")
+		}
+	default:
+		return errors.New("period must be monthly or range")
+	}
+	if req.TimeZone != "" {
+		if _, err := time.LoadLocation(req.TimeZone); err != nil {
+			return errors.New("timeZone must be a time zone such as Europe/Paris")
+		}
+	}
+	if req.Thresholds == nil {
+		req.Thresholds = defaultThresholds
+	}
+	if len(req.Thresholds) == 0 || len(req.Thresholds) > maxThresholds {
+		return errors.New("thresholds must have between 1 and 5 percentages")
+	}
+	for i, t := range req.Thresholds {
+		if t < 1 || t > maxThreshold || (i > 0 && t <= req.Thresholds[i-1]) {
+			return errors.New("thresholds must be percentages from 1 to 1000 in increasing order")
+		}
+	}
+	return nil
+}
+
+const budgetQuery = `SELECT b.id, b.group_id, g.name, b.name, b.category, b.amount, b.period, b.starts_at, b.ends_at,
+       b.time_zone, b.thresholds, b.created_at FROM budget b JOIN expense_group g ON g.id = b.group_id`
+
+func scanBudget(row interface{ Scan(...interface{}) error }) (budget, error) {
+	var b budget
+	var thresholds pq.Int64Array
+	err := row.Scan(&b.ID, &b.GroupID, &b.Group, &b.Name, &b.Category, &b.Amount, &b.Period, &b.From, &b.To,
+		&b.TimeZone, &thresholds, &b.CreatedAt)
+	b.Thresholds = make([]int, len(thresholds))
+	for i, t := range thresholds {
+		b.Thresholds[i] = int(t)
+	}
+	return b, err
+}
+
+// list The budgets query returns, with their status for userID
+func list(db *database.DB, userID string, query string, args ...interface{}) ([]budget, error) {
+	queryRows, err := db.Db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	budgets := []budget{}
+	for queryRows.Next() {
+		b, err := scanBudget(queryRows)
+		if err != nil {
+			queryRows.Close()
+			return nil, err
+		}
+		budgets = append(budgets, b)
+	}
+	queryRows.Close()
+	if err = queryRows.Err(); err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	for i := range budgets {
+		if err = budgets[i].status(db.Db, userID, now); err != nil {
+			return nil, err
+		}
+	}
+	return budgets, nil
+}
+
+// getBudgets The budgets of every group the user is a member of
+func getBudgets(db *database.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.GetString("UserID")
+		budgets, err := list(db, userID, budgetQuery+` JOIN group_member m ON m.group_id = b.group_id AND m.user_id=$1
+															ORDER BY g.name, b.name, b.id`, userID)
+		if err != nil {
+			database.RespondErr(err, c)
+			return
+		}
+
+		c.JSON(200, budgets)
+	}
+}
+
+func getGroupBudgets(db *database.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		groupID, ok := groupParam(c, db)
+		if !ok {
+			return
+		}
+		budgets, err := list(db, c.GetString("UserID"), budgetQuery+" WHERE b.group_id=$1 ORDER BY b.name, b.id", groupID)
+		if err != nil {
+			database.RespondErr(err, c)
+			return
+		}
+
+		c.JSON(200, budgets)
+	}
+}
+
+// groupParam The group in the URL, if the user is a member of it
+func groupParam(c *gin.Context, db *database.DB) (int, bool) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(400, "Invalid group ID")
+		return 0, false
+	}
+	isMember, err := groups.Members(db.Db, id, []string{c.GetString("UserID")})
+	if err != nil {
+		database.RespondErr(err, c)
+		return 0, false
+	}
+	if !isMember {
+		c.AbortWithStatusJSON(404, "Group not found")
+		return 0, false
+	}
+	return id, true
+}
+
+// budgetParam The budget in the URL, if the user is a member of its group
+func budgetParam(c *gin.Context, db *database.DB) (budget, bool) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(400, "Invalid budget ID")
+		return budget{}, false
+	}
+	b, err := scanBudget(db.Db.QueryRow(budgetQuery+` WHERE b.id=$1
+								AND EXISTS(SELECT 1 FROM group_member m WHERE m.group_id = b.group_id AND m.user_id=$2)`,
+		id, c.GetString("UserID")))
+	if err == sql.ErrNoRows {
+		c.AbortWithStatusJSON(404, "Budget not found")
+		return b, false
+	}
+	if err != nil {
+		database.RespondErr(err, c)
+		return b, false
+	}
+	return b, true
+}
+
+// respondBudget Responds with the budget with id and its status
+func respondBudget(c *gin.Context, db *database.DB, id int, status int) {
+	b, err := scanBudget(db.Db.QueryRow(budgetQuery+" WHERE b.id=$1", id))
+	if err == nil {
+		err = b.status(db.Db, c.GetString("UserID"), time.Now())
+	}
+	if err != nil {
+		database.RespondErr(err, c)
+		return
+	}
+	c.JSON(status, b)
+}
+
+func getBudget(db *database.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		b, ok := budgetParam(c, db)
+		if !ok {
+			return
+		}
+		respondBudget(c, db, b.ID, 200)
+	}
+}
+
+// bindBudget The budget in the request, with the user's time zone when it
+// doesn't have one
+func bindBudget(c *gin.Context, db *database.DB) (budgetRequest, bool) {
+	var req budgetRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return req, false
+	}
+	if err := req.validate(); err != nil {
+		c.JSON(http.StatusBadRequest, err.Error())
+		return req, false
+	}
+	if req.TimeZone == "" {
+		err := db.Db.QueryRow("SELECT COALESCE((SELECT time_zone FROM notification_setting WHERE user_id=$1), 'UTC')",
+			c.GetString("UserID")).Scan(&req.TimeZone)
+		if err != nil {
+			database.CheckDBErr(err.(*pq.Error), c)
+			return req, false
+		}
+	}
+	return req, true
+}
+
+// createBudget Any member of a group can give it a budget
+func createBudget(db *database.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		groupID, ok := groupParam(c, db)
+		if !ok {
+			return
+		}
+		req, ok := bindBudget(c, db)
+		if !ok {
+			return
+		}
+		var id int
+		err := db.Db.QueryRow(`INSERT INTO budget (group_id, name, category, amount, period, starts_at, ends_at, time_zone,
+								thresholds, created_by) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10) RETURNING id`,
+			groupID, req.Name, req.Category, req.Amount, req.Period, req.From, req.To, req.TimeZone, pq.Array(req.Thresholds),
+			c.GetString("UserID")).Scan(&id)
+		if err != nil {
+			database.CheckDBErr(err.(*pq.Error), c)
+			return
+		}
+
+		respondBudget(c, db, id, 201)
+	}
+}
+
+// replaceBudget Changes a budget to the one in the request. Alerts already
+// sent in the current period aren't sent again.
+func replaceBudget(db *database.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		b, ok := budgetParam(c, db)
+		if !ok {
+			return
+		}
+		req, ok := bindBudget(c, db)
+		if !ok {
+			return
+		}
+		_, err := db.Db.Exec(`UPDATE budget SET name=$2, category=$3, amount=$4, period=$5, starts_at=$6, ends_at=$7,
+								time_zone=$8, thresholds=$9 WHERE id=$1`,
+			b.ID, req.Name, req.Category, req.Amount, req.Period, req.From, req.To, req.TimeZone, pq.Array(req.Thresholds))
+		if err != nil {
+			database.CheckDBErr(err.(*pq.Error), c)
+			return
+		}
+
+		respondBudget(c, db, b.ID, 201)
+	}
+}
+
+func deleteBudget(db *database.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		b, ok := budgetParam(c, db)
+		if !ok {
+			return
+		}
+		if _, err := db.Db.Exec("DELETE FROM budget WHERE id=$1", b.ID); err != nil {
+			database.CheckDBErr(err.(*pq.Error), c)
+			return
+		}
+
+		c.JSON(201, b.ID)
+	}
+}
@@ -0,0 +1,72 @@
+package budgets
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPeriod(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Skip("no time zone database")
+	}
+	b := budget{Period: Monthly, TimeZone: "Europe/Berlin"}
+	// Still February in UTC, already March in Berlin
+	start, end := b.period(time.Date(2024, 2, 29, 23, 30, 0, 0, time.UTC))
+	if !start.Equal(time.Date(2024, 3, 1, 0, 0, 0, 0, berlin)) || !end.Equal(time.Date(2024, 4, 1, 0, 0, 0, 0, berlin)) {
+		t.Errorf("the month is from %v to %v", start, end)
+	}
+
+	from, to := time.Date(2024, 7, 1, 0, 0, 0, 0, time.UTC), time.Date(2024, 7, 15, 0, 0, 0, 0, time.UTC)
+	b = budget{Period: Range, From: &from, To: &to, TimeZone: "UTC"}
+	if start, end = b.period(time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)); start != from || end != to {
+		t.Errorf("a range budget is from %v to %v", start, end)
+	}
+}
+
+func TestReached(t *testing.T) {
+	for _, c := range []struct {
+		spent int64
+		want  []int
+	}{{0, nil}, {7999, nil}, {8000, []int{80}}, {10000, []int{80, 100}}, {50000, []int{80, 100, 150}}} {
+		got := reached([]int{80, 100, 150}, c.spent, 10000)
+		if len(got) != len(c.want) {
+			t.Errorf("%d cents reached %v, want %v", c.spent, got, c.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != c.want[i] {
+				t.Errorf("%d cents reached %v, want %v", c.spent, got, c.want)
+			}
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	groceries := "Groceries"
+	req := budgetRequest{Amount: 400.004, Category: &groceries}
+	if err := req.validate(); err != nil {
+		t.Fatal(err)
+	}
+	if req.Period != Monthly || *req.Category != "groceries" || req.Amount != 400 || len(req.Thresholds) != 2 {
+		t.Errorf("the defaults weren't filled in: %+v", req)
+	}
+
+	from, to := time.Now(), time.Now().Add(time.Hour)
+	unknown := "pets"
+	for _, req := range []budgetRequest{
+		{Amount: 0},
+		{Amount: 10, Category: &unknown},
+		{Amount: 10, Period: "weekly"},
+		{Amount: 10, Period: Range, From: &to, To: &from},
+		{Amount: 10, From: &from, To: &to},
+		{Amount: 10, Thresholds: []int{100, 80}},
+		{Amount: 10, Thresholds: []int{}},
+		{Amount: 10, Thresholds: []int{0}},
+		{Amount: 10, TimeZone: "Mars/Olympus"},
+	} {
+		if err := req.validate(); err == nil {
+			t.Errorf("%+v should be rejected", req)
+		}
+	}
+}
@@ -0,0 +1,172 @@
+package budgets
+
+import (
+	"context"
+	"fmt"
+	"how-much-do-i-owe/database"
+	"how-much-do-i-owe/notifications"
+	"how-much-do-i-owe/scheduler"
+	"log"
+	"strings"
+	"time"
+)
+
+// Job Alerts the members of a group when its spending reaches a threshold of
+// one of its budgets, once per threshold and period
+var Job = scheduler.Job{Name: "budgets", Every: time.Minute, Run: alert}
+
+// openQuery Budgets whose spending can still change: every monthly budget and
+// the ranges that haven't ended
+const openQuery = budgetQuery + " WHERE b.period = 'monthly' OR b.ends_at > now() ORDER BY b.id"
+
+func alert(ctx context.Context, db *database.DB) error {
+	queryRows, err := db.Db.QueryContext(ctx, openQuery)
+	if err != nil {
+		return err
+	}
+	var budgets []budget
+	for queryRows.Next() {
+		b, err := scanBudget(queryRows)
+		if err != nil {
+			queryRows.Close()
+			return err
+		}
+		budgets = append(budgets, b)
+	}
+	queryRows.Close()
+	if err = queryRows.Err(); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	for _, b := range budgets {
+		if err = b.status(db.Db, "", now); err != nil {
+			log.Printf("budgets: unable to check the spending of budget %d: %v", b.ID, err)
+			continue
+		}
+		if len(b.Reached) == 0 {
+			continue
+		}
+		if err = alertMembers(db, b); err != nil {
+			// The thresholds stay unrecorded and are tried again with the next run
+			log.Printf("budgets: unable to alert the members of group %d about budget %d: %v", b.GroupID, b.ID, err)
+		}
+	}
+	return nil
+}
+
+// alertMembers Records the thresholds b reached and notifies the members in
+// one transaction, so thresholds whose alert failed are tried again next time.
+// Members only hear about the notifications once they're committed.
+func alertMembers(db *database.DB, b budget) error {
+	tx, err := db.Db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	threshold, err := record(tx, b)
+	if err != nil || threshold == 0 {
+		return err
+	}
+	announce, err := notifyMembers(tx, b, threshold)
+	if err != nil {
+		return err
+	}
+	if err = tx.Commit(); err != nil {
+		return err
+	}
+	for _, a := range announce {
+		a()
+	}
+	return nil
+}
+
+// record Records the thresholds b reached that members weren't alerted about
+// yet in this period, and returns the highest of them, or 0 when there are
+// none. Members get one alert for them all.
+func record(db database.Querier, b budget) (int, error) {
+	highest := 0
+	for _, t := range b.Reached {
+		result, err := db.Exec(`INSERT INTO budget_alert (budget_id, period_start, threshold, spent) VALUES ($1, $2, $3, $4)
+									ON CONFLICT DO NOTHING`, b.ID, b.PeriodStart, t, b.Spent)
+		if err != nil {
+			return 0, err
+		}
+		if inserted, _ := result.RowsAffected(); inserted > 0 {
+			highest = t
+		}
+	}
+	return highest, nil
+}
+
+// notifyMembers Records the alert that b reached threshold for every member
+// of its group, and returns what announces them once they're committed
+func notifyMembers(db database.Querier, b budget, threshold int) ([]func(), error) {
+	queryRows, err := db.Query("SELECT user_id FROM group_member WHERE group_id=$1", b.GroupID)
+	if err != nil {
+		return nil, err
+	}
+	var members []string
+	for queryRows.Next() {
+		var id string
+		if err = queryRows.Scan(&id); err != nil {
+			queryRows.Close()
+			return nil, err
+		}
+		members = append(members, id)
+	}
+	queryRows.Close()
+	if err = queryRows.Err(); err != nil {
+		return nil, err
+	}
+
+	n := notifications.Notification{Type: notifications.BudgetAlert, Link: "/"}
+	n.Title, n.Body = message(b, threshold)
+	var announce []func()
+	for _, id := range members {
+		n.UserID = id
+		a, err := notifications.Record(db, n)
+		if err != nil {
+			return nil, err
+		}
+		announce = append(announce, a)
+	}
+	return announce, nil
+}
+
+// message The title and body of the alert that b reached threshold
+func message(b budget, threshold int) (string, string) {
+	title := fmt.Sprintf("%s of %s is %d%% spent", b.label(), b.Group, threshold)
+	if threshold == 100 {
+		title = fmt.Sprintf("%s of %s is used up", b.label(), b.Group)
+	}
+	body := fmt.Sprintf("%.2f of %.2f spent", b.Spent, b.Amount)
+	if b.Remaining >= 0 {
+		body += fmt.Sprintf(", %.2f left", b.Remaining)
+	} else {
+		body += fmt.Sprintf(", %.2f over", -b.Remaining)
+	}
+	if b.Period == Monthly {
+		body += " this month."
+	} else {
+		location, err := time.LoadLocation(b.TimeZone)
+		if err != nil {
+			location = time.UTC
+		}
+		body += fmt.Sprintf(" from %s to %s.", b.PeriodStart.In(location).Format("2 Jan 2006"),
+			b.PeriodEnd.In(location).Format("2 Jan 2006"))
+	}
+	return title, body
+}
+
+// label What to call b: its name, or the budget of its category
+func (b budget) label() string {
+	if b.Name != "" {
+		return b.Name
+	}
+	if b.Category == nil {
+		return "Budget"
+	}
+	return strings.ToUpper((*b.Category)[:1]) + (*b.Category)[1:] + " budget"
+}
@@ -0,0 +1,57 @@
+package budgets
+
+import (
+	"how-much-do-i-owe/database"
+	"how-much-do-i-owe/money"
+	"math"
+	"time"
+)
+
+// spentQuery What the group's expenses in a period came to, and the share of
+// $5 in them. Settlements move money between members, they aren't spending.
+const spentQuery = `SELECT COALESCE(sum(tp.dollar_share), 0),
+       COALESCE(sum(tp.dollar_share) FILTER (WHERE tp.user_id = $5), 0)
+    FROM transaction t JOIN transaction_participants tp ON tp.transaction_id = t.id
+    WHERE t.group_id = $1 AND t.split_type <> 'settlement' AND ($2::text IS NULL OR t.category = $2)
+      AND t.timestamp >= $3 AND t.timestamp < $4`
+
+// period The period of b that now falls in: the month in the budget's time
+// zone, or the range whatever now is
+func (b budget) period(now time.Time) (time.Time, time.Time) {
+	if b.Period == Range && b.From != nil && b.To != nil {
+		return *b.From, *b.To
+	}
+	location, err := time.LoadLocation(b.TimeZone)
+	if err != nil {
+		location = time.UTC
+	}
+	now = now.In(location)
+	start := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, location)
+	return start, start.AddDate(0, 1, 0)
+}
+
+// status Fills in the status of b at now, with the share of userID
+func (b *budget) status(db database.Querier, userID string, now time.Time) error {
+	b.PeriodStart, b.PeriodEnd = b.period(now)
+	b.Active = !now.Before(b.PeriodStart) && now.Before(b.PeriodEnd)
+	err := db.QueryRow(spentQuery, b.GroupID, b.Category, b.PeriodStart, b.PeriodEnd, userID).Scan(&b.Spent, &b.Share)
+	if err != nil {
+		return err
+	}
+	spent, amount := money.ToCents(b.Spent), money.ToCents(b.Amount)
+	b.Remaining = money.FromCents(amount - spent)
+	b.Percent = math.Round(float64(spent)*1000/float64(amount)) / 10
+	b.Reached = reached(b.Thresholds, spent, amount)
+	return nil
+}
+
+// reached The thresholds, percentages of amount, that spent has reached
+func reached(thresholds []int, spent int64, amount int64) []int {
+	reached := []int{}
+	for _, t := range thresholds {
+		if spent*100 >= int64(t)*amount {
+			reached = append(reached, t)
+		}
+	}
+	return reached
+}
@@ -0,0 +1,371 @@
+package chat
+
+import (
+	"crypto/ed25519"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+	"how-much-do-i-owe/api/transactions"
+	"how-much-do-i-owe/database"
+	"how-much-do-i-owe/mail"
+	"how-much-do-i-owe/secrets"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+)
+
+const (
+	providerSlack   = "slack"
+	providerDiscord = "discord"
+
+	// linkExpiry How long the link a chat user is sent to link their account works
+	linkExpiry = 30 * time.Minute
+)
+
+// slackSigningSecret and discordPublicKey are set up by ConfigChat, a chat
+// service without them answers no commands
+var (
+	slackSigningSecret string
+	discordPublicKey   ed25519.PublicKey
+)
+
+// ConfigChat Reads the keys that verify slash commands from the environment
+//
+//   - SLACK_SIGNING_SECRET the signing secret of the Slack app
+//   - DISCORD_PUBLIC_KEY the hex public key of the Discord application
+func ConfigChat() error {
+	slackSigningSecret = os.Getenv("SLACK_SIGNING_SECRET")
+	if slackSigningSecret != "" {
+		fmt.Println("Answering Slack commands")
+	}
+	if hexKey := os.Getenv("DISCORD_PUBLIC_KEY"); hexKey != "" {
+		key, err := hex.DecodeString(hexKey)
+		if err != nil || len(key) != ed25519.PublicKeySize {
+			return fmt.Errorf("DISCORD_PUBLIC_KEY must be a hex encoded Ed25519 public key")
+		}
+		discordPublicKey = key
+		fmt.Println("Answering Discord commands")
+	}
+	return nil
+}
+
+// chatUser Someone on a chat service. Team is the Slack workspace, and empty
+// for Discord whose user IDs are global. TeamName is the workspace's domain.
+type chatUser struct {
+	provider string
+	team     string
+	teamName string
+	id       string
+	name     string
+}
+
+// chatAccount A chat user linked to the user's account
+type chatAccount struct {
+	ID         int       `json:"id"`
+	Provider   string    `json:"provider"`
+	TeamID     string    `json:"teamId"`
+	ChatUserID string    `json:"chatUserId"`
+	ChatName   string    `json:"chatName"`
+	CreatedAt  time.Time `json:"createdAt"`
+}
+
+// linkClaims Who a link sent in chat links to the account that opens it
+type linkClaims struct {
+	Provider string `json:"provider"`
+	Team     string `json:"team"`
+	TeamName string `json:"teamName,omitempty"`
+	User     string `json:"user"`
+	Name     string `json:"name"`
+	Expires  int64  `json:"exp"`
+}
+
+// linkPreview The chat user a link links, for the user who opened it to
+// check it's theirs before linking it
+type linkPreview struct {
+	Provider   string `json:"provider"`
+	TeamID     string `json:"teamId"`
+	TeamName   string `json:"teamName"`
+	ChatUserID string `json:"chatUserId"`
+	ChatName   string `json:"chatName"`
+}
+
+type linkRequest struct {
+	Code string `json:"code" binding:"required"`
+}
+
+// Routes All the routes created by the package nested in
+// api/v1/*
+func Routes(r *gin.RouterGroup, db *database.DB) {
+	r.GET("/chat-accounts", getChatAccounts(db))
+	r.GET("/chat-account/preview", previewChatLink(db))
+	r.PUT("/chat-account", linkChatAccount(db))
+	r.DELETE("/chat-account/:id", unlinkChatAccount(db))
+}
+
+// HookRoutes The routes chat services send slash commands to, nested in
+// api/v1/chat/*. They have no session, requests are verified by their signature.
+func HookRoutes(r *gin.RouterGroup, db *database.DB) {
+	b := &bot{ledger: dbLedger{db}, slackSecret: slackSigningSecret, discordKey: discordPublicKey, now: time.Now}
+	r.POST("/slack", b.slack)
+	r.POST("/discord", b.discord)
+}
+
+// linkURL Where a chat user links their account, the app asks the user who
+// opens it to confirm
+func linkURL(u chatUser, now time.Time) (string, error) {
+	code, err := secrets.Sign(secrets.SigningKey("chat-link"), linkClaims{
+		Provider: u.provider,
+		Team:     u.team,
+		TeamName: u.teamName,
+		User:     u.id,
+		Name:     u.name,
+		Expires:  now.Add(linkExpiry).Unix(),
+	})
+	if err != nil {
+		return "", err
+	}
+	return mail.Link("/?chat-link=" + code), nil
+}
+
+const chatAccountQuery = `SELECT id, provider, team_id, chat_user_id, chat_name, created_at FROM chat_account`
+
+func scanChatAccount(row interface{ Scan(...interface{}) error }) (chatAccount, error) {
+	var a chatAccount
+	err := row.Scan(&a.ID, &a.Provider, &a.TeamID, &a.ChatUserID, &a.ChatName, &a.CreatedAt)
+	return a, err
+}
+
+func getChatAccounts(db *database.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		queryRows, err := db.Db.Query(chatAccountQuery+" WHERE user_id=$1 ORDER BY id", c.GetString("UserID"))
+		if err != nil {
+			database.CheckDBErr(err.(*pq.Error), c)
+			return
+		}
+		defer queryRows.Close()
+
+		accounts := []chatAccount{}
+		for queryRows.Next() {
+			a, err := scanChatAccount(queryRows)
+			if err != nil {
+				c.AbortWithStatusJSON(500, "The server was unable to get chat accounts")
+				return
+			}
+			accounts = append(accounts, a)
+		}
+
+		c.JSON(200, accounts)
+	}
+}
+
+var (
+	// errInvalidLink A link's code wasn't signed by the server or has expired
+	errInvalidLink = errors.New("the link is invalid or has expired")
+	// errLinkedElsewhere The chat user of a link is linked to another account
+	errLinkedElsewhere = errors.New("the chat user is linked to another account")
+)
+
+// checkLink The chat user a link's code links, unless the code is invalid,
+// has expired or the chat user is linked to another account than userID's.
+// Links can be forwarded, so a chat user is never moved between accounts.
+func checkLink(db *database.DB, userID string, code string) (linkClaims, error) {
+	var claims linkClaims
+	if err := secrets.Verify(secrets.SigningKey("chat-link"), code, &claims); err != nil ||
+		time.Now().Unix() > claims.Expires {
+		return claims, errInvalidLink
+	}
+	var elsewhere bool
+	err := db.Db.QueryRow(`SELECT EXISTS(SELECT 1 FROM chat_account
+								WHERE provider=$1 AND team_id=$2 AND chat_user_id=$3 AND user_id<>$4)`,
+		claims.Provider, claims.Team, claims.User, userID).Scan(&elsewhere)
+	if err != nil {
+		return claims, err
+	}
+	if elsewhere {
+		return claims, errLinkedElsewhere
+	}
+	return claims, nil
+}
+
+// linkErr Responds with why a link can't be used
+func linkErr(c *gin.Context, err error) {
+	switch err {
+	case errInvalidLink:
+		c.AbortWithStatusJSON(http.StatusBadRequest, "The link is invalid or has expired, run the command in chat again for a new one")
+	case errLinkedElsewhere:
+		c.AbortWithStatusJSON(http.StatusConflict, "This chat account is linked to another account, unlink it there first")
+	default:
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) {
+			database.CheckDBErr(pqErr, c)
+			return
+		}
+		c.AbortWithStatusJSON(500, "The server was unable to check the link")
+	}
+}
+
+// previewChatLink Who a link links, for the app to show before the user
+// confirms
+func previewChatLink(db *database.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		claims, err := checkLink(db, c.GetString("UserID"), c.Query("code"))
+		if err != nil {
+			linkErr(c, err)
+			return
+		}
+
+		c.JSON(200, linkPreview{
+			Provider:   claims.Provider,
+			TeamID:     claims.Team,
+			TeamName:   claims.TeamName,
+			ChatUserID: claims.User,
+			ChatName:   claims.Name,
+		})
+	}
+}
+
+// linkChatAccount Links the chat user a code was sent to to the user's
+// account, once they confirmed the preview. A chat user linked to another
+// account has to be unlinked there first.
+func linkChatAccount(db *database.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req linkRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		userID := c.GetString("UserID")
+		claims, err := checkLink(db, userID, req.Code)
+		if err != nil {
+			linkErr(c, err)
+			return
+		}
+
+		// The WHERE leaves a chat user linked to someone else in the meantime
+		// alone, and nothing is returned
+		var id int
+		err = db.Db.QueryRow(`INSERT INTO chat_account (user_id, provider, team_id, chat_user_id, chat_name) VALUES ($1, $2, $3, $4, $5)
+								ON CONFLICT (provider, team_id, chat_user_id) DO UPDATE SET chat_name=$5 WHERE chat_account.user_id=$1
+								RETURNING id`,
+			userID, claims.Provider, claims.Team, claims.User, claims.Name).Scan(&id)
+		if err == sql.ErrNoRows {
+			linkErr(c, errLinkedElsewhere)
+			return
+		}
+		if err != nil {
+			database.CheckDBErr(err.(*pq.Error), c)
+			return
+		}
+		a, err := scanChatAccount(db.Db.QueryRow(chatAccountQuery+" WHERE id=$1", id))
+		if err != nil {
+			database.CheckDBErr(err.(*pq.Error), c)
+			return
+		}
+
+		c.JSON(201, a)
+	}
+}
+
+func unlinkChatAccount(db *database.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.JSON(400, "Invalid chat account ID")
+			return
+		}
+		result, err := db.Db.Exec("DELETE FROM chat_account WHERE id=$1 AND user_id=$2", id, c.GetString("UserID"))
+		if err != nil {
+			database.CheckDBErr(err.(*pq.Error), c)
+			return
+		}
+		if deleted, _ := result.RowsAffected(); deleted == 0 {
+			c.AbortWithStatusJSON(404, "Chat account not found")
+			return
+		}
+
+		c.JSON(201, id)
+	}
+}
+
+// dbLedger The ledger in the database, through the transactions package so
+// commands are checked and recorded exactly like requests to the API
+type dbLedger struct {
+	db *database.DB
+}
+
+func (l dbLedger) account(u chatUser) (string, error) {
+	var userID string
+	err := l.db.Db.QueryRow("SELECT user_id FROM chat_account WHERE provider=$1 AND team_id=$2 AND chat_user_id=$3",
+		u.provider, u.team, u.id).Scan(&userID)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	return userID, err
+}
+
+func (l dbLedger) contact(userID string, u chatUser, chatID string, name string) (contact, error) {
+	var found []contact
+	if chatID != "" {
+		var k contact
+		err := l.db.Db.QueryRow(`SELECT a.id, COALESCE(NULLIF(c.nickname, ''), a.name) FROM chat_account ca
+						JOIN contact c ON c.user_id=$1 AND c.contact_id = ca.user_id
+						JOIN account a ON a.id = ca.user_id
+						WHERE ca.provider=$2 AND ca.team_id=$3 AND ca.chat_user_id=$4`, userID, u.provider, u.team, chatID).Scan(&k.id, &k.name)
+		if err == nil {
+			return k, nil
+		}
+		if err != sql.ErrNoRows {
+			return contact{}, err
+		}
+		// Mentions of chat users who haven't linked their account may still
+		// name a contact
+		if name == "" {
+			return contact{}, errNoContact
+		}
+	}
+
+	queryRows, err := l.db.Db.Query(`SELECT a.id, COALESCE(NULLIF(c.nickname, ''), a.name) FROM contact c
+					JOIN account a ON a.id = c.contact_id
+					WHERE c.user_id=$1 AND (lower(c.nickname)=lower($2) OR lower(a.name)=lower($2) OR lower(a.email)=lower($2)
+					    OR (a.email <> '' AND lower(split_part(a.email, '@', 1))=lower($2)))
+					LIMIT 2`, userID, name)
+	if err != nil {
+		return contact{}, err
+	}
+	defer queryRows.Close()
+	for queryRows.Next() {
+		var k contact
+		if err = queryRows.Scan(&k.id, &k.name); err != nil {
+			return contact{}, err
+		}
+		found = append(found, k)
+	}
+	if err = queryRows.Err(); err != nil {
+		return contact{}, err
+	}
+	switch len(found) {
+	case 0:
+		return contact{}, errNoContact
+	case 1:
+		return found[0], nil
+	}
+	return contact{}, errAmbiguous
+}
+
+func (l dbLedger) balances(userID string) ([]transactions.Balance, error) {
+	return transactions.Balances(l.db, userID)
+}
+
+func (l dbLedger) owe(userID string, creditorID string, amount float64, description string) error {
+	_, err := transactions.RecordDebt(l.db, userID, creditorID, amount, description)
+	return err
+}
+
+func (l dbLedger) settle(userID string, from string, to string, amount float64) error {
+	_, err := transactions.RecordSettlement(l.db, userID, from, to, amount, "Settled up in chat")
+	return err
+}
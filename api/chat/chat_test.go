@@ -0,0 +1,230 @@
+package chat
+
+import (
+	"bufio"
+	"crypto/ed25519"
+	"encoding/json"
+	"github.com/gin-gonic/gin"
+	"how-much-do-i-owe/api/transactions"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// The keys the fixtures in testdata were signed with, at fixtureTime
+const (
+	fixtureSlackSecret = "8f742231b10e8888abcd99yyyzzz85a5"
+	fixtureDiscordSeed = "how-much-do-i-owe discord tests!"
+)
+
+var fixtureTime = time.Unix(1700000000, 0)
+
+type debt struct {
+	userID, creditorID string
+	amount             float64
+	description        string
+}
+
+type payment struct {
+	from, to string
+	amount   float64
+}
+
+// fakeLedger Steve on Slack and Mason on Discord are the linked user "me",
+// whose contacts are Alice, who has no chat account, and Bob, who is linked
+// on both
+type fakeLedger struct {
+	debts    []debt
+	payments []payment
+}
+
+var fakeLinks = map[chatUser]string{
+	{provider: providerSlack, team: "T0001", id: "U2147483697"}: "me",
+	{provider: providerSlack, team: "T0001", id: "U0BOB"}:       "bob",
+	{provider: providerDiscord, id: "53908232506183680"}:        "me",
+	{provider: providerDiscord, id: "80351110224678912"}:        "alice",
+}
+
+var fakeContacts = []contact{{id: "alice", name: "Alice"}, {id: "bob", name: "Bob"}}
+
+func (l *fakeLedger) account(u chatUser) (string, error) {
+	return fakeLinks[chatUser{provider: u.provider, team: u.team, id: u.id}], nil
+}
+
+func (l *fakeLedger) contact(userID string, u chatUser, chatID string, name string) (contact, error) {
+	if chatID != "" {
+		linked := fakeLinks[chatUser{provider: u.provider, team: u.team, id: chatID}]
+		for _, k := range fakeContacts {
+			if k.id == linked {
+				return k, nil
+			}
+		}
+	}
+	for _, k := range fakeContacts {
+		if strings.EqualFold(k.name, name) {
+			return k, nil
+		}
+	}
+	return contact{}, errNoContact
+}
+
+func (l *fakeLedger) balances(userID string) ([]transactions.Balance, error) {
+	return []transactions.Balance{
+		{ID: "alice", Name: "Alice", Balance: 10},
+		{ID: "bob", Name: "Bob", Balance: -12.5},
+	}, nil
+}
+
+func (l *fakeLedger) owe(userID string, creditorID string, amount float64, description string) error {
+	l.debts = append(l.debts, debt{userID, creditorID, amount, description})
+	return nil
+}
+
+func (l *fakeLedger) settle(userID string, from string, to string, amount float64) error {
+	l.payments = append(l.payments, payment{from, to, amount})
+	return nil
+}
+
+func newTestBot() (*gin.Engine, *fakeLedger) {
+	gin.SetMode(gin.TestMode)
+	ledger := &fakeLedger{}
+	key := ed25519.NewKeyFromSeed([]byte(fixtureDiscordSeed))
+	b := &bot{
+		ledger:      ledger,
+		slackSecret: fixtureSlackSecret,
+		discordKey:  key.Public().(ed25519.PublicKey),
+		now:         func() time.Time { return fixtureTime },
+	}
+	r := gin.New()
+	r.POST("/api/v1/chat/slack", b.slack)
+	r.POST("/api/v1/chat/discord", b.discord)
+	return r, ledger
+}
+
+// send Sends a request recorded in testdata
+func send(t *testing.T, r *gin.Engine, fixture string) *httptest.ResponseRecorder {
+	f, err := os.Open(filepath.Join("testdata", fixture))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	req, err := http.ReadRequest(bufio.NewReader(f))
+	if err != nil {
+		t.Fatalf("%s: %v", fixture, err)
+	}
+	req.RequestURI = ""
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+// replay Sends a request recorded in testdata and returns the reply text
+func replay(t *testing.T, r *gin.Engine, fixture string) (int, string) {
+	w := send(t, r, fixture)
+	if w.Code != http.StatusOK {
+		return w.Code, ""
+	}
+
+	var reply struct {
+		Text string `json:"text"`
+		Type int    `json:"type"`
+		Data struct {
+			Content string `json:"content"`
+			Flags   int    `json:"flags"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &reply); err != nil {
+		t.Fatalf("%s: the reply isn't JSON: %s", fixture, w.Body.String())
+	}
+	if strings.HasPrefix(fixture, "discord") {
+		if reply.Type == discordMessage && reply.Data.Flags != discordEphemeral {
+			t.Errorf("%s: Discord replies should only be shown to the user", fixture)
+		}
+		return w.Code, reply.Data.Content
+	}
+	return w.Code, reply.Text
+}
+
+func TestRecordedCommands(t *testing.T) {
+	tests := []struct {
+		fixture string
+		status  int
+		reply   string
+	}{
+		{"slack_owe.http", 200, "Recorded that you owe Alice 24.50 for pizza."},
+		{"slack_owe_mention.http", 200, "Recorded that you owe Bob 12.00 for movie tickets."},
+		{"slack_balance.http", 200, "Alice owes you 10.00\nYou owe Bob 12.50"},
+		{"slack_settle.http", 200, "Recorded that you paid Bob 12.50."},
+		{"slack_howmuch.http", 200, "Alice owes you 10.00"},
+		{"slack_unknown_contact.http", 200, "None of your contacts is @carol."},
+		{"slack_bad_amount.http", 200, `"lots" isn't an amount, try something like 24.50`},
+		{"slack_unlinked.http", 200, "Link your Slack account to how much do i owe? first: "},
+		{"slack_bad_signature.http", 401, ""},
+		{"slack_stale.http", 401, ""},
+		{"discord_ping.http", 200, ""},
+		{"discord_owe.http", 200, "Recorded that you owe Alice 24.50 for pizza night."},
+		{"discord_howmuch_settle.http", 200, "Recorded that you paid Bob 5.00."},
+		{"discord_bad_signature.http", 401, ""},
+	}
+	for _, test := range tests {
+		t.Run(test.fixture, func(t *testing.T) {
+			r, _ := newTestBot()
+			status, reply := replay(t, r, test.fixture)
+			if status != test.status {
+				t.Fatalf("got status %d, want %d", status, test.status)
+			}
+			if !strings.HasPrefix(reply, test.reply) {
+				t.Errorf("got reply %q, want %q", reply, test.reply)
+			}
+		})
+	}
+}
+
+func TestCommandsRecordThroughTheLedger(t *testing.T) {
+	r, ledger := newTestBot()
+	replay(t, r, "slack_owe.http")
+	replay(t, r, "discord_owe.http")
+	replay(t, r, "slack_settle.http")
+	replay(t, r, "slack_bad_signature.http")
+
+	want := []debt{{"me", "alice", 24.5, "pizza"}, {"me", "alice", 24.5, "pizza night"}}
+	if len(ledger.debts) != len(want) {
+		t.Fatalf("got debts %v, want %v", ledger.debts, want)
+	}
+	for i := range want {
+		if ledger.debts[i] != want[i] {
+			t.Errorf("got debt %v, want %v", ledger.debts[i], want[i])
+		}
+	}
+	if len(ledger.payments) != 1 || ledger.payments[0] != (payment{"me", "bob", 12.5}) {
+		t.Errorf("settling with Bob, who the user owes, should record a payment to him, got %v", ledger.payments)
+	}
+}
+
+func TestPing(t *testing.T) {
+	r, _ := newTestBot()
+	w := send(t, r, "discord_ping.http")
+	if w.Code != 200 || strings.TrimSpace(w.Body.String()) != `{"type":1}` {
+		t.Errorf("a ping should be answered with a pong, got %d %s", w.Code, w.Body.String())
+	}
+}
+
+func TestParseMention(t *testing.T) {
+	tests := []struct{ who, chatID, name string }{
+		{"<@U0BOB|bob>", "U0BOB", "bob"},
+		{"<@80351110224678912>", "80351110224678912", ""},
+		{"<@!80351110224678912>", "80351110224678912", ""},
+		{"@alice", "", "alice"},
+		{"alice@example.com", "", "alice@example.com"},
+	}
+	for _, test := range tests {
+		chatID, name := parseMention(test.who)
+		if chatID != test.chatID || name != test.name {
+			t.Errorf("parseMention(%q) = %q, %q, want %q, %q", test.who, chatID, name, test.chatID, test.name)
+		}
+	}
+}
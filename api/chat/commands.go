@@ -0,0 +1,250 @@
+package chat
+
+import (
+	"crypto/ed25519"
+	"errors"
+	"fmt"
+	"how-much-do-i-owe/api/transactions"
+	"log"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	errNoContact  = errors.New("no contact matches")
+	errAmbiguous  = errors.New("more than one contact matches")
+	mentionFormat = regexp.MustCompile(`^<@!?([A-Za-z0-9]+)(?:\|([^>]*))?>$`)
+)
+
+// contact Someone a command is about
+type contact struct {
+	id   string
+	name string
+}
+
+// ledger What commands read and change. It's the database on the server, and
+// a fake in tests.
+type ledger interface {
+	// account The account a chat user is linked to, empty when they aren't
+	account(u chatUser) (string, error)
+	// contact The user's contact mentioned as chatID, a user of the chat
+	// service, or called name. Fails with errNoContact or errAmbiguous.
+	contact(userID string, u chatUser, chatID string, name string) (contact, error)
+	balances(userID string) ([]transactions.Balance, error)
+	owe(userID string, creditorID string, amount float64, description string) error
+	settle(userID string, from string, to string, amount float64) error
+}
+
+// bot Answers slash commands from Slack and Discord
+type bot struct {
+	ledger      ledger
+	slackSecret string
+	discordKey  ed25519.PublicKey
+	now         func() time.Time
+}
+
+// command A slash command from a chat user with the words after it. A single
+// /howmuch command with the name as its first word works too.
+type command struct {
+	user chatUser
+	name string
+	args []string
+}
+
+const help = "Commands:\n" +
+	"/owe @someone AMOUNT [what for] records that you owe a contact\n" +
+	"/balance [@someone] shows who owes whom\n" +
+	"/settle @someone [AMOUNT] records that you settled up, the whole balance by default"
+
+// run Carries out a command and returns the reply
+func (b *bot) run(cmd command) string {
+	name := strings.ToLower(strings.TrimPrefix(cmd.name, "/"))
+	args := cmd.args
+	if name == "howmuch" {
+		if len(args) == 0 {
+			return help
+		}
+		name, args = strings.ToLower(args[0]), args[1:]
+	}
+	if name == "help" {
+		return help
+	}
+
+	userID, err := b.ledger.account(cmd.user)
+	if err != nil {
+		return failed(err)
+	}
+	if userID == "" {
+		link, err := linkURL(cmd.user, b.now())
+		if err != nil {
+			return failed(err)
+		}
+		return fmt.Sprintf("Link your %s account to how much do i owe? first: %s", title(cmd.user.provider), link)
+	}
+
+	switch name {
+	case "owe":
+		return b.owe(cmd.user, userID, args)
+	case "balance", "balances":
+		return b.balance(cmd.user, userID, args)
+	case "settle":
+		return b.settle(cmd.user, userID, args)
+	}
+	return fmt.Sprintf("I don't know the command %q.\n%s", name, help)
+}
+
+func (b *bot) owe(u chatUser, userID string, args []string) string {
+	if len(args) < 2 {
+		return "Usage: /owe @someone AMOUNT [what for]"
+	}
+	them, reply := b.find(u, userID, args[0])
+	if reply != "" {
+		return reply
+	}
+	amount, ok := parseAmount(args[1])
+	if !ok {
+		return fmt.Sprintf("%q isn't an amount, try something like 24.50", args[1])
+	}
+	description := strings.Join(args[2:], " ")
+	if err := b.ledger.owe(userID, them.id, amount, description); err != nil {
+		return failed(err)
+	}
+	if description == "" {
+		return fmt.Sprintf("Recorded that you owe %s %.2f.", them.name, amount)
+	}
+	return fmt.Sprintf("Recorded that you owe %s %.2f for %s.", them.name, amount, description)
+}
+
+func (b *bot) balance(u chatUser, userID string, args []string) string {
+	balances, err := b.ledger.balances(userID)
+	if err != nil {
+		return failed(err)
+	}
+	if len(args) > 0 {
+		them, reply := b.find(u, userID, args[0])
+		if reply != "" {
+			return reply
+		}
+		for _, balance := range balances {
+			if balance.ID == them.id {
+				return describe(them.name, balance.Balance)
+			}
+		}
+		return fmt.Sprintf("You and %s are settled up.", them.name)
+	}
+	if len(balances) == 0 {
+		return "You're settled up with everyone."
+	}
+	lines := make([]string, len(balances))
+	for i, balance := range balances {
+		lines[i] = describe(balance.Name, balance.Balance)
+	}
+	return strings.Join(lines, "\n")
+}
+
+func (b *bot) settle(u chatUser, userID string, args []string) string {
+	if len(args) < 1 {
+		return "Usage: /settle @someone [AMOUNT]"
+	}
+	them, reply := b.find(u, userID, args[0])
+	if reply != "" {
+		return reply
+	}
+	balances, err := b.ledger.balances(userID)
+	if err != nil {
+		return failed(err)
+	}
+	var owed float64
+	for _, balance := range balances {
+		if balance.ID == them.id {
+			owed = balance.Balance
+		}
+	}
+	if owed == 0 {
+		return fmt.Sprintf("You and %s are settled up already.", them.name)
+	}
+	amount := math.Abs(owed)
+	if len(args) > 1 {
+		var ok bool
+		if amount, ok = parseAmount(args[1]); !ok {
+			return fmt.Sprintf("%q isn't an amount, try something like 24.50", args[1])
+		}
+	}
+
+	// A positive balance is owed to the user, so they were paid
+	from, to := userID, them.id
+	if owed > 0 {
+		from, to = them.id, userID
+	}
+	if err = b.ledger.settle(userID, from, to, amount); err != nil {
+		return failed(err)
+	}
+	if owed > 0 {
+		return fmt.Sprintf("Recorded that %s paid you %.2f.", them.name, amount)
+	}
+	return fmt.Sprintf("Recorded that you paid %s %.2f.", them.name, amount)
+}
+
+// find The contact who, a mention or a name, refers to. The reply says why
+// when there's no such contact.
+func (b *bot) find(u chatUser, userID string, who string) (contact, string) {
+	chatID, name := parseMention(who)
+	them, err := b.ledger.contact(userID, u, chatID, name)
+	switch err {
+	case nil:
+		return them, ""
+	case errNoContact:
+		return them, fmt.Sprintf("None of your contacts is %s.", who)
+	case errAmbiguous:
+		return them, fmt.Sprintf("More than one of your contacts is called %s, use their email instead.", who)
+	}
+	return them, failed(err)
+}
+
+// parseMention Splits who into the chat user it mentions, like <@U123|alice>
+// from Slack or <@123> from Discord, and the name it has. Plain names may
+// start with an @.
+func parseMention(who string) (string, string) {
+	if match := mentionFormat.FindStringSubmatch(who); match != nil {
+		return match[1], match[2]
+	}
+	return "", strings.TrimPrefix(who, "@")
+}
+
+// parseAmount Reads a positive amount like 24.50 or $24.50
+func parseAmount(s string) (float64, bool) {
+	amount, err := strconv.ParseFloat(strings.TrimLeft(s, "$€£"), 64)
+	if err != nil || amount <= 0 || math.IsInf(amount, 0) {
+		return 0, false
+	}
+	return amount, true
+}
+
+// describe A balance with someone in words
+func describe(name string, balance float64) string {
+	if balance > 0 {
+		return fmt.Sprintf("%s owes you %.2f", name, balance)
+	}
+	return fmt.Sprintf("You owe %s %.2f", name, -balance)
+}
+
+// failed The reply to a command that couldn't be carried out. Why is only
+// shown when the transactions package rejected it.
+func failed(err error) string {
+	var invalid *transactions.Invalid
+	if errors.As(err, &invalid) {
+		return invalid.Message
+	}
+	log.Printf("chat: unable to run a command: %v", err)
+	return "Something went wrong, try again in a moment."
+}
+
+func title(provider string) string {
+	if provider == providerDiscord {
+		return "Discord"
+	}
+	return "Slack"
+}
@@ -0,0 +1,221 @@
+package chat
+
+import (
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// maxBody Slash command requests are small, anything bigger isn't one
+	maxBody = 64 << 10
+	// maxSkew How old a signed request can be, so recorded ones can't be replayed
+	maxSkew = 5 * time.Minute
+)
+
+// Discord interaction and response types
+const (
+	discordPing       = 1
+	discordCommand    = 2
+	discordPong       = 1
+	discordMessage    = 4
+	discordEphemeral  = 64
+	discordSubcommand = 1
+	discordUserOption = 6
+)
+
+// discordInteraction The parts of a Discord interaction that commands use.
+// User is set in direct messages, Member in servers.
+type discordInteraction struct {
+	Type   int `json:"type"`
+	Member *struct {
+		User discordUser `json:"user"`
+	} `json:"member"`
+	User *discordUser `json:"user"`
+	Data struct {
+		Name    string          `json:"name"`
+		Options []discordOption `json:"options"`
+	} `json:"data"`
+}
+
+type discordUser struct {
+	ID       string `json:"id"`
+	Username string `json:"username"`
+}
+
+type discordOption struct {
+	Name    string          `json:"name"`
+	Type    int             `json:"type"`
+	Value   json.RawMessage `json:"value"`
+	Options []discordOption `json:"options"`
+}
+
+// optionOrder Where the options of a Discord command go in the words of a
+// command, the description is last because it can be more than one word
+var optionOrder = []string{"who", "amount", "description"}
+
+// readBody The raw body of a request, which signatures are computed over
+func readBody(c *gin.Context) ([]byte, bool) {
+	body, err := io.ReadAll(io.LimitReader(c.Request.Body, maxBody+1))
+	if err != nil || len(body) > maxBody {
+		c.AbortWithStatusJSON(http.StatusBadRequest, "Invalid request body")
+		return nil, false
+	}
+	return body, true
+}
+
+// fresh If a request signed at timestamp, seconds since the epoch, is recent
+func (b *bot) fresh(timestamp string) bool {
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return false
+	}
+	skew := b.now().Sub(time.Unix(seconds, 0))
+	return skew < maxSkew && skew > -maxSkew
+}
+
+// verifySlack Checks the v0 signature Slack sends with every request
+func (b *bot) verifySlack(c *gin.Context, body []byte) bool {
+	timestamp := c.GetHeader("X-Slack-Request-Timestamp")
+	if !b.fresh(timestamp) {
+		return false
+	}
+	mac := hmac.New(sha256.New, []byte(b.slackSecret))
+	mac.Write([]byte("v0:" + timestamp + ":"))
+	mac.Write(body)
+	expected := "v0=" + hex.EncodeToString(mac.Sum(nil))
+	return hmac.Equal([]byte(expected), []byte(c.GetHeader("X-Slack-Signature")))
+}
+
+// verifyDiscord Checks the Ed25519 signature Discord sends with every request
+func (b *bot) verifyDiscord(c *gin.Context, body []byte) bool {
+	timestamp := c.GetHeader("X-Signature-Timestamp")
+	signature, err := hex.DecodeString(c.GetHeader("X-Signature-Ed25519"))
+	if err != nil || !b.fresh(timestamp) {
+		return false
+	}
+	return ed25519.Verify(b.discordKey, append([]byte(timestamp), body...), signature)
+}
+
+// slack Answers a Slack slash command, sent as a form. The reply is only
+// shown to the user who sent it.
+func (b *bot) slack(c *gin.Context) {
+	if b.slackSecret == "" {
+		c.AbortWithStatusJSON(http.StatusNotFound, "Slack commands aren't set up")
+		return
+	}
+	body, ok := readBody(c)
+	if !ok {
+		return
+	}
+	if !b.verifySlack(c, body) {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, "Invalid request signature")
+		return
+	}
+	form, err := url.ParseQuery(string(body))
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	// Slack checks the certificate of the URL now and then
+	if form.Get("ssl_check") == "1" {
+		c.Status(http.StatusOK)
+		return
+	}
+
+	reply := b.run(command{
+		user: chatUser{provider: providerSlack, team: form.Get("team_id"), teamName: form.Get("team_domain"), id: form.Get("user_id"),
+			name: form.Get("user_name")},
+		name: form.Get("command"),
+		args: strings.Fields(form.Get("text")),
+	})
+	c.JSON(http.StatusOK, gin.H{"response_type": "ephemeral", "text": reply})
+}
+
+// discord Answers a Discord interaction. Commands are owe, balance and settle
+// with the options who (a user or a name), amount and description, or
+// howmuch with them as subcommands.
+func (b *bot) discord(c *gin.Context) {
+	if b.discordKey == nil {
+		c.AbortWithStatusJSON(http.StatusNotFound, "Discord commands aren't set up")
+		return
+	}
+	body, ok := readBody(c)
+	if !ok {
+		return
+	}
+	if !b.verifyDiscord(c, body) {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, "Invalid request signature")
+		return
+	}
+	var interaction discordInteraction
+	if err := json.Unmarshal(body, &interaction); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	switch interaction.Type {
+	case discordPing:
+		c.JSON(http.StatusOK, gin.H{"type": discordPong})
+		return
+	case discordCommand:
+	default:
+		c.AbortWithStatusJSON(http.StatusBadRequest, "Unsupported interaction type")
+		return
+	}
+	user := interaction.User
+	if interaction.Member != nil {
+		user = &interaction.Member.User
+	}
+	if user == nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, "The interaction has no user")
+		return
+	}
+
+	name, options := interaction.Data.Name, interaction.Data.Options
+	if len(options) == 1 && options[0].Type == discordSubcommand {
+		name, options = options[0].Name, options[0].Options
+	}
+	reply := b.run(command{
+		user: chatUser{provider: providerDiscord, id: user.ID, name: user.Username},
+		name: name,
+		args: discordArgs(options),
+	})
+	c.JSON(http.StatusOK, gin.H{"type": discordMessage, "data": gin.H{"content": reply, "flags": discordEphemeral}})
+}
+
+// discordArgs The words of a command from its options, users become mentions
+// like <@123> as if they were typed in a message
+func discordArgs(options []discordOption) []string {
+	var args []string
+	for _, name := range optionOrder {
+		for _, option := range options {
+			if option.Name != name {
+				continue
+			}
+			var value interface{}
+			if err := json.Unmarshal(option.Value, &value); err != nil {
+				continue
+			}
+			word := fmt.Sprint(value)
+			if s, ok := value.(string); ok {
+				word = s
+			}
+			if option.Type == discordUserOption {
+				word = "<@" + word + ">"
+			}
+			args = append(args, strings.Fields(word)...)
+		}
+	}
+	return args
+}
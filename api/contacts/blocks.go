@@ -0,0 +1,111 @@
+package contacts
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+	"how-much-do-i-owe/database"
+	"time"
+)
+
+type block struct {
+	UserID    string    `json:"userId"`
+	Name      string    `json:"name"`
+	Email     string    `json:"email"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// Blocked If userID and any of others have blocked one another. Blocked users
+// can't send each other contact requests or put each other in transactions.
+func Blocked(db database.Querier, userID string, others []string) (bool, error) {
+	var blocked bool
+	err := db.QueryRow(`SELECT EXISTS(SELECT 1 FROM contact_block
+								WHERE (user_id=$1 AND blocked_id = ANY($2)) OR (blocked_id=$1 AND user_id = ANY($2)))`,
+		userID, pq.Array(others)).Scan(&blocked)
+	return blocked, err
+}
+
+func getBlocks(db *database.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		queryRows, err := db.Db.Query(`SELECT a.id, a.name, a.email, b.created_at FROM contact_block b
+				JOIN account a ON a.id = b.blocked_id WHERE b.user_id=$1 ORDER BY b.created_at DESC`, c.GetString("UserID"))
+		if err != nil {
+			database.CheckDBErr(err.(*pq.Error), c)
+			return
+		}
+		defer queryRows.Close()
+
+		blocks := []block{}
+		for queryRows.Next() {
+			var b block
+			if err = queryRows.Scan(&b.UserID, &b.Name, &b.Email, &b.CreatedAt); err != nil {
+				c.AbortWithStatusJSON(500, "The server was unable to get blocked users")
+				return
+			}
+			blocks = append(blocks, b)
+		}
+
+		c.JSON(200, blocks)
+	}
+}
+
+// blockUser Blocks a user, which also ends any contact or pending requests with them
+func blockUser(db *database.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.GetString("UserID")
+		blockedID := c.Param("id")
+		if blockedID == userID {
+			c.JSON(400, "You can't block yourself")
+			return
+		}
+
+		tx, err := db.Db.Begin()
+		if err != nil {
+			database.CheckDBErr(err.(*pq.Error), c)
+			return
+		}
+		defer tx.Rollback()
+
+		var exists bool
+		if err = tx.QueryRow("SELECT EXISTS(SELECT 1 FROM account WHERE id=$1 AND id NOT IN (SELECT id FROM ghost))", blockedID).Scan(&exists); err != nil {
+			database.CheckDBErr(err.(*pq.Error), c)
+			return
+		}
+		if !exists {
+			c.AbortWithStatusJSON(404, "User not found")
+			return
+		}
+		if err = removeBetween(tx, userID, blockedID); err != nil {
+			database.CheckDBErr(err.(*pq.Error), c)
+			return
+		}
+		_, err = tx.Exec("INSERT INTO contact_block (user_id, blocked_id) VALUES ($1, $2) ON CONFLICT DO NOTHING",
+			userID, blockedID)
+		if err != nil {
+			database.CheckDBErr(err.(*pq.Error), c)
+			return
+		}
+		if err = tx.Commit(); err != nil {
+			database.CheckDBErr(err.(*pq.Error), c)
+			return
+		}
+
+		c.JSON(201, "User blocked")
+	}
+}
+
+func unblockUser(db *database.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		result, err := db.Db.Exec("DELETE FROM contact_block WHERE user_id=$1 AND blocked_id=$2",
+			c.GetString("UserID"), c.Param("id"))
+		if err != nil {
+			database.CheckDBErr(err.(*pq.Error), c)
+			return
+		}
+		if removed, _ := result.RowsAffected(); removed == 0 {
+			c.AbortWithStatusJSON(404, "User isn't blocked")
+			return
+		}
+
+		c.JSON(201, "User unblocked")
+	}
+}
@@ -1,18 +1,22 @@
 package contacts
 
 import (
-	"fmt"
+	"database/sql"
+	"errors"
 	"github.com/gin-gonic/gin"
 	"github.com/lib/pq"
 	"how-much-do-i-owe/database"
-	"net/http"
+	"time"
 )
 
+// contact Someone who accepted a contact request, or whose request was
+// accepted, or a placeholder the user made (ghost)
 type contact struct {
-	Sent     bool   `json:"sent"`
-	Received bool   `json:"received"`
-	Name     string `json:"name"`
-	Email    string `json:"email"`
+	Name  string    `json:"name"`
+	Email string    `json:"email"`
+	Since time.Time `json:"since"`
+	Ghost bool      `json:"ghost"`
+	contactSettings
 }
 
 // Routes All the routes created by the package nested in
@@ -20,82 +24,187 @@ type contact struct {
 func Routes(r *gin.RouterGroup, db *database.DB) {
 	r.GET("/contacts", getAllContacts(db))
 	r.PUT("/contact/:id", addContact(db))
+	r.PATCH("/contact/:id", updateContact(db))
 	r.DELETE("/contact/:id", removeContact(db))
+
+	r.GET("/contact-requests", getContactRequests(db))
+	r.PUT("/contact-request/:id/accept", acceptContactRequest(db))
+	r.PUT("/contact-request/:id/decline", declineContactRequest(db))
+	r.DELETE("/contact-request/:id", cancelContactRequest(db))
+
+	r.GET("/invitations", getInvitations(db))
+	r.PUT("/invitation", inviteContact(db))
+	r.PUT("/invitation/:id/resend", resendInvitation(db))
+	r.DELETE("/invitation/:id", revokeInvitation(db))
+
+	r.GET("/ghosts", getGhosts(db))
+	r.PUT("/ghost", createGhost(db))
+	r.DELETE("/ghost/:id", deleteGhost(db))
+	r.PUT("/ghost/:id/merge/:contactId", mergeGhost(db))
+
+	r.GET("/blocks", getBlocks(db))
+	r.PUT("/block/:id", blockUser(db))
+	r.DELETE("/block/:id", unblockUser(db))
+}
+
+// contactQuery Selects the contacts of the user $1
+const contactQuery = `SELECT contact_id, name, COALESCE(g.email, a.email), contact.created_at, g.id IS NOT NULL,
+       nickname, notes, currency, split_type, your_share, their_share
+	FROM contact JOIN account a on a.id = contact.contact_id
+	LEFT JOIN ghost g on g.id = contact.contact_id WHERE user_id=$1`
+
+func scanContact(row interface{ Scan(...interface{}) error }) (string, contact, error) {
+	var contactID string
+	var ct contact
+	var split Split
+	err := row.Scan(&contactID, &ct.Name, &ct.Email, &ct.Since, &ct.Ghost,
+		&ct.Nickname, &ct.Notes, &ct.Currency, &split.SplitType, &split.YourShare, &split.TheirShare)
+	if split.SplitType != "" {
+		ct.DefaultSplit = &split
+	}
+	return contactID, ct, err
 }
 
 func getAllContacts(db *database.DB) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		googleID, exists := c.Get("GoogleID")
-		if !exists {
-			c.JSON(http.StatusNotAcceptable, "Active Session Required")
+		userID := c.GetString("UserID")
+
+		queryRows, err := db.Db.Query(contactQuery, userID)
+		if err != nil {
+			database.CheckDBErr(err.(*pq.Error), c)
+			return
 		}
+		defer queryRows.Close()
 
-		queryRows, err := db.Db.Query(`SELECT user_id, contact_id, name, email FROM contact 
-				JOIN account a on a.google_id = contact.contact_id WHERE user_id=$1 OR contact_id=$1`, googleID)
-		fmt.Println(googleID)
 		contacts := make(map[string]contact)
 		for queryRows.Next() {
-			var senderID string
-			var recipientID string
-			var name string
-			var email string
-			err = queryRows.Scan(&senderID, &recipientID, &name, &email)
+			contactID, ct, err := scanContact(queryRows)
 			if err != nil {
-				c.AbortWithStatusJSON(500, "The server was unable to get transactions")
+				c.AbortWithStatusJSON(500, "The server was unable to get contacts")
+				return
 			}
-			if senderID == googleID {
-				temp := contacts[recipientID]
-				temp.Sent = true
-				temp.Name = name
-				temp.Email = email
-				contacts[recipientID] = temp
-			} else {
-				temp := contacts[senderID]
-				temp.Received = true
-				temp.Name = name
-				temp.Email = email
-				contacts[senderID] = temp
-			}
-
-		}
-		if err != nil {
-			database.CheckDBErr(err.(*pq.Error), c)
-			return
+			contacts[contactID] = ct
 		}
 
 		c.JSON(200, contacts)
 	}
 }
 
+var (
+	errNoSuchUser      = errors.New("user not found")
+	errSelf            = errors.New("you can't add yourself as a contact")
+	errBlocked         = errors.New("you can't send a contact request to this user")
+	errAlreadyContacts = errors.New("you are already contacts")
+)
+
+// addContact Sends a contact request. If the other user already asked, their
+// request is accepted instead.
 func addContact(db *database.DB) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		googleID, exists := c.Get("GoogleID")
-		if !exists {
-			c.JSON(http.StatusNotAcceptable, "Active Session Required")
+		userID := c.GetString("UserID")
+
+		tx, err := db.Db.Begin()
+		if err != nil {
+			database.CheckDBErr(err.(*pq.Error), c)
+			return
 		}
-		contactID := c.Param("id")
-		receivedContact := 0
-		err := db.Db.QueryRow(`INSERT INTO contact (user_id, contact_id) VALUES ($1, $2) ON CONFLICT DO NOTHING RETURNING
-							(SELECT count(*) FROM contact WHERE user_id=$2 AND contact_id=$1)`, googleID, contactID).Scan(&receivedContact)
+		defer tx.Rollback()
 
+		id, err := requestContact(tx, userID, c.Param("id"))
+		if err == nil {
+			err = tx.Commit()
+		}
+		if !checkRequestErr(err, c) {
+			return
+		}
+		request, err := getContactRequest(db.Db, id, userID)
 		if err != nil {
 			database.CheckDBErr(err.(*pq.Error), c)
 			return
 		}
+		publishRequest(db.Db, id, userID, request.UserID)
+
+		c.JSON(201, request)
+	}
+}
+
+// checkRequestErr Responds to an error from requestContact, if there was one
+func checkRequestErr(err error, c *gin.Context) bool {
+	switch err {
+	case nil:
+		return true
+	case errSelf:
+		c.AbortWithStatusJSON(400, "You can't add yourself as a contact")
+	case errNoSuchUser:
+		c.AbortWithStatusJSON(404, "User not found")
+	case errBlocked:
+		c.AbortWithStatusJSON(403, "You can't send a contact request to this user")
+	case errAlreadyContacts:
+		c.AbortWithStatusJSON(409, "You are already contacts")
+	default:
+		database.CheckDBErr(err.(*pq.Error), c)
+	}
+	return false
+}
+
+// requestContact Sends a contact request from userID to contactID and returns
+// its ID. When contactID had already asked, that request is accepted instead
+// and its ID returned.
+func requestContact(tx database.Querier, userID string, contactID string) (int, error) {
+	if contactID == userID {
+		return 0, errSelf
+	}
+	// Ghosts can't answer requests, they are claimed instead
+	var exists bool
+	err := tx.QueryRow("SELECT EXISTS(SELECT 1 FROM account WHERE id=$1 AND id NOT IN (SELECT id FROM ghost))",
+		contactID).Scan(&exists)
+	if err != nil {
+		return 0, err
+	}
+	if !exists {
+		return 0, errNoSuchUser
+	}
+	blocked, err := Blocked(tx, userID, []string{contactID})
+	if err != nil {
+		return 0, err
+	}
+	if blocked {
+		return 0, errBlocked
+	}
+	var isContact bool
+	if err = tx.QueryRow("SELECT EXISTS(SELECT 1 FROM contact WHERE user_id=$1 AND contact_id=$2)",
+		userID, contactID).Scan(&isContact); err != nil {
+		return 0, err
+	}
+	if isContact {
+		return 0, errAlreadyContacts
+	}
 
-		c.JSON(201, receivedContact == 1)
+	// They asked first, so this is a yes
+	var id int
+	err = tx.QueryRow("SELECT id FROM contact_request WHERE from_id=$1 AND to_id=$2 AND status='pending'",
+		contactID, userID).Scan(&id)
+	if err == nil {
+		return id, respond(tx, id, statusAccepted)
 	}
+	if err != sql.ErrNoRows {
+		return 0, err
+	}
+
+	// Asking twice is the same as asking once
+	err = tx.QueryRow(`INSERT INTO contact_request (from_id, to_id) VALUES ($1, $2)
+						ON CONFLICT (from_id, to_id) WHERE status='pending' DO UPDATE SET status=excluded.status
+						RETURNING id`, userID, contactID).Scan(&id)
+	return id, err
 }
 
+// removeContact Removes a contact for both users, along with any requests between them
 func removeContact(db *database.DB) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		googleID, exists := c.Get("GoogleID")
-		if !exists {
-			c.JSON(http.StatusNotAcceptable, "Active Session Required")
-		}
+		userID := c.GetString("UserID")
 		contactID := c.Param("id")
-		_, err := db.Db.Query("DELETE FROM contact WHERE (user_id=$1 AND contact_id=$2) OR (user_id=$2 AND contact_id=$1)", googleID, contactID)
 
+		err := removeBetween(db.Db, userID, contactID)
 		if err != nil {
 			database.CheckDBErr(err.(*pq.Error), c)
 			return
@@ -104,3 +213,16 @@ func removeContact(db *database.DB) gin.HandlerFunc {
 		c.JSON(201, "success")
 	}
 }
+
+// removeBetween Ends the contact between two users and withdraws pending requests
+func removeBetween(db database.Querier, userID string, otherID string) error {
+	_, err := db.Exec("DELETE FROM contact WHERE (user_id=$1 AND contact_id=$2) OR (user_id=$2 AND contact_id=$1)",
+		userID, otherID)
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec(`UPDATE contact_request SET status='cancelled', responded_at=now()
+						WHERE status='pending' AND ((from_id=$1 AND to_id=$2) OR (from_id=$2 AND to_id=$1))`,
+		userID, otherID)
+	return err
+}
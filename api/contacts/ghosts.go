@@ -0,0 +1,249 @@
+package contacts
+
+import (
+	"context"
+	"database/sql"
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+	"how-much-do-i-owe/database"
+	"net/http"
+	netmail "net/mail"
+	"strings"
+	"time"
+)
+
+// ghost A placeholder for someone who hasn't signed up, with only a name and
+// maybe an email. Only the user who made it can put it in transactions.
+type ghost struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	Email     string    `json:"email"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+type ghostRequest struct {
+	Name  string `json:"name"`
+	Email string `json:"email"`
+}
+
+// OthersGhosts If any of ids is a ghost that belongs to someone other than userID
+func OthersGhosts(db database.Querier, userID string, ids []string) (bool, error) {
+	var found bool
+	err := db.QueryRow("SELECT EXISTS(SELECT 1 FROM ghost WHERE id = ANY($2) AND owner_id<>$1)",
+		userID, pq.Array(ids)).Scan(&found)
+	return found, err
+}
+
+func getGhosts(db *database.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		queryRows, err := db.Db.Query(`SELECT g.id, a.name, g.email, g.created_at FROM ghost g
+				JOIN account a ON a.id = g.id WHERE g.owner_id=$1 ORDER BY a.name`, c.GetString("UserID"))
+		if err != nil {
+			database.CheckDBErr(err.(*pq.Error), c)
+			return
+		}
+		defer queryRows.Close()
+
+		ghosts := []ghost{}
+		for queryRows.Next() {
+			var g ghost
+			if err = queryRows.Scan(&g.ID, &g.Name, &g.Email, &g.CreatedAt); err != nil {
+				c.AbortWithStatusJSON(500, "The server was unable to get placeholders")
+				return
+			}
+			ghosts = append(ghosts, g)
+		}
+
+		c.JSON(200, ghosts)
+	}
+}
+
+// createGhost Adds a placeholder, which shows up among the user's contacts
+func createGhost(db *database.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.GetString("UserID")
+		var req ghostRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		g := ghost{Name: strings.TrimSpace(req.Name)}
+		if g.Name == "" || len(g.Name) > 100 {
+			c.JSON(http.StatusBadRequest, "A placeholder needs a name of at most 100 characters")
+			return
+		}
+		if req.Email != "" {
+			address, err := netmail.ParseAddress(req.Email)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, "Invalid email address")
+				return
+			}
+			g.Email = strings.ToLower(address.Address)
+		}
+
+		tx, err := db.Db.Begin()
+		if err != nil {
+			database.CheckDBErr(err.(*pq.Error), c)
+			return
+		}
+		defer tx.Rollback()
+
+		if g.Email != "" {
+			var exists bool
+			err = tx.QueryRow("SELECT EXISTS(SELECT 1 FROM account WHERE lower(email)=$1)", g.Email).Scan(&exists)
+			if err != nil {
+				database.CheckDBErr(err.(*pq.Error), c)
+				return
+			}
+			if exists {
+				c.AbortWithStatusJSON(409, "Someone with this email address already has an account, add them as a contact instead")
+				return
+			}
+		}
+		if g.ID, err = database.NewUserID(); err != nil {
+			c.AbortWithStatusJSON(500, "The server was unable to create the placeholder")
+			return
+		}
+		statements := []struct {
+			query string
+			args  []interface{}
+		}{
+			{"INSERT INTO account (id, email, picture, name) VALUES ($1, '', '', $2)", []interface{}{g.ID, g.Name}},
+			{"INSERT INTO ghost (id, owner_id, email) VALUES ($1, $2, $3)", []interface{}{g.ID, userID, g.Email}},
+			{"INSERT INTO contact (user_id, contact_id) VALUES ($1, $2), ($2, $1)", []interface{}{userID, g.ID}},
+		}
+		for _, statement := range statements {
+			if _, err = tx.Exec(statement.query, statement.args...); err != nil {
+				database.CheckDBErr(err.(*pq.Error), c)
+				return
+			}
+		}
+		if err = tx.QueryRow("SELECT created_at FROM ghost WHERE id=$1", g.ID).Scan(&g.CreatedAt); err != nil {
+			database.CheckDBErr(err.(*pq.Error), c)
+			return
+		}
+		if err = tx.Commit(); err != nil {
+			database.CheckDBErr(err.(*pq.Error), c)
+			return
+		}
+
+		c.JSON(201, g)
+	}
+}
+
+// deleteGhost Removes a placeholder that isn't in any transaction
+func deleteGhost(db *database.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.Param("id")
+		var used bool
+		err := db.Db.QueryRow(`SELECT EXISTS(SELECT 1 FROM transaction WHERE payer=$1)
+       						OR EXISTS(SELECT 1 FROM transaction_participants WHERE user_id=$1)
+							FROM ghost WHERE id=$1 AND owner_id=$2`, id, c.GetString("UserID")).Scan(&used)
+		if err == sql.ErrNoRows {
+			c.AbortWithStatusJSON(404, "Placeholder not found")
+			return
+		}
+		if err != nil {
+			database.CheckDBErr(err.(*pq.Error), c)
+			return
+		}
+		if used {
+			c.AbortWithStatusJSON(409, "The placeholder is in transactions, invite them or merge it into a contact instead")
+			return
+		}
+		if _, err = db.Db.Exec("DELETE FROM account WHERE id=$1", id); err != nil {
+			database.CheckDBErr(err.(*pq.Error), c)
+			return
+		}
+
+		c.JSON(201, "Placeholder deleted")
+	}
+}
+
+// mergeGhost Moves a placeholder's history into a contact, for when the
+// person it stood for signed up without being invited
+func mergeGhost(db *database.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.GetString("UserID")
+		ghostID := c.Param("id")
+		contactID := c.Param("contactId")
+
+		tx, err := db.Db.Begin()
+		if err != nil {
+			database.CheckDBErr(err.(*pq.Error), c)
+			return
+		}
+		defer tx.Rollback()
+
+		var owned, isContact bool
+		err = tx.QueryRow(`SELECT EXISTS(SELECT 1 FROM ghost WHERE id=$1 AND owner_id=$3),
+       						EXISTS(SELECT 1 FROM contact WHERE user_id=$3 AND contact_id=$2)
+       							AND NOT EXISTS(SELECT 1 FROM ghost WHERE id=$2)`, ghostID, contactID, userID).Scan(&owned, &isContact)
+		if err != nil {
+			database.CheckDBErr(err.(*pq.Error), c)
+			return
+		}
+		if !owned {
+			c.AbortWithStatusJSON(404, "Placeholder not found")
+			return
+		}
+		if !isContact {
+			c.AbortWithStatusJSON(404, "Contact not found")
+			return
+		}
+		if err = claimGhost(tx, ghostID, contactID); err != nil {
+			database.CheckDBErr(err.(*pq.Error), c)
+			return
+		}
+		if err = tx.Commit(); err != nil {
+			database.CheckDBErr(err.(*pq.Error), c)
+			return
+		}
+
+		c.JSON(201, "Placeholder merged")
+	}
+}
+
+// ClaimGhosts Moves the history of every ghost with email into userID. Only
+// for an address the user has proven they own.
+func ClaimGhosts(tx database.Querier, userID string, email string) error {
+	queryRows, err := tx.Query("SELECT id FROM ghost WHERE lower(email)=$1 AND email<>''", strings.ToLower(email))
+	if err != nil {
+		return err
+	}
+	var ghosts []string
+	for queryRows.Next() {
+		var id string
+		if err = queryRows.Scan(&id); err != nil {
+			queryRows.Close()
+			return err
+		}
+		ghosts = append(ghosts, id)
+	}
+	queryRows.Close()
+	if err = queryRows.Err(); err != nil {
+		return err
+	}
+
+	for _, id := range ghosts {
+		if err = claimGhost(tx, id, userID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// claimGhost Merges a ghost into the account of the person it stood for, which
+// also makes them contacts with its owner. A ghost already claimed is skipped,
+// and so is one claimed by its own owner.
+func claimGhost(tx database.Querier, ghostID string, userID string) error {
+	var ownerID string
+	err := tx.QueryRow("SELECT owner_id FROM ghost WHERE id=$1 FOR UPDATE", ghostID).Scan(&ownerID)
+	if err == sql.ErrNoRows || (err == nil && ownerID == userID) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return database.MergeAccount(context.Background(), tx, ghostID, userID)
+}
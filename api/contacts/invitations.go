@@ -0,0 +1,543 @@
+package contacts
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+	"how-much-do-i-owe/database"
+	"how-much-do-i-owe/mail"
+	"how-much-do-i-owe/secrets"
+	"math"
+	"net/http"
+	netmail "net/mail"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	invitationLifetime = 14 * 24 * time.Hour
+	// A user can send at most invitationsPerDay invitation emails a day, an
+	// address gets at most invitationsPerAddress a day from everyone together,
+	// and the same invitation is resent at most once per resendInterval
+	invitationsPerDay     = 20
+	invitationsPerAddress = 5
+	resendInterval        = time.Hour
+)
+
+// ErrInvalidInvitation An invitation link that was tampered with, has expired,
+// was revoked or resent, or was already used
+var ErrInvalidInvitation = errors.New("invitation is invalid or has expired")
+
+var errTooManyInvitations = errors.New("too many invitations")
+
+type invitation struct {
+	ID         int       `json:"id"`
+	Email      string    `json:"email"`
+	CreatedAt  time.Time `json:"createdAt"`
+	ExpiresAt  time.Time `json:"expiresAt"`
+	LastSentAt time.Time `json:"lastSentAt"`
+	Sends      int       `json:"sends"`
+	GhostID    *string   `json:"ghostId"`
+}
+
+// inviteRequest Who to invite. With a ghost the email defaults to the ghost's,
+// and the ghost's history moves to whoever accepts.
+type inviteRequest struct {
+	Email   string `json:"email"`
+	GhostID string `json:"ghostId"`
+}
+
+// inviteResult What inviting an address led to. An address with an account
+// gets a contact request, any other an invitation.
+type inviteResult struct {
+	ContactRequest *contactRequest `json:"contactRequest"`
+	Invitation     *invitation     `json:"invitation"`
+}
+
+// invitationClaims What an invitation link carries. The nonce changes with
+// every resend, so only the newest link works.
+type invitationClaims struct {
+	ID     int    `json:"inv"`
+	Nonce  string `json:"nonce"`
+	Expiry int64  `json:"exp"`
+}
+
+const invitationQuery = `SELECT i.id, i.email, i.created_at, i.expires_at,
+       COALESCE(max(s.sent_at), i.created_at), count(s.sent_at), i.ghost_id
+	FROM invitation i LEFT JOIN invitation_send s ON s.invitation_id = i.id`
+
+func scanInvitation(row interface{ Scan(...interface{}) error }) (invitation, error) {
+	var inv invitation
+	err := row.Scan(&inv.ID, &inv.Email, &inv.CreatedAt, &inv.ExpiresAt, &inv.LastSentAt, &inv.Sends, &inv.GhostID)
+	return inv, err
+}
+
+func getInvitation(db database.Querier, id int, userID string) (invitation, error) {
+	return scanInvitation(db.QueryRow(invitationQuery+` WHERE i.id=$1 AND i.inviter_id=$2
+			AND i.revoked_at IS NULL AND i.accepted_at IS NULL GROUP BY i.id`, id, userID))
+}
+
+func invitationKey() []byte {
+	return secrets.SigningKey("invitation")
+}
+
+func hashNonce(nonce string) string {
+	sum := sha256.Sum256([]byte(nonce))
+	return hex.EncodeToString(sum[:])
+}
+
+// inviteContact Looks up an email address. If it belongs to an account a
+// contact request is sent, otherwise an invitation is emailed.
+func inviteContact(db *database.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.GetString("UserID")
+		var req inviteRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		tx, err := db.Db.Begin()
+		if err != nil {
+			database.CheckDBErr(err.(*pq.Error), c)
+			return
+		}
+		defer tx.Rollback()
+
+		if req.GhostID != "" {
+			var ghostEmail string
+			err = tx.QueryRow("SELECT email FROM ghost WHERE id=$1 AND owner_id=$2 FOR UPDATE", req.GhostID, userID).Scan(&ghostEmail)
+			if err == sql.ErrNoRows {
+				c.AbortWithStatusJSON(404, "Placeholder not found")
+				return
+			}
+			if err != nil {
+				database.CheckDBErr(err.(*pq.Error), c)
+				return
+			}
+			if req.Email == "" {
+				req.Email = ghostEmail
+			}
+		}
+		address, err := netmail.ParseAddress(req.Email)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, "Invalid email address")
+			return
+		}
+		email := strings.ToLower(address.Address)
+
+		var contactID string
+		err = tx.QueryRow("SELECT id FROM account WHERE lower(email)=$1", email).Scan(&contactID)
+		if err == nil {
+			id, err := requestContact(tx, userID, contactID)
+			if err == nil && req.GhostID != "" {
+				err = requestForGhost(tx, id, req.GhostID, contactID)
+			}
+			if err == nil {
+				err = tx.Commit()
+			}
+			if !checkRequestErr(err, c) {
+				return
+			}
+			request, err := getContactRequest(db.Db, id, userID)
+			if err != nil {
+				database.CheckDBErr(err.(*pq.Error), c)
+				return
+			}
+			publishRequest(db.Db, id, userID, contactID)
+			c.JSON(201, inviteResult{ContactRequest: &request})
+			return
+		}
+		if err != sql.ErrNoRows {
+			database.CheckDBErr(err.(*pq.Error), c)
+			return
+		}
+
+		// Inviting the same address again resends the open invitation
+		var id int
+		err = tx.QueryRow(`SELECT id FROM invitation WHERE inviter_id=$1 AND email=$2
+								AND revoked_at IS NULL AND accepted_at IS NULL`, userID, email).Scan(&id)
+		if err == sql.ErrNoRows {
+			err = tx.QueryRow(`INSERT INTO invitation (inviter_id, email, nonce_hash, expires_at) VALUES ($1, $2, '', now())
+									RETURNING id`, userID, email).Scan(&id)
+		}
+		if err == nil && req.GhostID != "" {
+			_, err = tx.Exec("UPDATE invitation SET ghost_id=$2 WHERE id=$1", id, req.GhostID)
+			if err == nil {
+				_, err = tx.Exec("UPDATE ghost SET email=$2 WHERE id=$1 AND email=''", req.GhostID, email)
+			}
+		}
+		if err != nil {
+			database.CheckDBErr(err.(*pq.Error), c)
+			return
+		}
+		sendAndRespond(c, db, tx, id, userID)
+	}
+}
+
+// requestForGhost Ties a contact request to the ghost it was sent for. When the
+// request was accepted straight away the ghost is claimed now.
+func requestForGhost(tx database.Querier, requestID int, ghostID string, contactID string) error {
+	result, err := tx.Exec("UPDATE contact_request SET ghost_id=$2 WHERE id=$1 AND status='pending'", requestID, ghostID)
+	if err != nil {
+		return err
+	}
+	if pending, _ := result.RowsAffected(); pending > 0 {
+		return nil
+	}
+	return claimGhost(tx, ghostID, contactID)
+}
+
+// sendAndRespond Emails an invitation, commits tx and responds with the invitation
+func sendAndRespond(c *gin.Context, db *database.DB, tx *sql.Tx, id int, userID string) {
+	err := sendInvitation(c, tx, id, userID)
+	if err == errTooManyInvitations {
+		c.AbortWithStatusJSON(http.StatusTooManyRequests, "Too many invitations have been sent, try again later")
+		return
+	}
+	if err != nil {
+		if pqErr, ok := err.(*pq.Error); ok {
+			database.CheckDBErr(pqErr, c)
+			return
+		}
+		fmt.Println("Unable to send invitation:", err)
+		c.AbortWithStatusJSON(503, "The server was unable to send the invitation")
+		return
+	}
+	if err = tx.Commit(); err != nil {
+		database.CheckDBErr(err.(*pq.Error), c)
+		return
+	}
+	inv, err := getInvitation(db.Db, id, userID)
+	if err != nil {
+		database.CheckDBErr(err.(*pq.Error), c)
+		return
+	}
+
+	c.JSON(201, inviteResult{Invitation: &inv})
+}
+
+// sendInvitation Emails a new link for an invitation and extends its expiry.
+// Links sent before stop working.
+func sendInvitation(c *gin.Context, tx *sql.Tx, id int, inviterID string) error {
+	var email, inviterName, inviterEmail string
+	var lastSent sql.NullTime
+	var sentToday, sentToAddress int
+	err := tx.QueryRow(`SELECT i.email, a.name, a.email,
+       			(SELECT max(sent_at) FROM invitation_send WHERE invitation_id=i.id),
+       			(SELECT count(*) FROM invitation_send s JOIN invitation o ON o.id = s.invitation_id
+       				WHERE o.inviter_id=i.inviter_id AND s.sent_at > $2),
+       			(SELECT count(*) FROM invitation_send s JOIN invitation o ON o.id = s.invitation_id
+       				WHERE o.email=i.email AND s.sent_at > $2)
+			FROM invitation i JOIN account a ON a.id = i.inviter_id
+			WHERE i.id=$1 FOR UPDATE OF i`, id, time.Now().Add(-24*time.Hour)).
+		Scan(&email, &inviterName, &inviterEmail, &lastSent, &sentToday, &sentToAddress)
+	if err != nil {
+		return err
+	}
+	if tooManyInvitations(sentToday, sentToAddress, lastSent, time.Now()) {
+		return errTooManyInvitations
+	}
+
+	nonce := make([]byte, 32)
+	if _, err = rand.Read(nonce); err != nil {
+		return err
+	}
+	claims := invitationClaims{
+		ID:     id,
+		Nonce:  base64.RawURLEncoding.EncodeToString(nonce),
+		Expiry: time.Now().Add(invitationLifetime).Unix(),
+	}
+	token, err := secrets.Sign(invitationKey(), claims)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec("UPDATE invitation SET nonce_hash=$2, expires_at=$3 WHERE id=$1",
+		id, hashNonce(claims.Nonce), time.Unix(claims.Expiry, 0))
+	if err != nil {
+		return err
+	}
+	if _, err = tx.Exec("INSERT INTO invitation_send (invitation_id) VALUES ($1)", id); err != nil {
+		return err
+	}
+
+	link := mail.Link("/oauth/v1/invitation?token=" + url.QueryEscape(token))
+	return mail.Send(c.Request.Context(), mail.Message{
+		To:      email,
+		Subject: fmt.Sprintf("%s invited you to how much do i owe?", inviterName),
+		Text: fmt.Sprintf("%s (%s) wants to add you as a contact on how much do i owe?, a shared ledger "+
+			"to keep track of who owes who.\n\nFollow this link to sign up and accept:\n\n%s\n\n"+
+			"The invitation expires on %s. If you don't know %s, you can ignore this email.\n",
+			inviterName, inviterEmail, link, time.Unix(claims.Expiry, 0).UTC().Format("January 2, 2006"), inviterName),
+	})
+}
+
+// tooManyInvitations Whether an invitation can't be sent now, because its
+// inviter or its address got too many in the last day or it was sent within
+// resendInterval
+func tooManyInvitations(sentToday int, sentToAddress int, lastSent sql.NullTime, now time.Time) bool {
+	return sentToday >= invitationsPerDay || sentToAddress >= invitationsPerAddress ||
+		(lastSent.Valid && now.Sub(lastSent.Time) < resendInterval)
+}
+
+// getInvitations Invitations that haven't been accepted or revoked, expired
+// ones included so they can be resent
+func getInvitations(db *database.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		queryRows, err := db.Db.Query(invitationQuery+` WHERE i.inviter_id=$1 AND i.revoked_at IS NULL AND i.accepted_at IS NULL
+				GROUP BY i.id ORDER BY i.created_at DESC`, c.GetString("UserID"))
+		if err != nil {
+			database.CheckDBErr(err.(*pq.Error), c)
+			return
+		}
+		defer queryRows.Close()
+
+		invitations := []invitation{}
+		for queryRows.Next() {
+			inv, err := scanInvitation(queryRows)
+			if err != nil {
+				c.AbortWithStatusJSON(500, "The server was unable to get invitations")
+				return
+			}
+			invitations = append(invitations, inv)
+		}
+
+		c.JSON(200, invitations)
+	}
+}
+
+func resendInvitation(db *database.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.GetString("UserID")
+		id, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.JSON(400, "Invalid invitation ID")
+			return
+		}
+
+		tx, err := db.Db.Begin()
+		if err != nil {
+			database.CheckDBErr(err.(*pq.Error), c)
+			return
+		}
+		defer tx.Rollback()
+
+		if _, err = getInvitation(tx, id, userID); err == sql.ErrNoRows {
+			c.AbortWithStatusJSON(404, "Invitation not found")
+			return
+		} else if err != nil {
+			database.CheckDBErr(err.(*pq.Error), c)
+			return
+		}
+		sendAndRespond(c, db, tx, id, userID)
+	}
+}
+
+func revokeInvitation(db *database.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.JSON(400, "Invalid invitation ID")
+			return
+		}
+
+		err = db.Db.QueryRow(`UPDATE invitation SET revoked_at=now()
+								WHERE id=$1 AND inviter_id=$2 AND revoked_at IS NULL AND accepted_at IS NULL
+								RETURNING id`, id, c.GetString("UserID")).Scan(&id)
+		if err == sql.ErrNoRows {
+			c.AbortWithStatusJSON(404, "Invitation not found")
+			return
+		}
+		if err != nil {
+			database.CheckDBErr(err.(*pq.Error), c)
+			return
+		}
+
+		c.JSON(201, "Invitation revoked")
+	}
+}
+
+// CheckInvitation The ID of the open invitation a link is for, or
+// ErrInvalidInvitation
+func CheckInvitation(db database.Querier, token string) (int, error) {
+	var claims invitationClaims
+	if err := secrets.Verify(invitationKey(), token, &claims); err != nil {
+		return 0, ErrInvalidInvitation
+	}
+	if time.Now().After(time.Unix(claims.Expiry, 0)) {
+		return 0, ErrInvalidInvitation
+	}
+	var id int
+	err := db.QueryRow(`SELECT id FROM invitation WHERE id=$1 AND nonce_hash=$2
+							AND revoked_at IS NULL AND accepted_at IS NULL AND expires_at > now()`,
+		claims.ID, hashNonce(claims.Nonce)).Scan(&id)
+	if err == sql.ErrNoRows {
+		return 0, ErrInvalidInvitation
+	}
+	return id, err
+}
+
+// InvitationPreview What accepting an invitation does, for the user to confirm
+// before it happens. Ghost is the name of the placeholder it was sent for,
+// and Balance what the placeholder owes the inviter, negative when the
+// inviter owes it. ClaimsGhost is whether the placeholder and its balance
+// become the user's, which needs a verified login with the invited address.
+type InvitationPreview struct {
+	Inviter      string  `json:"inviter"`
+	InviterEmail string  `json:"inviterEmail"`
+	Email        string  `json:"email"`
+	Ghost        *string `json:"ghost"`
+	Balance      float64 `json:"balance"`
+	ClaimsGhost  bool    `json:"claimsGhost"`
+}
+
+// PreviewInvitation What accepting an open invitation would do for userID
+func PreviewInvitation(db database.Querier, id int, userID string) (InvitationPreview, error) {
+	var p InvitationPreview
+	var inviterID string
+	var ghostID sql.NullString
+	err := db.QueryRow(`SELECT i.inviter_id, a.name, a.email, i.email, i.ghost_id, g.name,
+       			COALESCE((SELECT sum(CASE WHEN t.payer=i.inviter_id THEN tp.dollar_share ELSE -tp.dollar_share END)
+       				FROM transaction t JOIN transaction_participants tp ON tp.transaction_id = t.id
+       				WHERE (t.payer=i.inviter_id AND tp.user_id=i.ghost_id) OR (t.payer=i.ghost_id AND tp.user_id=i.inviter_id)), 0)
+			FROM invitation i JOIN account a ON a.id = i.inviter_id LEFT JOIN account g ON g.id = i.ghost_id
+			WHERE i.id=$1 AND i.revoked_at IS NULL AND i.accepted_at IS NULL AND i.expires_at > now()`, id).
+		Scan(&inviterID, &p.Inviter, &p.InviterEmail, &p.Email, &ghostID, &p.Ghost, &p.Balance)
+	if err == sql.ErrNoRows {
+		return p, ErrInvalidInvitation
+	}
+	if err != nil || !ghostID.Valid {
+		return p, err
+	}
+	p.Balance = math.Round(p.Balance*100) / 100
+	verified, err := VerifiedEmail(db, userID, p.Email)
+	if err != nil || !verified {
+		return p, err
+	}
+	blocked, err := Blocked(db, inviterID, []string{userID})
+	p.ClaimsGhost = !blocked
+	return p, err
+}
+
+// AcceptInvitation Turns an invitation into a contact request from the
+// inviter to userID, whatever address userID signed up with. The ghost it was
+// sent for only becomes userID when they verified the address it was sent to.
+func AcceptInvitation(db *sql.DB, id int, userID string) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var inviterID, email string
+	var ghostID sql.NullString
+	err = tx.QueryRow(`SELECT inviter_id, email, ghost_id FROM invitation WHERE id=$1
+							AND revoked_at IS NULL AND accepted_at IS NULL AND expires_at > now() FOR UPDATE`, id).
+		Scan(&inviterID, &email, &ghostID)
+	if err == sql.ErrNoRows {
+		return ErrInvalidInvitation
+	}
+	if err != nil {
+		return err
+	}
+	verified, err := VerifiedEmail(tx, userID, email)
+	if err != nil {
+		return err
+	}
+	requestID, err := accept(tx, id, inviterID, ghostID, userID, verified)
+	if err != nil {
+		return err
+	}
+	if err = tx.Commit(); err != nil {
+		return err
+	}
+	if requestID != 0 {
+		publishRequest(db, requestID, inviterID, userID)
+	}
+	return nil
+}
+
+// VerifiedEmail If one of the logins of userID has email as a verified address
+func VerifiedEmail(db database.Querier, userID string, email string) (bool, error) {
+	var verified bool
+	err := db.QueryRow(`SELECT EXISTS(SELECT 1 FROM identity WHERE user_id=$1 AND lower(email)=lower($2)
+								AND email<>'' AND email_verified)`, userID, email).Scan(&verified)
+	return verified, err
+}
+
+// ClaimInvitations Turns every open invitation to email into a contact
+// request for userID. Only for an address the user has proven they own.
+func ClaimInvitations(tx database.Querier, userID string, email string) error {
+	queryRows, err := tx.Query(`SELECT id, inviter_id, ghost_id FROM invitation WHERE email=$1
+									AND revoked_at IS NULL AND accepted_at IS NULL AND expires_at > now()`, strings.ToLower(email))
+	if err != nil {
+		return err
+	}
+	type open struct {
+		id        int
+		inviterID string
+		ghostID   sql.NullString
+	}
+	var invitations []open
+	for queryRows.Next() {
+		var inv open
+		if err = queryRows.Scan(&inv.id, &inv.inviterID, &inv.ghostID); err != nil {
+			queryRows.Close()
+			return err
+		}
+		invitations = append(invitations, inv)
+	}
+	queryRows.Close()
+	if err = queryRows.Err(); err != nil {
+		return err
+	}
+
+	for _, inv := range invitations {
+		if _, err = accept(tx, inv.id, inv.inviterID, inv.ghostID, userID, true); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// accept Marks an invitation accepted by userID and sends the contact request.
+// An invitation to someone who is already a contact, or who blocked the
+// inviter, is used up without a request. Accepting an invitation sent for a
+// ghost makes the two contacts right away, and claims the ghost when claim is
+// set, which is only for an account that verified the invited address. Anyone
+// else could be merging someone else's debts into their account, so the ghost
+// stays with the inviter to merge into the contact if it was them. Returns the
+// ID of the request, or 0 when none was sent.
+func accept(tx database.Querier, id int, inviterID string, ghostID sql.NullString, userID string, claim bool) (int, error) {
+	if ghostID.Valid && claim {
+		blocked, err := Blocked(tx, inviterID, []string{userID})
+		if err != nil {
+			return 0, err
+		}
+		if !blocked {
+			if err = claimGhost(tx, ghostID.String, userID); err != nil {
+				return 0, err
+			}
+		}
+	}
+	requestID, err := requestContact(tx, inviterID, userID)
+	if err != nil && err != errSelf && err != errBlocked && err != errAlreadyContacts {
+		return 0, err
+	}
+	if err == nil && ghostID.Valid && !claim {
+		// Unless they had asked the inviter already, which accepted it
+		if err = respond(tx, requestID, statusAccepted); err != nil && err != sql.ErrNoRows {
+			return 0, err
+		}
+	}
+	_, err = tx.Exec("UPDATE invitation SET accepted_at=now(), accepted_by=$2 WHERE id=$1", id, userID)
+	return requestID, err
+}
@@ -0,0 +1,107 @@
+package contacts
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"how-much-do-i-owe/database/databasetest"
+	"how-much-do-i-owe/secrets"
+	"strings"
+	"testing"
+	"time"
+)
+
+// openInvitation Answers the lookup of invitation 7 with the nonce "current",
+// and fails the test when the link should have been turned down before it
+func openInvitation(lookup bool) databasetest.Answerer {
+	return func(t *testing.T, query string, args []driver.Value) databasetest.Answer {
+		if !databasetest.Has(query, "SELECT id FROM invitation WHERE id=$1 AND nonce_hash=$2") {
+			t.Errorf("unexpected query %s", query)
+			return databasetest.Answer{}
+		}
+		if !lookup {
+			t.Error("looked up an invitation for a link that isn't valid")
+		}
+		a := databasetest.Answer{Columns: []string{"id"}}
+		if args[0] == int64(7) && args[1] == hashNonce("current") {
+			a.Rows = [][]driver.Value{{int64(7)}}
+		}
+		return a
+	}
+}
+
+func TestCheckInvitation(t *testing.T) {
+	t.Setenv("SIGNING_SECRET", "test")
+	link := func(claims invitationClaims) string {
+		token, err := secrets.Sign(invitationKey(), claims)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return token
+	}
+	valid := link(invitationClaims{ID: 7, Nonce: "current", Expiry: time.Now().Add(time.Hour).Unix()})
+	encoded, signature, _ := strings.Cut(valid, ".")
+	forged := link(invitationClaims{ID: 8, Nonce: "current", Expiry: time.Now().Add(time.Hour).Unix()})
+	forgedEncoded, _, _ := strings.Cut(forged, ".")
+
+	tests := []struct {
+		name   string
+		token  string
+		lookup bool
+		want   int
+	}{
+		{"valid", valid, true, 7},
+		{"expired", link(invitationClaims{ID: 7, Nonce: "current", Expiry: time.Now().Add(-time.Second).Unix()}), false, 0},
+		{"resent since", link(invitationClaims{ID: 7, Nonce: "older", Expiry: time.Now().Add(time.Hour).Unix()}), true, 0},
+		{"claims of another invitation", forgedEncoded + "." + signature, false, 0},
+		{"no signature", encoded, false, 0},
+		{"garbage", "not a token", false, 0},
+		{"empty", "", false, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			id, err := CheckInvitation(databasetest.New(t, openInvitation(tt.lookup)).Db, tt.token)
+			if tt.want != 0 {
+				if err != nil || id != tt.want {
+					t.Errorf("got %d, %v, want invitation %d", id, err, tt.want)
+				}
+				return
+			}
+			if err != ErrInvalidInvitation {
+				t.Errorf("got %d, %v, want ErrInvalidInvitation", id, err)
+			}
+		})
+	}
+
+	t.Run("signed with another secret", func(t *testing.T) {
+		t.Setenv("SIGNING_SECRET", "another")
+		if _, err := CheckInvitation(databasetest.New(t, openInvitation(false)).Db, valid); err != ErrInvalidInvitation {
+			t.Errorf("got %v, want ErrInvalidInvitation", err)
+		}
+	})
+}
+
+func TestTooManyInvitations(t *testing.T) {
+	now := time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC)
+	never := sql.NullTime{}
+	sent := func(ago time.Duration) sql.NullTime { return sql.NullTime{Time: now.Add(-ago), Valid: true} }
+	tests := []struct {
+		name                     string
+		sentToday, sentToAddress int
+		lastSent                 sql.NullTime
+		want                     bool
+	}{
+		{"first invitation", 0, 0, never, false},
+		{"under every limit", invitationsPerDay - 1, invitationsPerAddress - 1, sent(2 * time.Hour), false},
+		{"inviter's daily limit", invitationsPerDay, 0, never, true},
+		{"address's daily limit", 0, invitationsPerAddress, never, true},
+		{"resent too soon", 1, 1, sent(resendInterval - time.Minute), true},
+		{"resent after the interval", 1, 1, sent(resendInterval), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tooManyInvitations(tt.sentToday, tt.sentToAddress, tt.lastSent, now); got != tt.want {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
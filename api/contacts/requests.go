@@ -0,0 +1,209 @@
+package contacts
+
+import (
+	"database/sql"
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+	"how-much-do-i-owe/database"
+	"how-much-do-i-owe/events"
+	"how-much-do-i-owe/notifications"
+	"how-much-do-i-owe/webhooks"
+	"strconv"
+	"time"
+)
+
+const (
+	statusPending   = "pending"
+	statusAccepted  = "accepted"
+	statusDeclined  = "declined"
+	statusCancelled = "cancelled"
+
+	directionIncoming = "incoming"
+	directionOutgoing = "outgoing"
+)
+
+// contactRequest A request as seen by one of the two users, the name and
+// email are those of the other user
+type contactRequest struct {
+	ID          int        `json:"id"`
+	UserID      string     `json:"userId"`
+	Name        string     `json:"name"`
+	Email       string     `json:"email"`
+	Direction   string     `json:"direction"`
+	Status      string     `json:"status"`
+	CreatedAt   time.Time  `json:"createdAt"`
+	RespondedAt *time.Time `json:"respondedAt"`
+	// GhostName The placeholder whose history moves to whoever accepts
+	GhostName *string `json:"ghostName"`
+}
+
+// contactRequestQuery Selects requests from the point of view of the user $1
+const contactRequestQuery = `SELECT r.id, a.id, a.name, a.email,
+       CASE WHEN r.to_id=$1 THEN 'incoming' ELSE 'outgoing' END, r.status, r.created_at, r.responded_at, g.name
+	FROM contact_request r
+	JOIN account a ON a.id = CASE WHEN r.to_id=$1 THEN r.from_id ELSE r.to_id END
+	LEFT JOIN account g ON g.id = r.ghost_id`
+
+func scanContactRequest(row interface{ Scan(...interface{}) error }) (contactRequest, error) {
+	var r contactRequest
+	err := row.Scan(&r.ID, &r.UserID, &r.Name, &r.Email, &r.Direction, &r.Status, &r.CreatedAt, &r.RespondedAt, &r.GhostName)
+	return r, err
+}
+
+func getContactRequest(db database.Querier, id int, userID string) (contactRequest, error) {
+	return scanContactRequest(db.QueryRow(contactRequestQuery+" WHERE r.id=$2 AND (r.from_id=$1 OR r.to_id=$1)", userID, id))
+}
+
+// getContactRequests Pending requests, both those waiting for the user to
+// respond and those the user is waiting on, newest first
+func getContactRequests(db *database.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.GetString("UserID")
+
+		queryRows, err := db.Db.Query(contactRequestQuery+` WHERE (r.from_id=$1 OR r.to_id=$1) AND r.status='pending'
+				ORDER BY r.created_at DESC`, userID)
+		if err != nil {
+			database.CheckDBErr(err.(*pq.Error), c)
+			return
+		}
+		defer queryRows.Close()
+
+		requests := []contactRequest{}
+		for queryRows.Next() {
+			r, err := scanContactRequest(queryRows)
+			if err != nil {
+				c.AbortWithStatusJSON(500, "The server was unable to get contact requests")
+				return
+			}
+			requests = append(requests, r)
+		}
+
+		c.JSON(200, requests)
+	}
+}
+
+// respond Closes a pending request, accepting one makes the two users contacts
+// and claims the ghost it was sent for, in the same transaction as their
+// contact.accepted webhooks
+func respond(tx database.Querier, id int, status string) error {
+	var from, to string
+	var ghostID sql.NullString
+	err := tx.QueryRow(`UPDATE contact_request SET status=$2, responded_at=now() WHERE id=$1 AND status='pending'
+							RETURNING from_id, to_id, ghost_id`, id, status).Scan(&from, &to, &ghostID)
+	if err != nil || status != statusAccepted {
+		return err
+	}
+	_, err = tx.Exec(`INSERT INTO contact (user_id, contact_id) VALUES ($1, $2), ($2, $1) ON CONFLICT DO NOTHING`, from, to)
+	if err != nil {
+		return err
+	}
+	if ghostID.Valid {
+		if err = claimGhost(tx, ghostID.String, to); err != nil {
+			return err
+		}
+	}
+	// Both get a contact.accepted webhook, queued with the acceptance itself
+	for _, user := range []string{from, to} {
+		request, err := getContactRequest(tx, id, user)
+		if err != nil {
+			return err
+		}
+		if err = webhooks.Enqueue(tx, webhooks.ContactAccepted, request, user); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// answerContactRequest A handler for the user a request was sent to (incoming)
+// or the user who sent it (outgoing) to close it with status
+func answerContactRequest(db *database.DB, direction string, status string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.GetString("UserID")
+		id, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.JSON(400, "Invalid contact request ID")
+			return
+		}
+
+		tx, err := db.Db.Begin()
+		if err != nil {
+			database.CheckDBErr(err.(*pq.Error), c)
+			return
+		}
+		defer tx.Rollback()
+
+		request, err := getContactRequest(tx, id, userID)
+		if err == sql.ErrNoRows || (err == nil && (request.Direction != direction || request.Status != statusPending)) {
+			c.AbortWithStatusJSON(404, "Contact request not found")
+			return
+		}
+		if err != nil {
+			database.CheckDBErr(err.(*pq.Error), c)
+			return
+		}
+		if err = respond(tx, id, status); err != nil {
+			database.CheckDBErr(err.(*pq.Error), c)
+			return
+		}
+		if request, err = getContactRequest(tx, id, userID); err != nil {
+			database.CheckDBErr(err.(*pq.Error), c)
+			return
+		}
+		if err = tx.Commit(); err != nil {
+			database.CheckDBErr(err.(*pq.Error), c)
+			return
+		}
+		publishRequest(db.Db, id, userID, request.UserID)
+
+		c.JSON(200, request)
+	}
+}
+
+// publishRequest Tells each of users about the request as they see it, a new
+// one while it's pending and an update once it was answered. The user it was
+// sent to is notified of a new request, and the user who sent it when it's
+// accepted.
+func publishRequest(db database.Querier, id int, users ...string) {
+	for _, user := range users {
+		request, err := getContactRequest(db, id, user)
+		if err != nil {
+			continue
+		}
+		kind := events.ContactRequestClosed
+		if request.Status == statusPending {
+			kind = events.ContactRequestSent
+		}
+		events.Publish(kind, request, user)
+
+		if request.Direction == directionIncoming && request.Status == statusPending {
+			notifications.Notify(db, notifications.Notification{
+				UserID: user,
+				Type:   notifications.ContactRequest,
+				Title:  request.Name + " wants to add you as a contact",
+				Body:   request.Email,
+				Link:   "/",
+			})
+		} else if request.Direction == directionOutgoing && request.Status == statusAccepted {
+			notifications.Notify(db, notifications.Notification{
+				UserID: user,
+				Type:   notifications.ContactRequest,
+				Title:  request.Name + " accepted your contact request",
+				Link:   "/",
+			})
+		}
+	}
+}
+
+func acceptContactRequest(db *database.DB) gin.HandlerFunc {
+	return answerContactRequest(db, directionIncoming, statusAccepted)
+}
+
+func declineContactRequest(db *database.DB) gin.HandlerFunc {
+	return answerContactRequest(db, directionIncoming, statusDeclined)
+}
+
+// cancelContactRequest Withdraws a request the user sent
+func cancelContactRequest(db *database.DB) gin.HandlerFunc {
+	return answerContactRequest(db, directionOutgoing, statusCancelled)
+}
@@ -0,0 +1,135 @@
+package contacts
+
+import (
+	"database/sql"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+	"how-much-do-i-owe/database"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+// Split How a user splits transactions with just one contact when the
+// transaction doesn't say. YourShare and TheirShare are percentages for
+// percent splits and weights for shares splits, equal splits don't use them.
+type Split struct {
+	SplitType  string `json:"splitType"`
+	YourShare  int    `json:"yourShare"`
+	TheirShare int    `json:"theirShare"`
+}
+
+// contactSettings What a user keeps about a contact, only they see it
+type contactSettings struct {
+	Nickname     string `json:"nickname"`
+	Notes        string `json:"notes"`
+	Currency     string `json:"currency"`
+	DefaultSplit *Split `json:"defaultSplit"`
+}
+
+// contactUpdate Changes to contactSettings. Fields left out or null stay as
+// they are, a defaultSplit with an empty splitType removes it.
+type contactUpdate struct {
+	Nickname     *string `json:"nickname"`
+	Notes        *string `json:"notes"`
+	Currency     *string `json:"currency"`
+	DefaultSplit *Split  `json:"defaultSplit"`
+}
+
+var currencyCode = regexp.MustCompile(`^[A-Z]{3}$`)
+
+func (u *contactUpdate) validate() error {
+	if u.Nickname != nil {
+		*u.Nickname = strings.TrimSpace(*u.Nickname)
+		if len(*u.Nickname) > 100 {
+			return fmt.Errorf("nickname can be at most 100 characters")
+		}
+	}
+	if u.Notes != nil && len(*u.Notes) > 2000 {
+		return fmt.Errorf("notes can be at most 2000 characters")
+	}
+	if u.Currency != nil {
+		*u.Currency = strings.ToUpper(strings.TrimSpace(*u.Currency))
+		if *u.Currency != "" && !currencyCode.MatchString(*u.Currency) {
+			return fmt.Errorf("currency must be a three letter ISO 4217 code")
+		}
+	}
+	if split := u.DefaultSplit; split != nil {
+		switch split.SplitType {
+		case "", "equal":
+			split.YourShare, split.TheirShare = 0, 0
+		case "percent", "shares":
+			if split.YourShare <= 0 || split.TheirShare <= 0 {
+				return fmt.Errorf("yourShare and theirShare must be positive")
+			}
+			if split.SplitType == "percent" && split.YourShare+split.TheirShare != 100 {
+				return fmt.Errorf("percentages add up to %d, not 100", split.YourShare+split.TheirShare)
+			}
+		default:
+			return fmt.Errorf("a default split must be equal, percent or shares")
+		}
+	}
+	return nil
+}
+
+// updateContact Changes the nickname, notes, currency or default split the
+// user keeps for a contact
+func updateContact(db *database.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.GetString("UserID")
+		var update contactUpdate
+		if err := c.ShouldBindJSON(&update); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if err := update.validate(); err != nil {
+			c.JSON(http.StatusBadRequest, err.Error())
+			return
+		}
+		var splitType sql.NullString
+		var yours, theirs int
+		if update.DefaultSplit != nil {
+			splitType = sql.NullString{String: update.DefaultSplit.SplitType, Valid: true}
+			yours, theirs = update.DefaultSplit.YourShare, update.DefaultSplit.TheirShare
+		}
+
+		result, err := db.Db.Exec(`UPDATE contact SET nickname=COALESCE($3, nickname), notes=COALESCE($4, notes),
+                   			currency=COALESCE($5, currency), split_type=COALESCE($6, split_type),
+                   			your_share=CASE WHEN $6::text IS NULL THEN your_share ELSE $7 END,
+                   			their_share=CASE WHEN $6::text IS NULL THEN their_share ELSE $8 END
+							WHERE user_id=$1 AND contact_id=$2`,
+			userID, c.Param("id"), update.Nickname, update.Notes, update.Currency, splitType, yours, theirs)
+		if err != nil {
+			database.CheckDBErr(err.(*pq.Error), c)
+			return
+		}
+		if updated, _ := result.RowsAffected(); updated == 0 {
+			c.AbortWithStatusJSON(404, "Contact not found")
+			return
+		}
+		_, ct, err := scanContact(db.Db.QueryRow(contactQuery+" AND contact_id=$2", userID, c.Param("id")))
+		if err != nil {
+			database.CheckDBErr(err.(*pq.Error), c)
+			return
+		}
+
+		c.JSON(200, ct)
+	}
+}
+
+// DefaultSplit The split userID set for transactions with just contactID, or
+// nil when there is none
+func DefaultSplit(db database.Querier, userID string, contactID string) (*Split, error) {
+	var split Split
+	err := db.QueryRow(`SELECT split_type, your_share, their_share FROM contact
+							WHERE user_id=$1 AND contact_id=$2 AND split_type<>''`, userID, contactID).
+		Scan(&split.SplitType, &split.YourShare, &split.TheirShare)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &split, nil
+}
@@ -0,0 +1,322 @@
+package groups
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+	"how-much-do-i-owe/database"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type member struct {
+	ID       string    `json:"id"`
+	Name     string    `json:"name"`
+	Email    string    `json:"email"`
+	JoinedAt time.Time `json:"joinedAt"`
+}
+
+// group People who share expenses, like housemates or a trip. Only members
+// see a group, and only members can be in its transactions.
+type group struct {
+	ID        int       `json:"id"`
+	Name      string    `json:"name"`
+	CreatedBy *string   `json:"createdBy"`
+	CreatedAt time.Time `json:"createdAt"`
+	Members   []member  `json:"members"`
+}
+
+type groupRequest struct {
+	Name    string   `json:"name"`
+	Members []string `json:"members"`
+}
+
+// Routes All the routes created by the package nested in
+// api/v1/*
+func Routes(r *gin.RouterGroup, db *database.DB) {
+	r.GET("/groups", getGroups(db))
+	r.GET("/group/:id", getGroup(db))
+	r.PUT("/group", createGroup(db))
+	r.PATCH("/group/:id", renameGroup(db))
+	r.PUT("/group/:id/member/:userId", addMember(db))
+	r.DELETE("/group/:id/member/:userId", removeMember(db))
+}
+
+// Members If every one of ids is a member of the group
+func Members(db database.Querier, groupID int, ids []string) (bool, error) {
+	var missing bool
+	err := db.QueryRow(`SELECT EXISTS(SELECT 1 FROM unnest($2::text[]) id
+								WHERE NOT EXISTS(SELECT 1 FROM group_member WHERE group_id=$1 AND user_id=id))`,
+		groupID, pq.Array(ids)).Scan(&missing)
+	return !missing, err
+}
+
+// loadGroups The groups with ids, members included, in the order of ids
+func loadGroups(db database.Querier, ids []int) ([]group, error) {
+	groups := make([]group, 0, len(ids))
+	index := make(map[int]int)
+	queryRows, err := db.Query(`SELECT id, name, created_by, created_at FROM expense_group WHERE id = ANY($1)`, pq.Array(ids))
+	if err != nil {
+		return nil, err
+	}
+	defer queryRows.Close()
+	byID := make(map[int]group)
+	for queryRows.Next() {
+		g := group{Members: []member{}}
+		if err = queryRows.Scan(&g.ID, &g.Name, &g.CreatedBy, &g.CreatedAt); err != nil {
+			return nil, err
+		}
+		byID[g.ID] = g
+	}
+	for _, id := range ids {
+		if g, ok := byID[id]; ok {
+			index[id] = len(groups)
+			groups = append(groups, g)
+		}
+	}
+
+	memberRows, err := db.Query(`SELECT m.group_id, a.id, a.name, COALESCE(g.email, a.email), m.joined_at FROM group_member m
+									JOIN account a ON a.id = m.user_id LEFT JOIN ghost g ON g.id = m.user_id
+									WHERE m.group_id = ANY($1) ORDER BY m.joined_at, a.name`, pq.Array(ids))
+	if err != nil {
+		return nil, err
+	}
+	defer memberRows.Close()
+	for memberRows.Next() {
+		var groupID int
+		var m member
+		if err = memberRows.Scan(&groupID, &m.ID, &m.Name, &m.Email, &m.JoinedAt); err != nil {
+			return nil, err
+		}
+		if i, ok := index[groupID]; ok {
+			groups[i].Members = append(groups[i].Members, m)
+		}
+	}
+	return groups, memberRows.Err()
+}
+
+// groupParam The group in the URL, if the user is a member of it
+func groupParam(c *gin.Context, db database.Querier) (int, bool) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(400, "Invalid group ID")
+		return 0, false
+	}
+	isMember, err := Members(db, id, []string{c.GetString("UserID")})
+	if err != nil {
+		database.CheckDBErr(err.(*pq.Error), c)
+		return 0, false
+	}
+	if !isMember {
+		c.AbortWithStatusJSON(404, "Group not found")
+		return 0, false
+	}
+	return id, true
+}
+
+func getGroups(db *database.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		queryRows, err := db.Db.Query(`SELECT g.id FROM expense_group g JOIN group_member m ON m.group_id = g.id
+				WHERE m.user_id=$1 ORDER BY g.name`, c.GetString("UserID"))
+		if err != nil {
+			database.CheckDBErr(err.(*pq.Error), c)
+			return
+		}
+		var ids []int
+		for queryRows.Next() {
+			var id int
+			if err = queryRows.Scan(&id); err != nil {
+				queryRows.Close()
+				c.AbortWithStatusJSON(500, "The server was unable to get groups")
+				return
+			}
+			ids = append(ids, id)
+		}
+		queryRows.Close()
+
+		groups, err := loadGroups(db.Db, ids)
+		if err != nil {
+			database.CheckDBErr(err.(*pq.Error), c)
+			return
+		}
+
+		c.JSON(200, groups)
+	}
+}
+
+func getGroup(db *database.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, ok := groupParam(c, db.Db)
+		if !ok {
+			return
+		}
+		respondGroup(c, db.Db, id, 200)
+	}
+}
+
+func respondGroup(c *gin.Context, db database.Querier, id int, status int) {
+	groups, err := loadGroups(db, []int{id})
+	if err != nil {
+		database.CheckDBErr(err.(*pq.Error), c)
+		return
+	}
+	if len(groups) == 0 {
+		c.AbortWithStatusJSON(404, "Group not found")
+		return
+	}
+	c.JSON(status, groups[0])
+}
+
+// canAdd Checks that the user may add someone to a group: only their own
+// contacts, which includes their ghosts
+func canAdd(c *gin.Context, db database.Querier, userID string, memberID string) bool {
+	if memberID == userID {
+		return true
+	}
+	var isContact bool
+	err := db.QueryRow("SELECT EXISTS(SELECT 1 FROM contact WHERE user_id=$1 AND contact_id=$2)", userID, memberID).Scan(&isContact)
+	if err != nil {
+		database.CheckDBErr(err.(*pq.Error), c)
+		return false
+	}
+	if !isContact {
+		c.AbortWithStatusJSON(400, "Only your contacts can be added to a group")
+		return false
+	}
+	return true
+}
+
+// createGroup Starts a group with the user and the contacts in members
+func createGroup(db *database.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.GetString("UserID")
+		var req groupRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		req.Name = strings.TrimSpace(req.Name)
+		if req.Name == "" || len(req.Name) > 100 {
+			c.JSON(http.StatusBadRequest, "A group needs a name of at most 100 characters")
+			return
+		}
+
+		tx, err := db.Db.Begin()
+		if err != nil {
+			database.CheckDBErr(err.(*pq.Error), c)
+			return
+		}
+		defer tx.Rollback()
+
+		var id int
+		err = tx.QueryRow("INSERT INTO expense_group (name, created_by) VALUES ($1, $2) RETURNING id", req.Name, userID).Scan(&id)
+		if err != nil {
+			database.CheckDBErr(err.(*pq.Error), c)
+			return
+		}
+		for _, memberID := range append([]string{userID}, req.Members...) {
+			if !canAdd(c, tx, userID, memberID) {
+				return
+			}
+			_, err = tx.Exec("INSERT INTO group_member (group_id, user_id) VALUES ($1, $2) ON CONFLICT DO NOTHING", id, memberID)
+			if err != nil {
+				database.CheckDBErr(err.(*pq.Error), c)
+				return
+			}
+		}
+		if err = tx.Commit(); err != nil {
+			database.CheckDBErr(err.(*pq.Error), c)
+			return
+		}
+
+		respondGroup(c, db.Db, id, 201)
+	}
+}
+
+func renameGroup(db *database.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, ok := groupParam(c, db.Db)
+		if !ok {
+			return
+		}
+		var req groupRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		req.Name = strings.TrimSpace(req.Name)
+		if req.Name == "" || len(req.Name) > 100 {
+			c.JSON(http.StatusBadRequest, "A group needs a name of at most 100 characters")
+			return
+		}
+		if _, err := db.Db.Exec("UPDATE expense_group SET name=$2 WHERE id=$1", id, req.Name); err != nil {
+			database.CheckDBErr(err.(*pq.Error), c)
+			return
+		}
+
+		respondGroup(c, db.Db, id, 200)
+	}
+}
+
+// addMember Adds one of the user's contacts to a group they are in
+func addMember(db *database.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, ok := groupParam(c, db.Db)
+		if !ok {
+			return
+		}
+		memberID := c.Param("userId")
+		if !canAdd(c, db.Db, c.GetString("UserID"), memberID) {
+			return
+		}
+		_, err := db.Db.Exec("INSERT INTO group_member (group_id, user_id) VALUES ($1, $2) ON CONFLICT DO NOTHING", id, memberID)
+		if err != nil {
+			database.CheckDBErr(err.(*pq.Error), c)
+			return
+		}
+
+		respondGroup(c, db.Db, id, 201)
+	}
+}
+
+// removeMember Takes someone out of a group, or lets the user leave it. Their
+// transactions stay in the group. A group with nobody but ghosts left in it is
+// deleted.
+func removeMember(db *database.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, ok := groupParam(c, db.Db)
+		if !ok {
+			return
+		}
+
+		tx, err := db.Db.Begin()
+		if err != nil {
+			database.CheckDBErr(err.(*pq.Error), c)
+			return
+		}
+		defer tx.Rollback()
+
+		result, err := tx.Exec("DELETE FROM group_member WHERE group_id=$1 AND user_id=$2", id, c.Param("userId"))
+		if err != nil {
+			database.CheckDBErr(err.(*pq.Error), c)
+			return
+		}
+		if removed, _ := result.RowsAffected(); removed == 0 {
+			c.AbortWithStatusJSON(404, "Member not found")
+			return
+		}
+		_, err = tx.Exec(`DELETE FROM expense_group WHERE id=$1 AND NOT EXISTS(SELECT 1 FROM group_member
+								WHERE group_id=$1 AND user_id NOT IN (SELECT id FROM ghost))`, id)
+		if err != nil {
+			database.CheckDBErr(err.(*pq.Error), c)
+			return
+		}
+		if err = tx.Commit(); err != nil {
+			database.CheckDBErr(err.(*pq.Error), c)
+			return
+		}
+
+		c.JSON(201, "Member removed")
+	}
+}
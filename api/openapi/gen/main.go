@@ -0,0 +1,376 @@
+// Command gen Generates the typed Go client in client/ from api/openapi/openapi.json
+//
+// Usage (normally through go generate in client/):
+//
+//	go run how-much-do-i-owe/api/openapi/gen -spec api/openapi/openapi.json -out client/client_gen.go
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"go/format"
+	"log"
+	"os"
+	"sort"
+	"strings"
+)
+
+type document struct {
+	Paths      map[string]map[string]json.RawMessage `json:"paths"`
+	Components struct {
+		Schemas    map[string]*schema    `json:"schemas"`
+		Parameters map[string]*parameter `json:"parameters"`
+		Responses  map[string]*response  `json:"responses"`
+	} `json:"components"`
+}
+
+type operation struct {
+	OperationID string               `json:"operationId"`
+	Summary     string               `json:"summary"`
+	ClientSkip  bool                 `json:"x-client-skip"`
+	Parameters  []*parameter         `json:"parameters"`
+	RequestBody *content             `json:"requestBody"`
+	Responses   map[string]*response `json:"responses"`
+}
+
+type parameter struct {
+	Ref      string  `json:"$ref"`
+	Name     string  `json:"name"`
+	In       string  `json:"in"`
+	Required bool    `json:"required"`
+	Schema   *schema `json:"schema"`
+}
+
+type content struct {
+	Content map[string]struct {
+		Schema *schema `json:"schema"`
+	} `json:"content"`
+}
+
+type response struct {
+	Ref string `json:"$ref"`
+	content
+}
+
+type schema struct {
+	Ref                  string             `json:"$ref"`
+	Type                 string             `json:"type"`
+	Format               string             `json:"format"`
+	Nullable             bool               `json:"nullable"`
+	Properties           map[string]*schema `json:"properties"`
+	Items                *schema            `json:"items"`
+	AdditionalProperties *schema            `json:"additionalProperties"`
+	AllOf                []*schema          `json:"allOf"`
+}
+
+var methods = []string{"get", "put", "post", "patch", "delete"}
+
+func main() {
+	specPath := flag.String("spec", "api/openapi/openapi.json", "path to the OpenAPI document")
+	outPath := flag.String("out", "client/client_gen.go", "path of the generated Go file")
+	flag.Parse()
+
+	raw, err := os.ReadFile(*specPath)
+	if err != nil {
+		log.Fatal(err)
+	}
+	var doc document
+	if err = json.Unmarshal(raw, &doc); err != nil {
+		log.Fatal(err)
+	}
+
+	src, err := generate(&doc)
+	if err != nil {
+		log.Fatal(err)
+	}
+	formatted, err := format.Source(src)
+	if err != nil {
+		log.Fatalf("generated code does not compile: %s\n%s", err, src)
+	}
+	if err = os.WriteFile(*outPath, formatted, 0644); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func generate(doc *document) ([]byte, error) {
+	var b strings.Builder
+
+	for _, name := range sortedKeys(doc.Components.Schemas) {
+		s := doc.Components.Schemas[name]
+		if s.Type != "object" || s.Properties == nil {
+			return nil, fmt.Errorf("component schema %s must be an object with properties", name)
+		}
+		fmt.Fprintf(&b, "type %s struct {\n", goName(name))
+		for _, prop := range sortedKeys(s.Properties) {
+			t, err := goType(s.Properties[prop])
+			if err != nil {
+				return nil, fmt.Errorf("%s.%s: %w", name, prop, err)
+			}
+			fmt.Fprintf(&b, "%s %s `json:\"%s\"`\n", goName(prop), t, prop)
+		}
+		b.WriteString("}\n\n")
+	}
+
+	for _, path := range sortedKeys(doc.Paths) {
+		item := doc.Paths[path]
+		var shared []*parameter
+		if rawParams, ok := item["parameters"]; ok {
+			if err := json.Unmarshal(rawParams, &shared); err != nil {
+				return nil, fmt.Errorf("%s: %w", path, err)
+			}
+		}
+		for _, method := range methods {
+			rawOp, ok := item[method]
+			if !ok {
+				continue
+			}
+			var op operation
+			if err := json.Unmarshal(rawOp, &op); err != nil {
+				return nil, fmt.Errorf("%s %s: %w", method, path, err)
+			}
+			if op.ClientSkip {
+				continue
+			}
+			if err := writeOperation(&b, doc, path, method, &op, append(shared, op.Parameters...)); err != nil {
+				return nil, fmt.Errorf("%s %s: %w", method, path, err)
+			}
+		}
+	}
+
+	body := b.String()
+	var header strings.Builder
+	header.WriteString("// Code generated by api/openapi/gen from api/openapi/openapi.json; DO NOT EDIT.\n\n")
+	header.WriteString("package client\n\nimport (\n")
+	for _, pkg := range []string{"context", "fmt", "net/url", "time"} {
+		if strings.Contains(body, pkg[strings.LastIndex(pkg, "/")+1:]+".") {
+			fmt.Fprintf(&header, "%q\n", pkg)
+		}
+	}
+	header.WriteString(")\n\n")
+	return []byte(header.String() + body), nil
+}
+
+func writeOperation(b *strings.Builder, doc *document, path string, method string, op *operation, params []*parameter) error {
+	name := goName(op.OperationID)
+	args := []string{"ctx context.Context"}
+	pathExpr := fmt.Sprintf("%q", path)
+	var query []*parameter
+	for _, p := range params {
+		if p.Ref != "" {
+			p = doc.Components.Parameters[strings.TrimPrefix(p.Ref, "#/components/parameters/")]
+			if p == nil {
+				return fmt.Errorf("unknown parameter reference")
+			}
+		}
+		switch p.In {
+		case "path":
+			arg := lowerFirst(goName(p.Name))
+			args = append(args, arg+" string")
+			pathExpr = strings.Replace(pathExpr, "{"+p.Name+"}", `"+url.PathEscape(`+arg+`)+"`, 1)
+		case "query":
+			query = append(query, p)
+		}
+	}
+	pathExpr = strings.TrimSuffix(strings.TrimPrefix(pathExpr, `""+`), `+""`)
+
+	queryExpr := "nil"
+	if len(query) > 0 {
+		fmt.Fprintf(b, "// %sParams The query parameters of %s\n", name, name)
+		fmt.Fprintf(b, "type %sParams struct {\n", name)
+		for _, p := range query {
+			t, err := goType(p.Schema)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(b, "%s %s\n", goName(p.Name), t)
+		}
+		b.WriteString("}\n\n")
+		args = append(args, "params "+name+"Params")
+		queryExpr = "query"
+	}
+
+	bodyExpr := "nil"
+	if op.RequestBody != nil {
+		if media, ok := op.RequestBody.Content["application/json"]; ok {
+			t, err := goType(media.Schema)
+			if err != nil {
+				return err
+			}
+			args = append(args, "body "+t)
+			bodyExpr = "body"
+		}
+	}
+
+	result, raw, err := successType(doc, op)
+	if err != nil {
+		return err
+	}
+
+	if op.Summary != "" {
+		fmt.Fprintf(b, "// %s %s\n", name, op.Summary)
+	}
+	if result == "" {
+		fmt.Fprintf(b, "func (c *Client) %s(%s) error {\n", name, strings.Join(args, ", "))
+	} else {
+		fmt.Fprintf(b, "func (c *Client) %s(%s) (%s, error) {\n", name, strings.Join(args, ", "), result)
+	}
+	if len(query) > 0 {
+		b.WriteString("query := url.Values{}\n")
+		for _, p := range query {
+			field := "params." + goName(p.Name)
+			t, _ := goType(p.Schema)
+			switch t {
+			case "time.Time":
+				fmt.Fprintf(b, "if !%s.IsZero() {\nquery.Set(%q, %s.Format(time.RFC3339))\n}\n", field, p.Name, field)
+			case "bool":
+				fmt.Fprintf(b, "if %s {\nquery.Set(%q, \"true\")\n}\n", field, p.Name)
+			case "string":
+				fmt.Fprintf(b, "if %s != \"\" {\nquery.Set(%q, %s)\n}\n", field, p.Name, field)
+			default:
+				fmt.Fprintf(b, "if %s != 0 {\nquery.Set(%q, fmt.Sprint(%s))\n}\n", field, p.Name, field)
+			}
+		}
+	}
+	verb := strings.ToUpper(method)
+	switch {
+	case result == "":
+		fmt.Fprintf(b, "return c.do(ctx, %q, %s, %s, %s, nil)\n", verb, pathExpr, queryExpr, bodyExpr)
+	case raw:
+		fmt.Fprintf(b, "return c.doRaw(ctx, %q, %s, %s, %s)\n", verb, pathExpr, queryExpr, bodyExpr)
+	default:
+		fmt.Fprintf(b, "var out %s\n", strings.TrimPrefix(result, "*"))
+		fmt.Fprintf(b, "err := c.do(ctx, %q, %s, %s, %s, &out)\n", verb, pathExpr, queryExpr, bodyExpr)
+		if strings.HasPrefix(result, "*") {
+			b.WriteString("if err != nil {\nreturn nil, err\n}\nreturn &out, nil\n")
+		} else {
+			b.WriteString("return out, err\n")
+		}
+	}
+	b.WriteString("}\n\n")
+	return nil
+}
+
+// successType The Go type of the first 2xx response that has a body. raw is
+// true when that body is not JSON and is returned as bytes.
+func successType(doc *document, op *operation) (result string, raw bool, err error) {
+	for _, code := range sortedKeys(op.Responses) {
+		if !strings.HasPrefix(code, "2") {
+			continue
+		}
+		resp := op.Responses[code]
+		if resp.Ref != "" {
+			resp = doc.Components.Responses[strings.TrimPrefix(resp.Ref, "#/components/responses/")]
+			if resp == nil {
+				return "", false, fmt.Errorf("unknown response reference")
+			}
+		}
+		if media, ok := resp.Content["application/json"]; ok {
+			t, err := goType(media.Schema)
+			if err != nil {
+				return "", false, err
+			}
+			if media.Schema.Ref != "" {
+				t = "*" + t
+			}
+			return t, false, nil
+		}
+		if len(resp.Content) > 0 {
+			return "[]byte", true, nil
+		}
+	}
+	return "", false, nil
+}
+
+func goType(s *schema) (string, error) {
+	if s == nil {
+		return "interface{}", nil
+	}
+	if s.Ref != "" {
+		return goName(strings.TrimPrefix(s.Ref, "#/components/schemas/")), nil
+	}
+	// A nullable reference is written as allOf with the one reference
+	if len(s.AllOf) == 1 && s.AllOf[0].Ref != "" {
+		t, err := goType(s.AllOf[0])
+		if s.Nullable {
+			t = "*" + t
+		}
+		return t, err
+	}
+	if s.Nullable && s.Type != "array" && s.Type != "object" {
+		plain := *s
+		plain.Nullable = false
+		t, err := goType(&plain)
+		return "*" + t, err
+	}
+	switch s.Type {
+	case "string":
+		if s.Format == "date-time" {
+			return "time.Time", nil
+		}
+		return "string", nil
+	case "integer":
+		return "int", nil
+	case "number":
+		return "float64", nil
+	case "boolean":
+		return "bool", nil
+	case "array":
+		t, err := goType(s.Items)
+		return "[]" + t, err
+	case "object":
+		if s.Properties != nil {
+			return "", fmt.Errorf("inline object schemas are not supported, move it to components")
+		}
+		if s.AdditionalProperties != nil {
+			t, err := goType(s.AdditionalProperties)
+			return "map[string]" + t, err
+		}
+		return "map[string]interface{}", nil
+	}
+	return "", fmt.Errorf("unsupported schema type %q", s.Type)
+}
+
+var initialisms = map[string]string{"id": "ID", "url": "URL", "json": "JSON", "api": "API", "ip": "IP", "qr": "QR", "svg": "SVG", "png": "PNG", "pdf": "PDF", "html": "HTML", "csrf": "CSRF"}
+
+// goName Converts camelCase, snake_case and kebab-case names to exported Go identifiers
+func goName(name string) string {
+	var words []string
+	start := 0
+	for i := 1; i <= len(name); i++ {
+		if i == len(name) || name[i] == '_' || name[i] == '-' || (name[i] >= 'A' && name[i] <= 'Z' && name[i-1] >= 'a' && name[i-1] <= 'z') {
+			if start < i {
+				words = append(words, name[start:i])
+			}
+			start = i
+			if i < len(name) && (name[i] == '_' || name[i] == '-') {
+				start++
+			}
+		}
+	}
+	var out strings.Builder
+	for _, w := range words {
+		if upper, ok := initialisms[strings.ToLower(w)]; ok {
+			out.WriteString(upper)
+		} else {
+			out.WriteString(strings.ToUpper(w[:1]) + w[1:])
+		}
+	}
+	return out.String()
+}
+
+func lowerFirst(name string) string {
+	if upper, ok := initialisms[strings.ToLower(name)]; ok && upper == name {
+		return strings.ToLower(name)
+	}
+	return strings.ToLower(name[:1]) + name[1:]
+}
+
+func sortedKeys[T any](m map[string]T) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
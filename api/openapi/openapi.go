@@ -0,0 +1,24 @@
+package openapi
+
+import (
+	_ "embed"
+	"github.com/gin-gonic/gin"
+)
+
+// Spec The OpenAPI 3 document describing every route under
+// api/v1/* and oauth/v1/*
+//
+//go:embed openapi.json
+var Spec []byte
+
+// Routes All the routes created by the package nested in
+// api/*
+func Routes(r *gin.RouterGroup) {
+	r.GET("/openapi.json", getSpec())
+}
+
+func getSpec() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Data(200, "application/json; charset=utf-8", Spec)
+	}
+}
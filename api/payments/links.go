@@ -0,0 +1,105 @@
+package payments
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// Link A payment to someone the user owes, pre-filled with the amount and a
+// memo where the kind of payment takes one. URL opens the payment app, SEPA
+// transfers have none and are only scanned by banking apps. Payload is what
+// the QR code of the link holds.
+type Link struct {
+	Kind     string  `json:"kind"`
+	URL      string  `json:"url"`
+	Payload  string  `json:"payload"`
+	Amount   float64 `json:"amount"`
+	Currency string  `json:"currency"`
+	Memo     string  `json:"memo"`
+	QRCode   string  `json:"qrCode"`
+}
+
+// currencies The one currency a kind of payment can be made in, PayPal takes
+// any
+var currencies = map[string]string{KindVenmo: "USD", KindCashApp: "USD", KindSEPA: "EUR", KindUPI: "INR"}
+
+// memoLengths How long a memo each kind of payment takes, PayPal.me and Cash
+// App links have no memo
+var memoLengths = map[string]int{KindVenmo: 280, KindSEPA: 140, KindUPI: 80}
+
+// Links The links that pay amount with each of the handles. Currency is the
+// one the user set for the contact, handles that can't pay in it are left
+// out, and when it isn't set every handle gets a link in its own currency.
+func Links(handles []Handle, amount float64, currency string, refs []string) []Link {
+	links := []Link{}
+	for _, h := range handles {
+		if link, ok := NewLink(h, amount, currency, refs); ok {
+			links = append(links, link)
+		}
+	}
+	return links
+}
+
+// NewLink The link that pays amount with a handle, and false when it can't
+// pay in currency. The memo lists refs, the transactions being settled.
+func NewLink(h Handle, amount float64, currency string, refs []string) (Link, bool) {
+	if fixed, ok := currencies[h.Kind]; ok {
+		if currency != "" && currency != fixed {
+			return Link{}, false
+		}
+		currency = fixed
+	}
+	link := Link{Kind: h.Kind, Amount: amount, Currency: currency, Memo: Memo(refs, memoLengths[h.Kind])}
+	value := fmt.Sprintf("%.2f", amount)
+
+	switch h.Kind {
+	case KindPayPal:
+		link.URL = "https://paypal.me/" + h.Handle + "/" + value + currency
+	case KindVenmo:
+		link.URL = "https://venmo.com/" + h.Handle + "?txn=pay&amount=" + value + "&note=" + escape(link.Memo)
+	case KindCashApp:
+		link.URL = "https://cash.app/$" + h.Handle + "/" + value
+	case KindSEPA:
+		// An EPC QR code (EPC069-12) for a SEPA credit transfer, the lines are
+		// service tag, version, UTF-8, transfer, BIC, name, IBAN, amount,
+		// purpose, structured and unstructured remittance
+		link.Payload = strings.Join([]string{"BCD", "002", "1", "SCT", h.BIC, h.Name, h.Handle,
+			"EUR" + value, "", "", link.Memo}, "\n")
+	case KindUPI:
+		link.URL = "upi://pay?pa=" + escape(h.Handle) + "&pn=" + escape(h.Name) + "&am=" + value +
+			"&cu=INR&tn=" + escape(link.Memo)
+	default:
+		return Link{}, false
+	}
+	if link.Payload == "" {
+		link.Payload = link.URL
+	}
+	return link, true
+}
+
+// Memo What a payment is for, the transactions in refs, in at most max
+// characters. Transactions that don't fit are counted at the end.
+func Memo(refs []string, max int) string {
+	if max <= 0 || len(refs) == 0 {
+		return ""
+	}
+	memo := "how much do i owe: " + strings.Join(refs, ", ")
+	for n := len(refs) - 1; len([]rune(memo)) > max; n-- {
+		if n == 0 {
+			memo = fmt.Sprintf("how much do i owe: %d transactions", len(refs))
+			break
+		}
+		memo = fmt.Sprintf("how much do i owe: %s and %d more", strings.Join(refs[:n], ", "), len(refs)-n)
+	}
+	if runes := []rune(memo); len(runes) > max {
+		memo = string(runes[:max])
+	}
+	return memo
+}
+
+// escape Escapes a query value with %20 for spaces, which payment apps read
+// more reliably than +
+func escape(s string) string {
+	return strings.ReplaceAll(url.QueryEscape(s), "+", "%20")
+}
@@ -0,0 +1,89 @@
+package payments
+
+import "testing"
+
+func TestLinks(t *testing.T) {
+	handles := []Handle{
+		{Kind: KindPayPal, Handle: "alice"},
+		{Kind: KindVenmo, Handle: "alice-smith"},
+		{Kind: KindCashApp, Handle: "alice"},
+		{Kind: KindSEPA, Handle: "DE89370400440532013000", Name: "Alice Smith", BIC: "COBADEFFXXX"},
+		{Kind: KindUPI, Handle: "alice@okbank", Name: "Alice Smith"},
+	}
+	refs := []string{"pizza", "movie tickets"}
+
+	links := Links(handles, 24.5, "", refs)
+	want := []string{
+		"https://paypal.me/alice/24.50",
+		"https://venmo.com/alice-smith?txn=pay&amount=24.50&note=how%20much%20do%20i%20owe%3A%20pizza%2C%20movie%20tickets",
+		"https://cash.app/$alice/24.50",
+		"BCD\n002\n1\nSCT\nCOBADEFFXXX\nAlice Smith\nDE89370400440532013000\nEUR24.50\n\n\nhow much do i owe: pizza, movie tickets",
+		"upi://pay?pa=alice%40okbank&pn=Alice%20Smith&am=24.50&cu=INR&tn=how%20much%20do%20i%20owe%3A%20pizza%2C%20movie%20tickets",
+	}
+	if len(links) != len(want) {
+		t.Fatalf("got %d links, want %d", len(links), len(want))
+	}
+	for i, link := range links {
+		if link.Payload != want[i] {
+			t.Errorf("%s: got %q, want %q", link.Kind, link.Payload, want[i])
+		}
+	}
+	if links[3].URL != "" {
+		t.Error("SEPA transfers have no link to open")
+	}
+
+	// Only the handles that pay in the currency of the contact get a link
+	links = Links(handles, 10, "EUR", refs)
+	if len(links) != 2 || links[0].URL != "https://paypal.me/alice/10.00EUR" || links[1].Kind != KindSEPA {
+		t.Errorf("got %v, want PayPal in euros and SEPA", links)
+	}
+}
+
+func TestMemo(t *testing.T) {
+	refs := []string{"pizza", "movie tickets", "groceries for the weekend trip"}
+	tests := []struct {
+		max  int
+		want string
+	}{
+		{0, ""},
+		{200, "how much do i owe: pizza, movie tickets, groceries for the weekend trip"},
+		{50, "how much do i owe: pizza, movie tickets and 1 more"},
+		{40, "how much do i owe: pizza and 2 more"},
+		{30, "how much do i owe: 3 transacti"},
+	}
+	for _, test := range tests {
+		if got := Memo(refs, test.max); got != test.want {
+			t.Errorf("Memo(%d) = %q, want %q", test.max, got, test.want)
+		}
+		if len(Memo(refs, test.max)) > test.max {
+			t.Errorf("Memo(%d) is too long", test.max)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		req    handleRequest
+		handle string
+		valid  bool
+	}{
+		{handleRequest{Kind: "PayPal", Handle: "https://paypal.me/alice"}, "alice", true},
+		{handleRequest{Kind: "venmo", Handle: "@alice-smith"}, "alice-smith", true},
+		{handleRequest{Kind: "cashapp", Handle: "$alice"}, "alice", true},
+		{handleRequest{Kind: "sepa", Handle: "de89 3704 0044 0532 0130 00", Name: "Alice"}, "DE89370400440532013000", true},
+		{handleRequest{Kind: "sepa", Handle: "DE89370400440532013001", Name: "Alice"}, "", false},
+		{handleRequest{Kind: "sepa", Handle: "DE89370400440532013000"}, "", false},
+		{handleRequest{Kind: "upi", Handle: "alice@okbank"}, "alice@okbank", true},
+		{handleRequest{Kind: "upi", Handle: "alice"}, "", false},
+		{handleRequest{Kind: "zelle", Handle: "alice"}, "", false},
+	}
+	for _, test := range tests {
+		err := test.req.validate()
+		if (err == nil) != test.valid {
+			t.Errorf("%s %s: got %v", test.req.Kind, test.req.Handle, err)
+		}
+		if test.valid && test.req.Handle != test.handle {
+			t.Errorf("got handle %q, want %q", test.req.Handle, test.handle)
+		}
+	}
+}
@@ -0,0 +1,221 @@
+package payments
+
+import (
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+	"how-much-do-i-owe/database"
+	"math/big"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Kinds of payment handles
+const (
+	KindPayPal  = "paypal"
+	KindVenmo   = "venmo"
+	KindCashApp = "cashapp"
+	KindSEPA    = "sepa"
+	KindUPI     = "upi"
+)
+
+// Kinds Every kind of payment handle, in the order links are listed
+var Kinds = []string{KindPayPal, KindVenmo, KindCashApp, KindSEPA, KindUPI}
+
+// Handle How the user can be paid. Handle is the PayPal.me or Venmo username,
+// the $Cashtag without the $, the IBAN for SEPA transfers or the UPI ID. Name
+// is the account holder, which SEPA transfers need, and BIC is optional.
+type Handle struct {
+	Kind      string    `json:"kind"`
+	Handle    string    `json:"handle"`
+	Name      string    `json:"name"`
+	BIC       string    `json:"bic"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+type handleRequest struct {
+	Kind   string `json:"kind" binding:"required"`
+	Handle string `json:"handle" binding:"required"`
+	Name   string `json:"name"`
+	BIC    string `json:"bic"`
+}
+
+var (
+	paypalName  = regexp.MustCompile(`^[A-Za-z0-9]{1,20}$`)
+	venmoName   = regexp.MustCompile(`^[A-Za-z0-9_-]{5,30}$`)
+	cashtag     = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9]{0,19}$`)
+	ibanFormat  = regexp.MustCompile(`^[A-Z]{2}[0-9]{2}[A-Z0-9]{11,30}$`)
+	bicFormat   = regexp.MustCompile(`^[A-Z]{6}[A-Z0-9]{2}([A-Z0-9]{3})?$`)
+	upiIDFormat = regexp.MustCompile(`^[A-Za-z0-9._-]{2,256}@[A-Za-z]{2,64}$`)
+)
+
+// Routes All the routes created by the package nested in
+// api/v1/*
+func Routes(r *gin.RouterGroup, db *database.DB) {
+	r.GET("/payment-handles", getHandles(db))
+	r.PUT("/payment-handle", setHandle(db))
+	r.DELETE("/payment-handle/:kind", deleteHandle(db))
+}
+
+// Visible If viewer may see how owner can be paid: they are contacts or
+// members of a group together, and neither blocked the other. Handles hold
+// bank details, which owing someone money isn't enough to see since anyone
+// can be named the payer of a transaction.
+func Visible(db database.Querier, viewer string, owner string) (bool, error) {
+	var visible bool
+	err := db.QueryRow(`SELECT (EXISTS(SELECT 1 FROM contact WHERE user_id=$1 AND contact_id=$2)
+								OR EXISTS(SELECT 1 FROM group_member v JOIN group_member o ON o.group_id = v.group_id
+									WHERE v.user_id=$1 AND o.user_id=$2))
+							AND NOT EXISTS(SELECT 1 FROM contact_block
+								WHERE (user_id=$1 AND blocked_id=$2) OR (user_id=$2 AND blocked_id=$1))`,
+		viewer, owner).Scan(&visible)
+	return visible, err
+}
+
+// Handles How userID can be paid, in the order of Kinds
+func Handles(db database.Querier, userID string) ([]Handle, error) {
+	queryRows, err := db.Query(`SELECT kind, handle, name, bic, created_at FROM payment_handle WHERE user_id=$1
+								ORDER BY array_position($2::text[], kind)`, userID, pq.Array(Kinds))
+	if err != nil {
+		return nil, err
+	}
+	defer queryRows.Close()
+
+	handles := []Handle{}
+	for queryRows.Next() {
+		var h Handle
+		if err = queryRows.Scan(&h.Kind, &h.Handle, &h.Name, &h.BIC, &h.CreatedAt); err != nil {
+			return nil, err
+		}
+		handles = append(handles, h)
+	}
+	return handles, queryRows.Err()
+}
+
+func getHandles(db *database.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		handles, err := Handles(db.Db, c.GetString("UserID"))
+		if err != nil {
+			database.CheckDBErr(err.(*pq.Error), c)
+			return
+		}
+		c.JSON(200, handles)
+	}
+}
+
+// setHandle Adds the handle of a kind, or replaces the one the user had
+func setHandle(db *database.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req handleRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if err := req.validate(); err != nil {
+			c.JSON(http.StatusBadRequest, err.Error())
+			return
+		}
+
+		var h Handle
+		err := db.Db.QueryRow(`INSERT INTO payment_handle (user_id, kind, handle, name, bic) VALUES ($1, $2, $3, $4, $5)
+								ON CONFLICT (user_id, kind) DO UPDATE SET handle=$3, name=$4, bic=$5, created_at=now()
+								RETURNING kind, handle, name, bic, created_at`,
+			c.GetString("UserID"), req.Kind, req.Handle, req.Name, req.BIC).Scan(&h.Kind, &h.Handle, &h.Name, &h.BIC, &h.CreatedAt)
+		if err != nil {
+			database.CheckDBErr(err.(*pq.Error), c)
+			return
+		}
+
+		c.JSON(201, h)
+	}
+}
+
+func deleteHandle(db *database.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		kind := c.Param("kind")
+		result, err := db.Db.Exec("DELETE FROM payment_handle WHERE user_id=$1 AND kind=$2", c.GetString("UserID"), kind)
+		if err != nil {
+			database.CheckDBErr(err.(*pq.Error), c)
+			return
+		}
+		if deleted, _ := result.RowsAffected(); deleted == 0 {
+			c.AbortWithStatusJSON(404, "Payment handle not found")
+			return
+		}
+
+		c.JSON(201, kind)
+	}
+}
+
+// validate Checks the handle is one its kind of payment accepts, and tidies
+// up how people usually write them, like @ before Venmo usernames and spaces
+// in IBANs
+func (req *handleRequest) validate() error {
+	req.Kind = strings.ToLower(strings.TrimSpace(req.Kind))
+	req.Handle = strings.TrimSpace(req.Handle)
+	req.Name = strings.TrimSpace(req.Name)
+	req.BIC = strings.ToUpper(strings.ReplaceAll(req.BIC, " ", ""))
+	if len(req.Name) > 70 {
+		return fmt.Errorf("name can be at most 70 characters")
+	}
+
+	switch req.Kind {
+	case KindPayPal:
+		req.Handle = strings.TrimPrefix(strings.TrimPrefix(strings.TrimPrefix(req.Handle, "https://"), "www."), "paypal.me/")
+		if !paypalName.MatchString(req.Handle) {
+			return fmt.Errorf("a PayPal.me username is up to 20 letters and digits")
+		}
+	case KindVenmo:
+		req.Handle = strings.TrimPrefix(req.Handle, "@")
+		if !venmoName.MatchString(req.Handle) {
+			return fmt.Errorf("a Venmo username is 5 to 30 letters, digits, dashes and underscores")
+		}
+	case KindCashApp:
+		req.Handle = strings.TrimPrefix(req.Handle, "$")
+		if !cashtag.MatchString(req.Handle) {
+			return fmt.Errorf("a $Cashtag is a letter followed by up to 19 letters and digits")
+		}
+	case KindSEPA:
+		req.Handle = strings.ToUpper(strings.ReplaceAll(req.Handle, " ", ""))
+		if !validIBAN(req.Handle) {
+			return fmt.Errorf("%s isn't a valid IBAN", req.Handle)
+		}
+		if req.BIC != "" && !bicFormat.MatchString(req.BIC) {
+			return fmt.Errorf("a BIC is 8 or 11 letters and digits")
+		}
+		if req.Name == "" {
+			return fmt.Errorf("SEPA transfers need the name of the account holder")
+		}
+	case KindUPI:
+		if !upiIDFormat.MatchString(req.Handle) {
+			return fmt.Errorf("a UPI ID looks like name@bank")
+		}
+	default:
+		return fmt.Errorf("kind must be one of %s", strings.Join(Kinds, ", "))
+	}
+	if req.Kind != KindSEPA {
+		req.BIC = ""
+	}
+	return nil
+}
+
+// validIBAN Checks the format and the check digits of an IBAN
+func validIBAN(iban string) bool {
+	if !ibanFormat.MatchString(iban) {
+		return false
+	}
+	// The country and check digits go to the end, letters become numbers
+	// from A=10, and the result mod 97 is 1
+	var digits strings.Builder
+	for _, r := range iban[4:] + iban[:4] {
+		if r >= 'A' && r <= 'Z' {
+			fmt.Fprintf(&digits, "%d", r-'A'+10)
+		} else {
+			digits.WriteRune(r)
+		}
+	}
+	n, ok := new(big.Int).SetString(digits.String(), 10)
+	return ok && new(big.Int).Mod(n, big.NewInt(97)).Int64() == 1
+}
@@ -0,0 +1,169 @@
+package reminders
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"github.com/lib/pq"
+	"how-much-do-i-owe/database"
+	"how-much-do-i-owe/notifications"
+	"how-much-do-i-owe/scheduler"
+	"time"
+)
+
+// Job Checks every balance against the reminder rules and sends the
+// reminders that are due
+var Job = scheduler.Job{Name: "reminders", Every: 15 * time.Minute, Run: remind}
+
+// debtsQuery Everyone who owes more than the rule of the user they owe allows.
+// Placeholders and people on either side of a block are left out.
+const debtsQuery = `WITH debts AS (
+    SELECT creditor, debtor, sum(amount) AS amount FROM (
+        SELECT t.payer AS creditor, tp.user_id AS debtor, tp.dollar_share AS amount FROM transaction t
+            JOIN transaction_participants tp ON tp.transaction_id = t.id WHERE tp.user_id <> t.payer
+        UNION ALL
+        SELECT tp.user_id, t.payer, -tp.dollar_share FROM transaction t
+            JOIN transaction_participants tp ON tp.transaction_id = t.id WHERE tp.user_id <> t.payer
+    ) owed
+    WHERE creditor IN (SELECT user_id FROM reminder_rule WHERE enabled)
+    GROUP BY creditor, debtor
+), ruled AS (
+    SELECT DISTINCT ON (d.creditor, d.debtor) d.creditor, d.debtor, d.amount, r.threshold, r.enabled,
+           r.after_days, r.schedule, r.quiet_start, r.quiet_end
+    FROM debts d JOIN reminder_rule r ON r.user_id = d.creditor AND (r.contact_id = d.debtor OR r.contact_id IS NULL)
+    ORDER BY d.creditor, d.debtor, r.contact_id NULLS LAST
+)
+SELECT creditor, debtor, amount, after_days, schedule, quiet_start, quiet_end FROM ruled
+WHERE enabled AND amount >= threshold
+  AND debtor NOT IN (SELECT id FROM ghost)
+  AND NOT EXISTS(SELECT 1 FROM contact_block b WHERE (b.user_id = creditor AND b.blocked_id = debtor)
+                                                  OR (b.user_id = debtor AND b.blocked_id = creditor))`
+
+type debt struct {
+	creditor, debtor     string
+	amount               float64
+	afterDays            int
+	schedule             []int
+	quietStart, quietEnd int
+}
+
+func remind(ctx context.Context, db *database.DB) error {
+	queryRows, err := db.Db.QueryContext(ctx, debtsQuery)
+	if err != nil {
+		return err
+	}
+	var debts []debt
+	var creditors, debtors []string
+	for queryRows.Next() {
+		var d debt
+		var schedule pq.Int64Array
+		err = queryRows.Scan(&d.creditor, &d.debtor, &d.amount, &d.afterDays, &schedule, &d.quietStart, &d.quietEnd)
+		if err != nil {
+			queryRows.Close()
+			return err
+		}
+		for _, days := range schedule {
+			d.schedule = append(d.schedule, int(days))
+		}
+		debts = append(debts, d)
+		creditors = append(creditors, d.creditor)
+		debtors = append(debtors, d.debtor)
+	}
+	queryRows.Close()
+	if err = queryRows.Err(); err != nil {
+		return err
+	}
+
+	// Debts that were settled, or fell under the threshold, get no more reminders
+	_, err = db.Db.ExecContext(ctx, `DELETE FROM reminder_state WHERE (creditor_id, debtor_id) NOT IN
+							(SELECT * FROM unnest($1::text[], $2::text[]))`, pq.Array(creditors), pq.Array(debtors))
+	if err != nil {
+		return err
+	}
+	for _, d := range debts {
+		if err = remindDebt(ctx, db.Db, d, time.Now()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// remindDebt Records that a debt is over the threshold and sends its next
+// reminder when it's due and not in the quiet hours of the person who owes
+func remindDebt(ctx context.Context, db *sql.DB, d debt, now time.Time) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var overSince time.Time
+	var sent int
+	var timeZone, creditorName string
+	err = tx.QueryRowContext(ctx, `INSERT INTO reminder_state (creditor_id, debtor_id, amount) VALUES ($1, $2, $3)
+								ON CONFLICT (creditor_id, debtor_id) DO UPDATE SET amount=$3
+								RETURNING over_since, sent,
+								    COALESCE((SELECT time_zone FROM notification_setting WHERE user_id=$2), 'UTC'),
+								    (SELECT name FROM account WHERE id=$1)`,
+		d.creditor, d.debtor, d.amount).Scan(&overSince, &sent, &timeZone, &creditorName)
+	if err != nil {
+		return err
+	}
+	if sent >= len(d.schedule) || now.Before(dueAt(overSince, d.afterDays, d.schedule[sent])) {
+		return tx.Commit()
+	}
+	location, err := time.LoadLocation(timeZone)
+	if err != nil {
+		location = time.UTC
+	}
+	if quiet(now.In(location).Hour(), d.quietStart, d.quietEnd) {
+		return tx.Commit()
+	}
+
+	if _, err = tx.ExecContext(ctx, "UPDATE reminder_state SET sent=sent+1 WHERE creditor_id=$1 AND debtor_id=$2",
+		d.creditor, d.debtor); err != nil {
+		return err
+	}
+	if _, err = tx.ExecContext(ctx, "INSERT INTO payment_reminder (creditor_id, debtor_id, amount, stage) VALUES ($1, $2, $3, $4)",
+		d.creditor, d.debtor, d.amount, sent); err != nil {
+		return err
+	}
+	if err = tx.Commit(); err != nil {
+		return err
+	}
+	n := message(creditorName, d.amount, overSince.In(location), sent, len(d.schedule))
+	n.UserID = d.debtor
+	notifications.Notify(db, n)
+	return nil
+}
+
+// quiet Whether hour falls in the quiet hours from start to end, which may
+// wrap around midnight
+func quiet(hour int, start int, end int) bool {
+	if start == end {
+		return false
+	}
+	if start < end {
+		return hour >= start && hour < end
+	}
+	return hour >= start || hour < end
+}
+
+// message The reminder for stage of a schedule with stages reminders in it.
+// The first is friendly and the last says it's the last.
+func message(creditor string, amount float64, since time.Time, stage int, stages int) notifications.Notification {
+	n := notifications.Notification{Type: notifications.PaymentReminder, Link: "/"}
+	switch {
+	case stage == 0:
+		n.Title = fmt.Sprintf("A friendly reminder from %s", creditor)
+		n.Body = fmt.Sprintf("You owe %s %.2f. Settle up whenever you get a chance.", creditor, amount)
+	case stage == stages-1:
+		n.Title = fmt.Sprintf("Last reminder: you owe %s %.2f", creditor, amount)
+		n.Body = fmt.Sprintf("You have owed %s since %s. This is the last reminder about it.",
+			creditor, since.Format("January 2"))
+	default:
+		n.Title = fmt.Sprintf("Reminder: you owe %s %.2f", creditor, amount)
+		n.Body = fmt.Sprintf("You have owed %s since %s.", creditor, since.Format("January 2"))
+	}
+	return n
+}
@@ -0,0 +1,102 @@
+package reminders
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestQuiet(t *testing.T) {
+	tests := []struct {
+		name       string
+		hour       int
+		start, end int
+		want       bool
+	}{
+		{"no quiet hours", 3, 0, 0, false},
+		{"before", 8, 9, 17, false},
+		{"from the start", 9, 9, 17, true},
+		{"until the end", 16, 9, 17, true},
+		{"not at the end", 17, 9, 17, false},
+		{"at the start", 21, 21, 8, true},
+		{"late evening", 23, 21, 8, true},
+		{"midnight", 0, 21, 8, true},
+		{"early morning", 7, 21, 8, true},
+		{"morning after", 8, 21, 8, false},
+		{"afternoon", 14, 21, 8, false},
+		{"just before the start", 20, 21, 8, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := quiet(tt.hour, tt.start, tt.end); got != tt.want {
+				t.Errorf("quiet(%d, %d, %d) = %v, want %v", tt.hour, tt.start, tt.end, got, tt.want)
+			}
+		})
+	}
+}
+
+// TestQuietInDebtorTimeZone The quiet hours are those of the person who owes,
+// wherever the server is. The job checks the hour of now in their time zone.
+func TestQuietInDebtorTimeZone(t *testing.T) {
+	kolkata, err := time.LoadLocation("Asia/Kolkata")
+	if err != nil {
+		t.Skip("no time zone database")
+	}
+	newYork, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skip("no time zone database")
+	}
+	local := time.Local
+	time.Local = newYork
+	t.Cleanup(func() { time.Local = local })
+
+	tests := []struct {
+		name     string
+		now      time.Time
+		location *time.Location
+		want     bool
+	}{
+		// 17:30 UTC is 13:30 in New York and 23:00 in Kolkata
+		{"night for the debtor, afternoon for the server", time.Date(2026, 3, 2, 17, 30, 0, 0, time.UTC), kolkata, true},
+		// 04:00 UTC is 23:00 in New York and 09:30 in Kolkata
+		{"morning for the debtor, night for the server", time.Date(2026, 3, 2, 4, 0, 0, 0, time.UTC), kolkata, false},
+		{"in the server's time zone", time.Date(2026, 3, 2, 4, 0, 0, 0, time.UTC), newYork, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := quiet(tt.now.In(tt.location).Hour(), 22, 7); got != tt.want {
+				t.Errorf("%v is quiet %v, want %v", tt.now.In(tt.location), got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMessage(t *testing.T) {
+	losAngeles, err := time.LoadLocation("America/Los_Angeles")
+	if err != nil {
+		t.Skip("no time zone database")
+	}
+	// Still February 28 for a debtor in Los Angeles
+	since := time.Date(2026, 3, 1, 2, 0, 0, 0, time.UTC).In(losAngeles)
+	tests := []struct {
+		name          string
+		stage, stages int
+		title, body   string
+	}{
+		{"first", 0, 3, "A friendly reminder from Alice", "You owe Alice 12.50. Settle up whenever you get a chance."},
+		{"middle", 1, 3, "Reminder: you owe Alice 12.50", "You have owed Alice since February 28."},
+		{"last", 2, 3, "Last reminder: you owe Alice 12.50", "You have owed Alice since February 28. This is the last reminder about it."},
+		{"only one", 0, 1, "A friendly reminder from Alice", "You owe Alice 12.50. Settle up whenever you get a chance."},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			n := message("Alice", 12.5, since, tt.stage, tt.stages)
+			if n.Title != tt.title || n.Body != tt.body {
+				t.Errorf("got %q: %q, want %q: %q", n.Title, n.Body, tt.title, tt.body)
+			}
+			if n.Link == "" || strings.Contains(n.Title+n.Body, "%!") {
+				t.Errorf("the reminder is malformed: %+v", n)
+			}
+		})
+	}
+}
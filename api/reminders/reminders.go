@@ -0,0 +1,320 @@
+package reminders
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+	"how-much-do-i-owe/database"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	maxSchedule = 10
+	maxDays     = 365
+
+	defaultQuietStart = 21
+	defaultQuietEnd   = 9
+)
+
+var defaultSchedule = []int{0, 7, 21}
+
+// rule When to remind people who owe the user money. A rule without a contact
+// is the user's default, a rule for a contact replaces it for that contact,
+// so a disabled one turns reminders off for them.
+//
+// The first reminder goes out once someone has owed at least Threshold for
+// AfterDays, and the following ones Schedule days after that, e.g. 0, 7, 21.
+// Nothing is sent from QuietStart to QuietEnd, hours in the time zone of the
+// person who owes.
+type rule struct {
+	ID         int       `json:"id"`
+	ContactID  *string   `json:"contactId"`
+	Threshold  float64   `json:"threshold"`
+	AfterDays  int       `json:"afterDays"`
+	Schedule   []int     `json:"schedule"`
+	QuietStart int       `json:"quietStart"`
+	QuietEnd   int       `json:"quietEnd"`
+	Enabled    bool      `json:"enabled"`
+	CreatedAt  time.Time `json:"createdAt"`
+}
+
+// ruleRequest Creates the rule for ContactID, or the default rule, or
+// replaces it. Missing fields get their defaults.
+type ruleRequest struct {
+	ContactID  *string `json:"contactId"`
+	Threshold  float64 `json:"threshold"`
+	AfterDays  int     `json:"afterDays"`
+	Schedule   []int   `json:"schedule"`
+	QuietStart *int    `json:"quietStart"`
+	QuietEnd   *int    `json:"quietEnd"`
+	Enabled    *bool   `json:"enabled"`
+}
+
+// status Someone who owes the user more than their rule allows, and how far
+// along the reminders are
+type status struct {
+	ContactID      string     `json:"contactId"`
+	Name           string     `json:"name"`
+	Amount         float64    `json:"amount"`
+	OverSince      time.Time  `json:"overSince"`
+	Sent           int        `json:"sent"`
+	LastRemindedAt *time.Time `json:"lastRemindedAt"`
+	NextReminderAt *time.Time `json:"nextReminderAt"`
+}
+
+// reminder A reminder that was sent
+type reminder struct {
+	ID        int       `json:"id"`
+	ContactID string    `json:"contactId"`
+	Name      string    `json:"name"`
+	Amount    float64   `json:"amount"`
+	Stage     int       `json:"stage"`
+	SentAt    time.Time `json:"sentAt"`
+}
+
+// Routes All the routes created by the package nested in
+// api/v1/*
+func Routes(r *gin.RouterGroup, db *database.DB) {
+	r.GET("/reminder-rules", getRules(db))
+	r.PUT("/reminder-rule", saveRule(db))
+	r.DELETE("/reminder-rule/:id", deleteRule(db))
+	r.GET("/reminders", getStatus(db))
+	r.GET("/reminders/history", getHistory(db))
+}
+
+const ruleQuery = `SELECT id, contact_id, threshold, after_days, schedule, quiet_start, quiet_end, enabled, created_at FROM reminder_rule`
+
+func scanRule(row interface{ Scan(...interface{}) error }) (rule, error) {
+	var r rule
+	var schedule pq.Int64Array
+	err := row.Scan(&r.ID, &r.ContactID, &r.Threshold, &r.AfterDays, &schedule, &r.QuietStart, &r.QuietEnd, &r.Enabled, &r.CreatedAt)
+	r.Schedule = make([]int, len(schedule))
+	for i, days := range schedule {
+		r.Schedule[i] = int(days)
+	}
+	return r, err
+}
+
+func getRules(db *database.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		queryRows, err := db.Db.Query(ruleQuery+" WHERE user_id=$1 ORDER BY contact_id NULLS FIRST", c.GetString("UserID"))
+		if err != nil {
+			database.CheckDBErr(err.(*pq.Error), c)
+			return
+		}
+		defer queryRows.Close()
+
+		rules := []rule{}
+		for queryRows.Next() {
+			r, err := scanRule(queryRows)
+			if err != nil {
+				c.AbortWithStatusJSON(500, "The server was unable to get reminder rules")
+				return
+			}
+			rules = append(rules, r)
+		}
+
+		c.JSON(200, rules)
+	}
+}
+
+// validRule Fills in the defaults of a request and responds when it isn't valid
+func validRule(c *gin.Context, req *ruleRequest) bool {
+	if req.Threshold <= 0 {
+		c.JSON(http.StatusBadRequest, "threshold must be more than 0")
+		return false
+	}
+	if req.AfterDays < 0 || req.AfterDays > maxDays {
+		c.JSON(http.StatusBadRequest, "afterDays must be between 0 and 365")
+		return false
+	}
+	if req.Schedule == nil {
+		req.Schedule = defaultSchedule
+	}
+	if len(req.Schedule) == 0 || len(req.Schedule) > maxSchedule {
+		c.JSON(http.StatusBadRequest, "schedule must have between 1 and 10 reminders")
+		return false
+	}
+	for i, days := range req.Schedule {
+		if days < 0 || days > maxDays || (i > 0 && days < req.Schedule[i-1]) {
+			c.JSON(http.StatusBadRequest, "schedule must be days from 0 to 365 in increasing order")
+			return false
+		}
+	}
+	if req.QuietStart == nil {
+		quietStart := defaultQuietStart
+		req.QuietStart = &quietStart
+	}
+	if req.QuietEnd == nil {
+		quietEnd := defaultQuietEnd
+		req.QuietEnd = &quietEnd
+	}
+	if *req.QuietStart < 0 || *req.QuietStart > 23 || *req.QuietEnd < 0 || *req.QuietEnd > 23 {
+		c.JSON(http.StatusBadRequest, "quiet hours must be between 0 and 23")
+		return false
+	}
+	if req.Enabled == nil {
+		enabled := true
+		req.Enabled = &enabled
+	}
+	return true
+}
+
+func saveRule(db *database.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.GetString("UserID")
+		var req ruleRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if !validRule(c, &req) {
+			return
+		}
+		if req.ContactID != nil {
+			var isContact, ghost bool
+			err := db.Db.QueryRow(`SELECT EXISTS(SELECT 1 FROM contact WHERE user_id=$1 AND contact_id=$2),
+       										EXISTS(SELECT 1 FROM ghost WHERE id=$2)`, userID, *req.ContactID).Scan(&isContact, &ghost)
+			if err != nil {
+				database.CheckDBErr(err.(*pq.Error), c)
+				return
+			}
+			if !isContact {
+				c.AbortWithStatusJSON(404, "Contact not found")
+				return
+			}
+			if ghost {
+				c.AbortWithStatusJSON(400, "Placeholders can't be reminded, they haven't signed up")
+				return
+			}
+		}
+
+		conflict := "(user_id) WHERE contact_id IS NULL"
+		if req.ContactID != nil {
+			conflict = "(user_id, contact_id) WHERE contact_id IS NOT NULL"
+		}
+		var id int
+		err := db.Db.QueryRow(`INSERT INTO reminder_rule (user_id, contact_id, threshold, after_days, schedule, quiet_start, quiet_end, enabled)
+								VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+								ON CONFLICT `+conflict+` DO UPDATE SET threshold=$3, after_days=$4, schedule=$5,
+								    quiet_start=$6, quiet_end=$7, enabled=$8
+								RETURNING id`,
+			userID, req.ContactID, req.Threshold, req.AfterDays, pq.Array(req.Schedule), *req.QuietStart, *req.QuietEnd,
+			*req.Enabled).Scan(&id)
+		if err != nil {
+			database.CheckDBErr(err.(*pq.Error), c)
+			return
+		}
+		r, err := scanRule(db.Db.QueryRow(ruleQuery+" WHERE id=$1", id))
+		if err != nil {
+			database.CheckDBErr(err.(*pq.Error), c)
+			return
+		}
+
+		c.JSON(201, r)
+	}
+}
+
+func deleteRule(db *database.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.JSON(400, "Invalid reminder rule ID")
+			return
+		}
+		result, err := db.Db.Exec("DELETE FROM reminder_rule WHERE id=$1 AND user_id=$2", id, c.GetString("UserID"))
+		if err != nil {
+			database.CheckDBErr(err.(*pq.Error), c)
+			return
+		}
+		if deleted, _ := result.RowsAffected(); deleted == 0 {
+			c.AbortWithStatusJSON(404, "Reminder rule not found")
+			return
+		}
+
+		c.JSON(201, id)
+	}
+}
+
+// getStatus Everyone who owes the user more than their rule allows, with when
+// they were last reminded and when the next reminder is due. Worked out by
+// the reminders job, so it can be a few minutes behind the balances.
+func getStatus(db *database.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.GetString("UserID")
+		queryRows, err := db.Db.Query(`SELECT s.debtor_id, COALESCE(NULLIF(c.nickname, ''), a.name), s.amount, s.over_since, s.sent,
+       				(SELECT max(sent_at) FROM payment_reminder p WHERE p.creditor_id = s.creditor_id AND p.debtor_id = s.debtor_id
+       				    AND p.sent_at >= s.over_since),
+       				r.after_days, r.schedule
+				FROM reminder_state s JOIN account a ON a.id = s.debtor_id
+				LEFT JOIN contact c ON c.user_id = s.creditor_id AND c.contact_id = s.debtor_id
+				JOIN LATERAL (SELECT after_days, schedule FROM reminder_rule
+				    WHERE user_id = s.creditor_id AND (contact_id = s.debtor_id OR contact_id IS NULL)
+				    ORDER BY contact_id NULLS LAST LIMIT 1) r ON true
+				WHERE s.creditor_id=$1 ORDER BY s.over_since`, userID)
+		if err != nil {
+			database.CheckDBErr(err.(*pq.Error), c)
+			return
+		}
+		defer queryRows.Close()
+
+		statuses := []status{}
+		for queryRows.Next() {
+			var s status
+			var afterDays int
+			var schedule pq.Int64Array
+			err = queryRows.Scan(&s.ContactID, &s.Name, &s.Amount, &s.OverSince, &s.Sent, &s.LastRemindedAt, &afterDays, &schedule)
+			if err != nil {
+				c.AbortWithStatusJSON(500, "The server was unable to get reminders")
+				return
+			}
+			if s.Sent < len(schedule) {
+				next := dueAt(s.OverSince, afterDays, int(schedule[s.Sent]))
+				s.NextReminderAt = &next
+			}
+			statuses = append(statuses, s)
+		}
+
+		c.JSON(200, statuses)
+	}
+}
+
+// getHistory The reminders the user sent, newest first, optionally only those
+// to one contact
+func getHistory(db *database.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var contactID *string
+		if c.Query("contactId") != "" {
+			id := c.Query("contactId")
+			contactID = &id
+		}
+		queryRows, err := db.Db.Query(`SELECT p.id, p.debtor_id, a.name, p.amount, p.stage, p.sent_at FROM payment_reminder p
+				JOIN account a ON a.id = p.debtor_id
+				WHERE p.creditor_id=$1 AND ($2::text IS NULL OR p.debtor_id=$2)
+				ORDER BY p.sent_at DESC LIMIT 200`, c.GetString("UserID"), contactID)
+		if err != nil {
+			database.CheckDBErr(err.(*pq.Error), c)
+			return
+		}
+		defer queryRows.Close()
+
+		reminders := []reminder{}
+		for queryRows.Next() {
+			var r reminder
+			if err = queryRows.Scan(&r.ID, &r.ContactID, &r.Name, &r.Amount, &r.Stage, &r.SentAt); err != nil {
+				c.AbortWithStatusJSON(500, "The server was unable to get reminders")
+				return
+			}
+			reminders = append(reminders, r)
+		}
+
+		c.JSON(200, reminders)
+	}
+}
+
+// dueAt When a reminder is due for a debt that went over the threshold at
+// overSince
+func dueAt(overSince time.Time, afterDays int, scheduleDays int) time.Time {
+	return overSince.AddDate(0, 0, afterDays+scheduleDays)
+}
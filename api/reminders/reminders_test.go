@@ -0,0 +1,35 @@
+package reminders
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDueAt(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Skip("no time zone database")
+	}
+	over := time.Date(2026, 1, 10, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name                    string
+		overSince               time.Time
+		afterDays, scheduleDays int
+		want                    time.Time
+	}{
+		{"right away", over, 0, 0, over},
+		{"after the grace period", over, 3, 0, time.Date(2026, 1, 13, 12, 0, 0, 0, time.UTC)},
+		{"a later stage", over, 3, 7, time.Date(2026, 1, 20, 12, 0, 0, 0, time.UTC)},
+		{"into the next month", over, 14, 14, time.Date(2026, 2, 7, 12, 0, 0, 0, time.UTC)},
+		// Days are calendar days where the debt went over, so the time of day
+		// stays the same across the change to summer time
+		{"across summer time", time.Date(2026, 3, 25, 9, 0, 0, 0, berlin), 7, 0, time.Date(2026, 4, 1, 9, 0, 0, 0, berlin)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := dueAt(tt.overSince, tt.afterDays, tt.scheduleDays); !got.Equal(tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,124 @@
+package search
+
+import (
+	"math"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// matchScore How well query matches the best of fields, 0 when it doesn't
+// match at all. A field starting with the query beats a word in it starting
+// with it, which beats the query appearing anywhere, which beats a near miss:
+// a typo in a word's beginning, or the letters in order like "jd" for John Doe.
+// An empty query matches everything equally.
+func matchScore(query string, fields ...string) float64 {
+	query = strings.ToLower(strings.TrimSpace(query))
+	if query == "" {
+		return 1
+	}
+	best := 0.0
+	for _, field := range fields {
+		field = strings.ToLower(field)
+		if field == "" {
+			continue
+		}
+		best = math.Max(best, fieldScore(query, field))
+	}
+	return best
+}
+
+func fieldScore(query string, field string) float64 {
+	if strings.HasPrefix(field, query) {
+		return 4
+	}
+	words := strings.FieldsFunc(field, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	for _, word := range words {
+		if strings.HasPrefix(word, query) {
+			return 3
+		}
+	}
+	if strings.Contains(field, query) {
+		return 2
+	}
+
+	q := []rune(query)
+	if len(q) >= 3 {
+		allowed := 1
+		if len(q) > 5 {
+			allowed = 2
+		}
+		for _, word := range words {
+			w := []rune(word)
+			if len(w) > len(q) {
+				w = w[:len(q)]
+			}
+			if d := distance(q, w); d <= allowed {
+				return 1.5 - float64(d)/float64(allowed+1)
+			}
+		}
+	}
+	if subsequence(q, []rune(field)) {
+		return 0.5
+	}
+	return 0
+}
+
+// distance The Levenshtein distance between a and b
+func distance(a []rune, b []rune) int {
+	previous := make([]int, len(b)+1)
+	current := make([]int, len(b)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		current[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			current[j] = min(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+		previous, current = current, previous
+	}
+	return previous[len(b)]
+}
+
+func min(values ...int) int {
+	m := values[0]
+	for _, v := range values[1:] {
+		if v < m {
+			m = v
+		}
+	}
+	return m
+}
+
+// subsequence If every rune of q appears in s in the same order
+func subsequence(q []rune, s []rune) bool {
+	i := 0
+	for _, r := range s {
+		if i < len(q) && r == q[i] {
+			i++
+		}
+	}
+	return i == len(q)
+}
+
+// activityScore How much the user has to do with someone or a group: more
+// transactions count for more, each one less than the last, and transactions
+// in the last few weeks count extra
+func activityScore(transactions int, last *time.Time, now time.Time) float64 {
+	score := math.Log1p(float64(transactions))
+	if last != nil {
+		days := now.Sub(*last).Hours() / 24
+		if days < 0 {
+			days = 0
+		}
+		score += 2 / (1 + days/14)
+	}
+	return score
+}
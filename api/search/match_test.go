@@ -0,0 +1,166 @@
+package search
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestFieldScore(t *testing.T) {
+	tests := []struct {
+		name         string
+		query, field string
+		want         float64
+	}{
+		{"prefix", "jo", "john doe", 4},
+		{"word prefix", "do", "john doe", 3},
+		{"anywhere", "hn", "john doe", 2},
+		{"typo", "jahn", "john doe", 1},
+		{"typo in a long query", "jonathon", "jonathan smith", 1.5 - 1.0/3},
+		{"two typos in a long query", "jonatohn", "jonathan smith", 1.5 - 2.0/3},
+		{"swapped letters are two typos", "smiht", "jonathan smithers", 0},
+		{"too many typos", "jxhx", "john doe", 0},
+		{"short queries need no typos", "jx", "john doe", 0},
+		{"letters in order", "jd", "john doe", 0.5},
+		{"letters out of order", "dj", "john doe", 0},
+		{"nothing in common", "xyz", "john doe", 0},
+		{"non-ASCII prefix", "zoë", "zoë martin", 4},
+		{"non-ASCII word prefix", "ćwi", "paweł ćwik", 3},
+		{"a missing accent is a typo", "zoe", "zoë martin", 1},
+		{"a missing stroke is a typo", "lukasz", "łukasz nowak", 1.5 - 1.0/3},
+		{"non-ASCII letters in order", "łn", "łukasz nowak", 0.5},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := fieldScore(tt.query, tt.field); math.Abs(got-tt.want) > 1e-9 {
+				t.Errorf("fieldScore(%q, %q) = %v, want %v", tt.query, tt.field, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMatchScore(t *testing.T) {
+	tests := []struct {
+		name   string
+		query  string
+		fields []string
+		want   float64
+	}{
+		{"empty query", " ", []string{"John Doe"}, 1},
+		{"ignores case and spaces", " JOHN ", []string{"john doe"}, 4},
+		{"best field", "doe", []string{"John Doe", "doe@example.com"}, 4},
+		{"empty fields", "doe", []string{"", "John Doe"}, 3},
+		{"no fields", "doe", nil, 0},
+		{"upper case non-ASCII", "ÉMILE", []string{"émile zola"}, 4},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := matchScore(tt.query, tt.fields...); got != tt.want {
+				t.Errorf("matchScore(%q, %q) = %v, want %v", tt.query, tt.fields, got, tt.want)
+			}
+		})
+	}
+}
+
+// TestMatchOrder Each kind of match beats the kinds after it
+func TestMatchOrder(t *testing.T) {
+	tests := []struct {
+		query string
+		names []string
+	}{
+		{"an", []string{"Anna Berg", "Joan Anderson", "Joan Smith", "Ivo Lind"}},
+		{"mart", []string{"Martin Jones", "Zoë Martens", "Lemart Ok", "Zoë Mertin", "Malik Ravat", "Zoë Berg"}},
+		{"ło", []string{"Łona Kowal", "Jan Łotocki", "Pawełoski Jan", "Łukasz Nowak", "Zoë Berg"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			for i := 1; i < len(tt.names); i++ {
+				better, worse := matchScore(tt.query, tt.names[i-1]), matchScore(tt.query, tt.names[i])
+				if better <= worse {
+					t.Errorf("%s scores %v, not more than %s with %v", tt.names[i-1], better, tt.names[i], worse)
+				}
+			}
+		})
+	}
+}
+
+func TestDistance(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"", "", 0},
+		{"abc", "", 3},
+		{"", "abc", 3},
+		{"john", "john", 0},
+		{"kitten", "sitting", 3},
+		{"flaw", "lawn", 2},
+		{"jhon", "john", 2},
+		{"zoe", "zoë", 1},
+		{"łukasz", "lukasz", 1},
+	}
+	for _, tt := range tests {
+		if got := distance([]rune(tt.a), []rune(tt.b)); got != tt.want {
+			t.Errorf("distance(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestSubsequence(t *testing.T) {
+	tests := []struct {
+		q, s string
+		want bool
+	}{
+		{"", "john", true},
+		{"jd", "john doe", true},
+		{"jne", "john doe", true},
+		{"dj", "john doe", false},
+		{"jdd", "john doe", false},
+		{"zm", "zoë martin", true},
+		{"ëm", "zoë martin", true},
+		{"em", "zoë martin", false},
+	}
+	for _, tt := range tests {
+		if got := subsequence([]rune(tt.q), []rune(tt.s)); got != tt.want {
+			t.Errorf("subsequence(%q, %q) = %v, want %v", tt.q, tt.s, got, tt.want)
+		}
+	}
+}
+
+func TestActivityScore(t *testing.T) {
+	now := time.Date(2026, 6, 15, 12, 0, 0, 0, time.UTC)
+	at := func(daysAgo int) *time.Time {
+		t := now.AddDate(0, 0, -daysAgo)
+		return &t
+	}
+	tests := []struct {
+		name         string
+		transactions int
+		last         *time.Time
+		want         float64
+	}{
+		{"nothing", 0, nil, 0},
+		{"one long ago", 1, nil, math.Log(2)},
+		{"one today", 1, at(0), math.Log(2) + 2},
+		{"two weeks ago", 1, at(14), math.Log(2) + 1},
+		{"six weeks ago", 1, at(42), math.Log(2) + 0.5},
+		{"in the future", 1, at(-3), math.Log(2) + 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := activityScore(tt.transactions, tt.last, now); math.Abs(got-tt.want) > 1e-9 {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	// Each transaction counts for less than the one before
+	if first, tenth := activityScore(1, nil, now)-activityScore(0, nil, now),
+		activityScore(10, nil, now)-activityScore(9, nil, now); first <= tenth || tenth <= 0 {
+		t.Errorf("the first transaction adds %v and the tenth %v", first, tenth)
+	}
+	// Recent activity beats a little more activity long ago
+	if activityScore(3, at(1), now) <= activityScore(5, at(90), now) {
+		t.Error("recent transactions should count extra")
+	}
+}
@@ -0,0 +1,152 @@
+package search
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+	"how-much-do-i-owe/database"
+	"sort"
+	"strconv"
+	"time"
+)
+
+const (
+	defaultLimit = 10
+	maxLimit     = 50
+
+	typeContact = "contact"
+	typeGroup   = "group"
+)
+
+// result A contact or group matching a search. Members is only set for groups.
+type result struct {
+	Type            string     `json:"type"`
+	ID              string     `json:"id"`
+	Name            string     `json:"name"`
+	Nickname        string     `json:"nickname"`
+	Email           string     `json:"email"`
+	Ghost           bool       `json:"ghost"`
+	Members         []string   `json:"members"`
+	Transactions    int        `json:"transactions"`
+	LastTransaction *time.Time `json:"lastTransaction"`
+
+	score float64
+}
+
+// Routes All the routes created by the package nested in
+// api/v1/*
+func Routes(r *gin.RouterGroup, db *database.DB) {
+	r.GET("/search", search(db))
+}
+
+// contactQuery The contacts of the user $1, with how many transactions they
+// share and when the last one was
+const contactQuery = `WITH mine AS (
+    SELECT id, timestamp FROM transaction WHERE payer=$1
+    UNION
+    SELECT t.id, t.timestamp FROM transaction t
+        JOIN transaction_participants p ON p.transaction_id = t.id WHERE p.user_id=$1
+), shared AS (
+    SELECT who, count(DISTINCT id) AS n, max(timestamp) AS last FROM (
+        SELECT m.id, m.timestamp, p.user_id AS who FROM mine m JOIN transaction_participants p ON p.transaction_id = m.id
+        UNION ALL
+        SELECT m.id, m.timestamp, t.payer FROM mine m JOIN transaction t ON t.id = m.id
+    ) involved GROUP BY who
+)
+SELECT c.contact_id, a.name, c.nickname, COALESCE(g.email, a.email), g.id IS NOT NULL, COALESCE(s.n, 0), s.last
+FROM contact c JOIN account a ON a.id = c.contact_id
+LEFT JOIN ghost g ON g.id = c.contact_id
+LEFT JOIN shared s ON s.who = c.contact_id
+WHERE c.user_id=$1`
+
+// groupQuery The groups of the user $1 with their members and transactions
+const groupQuery = `SELECT g.id, g.name,
+       (SELECT array_agg(user_id ORDER BY joined_at) FROM group_member WHERE group_id = g.id),
+       count(t.id), max(t.timestamp)
+FROM expense_group g JOIN group_member m ON m.group_id = g.id AND m.user_id=$1
+LEFT JOIN transaction t ON t.group_id = g.id
+GROUP BY g.id`
+
+// search Finds the user's contacts and groups by name, nickname or email for
+// autocomplete. Matches are ranked by how well they match together with how
+// often and how recently the user shares transactions with them.
+func search(db *database.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.GetString("UserID")
+		query := c.Query("q")
+		limit := defaultLimit
+		if c.Query("limit") != "" {
+			var err error
+			if limit, err = strconv.Atoi(c.Query("limit")); err != nil || limit < 1 {
+				c.JSON(400, "limit must be a positive number")
+				return
+			}
+			if limit > maxLimit {
+				limit = maxLimit
+			}
+		}
+		only := c.Query("type")
+		if only != "" && only != typeContact && only != typeGroup {
+			c.JSON(400, "type must be contact or group")
+			return
+		}
+
+		now := time.Now()
+		results := []result{}
+		if only != typeGroup {
+			queryRows, err := db.Db.Query(contactQuery, userID)
+			if err != nil {
+				database.CheckDBErr(err.(*pq.Error), c)
+				return
+			}
+			for queryRows.Next() {
+				r := result{Type: typeContact}
+				err = queryRows.Scan(&r.ID, &r.Name, &r.Nickname, &r.Email, &r.Ghost, &r.Transactions, &r.LastTransaction)
+				if err != nil {
+					queryRows.Close()
+					c.AbortWithStatusJSON(500, "The server was unable to search contacts")
+					return
+				}
+				if match := matchScore(query, r.Nickname, r.Name, r.Email); match > 0 {
+					r.score = 1.5*match + activityScore(r.Transactions, r.LastTransaction, now)
+					results = append(results, r)
+				}
+			}
+			queryRows.Close()
+		}
+		if only != typeContact {
+			queryRows, err := db.Db.Query(groupQuery, userID)
+			if err != nil {
+				database.CheckDBErr(err.(*pq.Error), c)
+				return
+			}
+			for queryRows.Next() {
+				r := result{Type: typeGroup}
+				var id int
+				err = queryRows.Scan(&id, &r.Name, pq.Array(&r.Members), &r.Transactions, &r.LastTransaction)
+				if err != nil {
+					queryRows.Close()
+					c.AbortWithStatusJSON(500, "The server was unable to search groups")
+					return
+				}
+				r.ID = strconv.Itoa(id)
+				if match := matchScore(query, r.Name); match > 0 {
+					r.score = 1.5*match + activityScore(r.Transactions, r.LastTransaction, now)
+					results = append(results, r)
+				}
+			}
+			queryRows.Close()
+		}
+
+		sort.SliceStable(results, func(i, j int) bool {
+			if results[i].score != results[j].score {
+				return results[i].score > results[j].score
+			}
+			return results[i].Name < results[j].Name
+		})
+		if len(results) > limit {
+			results = results[:limit]
+		}
+
+		c.JSON(200, results)
+	}
+}
@@ -0,0 +1,112 @@
+package shares
+
+import (
+	"bytes"
+	"database/sql"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"how-much-do-i-owe/database"
+	"html/template"
+)
+
+const notFound = "This link doesn't exist, has expired or was revoked"
+
+// private Keeps shared pages out of caches, search engines and the Referer
+// header of links on them
+func private(c *gin.Context) {
+	c.Header("Cache-Control", "no-store")
+	c.Header("Referrer-Policy", "no-referrer")
+	c.Header("X-Robots-Tag", "noindex")
+}
+
+func getShared(db *database.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		private(c)
+		s, err := load(db, c.Param("token"))
+		if err == sql.ErrNoRows {
+			c.AbortWithStatusJSON(404, notFound)
+			return
+		}
+		if err != nil {
+			database.RespondErr(err, c)
+			return
+		}
+		c.JSON(200, s)
+	}
+}
+
+// getSharedPage What a share link shows as a page, for people opening it in
+// a browser
+func getSharedPage(db *database.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		private(c)
+		s, err := load(db, c.Param("token"))
+		if err == sql.ErrNoRows {
+			c.Data(404, "text/html; charset=utf-8", []byte("<!DOCTYPE html><title>Link not found</title><p>"+notFound+"</p>"))
+			return
+		}
+		if err != nil {
+			c.Data(503, "text/html; charset=utf-8", []byte("<!DOCTYPE html><title>Try again later</title><p>The server was unable to load this page</p>"))
+			return
+		}
+		var page bytes.Buffer
+		if err = pageTemplate.Execute(&page, s); err != nil {
+			c.AbortWithStatus(500)
+			return
+		}
+		c.Data(200, "text/html; charset=utf-8", page.Bytes())
+	}
+}
+
+var pageTemplate = template.Must(template.New("shared").Funcs(template.FuncMap{
+	"money":  func(amount float64) string { return fmt.Sprintf("%.2f", amount) },
+	"negate": func(amount float64) float64 { return -amount },
+}).Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<meta name="robots" content="noindex">
+<title>{{if .Title}}{{.Title}}{{else if .Group}}{{.Group}}{{else}}Shared expenses{{end}} · how much do i owe?</title>
+<style>
+body { font-family: sans-serif; max-width: 48rem; margin: 2rem auto; padding: 0 1rem; color: #222; }
+table { border-collapse: collapse; width: 100%; margin-bottom: 2rem; }
+th, td { text-align: left; padding: .4rem; border-bottom: 1px solid #ddd; vertical-align: top; }
+td.amount, th.amount { text-align: right; white-space: nowrap; }
+.muted { color: #777; font-size: .9rem; }
+</style>
+</head>
+<body>
+<h1>{{if .Title}}{{.Title}}{{else if .Group}}{{.Group}}{{else}}Shared expenses{{end}}</h1>
+<p class="muted">{{money .Total}} spent{{if and .Title .Group}} in {{.Group}}{{end}}
+{{- if .From}} from {{.From.Format "2 Jan 2006"}}{{end}}
+{{- if .To}} until {{.To.Format "2 Jan 2006"}}{{end}} · this link works until {{.ExpiresAt.Format "2 Jan 2006"}}</p>
+
+<h2>Who pays whom</h2>
+{{if .Payments}}
+<table>
+{{range .Payments}}<tr><td>{{.From}} pays {{.To}}</td><td class="amount">{{money .Amount}}</td></tr>
+{{end}}</table>
+{{else}}<p>Everyone is settled up.</p>{{end}}
+
+<h2>People</h2>
+<table>
+<tr><th>Name</th><th class="amount">Paid</th><th class="amount">Share</th><th class="amount">Balance</th></tr>
+{{range .People}}<tr><td>{{.Name}}{{if .Email}} <span class="muted">{{.Email}}</span>{{end}}</td>
+<td class="amount">{{money .Paid}}</td><td class="amount">{{money .Share}}</td>
+<td class="amount">{{if lt .Balance 0.0}}owes {{money (negate .Balance)}}{{else if gt .Balance 0.0}}is owed {{money .Balance}}{{else}}settled{{end}}</td></tr>
+{{end}}</table>
+
+<h2>Transactions</h2>
+<table>
+<tr><th>Date</th><th>Description</th><th>Paid by</th><th class="amount">Amount</th></tr>
+{{range .Transactions}}<tr><td>{{.Timestamp.Format "2 Jan 2006"}}</td>
+<td>{{if eq .SplitType "settlement"}}Settlement{{if .Description}}: {{.Description}}{{end}}{{else}}{{.Description}}{{end}}
+<div class="muted">{{range $i, $s := .Shares}}{{if $i}}, {{end}}{{$s.Name}} {{money $s.Amount}}{{end}}</div></td>
+<td>{{.PaidBy}}</td><td class="amount">{{money .Amount}}</td></tr>
+{{else}}<tr><td colspan="4">No transactions yet.</td></tr>
+{{end}}</table>
+<p class="muted">Shared from how much do i owe?</p>
+</body>
+</html>
+`))
@@ -0,0 +1,183 @@
+package shares
+
+import (
+	"database/sql"
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+	"how-much-do-i-owe/api/groups"
+	"how-much-do-i-owe/database"
+	"how-much-do-i-owe/mail"
+	"how-much-do-i-owe/secrets"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// defaultExpiry How long a link works when the user doesn't say
+	defaultExpiry = 30 * 24 * time.Hour
+	// maxExpiry The longest a link can work for
+	maxExpiry = 365 * 24 * time.Hour
+)
+
+// shareLink A read-only link to the transactions of a group, a date range, or
+// a date range in a group. URL is only returned when the link is created,
+// just the hash of its token is kept.
+type shareLink struct {
+	ID           int        `json:"id"`
+	Title        string     `json:"title"`
+	GroupID      *int       `json:"groupId"`
+	From         *time.Time `json:"from"`
+	To           *time.Time `json:"to"`
+	ShowEmails   bool       `json:"showEmails"`
+	ExpiresAt    time.Time  `json:"expiresAt"`
+	RevokedAt    *time.Time `json:"revokedAt"`
+	Views        int        `json:"views"`
+	LastViewedAt *time.Time `json:"lastViewedAt"`
+	CreatedAt    time.Time  `json:"createdAt"`
+	URL          string     `json:"url,omitempty"`
+}
+
+type shareLinkRequest struct {
+	Title      string     `json:"title"`
+	GroupID    *int       `json:"groupId"`
+	From       *time.Time `json:"from"`
+	To         *time.Time `json:"to"`
+	ShowEmails bool       `json:"showEmails"`
+	ExpiresAt  *time.Time `json:"expiresAt"`
+}
+
+// Routes All the routes created by the package nested in
+// api/v1/*
+func Routes(r *gin.RouterGroup, db *database.DB) {
+	r.GET("/share-links", getShareLinks(db))
+	r.PUT("/share-link", createShareLink(db))
+	r.DELETE("/share-link/:id", revokeShareLink(db))
+}
+
+// PublicRoutes The routes share links open, which anyone with the link can
+// see without a session. The token in the link is all that's checked.
+func PublicRoutes(r *gin.RouterGroup, db *database.DB) {
+	r.GET("/api/v1/shared/:token", getShared(db))
+	r.GET("/shared/:token", getSharedPage(db))
+}
+
+const shareLinkQuery = `SELECT id, title, group_id, starts_at, ends_at, show_emails, expires_at, revoked_at, views,
+       last_viewed_at, created_at FROM share_link`
+
+func scanShareLink(row interface{ Scan(...interface{}) error }) (shareLink, error) {
+	var l shareLink
+	err := row.Scan(&l.ID, &l.Title, &l.GroupID, &l.From, &l.To, &l.ShowEmails, &l.ExpiresAt, &l.RevokedAt, &l.Views,
+		&l.LastViewedAt, &l.CreatedAt)
+	return l, err
+}
+
+// getShareLinks The user's links, revoked and expired ones included so they
+// can see who looked at them
+func getShareLinks(db *database.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		queryRows, err := db.Db.Query(shareLinkQuery+" WHERE user_id=$1 ORDER BY created_at DESC", c.GetString("UserID"))
+		if err != nil {
+			database.CheckDBErr(err.(*pq.Error), c)
+			return
+		}
+		defer queryRows.Close()
+
+		links := []shareLink{}
+		for queryRows.Next() {
+			l, err := scanShareLink(queryRows)
+			if err != nil {
+				c.AbortWithStatusJSON(500, "The server was unable to get share links")
+				return
+			}
+			links = append(links, l)
+		}
+
+		c.JSON(200, links)
+	}
+}
+
+func createShareLink(db *database.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.GetString("UserID")
+		var req shareLinkRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		req.Title = strings.TrimSpace(req.Title)
+		if len(req.Title) > 200 {
+			c.JSON(http.StatusBadRequest, "title can be at most 200 characters")
+			return
+		}
+		if req.GroupID == nil && (req.From == nil || req.To == nil) {
+			c.JSON(http.StatusBadRequest, "A share link needs a groupId, or both from and to")
+			return
+		}
+		if req.From != nil && req.To != nil && !req.From.Before(*req.To) {
+			c.JSON(http.StatusBadRequest, "from must be before to")
+			return
+		}
+		now := time.Now()
+		expiresAt := now.Add(defaultExpiry)
+		if req.ExpiresAt != nil {
+			expiresAt = *req.ExpiresAt
+		}
+		if !expiresAt.After(now) || expiresAt.After(now.Add(maxExpiry)) {
+			c.JSON(http.StatusBadRequest, "expiresAt must be in the next year")
+			return
+		}
+		if req.GroupID != nil {
+			isMember, err := groups.Members(db.Db, *req.GroupID, []string{userID})
+			if err != nil {
+				database.CheckDBErr(err.(*pq.Error), c)
+				return
+			}
+			if !isMember {
+				c.AbortWithStatusJSON(404, "Group not found")
+				return
+			}
+		}
+
+		rawToken, err := secrets.NewToken("")
+		if err != nil {
+			c.AbortWithStatusJSON(500, "The server was unable to generate a link")
+			return
+		}
+		l, err := scanShareLink(db.Db.QueryRow(`INSERT INTO share_link (user_id, token_hash, title, group_id, starts_at, ends_at,
+                        show_emails, expires_at) VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+						RETURNING id, title, group_id, starts_at, ends_at, show_emails, expires_at, revoked_at, views,
+						    last_viewed_at, created_at`,
+			userID, secrets.HashToken(rawToken), req.Title, req.GroupID, req.From, req.To, req.ShowEmails, expiresAt))
+		if err != nil {
+			database.CheckDBErr(err.(*pq.Error), c)
+			return
+		}
+		l.URL = mail.Link("/shared/" + rawToken)
+
+		c.JSON(201, l)
+	}
+}
+
+func revokeShareLink(db *database.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.JSON(400, "Invalid share link ID")
+			return
+		}
+		err = db.Db.QueryRow(`UPDATE share_link SET revoked_at=now() WHERE id=$1 AND user_id=$2 AND revoked_at IS NULL
+								RETURNING id`, id, c.GetString("UserID")).Scan(&id)
+		if err == sql.ErrNoRows {
+			c.AbortWithStatusJSON(404, "Share link not found")
+			return
+		}
+		if err != nil {
+			database.CheckDBErr(err.(*pq.Error), c)
+			return
+		}
+
+		c.JSON(201, id)
+	}
+}
@@ -0,0 +1,107 @@
+package shares
+
+import (
+	"bytes"
+	"how-much-do-i-owe/money"
+	"strings"
+	"testing"
+	"time"
+)
+
+// trip Alice paid 90 for a dinner split three ways, Bob paid 30 for taxis
+// split with Carol, and Carol paid Alice back 10
+func trip(showEmails bool) *ledger {
+	l := newLedger(showEmails)
+	l.add("alice", "Alice", "alice@example.com", "alice", "Alice", "alice@example.com", 3000, false)
+	l.add("alice", "Alice", "alice@example.com", "bob", "Bob", "bob@example.com", 3000, false)
+	l.add("alice", "Alice", "alice@example.com", "carol", "Carol", "carol@example.com", 3000, false)
+	l.add("bob", "Bob", "bob@example.com", "bob", "Bob", "bob@example.com", 1500, false)
+	l.add("bob", "Bob", "bob@example.com", "carol", "Carol", "carol@example.com", 1500, false)
+	l.add("carol", "Carol", "carol@example.com", "alice", "Alice", "alice@example.com", 1000, true)
+	return l
+}
+
+func TestSummary(t *testing.T) {
+	people, payments := trip(false).summary()
+	want := []sharedPerson{
+		{Name: "Alice", Paid: 90, Share: 30, Balance: 50},
+		{Name: "Bob", Paid: 30, Share: 45, Balance: -15},
+		{Name: "Carol", Paid: 0, Share: 45, Balance: -35},
+	}
+	if len(people) != len(want) {
+		t.Fatalf("got %v, want %v", people, want)
+	}
+	for i := range want {
+		if people[i] != want[i] {
+			t.Errorf("got %+v, want %+v", people[i], want[i])
+		}
+	}
+	wantPayments := []sharedPayment{{"Carol", "Alice", 35}, {"Bob", "Alice", 15}}
+	if len(payments) != len(wantPayments) {
+		t.Fatalf("got payments %v, want %v", payments, wantPayments)
+	}
+	for i := range wantPayments {
+		if payments[i] != wantPayments[i] {
+			t.Errorf("got payment %+v, want %+v", payments[i], wantPayments[i])
+		}
+	}
+}
+
+func TestSettleUp(t *testing.T) {
+	people := []sharedPerson{{Name: "A"}, {Name: "B"}, {Name: "C"}, {Name: "D"}, {Name: "E"}}
+	balances := []int64{1001, -334, -333, -334, 0}
+	payments := settleUp(people, balances)
+	if len(payments) != 3 {
+		t.Fatalf("got %v, want three payments to A", payments)
+	}
+	var total int64
+	for _, p := range payments {
+		if p.To != "A" {
+			t.Errorf("%s pays %s, only A is owed", p.From, p.To)
+		}
+		total += money.ToCents(p.Amount)
+	}
+	if total != 1001 {
+		t.Errorf("the payments add up to %d cents, want 1001", total)
+	}
+	if len(settleUp(people, make([]int64, len(people)))) != 0 {
+		t.Error("nobody pays when everyone is settled up")
+	}
+}
+
+func TestEmailsAreRedacted(t *testing.T) {
+	people, _ := trip(false).summary()
+	for _, p := range people {
+		if p.Email != "" {
+			t.Errorf("%s's email is shown", p.Name)
+		}
+	}
+	people, _ = trip(true).summary()
+	if people[0].Email != "alice@example.com" {
+		t.Error("emails should be shown when the owner allowed it")
+	}
+}
+
+func TestPage(t *testing.T) {
+	people, payments := trip(false).summary()
+	s := shared{
+		Title:     "Lisbon <3",
+		Group:     "Lisbon",
+		ExpiresAt: time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC),
+		Total:     120,
+		Transactions: []sharedTransaction{{Timestamp: time.Date(2029, 6, 1, 20, 0, 0, 0, time.UTC),
+			Description: "Dinner", Amount: 90, PaidBy: "Alice", SplitType: "equal",
+			Shares: []sharedShare{{"Alice", 30}, {"Bob", 30}, {"Carol", 30}}}},
+		People:   people,
+		Payments: payments,
+	}
+	var page bytes.Buffer
+	if err := pageTemplate.Execute(&page, s); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"Lisbon &lt;3", "120.00 spent in Lisbon", "Carol pays Alice", "owes 35.00", "Alice 30.00, Bob 30.00"} {
+		if !strings.Contains(page.String(), want) {
+			t.Errorf("the page doesn't say %q", want)
+		}
+	}
+}
@@ -0,0 +1,240 @@
+package shares
+
+import (
+	"database/sql"
+	"how-much-do-i-owe/api/groups"
+	"how-much-do-i-owe/database"
+	"how-much-do-i-owe/money"
+	"how-much-do-i-owe/secrets"
+	"sort"
+	"time"
+)
+
+// shared What a share link shows: the transactions in its scope, what
+// everyone in them paid and owes, and the payments that settle everyone up.
+// Settlements are listed too, and count towards the balances. Total is what
+// was spent, settlements left out.
+type shared struct {
+	Title        string              `json:"title"`
+	Group        string              `json:"group"`
+	From         *time.Time          `json:"from"`
+	To           *time.Time          `json:"to"`
+	ExpiresAt    time.Time           `json:"expiresAt"`
+	Total        float64             `json:"total"`
+	Transactions []sharedTransaction `json:"transactions"`
+	People       []sharedPerson      `json:"people"`
+	Payments     []sharedPayment     `json:"payments"`
+}
+
+type sharedTransaction struct {
+	Timestamp   time.Time     `json:"timestamp"`
+	Description string        `json:"description"`
+	Amount      float64       `json:"amount"`
+	PaidBy      string        `json:"paidBy"`
+	SplitType   string        `json:"splitType"`
+	Shares      []sharedShare `json:"shares"`
+}
+
+type sharedShare struct {
+	Name   string  `json:"name"`
+	Amount float64 `json:"amount"`
+}
+
+// sharedPerson Someone in the transactions of a share link. Paid and Share
+// are of the expenses, Balance is positive when they are owed money. Email is
+// left out unless the owner of the link allowed it.
+type sharedPerson struct {
+	Name    string  `json:"name"`
+	Email   string  `json:"email,omitempty"`
+	Paid    float64 `json:"paid"`
+	Share   float64 `json:"share"`
+	Balance float64 `json:"balance"`
+}
+
+// sharedPayment One of the payments that settles everyone up
+type sharedPayment struct {
+	From   string  `json:"from"`
+	To     string  `json:"to"`
+	Amount float64 `json:"amount"`
+}
+
+// sharedQuery The transactions of a group, or of the owner when there's no
+// group, in a date range when it's set. One row per participant.
+const sharedQuery = `SELECT t.id, t.timestamp, t.description, t.split_type, t.payer, pa.name, pa.email,
+       tp.user_id, a.name, a.email, tp.dollar_share FROM transaction t
+    JOIN account pa ON pa.id = t.payer
+    JOIN transaction_participants tp ON tp.transaction_id = t.id
+    JOIN account a ON a.id = tp.user_id
+    WHERE ($2::integer IS NULL OR t.group_id=$2)
+      AND ($2::integer IS NOT NULL OR t.payer=$1
+        OR EXISTS(SELECT 1 FROM transaction_participants o WHERE o.transaction_id = t.id AND o.user_id=$1))
+      AND ($3::timestamptz IS NULL OR t.timestamp >= $3)
+      AND ($4::timestamptz IS NULL OR t.timestamp < $4)
+    ORDER BY t.timestamp, t.id, a.name`
+
+// load What the link with rawToken shows, and counts the view. Fails with
+// sql.ErrNoRows for links that don't exist, expired or were revoked, and
+// links to a group their owner has left.
+func load(db *database.DB, rawToken string) (shared, error) {
+	var s shared
+	var ownerID string
+	var groupID *int
+	var showEmails bool
+	err := db.Db.QueryRow(`UPDATE share_link SET views = views + 1, last_viewed_at=now()
+							WHERE token_hash=$1 AND revoked_at IS NULL AND expires_at > now()
+							RETURNING user_id, title, group_id, starts_at, ends_at, show_emails, expires_at`,
+		secrets.HashToken(rawToken)).Scan(&ownerID, &s.Title, &groupID, &s.From, &s.To, &showEmails, &s.ExpiresAt)
+	if err != nil {
+		return s, err
+	}
+	if groupID != nil {
+		isMember, err := groups.Members(db.Db, *groupID, []string{ownerID})
+		if err != nil {
+			return s, err
+		}
+		if !isMember {
+			return s, sql.ErrNoRows
+		}
+		if err = db.Db.QueryRow("SELECT name FROM expense_group WHERE id=$1", *groupID).Scan(&s.Group); err != nil {
+			return s, err
+		}
+	}
+
+	queryRows, err := db.Db.Query(sharedQuery, ownerID, groupID, s.From, s.To)
+	if err != nil {
+		return s, err
+	}
+	defer queryRows.Close()
+
+	s.Transactions = []sharedTransaction{}
+	people := newLedger(showEmails)
+	lastID := ""
+	for queryRows.Next() {
+		var id, payerID, payerName, payerEmail, userID, name, email string
+		var t sharedTransaction
+		var share float64
+		err = queryRows.Scan(&id, &t.Timestamp, &t.Description, &t.SplitType, &payerID, &payerName, &payerEmail,
+			&userID, &name, &email, &share)
+		if err != nil {
+			return s, err
+		}
+		if id != lastID {
+			t.PaidBy = payerName
+			t.Shares = []sharedShare{}
+			s.Transactions = append(s.Transactions, t)
+			lastID = id
+		}
+		current := &s.Transactions[len(s.Transactions)-1]
+		current.Shares = append(current.Shares, sharedShare{Name: name, Amount: share})
+		current.Amount = money.FromCents(money.ToCents(current.Amount) + money.ToCents(share))
+		people.add(payerID, payerName, payerEmail, userID, name, email, money.ToCents(share), t.SplitType == "settlement")
+	}
+	if err = queryRows.Err(); err != nil {
+		return s, err
+	}
+
+	for _, t := range s.Transactions {
+		if t.SplitType != "settlement" {
+			s.Total = money.FromCents(money.ToCents(s.Total) + money.ToCents(t.Amount))
+		}
+	}
+	s.People, s.Payments = people.summary()
+	return s, nil
+}
+
+// ledger What everyone in a share link paid, owes and is owed, in cents
+type ledger struct {
+	showEmails bool
+	order      []string
+	people     map[string]*sharedPerson
+	paid       map[string]int64
+	share      map[string]int64
+	balance    map[string]int64
+}
+
+func newLedger(showEmails bool) *ledger {
+	return &ledger{
+		showEmails: showEmails,
+		people:     make(map[string]*sharedPerson),
+		paid:       make(map[string]int64),
+		share:      make(map[string]int64),
+		balance:    make(map[string]int64),
+	}
+}
+
+func (l *ledger) person(id string, name string, email string) {
+	if _, ok := l.people[id]; ok {
+		return
+	}
+	p := &sharedPerson{Name: name}
+	if l.showEmails {
+		p.Email = email
+	}
+	l.people[id] = p
+	l.order = append(l.order, id)
+}
+
+// add Records that payerID paid cents of userID's share of a transaction
+func (l *ledger) add(payerID, payerName, payerEmail, userID, name, email string, cents int64, settlement bool) {
+	l.person(payerID, payerName, payerEmail)
+	l.person(userID, name, email)
+	l.balance[payerID] += cents
+	l.balance[userID] -= cents
+	if !settlement {
+		l.paid[payerID] += cents
+		l.share[userID] += cents
+	}
+}
+
+// summary Everyone in the order they first appeared, and who pays whom
+func (l *ledger) summary() ([]sharedPerson, []sharedPayment) {
+	people := make([]sharedPerson, 0, len(l.order))
+	balances := make([]int64, 0, len(l.order))
+	for _, id := range l.order {
+		p := *l.people[id]
+		p.Paid, p.Share, p.Balance = money.FromCents(l.paid[id]), money.FromCents(l.share[id]), money.FromCents(l.balance[id])
+		people = append(people, p)
+		balances = append(balances, l.balance[id])
+	}
+	return people, settleUp(people, balances)
+}
+
+// settleUp Payments that bring every balance to zero. The people who owe the
+// most pay the people who are owed the most first, which keeps the number of
+// payments low: at most one less than the people with a balance.
+func settleUp(people []sharedPerson, balances []int64) []sharedPayment {
+	type party struct {
+		name  string
+		cents int64
+	}
+	var owed, owing []party
+	for i, cents := range balances {
+		if cents > 0 {
+			owed = append(owed, party{people[i].Name, cents})
+		} else if cents < 0 {
+			owing = append(owing, party{people[i].Name, -cents})
+		}
+	}
+	for _, parties := range [][]party{owed, owing} {
+		parties := parties
+		sort.SliceStable(parties, func(i, j int) bool { return parties[i].cents > parties[j].cents })
+	}
+
+	payments := []sharedPayment{}
+	for i, j := 0, 0; i < len(owing) && j < len(owed); {
+		cents := owing[i].cents
+		if owed[j].cents < cents {
+			cents = owed[j].cents
+		}
+		payments = append(payments, sharedPayment{From: owing[i].name, To: owed[j].name, Amount: money.FromCents(cents)})
+		owing[i].cents -= cents
+		owed[j].cents -= cents
+		if owing[i].cents == 0 {
+			i++
+		}
+		if owed[j].cents == 0 {
+			j++
+		}
+	}
+	return payments
+}
@@ -0,0 +1,176 @@
+package statements
+
+import (
+	"database/sql"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+	"how-much-do-i-owe/api/groups"
+	"how-much-do-i-owe/database"
+	"strconv"
+	"time"
+)
+
+// subscription A group the user gets monthly statements for by email.
+// LastSent is the last month one was sent for.
+type subscription struct {
+	GroupID   int       `json:"groupId"`
+	Group     string    `json:"group"`
+	LastSent  *string   `json:"lastSent"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// Routes All the routes created by the package nested in
+// api/v1/*
+func Routes(r *gin.RouterGroup, db *database.DB) {
+	r.GET("/group/:id/statement", getStatement(db))
+	r.GET("/statement-subscriptions", getSubscriptions(db))
+	r.PUT("/group/:id/statement-subscription", subscribe(db))
+	r.DELETE("/group/:id/statement-subscription", unsubscribe(db))
+}
+
+// groupParam The group in the URL, if the user is a member of it
+func groupParam(c *gin.Context, db *database.DB) (int, bool) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(400, "Invalid group ID")
+		return 0, false
+	}
+	isMember, err := groups.Members(db.Db, id, []string{c.GetString("UserID")})
+	if err != nil {
+		database.CheckDBErr(err.(*pq.Error), c)
+		return 0, false
+	}
+	if !isMember {
+		c.AbortWithStatusJSON(404, "Group not found")
+		return 0, false
+	}
+	return id, true
+}
+
+// lastMonth The month before the one now is in, e.g. 2024-02
+func lastMonth(now time.Time) string {
+	return time.Date(now.Year(), now.Month()-1, 1, 0, 0, 0, 0, now.Location()).Format("2006-01")
+}
+
+// getStatement The user's statement for a group as JSON, or as a page or PDF
+// to download with format=html or format=pdf. It's for last month unless
+// month says otherwise.
+func getStatement(db *database.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.GetString("UserID")
+		groupID, ok := groupParam(c, db)
+		if !ok {
+			return
+		}
+		month := c.Query("month")
+		if month == "" {
+			month = lastMonth(time.Now().In(Location(db, userID)))
+		}
+		format := c.DefaultQuery("format", "json")
+		if format != "json" && format != "html" && format != "pdf" {
+			c.JSON(400, "format must be json, html or pdf")
+			return
+		}
+
+		s, err := Load(db, userID, groupID, month)
+		if err == ErrMonth {
+			c.JSON(400, err.Error())
+			return
+		}
+		if err == sql.ErrNoRows {
+			c.AbortWithStatusJSON(404, "Group not found")
+			return
+		}
+		if err != nil {
+			database.RespondErr(err, c)
+			return
+		}
+
+		c.Header("Cache-Control", "private, no-store")
+		filename := fmt.Sprintf("statement-%d-%s", groupID, month)
+		switch format {
+		case "html":
+			page, err := s.HTML()
+			if err != nil {
+				c.AbortWithStatusJSON(500, "The server was unable to make the statement")
+				return
+			}
+			c.Header("Content-Disposition", `inline; filename="`+filename+`.html"`)
+			c.Data(200, "text/html; charset=utf-8", page)
+		case "pdf":
+			c.Header("Content-Disposition", `attachment; filename="`+filename+`.pdf"`)
+			c.Data(200, "application/pdf", s.PDF())
+		default:
+			c.JSON(200, s)
+		}
+	}
+}
+
+func getSubscriptions(db *database.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		queryRows, err := db.Db.Query(`SELECT s.group_id, g.name, s.last_sent, s.created_at FROM statement_subscription s
+									JOIN expense_group g ON g.id = s.group_id WHERE s.user_id=$1 ORDER BY g.name`,
+			c.GetString("UserID"))
+		if err != nil {
+			database.CheckDBErr(err.(*pq.Error), c)
+			return
+		}
+		defer queryRows.Close()
+
+		subscriptions := []subscription{}
+		for queryRows.Next() {
+			var s subscription
+			if err = queryRows.Scan(&s.GroupID, &s.Group, &s.LastSent, &s.CreatedAt); err != nil {
+				c.AbortWithStatusJSON(500, "The server was unable to get statement subscriptions")
+				return
+			}
+			subscriptions = append(subscriptions, s)
+		}
+
+		c.JSON(200, subscriptions)
+	}
+}
+
+// subscribe Emails the user their statement for the group every month,
+// starting with the one for this month
+func subscribe(db *database.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.GetString("UserID")
+		groupID, ok := groupParam(c, db)
+		if !ok {
+			return
+		}
+		lastSent := lastMonth(time.Now().In(Location(db, userID)))
+		_, err := db.Db.Exec(`INSERT INTO statement_subscription (user_id, group_id, last_sent) VALUES ($1, $2, $3)
+								ON CONFLICT DO NOTHING`, userID, groupID, lastSent)
+		if err != nil {
+			database.CheckDBErr(err.(*pq.Error), c)
+			return
+		}
+
+		c.JSON(201, groupID)
+	}
+}
+
+func unsubscribe(db *database.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		groupID, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.JSON(400, "Invalid group ID")
+			return
+		}
+		err = db.Db.QueryRow("DELETE FROM statement_subscription WHERE user_id=$1 AND group_id=$2 RETURNING group_id",
+			c.GetString("UserID"), groupID).Scan(&groupID)
+		if err == sql.ErrNoRows {
+			c.AbortWithStatusJSON(404, "Statement subscription not found")
+			return
+		}
+		if err != nil {
+			database.CheckDBErr(err.(*pq.Error), c)
+			return
+		}
+
+		c.JSON(201, groupID)
+	}
+}
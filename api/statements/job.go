@@ -0,0 +1,107 @@
+package statements
+
+import (
+	"context"
+	"fmt"
+	"how-much-do-i-owe/database"
+	"how-much-do-i-owe/mail"
+	"how-much-do-i-owe/scheduler"
+	"log"
+	"strings"
+	"time"
+)
+
+// Job Emails last month's statements once the month is over in the time zone
+// of each subscriber
+var Job = scheduler.Job{Name: "statements", Every: time.Hour, Run: send}
+
+// dueQuery Subscriptions of members who have an email address. Whether last
+// month's statement is due depends on their time zone, so that's checked
+// after.
+const dueQuery = `SELECT s.user_id, s.group_id, COALESCE(s.last_sent, ''), a.email,
+       COALESCE((SELECT time_zone FROM notification_setting WHERE user_id=s.user_id), 'UTC')
+    FROM statement_subscription s
+    JOIN account a ON a.id = s.user_id
+    JOIN group_member m ON m.group_id = s.group_id AND m.user_id = s.user_id
+    WHERE a.email <> '' AND NOT EXISTS(SELECT 1 FROM ghost WHERE id = s.user_id)`
+
+type due struct {
+	userID, lastSent, email, timeZone string
+	groupID                           int
+}
+
+func send(ctx context.Context, db *database.DB) error {
+	queryRows, err := db.Db.QueryContext(ctx, dueQuery)
+	if err != nil {
+		return err
+	}
+	var subscriptions []due
+	for queryRows.Next() {
+		var d due
+		if err = queryRows.Scan(&d.userID, &d.groupID, &d.lastSent, &d.email, &d.timeZone); err != nil {
+			queryRows.Close()
+			return err
+		}
+		subscriptions = append(subscriptions, d)
+	}
+	queryRows.Close()
+	if err = queryRows.Err(); err != nil {
+		return err
+	}
+
+	for _, d := range subscriptions {
+		location, err := time.LoadLocation(d.timeZone)
+		if err != nil {
+			location = time.UTC
+		}
+		month := lastMonth(time.Now().In(location))
+		if d.lastSent >= month {
+			continue
+		}
+		if err = sendStatement(ctx, db, d, month); err != nil {
+			// The subscription stays due and is tried again with the next run
+			log.Printf("statements: unable to send the %s statement of group %d to %s: %v", month, d.groupID, d.userID, err)
+		}
+	}
+	return nil
+}
+
+// sendStatement Emails the statement of month to a subscriber and remembers
+// it was sent
+func sendStatement(ctx context.Context, db *database.DB, d due, month string) error {
+	s, err := Load(db, d.userID, d.groupID, month)
+	if err != nil {
+		return err
+	}
+	page, err := s.HTML()
+	if err != nil {
+		return err
+	}
+	err = mail.Send(ctx, mail.Message{To: d.email, Subject: "Your statement for " + s.Title(), Text: text(s), HTML: string(page)})
+	if err != nil {
+		return err
+	}
+	_, err = db.Db.ExecContext(ctx, "UPDATE statement_subscription SET last_sent=$3 WHERE user_id=$1 AND group_id=$2",
+		d.userID, d.groupID, month)
+	return err
+}
+
+// text The plain text part of a statement email, the totals and where to get
+// the whole statement
+func text(s Statement) string {
+	var t strings.Builder
+	fmt.Fprintf(&t, "Here's your statement for %s.\n\n", s.Title())
+	fmt.Fprintf(&t, "Opening balance: %s, %s\n", decimal(s.OpeningBalance), owes(s.OpeningBalance))
+	fmt.Fprintf(&t, "Closing balance: %s, %s\n\n", decimal(s.ClosingBalance), owes(s.ClosingBalance))
+	if len(s.Categories) > 0 {
+		fmt.Fprintf(&t, "The group spent %s, your share was %s:\n", decimal(s.Spent), decimal(s.Share))
+		for _, c := range s.Categories {
+			fmt.Fprintf(&t, "  %s: %s, your share %s\n", categoryName(c.Category), decimal(c.Spent), decimal(c.Share))
+		}
+		t.WriteString("\n")
+	}
+	fmt.Fprintf(&t, "Every transaction is in the statement: %s\nDownload it as a PDF: %s\n", s.link("html"), s.link("pdf"))
+	t.WriteString("\n--\nYou get this email because you asked for monthly statements of this group. " +
+		"Turn them off in the group's settings: " + mail.Link("/") + "\n")
+	return t.String()
+}
@@ -0,0 +1,260 @@
+package statements
+
+import (
+	"bytes"
+	"fmt"
+	"how-much-do-i-owe/mail"
+	"how-much-do-i-owe/pdf"
+	"html/template"
+	"strings"
+)
+
+// decimal An amount with two decimals
+func decimal(amount float64) string {
+	return fmt.Sprintf("%.2f", amount)
+}
+
+// signed A change to a balance, with a + when it's owed to the user
+func signed(amount float64) string {
+	if amount > 0 {
+		return "+" + decimal(amount)
+	}
+	return decimal(amount)
+}
+
+// owes How a balance reads to the user
+func owes(balance float64) string {
+	switch {
+	case balance > 0:
+		return "you are owed " + decimal(balance)
+	case balance < 0:
+		return "you owe " + decimal(-balance)
+	}
+	return "settled up"
+}
+
+func categoryName(category string) string {
+	if category == "" {
+		return "Uncategorized"
+	}
+	return strings.ToUpper(category[:1]) + category[1:]
+}
+
+func (l line) label() string {
+	if l.SplitType != "settlement" {
+		return l.Description
+	}
+	if l.Description == "" {
+		return "Settlement"
+	}
+	return "Settlement: " + l.Description
+}
+
+func (l line) shareList() string {
+	parts := make([]string, len(l.Shares))
+	for i, s := range l.Shares {
+		parts[i] = s.Name + " " + decimal(s.Amount)
+	}
+	return strings.Join(parts, ", ")
+}
+
+// Title What the statement is called, e.g. Flat – March 2024
+func (s Statement) Title() string {
+	return s.Group + " – " + s.From.Format("January 2006")
+}
+
+// link Where to get the statement in format
+func (s Statement) link(format string) string {
+	return mail.Link(fmt.Sprintf("/api/v1/group/%d/statement?month=%s&format=%s", s.GroupID, s.Month, format))
+}
+
+// HTML The statement as a page
+func (s Statement) HTML() ([]byte, error) {
+	var page bytes.Buffer
+	err := htmlTemplate.Execute(&page, s)
+	return page.Bytes(), err
+}
+
+var htmlTemplate = template.Must(template.New("statement").Funcs(template.FuncMap{
+	"money":    decimal,
+	"signed":   signed,
+	"owes":     owes,
+	"category": categoryName,
+	"label":    line.label,
+	"shares":   line.shareList,
+	"download": func(s Statement) string { return s.link("pdf") },
+}).Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>{{.Title}} · how much do i owe?</title>
+<style>
+body { font-family: sans-serif; max-width: 48rem; margin: 2rem auto; padding: 0 1rem; color: #222; }
+table { border-collapse: collapse; width: 100%; margin-bottom: 2rem; }
+th, td { text-align: left; padding: .4rem; border-bottom: 1px solid #ddd; vertical-align: top; }
+td.amount, th.amount { text-align: right; white-space: nowrap; }
+.muted { color: #777; font-size: .9rem; }
+</style>
+</head>
+<body>
+<h1>{{.Title}}</h1>
+<p class="muted">Statement for {{.Name}}, {{.From.Format "2 Jan 2006"}} to {{(.To.AddDate 0 0 -1).Format "2 Jan 2006"}}
+· <a href="{{download .}}">Download as PDF</a></p>
+
+<table>
+<tr><td>Opening balance</td><td class="amount">{{money .OpeningBalance}}</td><td>{{owes .OpeningBalance}}</td></tr>
+<tr><td>Closing balance</td><td class="amount">{{money .ClosingBalance}}</td><td>{{owes .ClosingBalance}}</td></tr>
+</table>
+
+<h2>Transactions</h2>
+<table>
+<tr><th>Date</th><th>Description</th><th>Paid by</th><th class="amount">Amount</th><th class="amount">Your balance</th></tr>
+<tr><td></td><td>Opening balance</td><td></td><td></td><td class="amount">{{money .OpeningBalance}}</td></tr>
+{{range .Lines}}<tr><td>{{.Timestamp.Format "2 Jan"}}</td>
+<td>{{label .}}{{if .Category}} <span class="muted">{{category .Category}}</span>{{end}}
+<div class="muted">{{shares .}}</div></td>
+<td>{{.PaidBy}}</td><td class="amount">{{money .Amount}}</td><td class="amount">{{signed .Change}}</td></tr>
+{{end}}<tr><td></td><td>Closing balance</td><td></td><td></td><td class="amount">{{money .ClosingBalance}}</td></tr>
+</table>
+
+<h2>Spending by category</h2>
+{{if .Categories}}
+<table>
+<tr><th>Category</th><th class="amount">Group spent</th><th class="amount">Your share</th></tr>
+{{range .Categories}}<tr><td>{{category .Category}}</td><td class="amount">{{money .Spent}}</td><td class="amount">{{money .Share}}</td></tr>
+{{end}}<tr><th>Total</th><th class="amount">{{money .Spent}}</th><th class="amount">{{money .Share}}</th></tr>
+</table>
+{{else}}<p>Nothing was spent this month.</p>{{end}}
+
+{{if .Closing}}<h2>Balances at the end of the month</h2>
+<table>
+{{range .Closing}}<tr><td>{{.Name}}</td><td class="amount">{{money .Balance}}</td><td>{{if gt .Balance 0.0}}owes you{{else}}you owe them{{end}}</td></tr>
+{{end}}</table>{{end}}
+<p class="muted">From how much do i owe?</p>
+</body>
+</html>
+`))
+
+// PDF The statement as a printable document
+func (s Statement) PDF() []byte {
+	const (
+		left      = pdf.Margin
+		right     = pdf.PageWidth - pdf.Margin
+		date      = left
+		desc      = left + 50
+		paidBy    = left + 290
+		amount    = right - 80
+		change    = right
+		size      = 9.0
+		rowHeight = 13.0
+		bottom    = pdf.PageHeight - pdf.Margin
+	)
+	d := pdf.New(s.Title())
+	y := pdf.Margin + 10
+	d.Text(left, y, 18, true, s.Title())
+	y += 20
+	d.Text(left, y, size, false, fmt.Sprintf("Statement for %s, %s to %s", s.Name, s.From.Format("2 Jan 2006"),
+		s.To.AddDate(0, 0, -1).Format("2 Jan 2006")))
+	y += 2 * rowHeight
+
+	newPage := func() {
+		d.AddPage()
+		y = pdf.Margin + 10
+	}
+	// row Starts a new page when there's no room for height more points
+	row := func(height float64) {
+		if y+height > bottom {
+			newPage()
+		}
+	}
+	heading := func(text string) {
+		row(4 * rowHeight)
+		y += rowHeight
+		d.Text(left, y, 12, true, text)
+		y += rowHeight
+	}
+	columns := func() {
+		d.Text(date, y, size, true, "Date")
+		d.Text(desc, y, size, true, "Description")
+		d.Text(paidBy, y, size, true, "Paid by")
+		d.TextRight(amount, y, size, true, "Amount")
+		d.TextRight(change, y, size, true, "Your balance")
+		d.Line(left, y+4, right, y+4)
+		y += rowHeight + 2
+	}
+
+	d.Text(left, y, size+1, false, "Opening balance: "+decimal(s.OpeningBalance)+", "+owes(s.OpeningBalance))
+	y += rowHeight + 2
+	d.Text(left, y, size+1, true, "Closing balance: "+decimal(s.ClosingBalance)+", "+owes(s.ClosingBalance))
+	y += rowHeight
+
+	heading("Transactions")
+	columns()
+	d.Text(desc, y, size, false, "Opening balance")
+	d.TextRight(change, y, size, false, decimal(s.OpeningBalance))
+	y += rowHeight
+	for _, l := range s.Lines {
+		if y+2*rowHeight > bottom {
+			newPage()
+			columns()
+		}
+		label := l.label()
+		if l.Category != "" {
+			label += " (" + categoryName(l.Category) + ")"
+		}
+		d.Text(date, y, size, false, l.Timestamp.Format("2 Jan"))
+		d.Text(desc, y, size, false, pdf.Truncate(label, paidBy-desc-10, size, false))
+		d.Text(paidBy, y, size, false, pdf.Truncate(l.PaidBy, amount-paidBy-60, size, false))
+		d.TextRight(amount, y, size, false, decimal(l.Amount))
+		d.TextRight(change, y, size, false, signed(l.Change))
+		y += rowHeight - 2
+		d.Text(desc, y, size-2, false, pdf.Truncate(l.shareList(), paidBy-desc-10, size-2, false))
+		y += rowHeight
+	}
+	row(rowHeight)
+	d.Line(left, y-rowHeight+4, right, y-rowHeight+4)
+	d.Text(desc, y, size, true, "Closing balance")
+	d.TextRight(change, y, size, true, decimal(s.ClosingBalance))
+	y += rowHeight
+
+	heading("Spending by category")
+	if len(s.Categories) == 0 {
+		d.Text(left, y, size, false, "Nothing was spent this month.")
+		y += rowHeight
+	} else {
+		d.Text(left, y, size, true, "Category")
+		d.TextRight(amount, y, size, true, "Group spent")
+		d.TextRight(change, y, size, true, "Your share")
+		d.Line(left, y+4, right, y+4)
+		y += rowHeight + 2
+		for _, c := range s.Categories {
+			row(rowHeight)
+			d.Text(left, y, size, false, categoryName(c.Category))
+			d.TextRight(amount, y, size, false, decimal(c.Spent))
+			d.TextRight(change, y, size, false, decimal(c.Share))
+			y += rowHeight
+		}
+		row(rowHeight)
+		d.Text(left, y, size, true, "Total")
+		d.TextRight(amount, y, size, true, decimal(s.Spent))
+		d.TextRight(change, y, size, true, decimal(s.Share))
+		y += rowHeight
+	}
+
+	if len(s.Closing) > 0 {
+		heading("Balances at the end of the month")
+		for _, b := range s.Closing {
+			row(rowHeight)
+			who := "you owe them"
+			if b.Balance > 0 {
+				who = "owes you"
+			}
+			d.Text(left, y, size, false, pdf.Truncate(b.Name, amount-left-60, size, false))
+			d.TextRight(amount, y, size, false, decimal(b.Balance))
+			d.Text(amount+10, y, size, false, who)
+			y += rowHeight
+		}
+	}
+	return d.Bytes()
+}
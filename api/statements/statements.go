@@ -0,0 +1,215 @@
+package statements
+
+import (
+	"errors"
+	"how-much-do-i-owe/api/transactions"
+	"how-much-do-i-owe/database"
+	"how-much-do-i-owe/money"
+	"sort"
+	"time"
+)
+
+// Statement What happened in a group for one of its members in a month. The
+// opening and closing balances are what the balances endpoint shows for the
+// group before the start and the end of the month, positive when the user is
+// owed money, and every line changes the balance by its Change.
+type Statement struct {
+	GroupID        int                    `json:"groupId"`
+	Group          string                 `json:"group"`
+	Name           string                 `json:"name"`
+	Month          string                 `json:"month"`
+	From           time.Time              `json:"from"`
+	To             time.Time              `json:"to"`
+	OpeningBalance float64                `json:"openingBalance"`
+	ClosingBalance float64                `json:"closingBalance"`
+	Opening        []transactions.Balance `json:"opening"`
+	Closing        []transactions.Balance `json:"closing"`
+	Lines          []line                 `json:"lines"`
+	Categories     []categoryTotal        `json:"categories"`
+	Spent          float64                `json:"spent"`
+	Share          float64                `json:"share"`
+}
+
+// line An expense or settlement in the month. Change is what it did to the
+// user's balance: what the others owe them when they paid, less their share
+// when someone else did.
+type line struct {
+	ID          string    `json:"id"`
+	Timestamp   time.Time `json:"timestamp"`
+	Description string    `json:"description"`
+	Category    string    `json:"category"`
+	SplitType   string    `json:"splitType"`
+	PaidBy      string    `json:"paidBy"`
+	Amount      float64   `json:"amount"`
+	Shares      []share   `json:"shares"`
+	Change      float64   `json:"change"`
+}
+
+type share struct {
+	ID     string  `json:"id"`
+	Name   string  `json:"name"`
+	Amount float64 `json:"amount"`
+}
+
+// categoryTotal What the group spent on a category in the month, and the
+// user's share of it. Uncategorized expenses have an empty category.
+type categoryTotal struct {
+	Category string  `json:"category"`
+	Spent    float64 `json:"spent"`
+	Share    float64 `json:"share"`
+}
+
+// ErrMonth The month isn't in the form 2006-01
+var ErrMonth = errors.New("month must be in the form YYYY-MM")
+
+// linesQuery The transactions of a group in a time range, one row per
+// participant. Names are the user's nicknames for people when they set one.
+const linesQuery = `SELECT t.id, t.timestamp, t.description, t.category, t.split_type, t.payer,
+       COALESCE(NULLIF(pc.nickname, ''), pa.name), tp.user_id, COALESCE(NULLIF(c.nickname, ''), a.name), tp.dollar_share
+    FROM transaction t
+    JOIN account pa ON pa.id = t.payer
+    JOIN transaction_participants tp ON tp.transaction_id = t.id
+    JOIN account a ON a.id = tp.user_id
+    LEFT JOIN contact pc ON pc.user_id=$1 AND pc.contact_id = t.payer
+    LEFT JOIN contact c ON c.user_id=$1 AND c.contact_id = tp.user_id
+    WHERE t.group_id=$2 AND t.timestamp >= $3 AND t.timestamp < $4
+    ORDER BY t.timestamp, t.id, a.name`
+
+// Month The first instant of month, e.g. 2024-03, and of the month after it
+// in location
+func Month(month string, location *time.Location) (time.Time, time.Time, error) {
+	from, err := time.ParseInLocation("2006-01", month, location)
+	if err != nil {
+		return time.Time{}, time.Time{}, ErrMonth
+	}
+	return from, from.AddDate(0, 1, 0), nil
+}
+
+// Location The user's time zone, which is when their months start
+func Location(db *database.DB, userID string) *time.Location {
+	var timeZone string
+	err := db.Db.QueryRow("SELECT COALESCE((SELECT time_zone FROM notification_setting WHERE user_id=$1), 'UTC')",
+		userID).Scan(&timeZone)
+	if err != nil {
+		return time.UTC
+	}
+	location, err := time.LoadLocation(timeZone)
+	if err != nil {
+		return time.UTC
+	}
+	return location
+}
+
+// Load The statement of userID for a group in month. The caller checks that
+// they are a member.
+func Load(db *database.DB, userID string, groupID int, month string) (Statement, error) {
+	s := Statement{GroupID: groupID, Month: month}
+	var err error
+	s.From, s.To, err = Month(month, Location(db, userID))
+	if err != nil {
+		return s, err
+	}
+	err = db.Db.QueryRow("SELECT g.name, a.name FROM expense_group g, account a WHERE g.id=$1 AND a.id=$2",
+		groupID, userID).Scan(&s.Group, &s.Name)
+	if err != nil {
+		return s, err
+	}
+
+	if s.Opening, err = transactions.BalancesIn(db, userID, &groupID, &s.From); err != nil {
+		return s, err
+	}
+	if s.Closing, err = transactions.BalancesIn(db, userID, &groupID, &s.To); err != nil {
+		return s, err
+	}
+	s.OpeningBalance, s.ClosingBalance = total(s.Opening), total(s.Closing)
+
+	queryRows, err := db.Db.Query(linesQuery, userID, groupID, s.From, s.To)
+	if err != nil {
+		return s, err
+	}
+	defer queryRows.Close()
+	var rows []row
+	for queryRows.Next() {
+		var r row
+		err = queryRows.Scan(&r.id, &r.timestamp, &r.description, &r.category, &r.splitType, &r.payer, &r.payerName,
+			&r.userID, &r.name, &r.share)
+		if err != nil {
+			return s, err
+		}
+		rows = append(rows, r)
+	}
+	if err = queryRows.Err(); err != nil {
+		return s, err
+	}
+	s.Lines, s.Categories, s.Spent, s.Share = summarize(userID, rows)
+	return s, nil
+}
+
+// row One participant of a transaction, as linesQuery returns them
+type row struct {
+	id, description, category, splitType, payer, payerName, userID, name string
+	timestamp                                                            time.Time
+	share                                                                float64
+}
+
+// summarize Turns rows into the lines of a statement and totals by category,
+// adding up in cents so the lines match the balances to the cent
+func summarize(userID string, rows []row) ([]line, []categoryTotal, float64, float64) {
+	lines := []line{}
+	var amounts, changes []int64
+	spent := make(map[string]int64)
+	shares := make(map[string]int64)
+	for _, r := range rows {
+		if len(lines) == 0 || lines[len(lines)-1].ID != r.id {
+			lines = append(lines, line{ID: r.id, Timestamp: r.timestamp, Description: r.description, Category: r.category,
+				SplitType: r.splitType, PaidBy: r.payerName, Shares: []share{}})
+			amounts = append(amounts, 0)
+			changes = append(changes, 0)
+		}
+		i := len(lines) - 1
+		cents := money.ToCents(r.share)
+		lines[i].Shares = append(lines[i].Shares, share{ID: r.userID, Name: r.name, Amount: r.share})
+		amounts[i] += cents
+		if r.payer == userID && r.userID != userID {
+			changes[i] += cents
+		} else if r.userID == userID && r.payer != userID {
+			changes[i] -= cents
+		}
+		if r.splitType != transactions.SplitSettlement {
+			spent[r.category] += cents
+			if r.userID == userID {
+				shares[r.category] += cents
+			}
+		}
+	}
+
+	var totalSpent, totalShare int64
+	categories := []categoryTotal{}
+	for category, cents := range spent {
+		categories = append(categories, categoryTotal{category, money.FromCents(cents), money.FromCents(shares[category])})
+		totalSpent += cents
+		totalShare += shares[category]
+	}
+	// Biggest first, uncategorized last
+	sort.Slice(categories, func(i, j int) bool {
+		if (categories[i].Category == "") != (categories[j].Category == "") {
+			return categories[j].Category == ""
+		}
+		if categories[i].Spent != categories[j].Spent {
+			return categories[i].Spent > categories[j].Spent
+		}
+		return categories[i].Category < categories[j].Category
+	})
+	for i := range lines {
+		lines[i].Amount, lines[i].Change = money.FromCents(amounts[i]), money.FromCents(changes[i])
+	}
+	return lines, categories, money.FromCents(totalSpent), money.FromCents(totalShare)
+}
+
+func total(balances []transactions.Balance) float64 {
+	var cents int64
+	for _, b := range balances {
+		cents += money.ToCents(b.Balance)
+	}
+	return money.FromCents(cents)
+}
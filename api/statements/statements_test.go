@@ -0,0 +1,112 @@
+package statements
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+// march Alice paid 90 for groceries split three ways and 30 for an
+// uncategorized expense with Bob, Bob paid 60 for dinner with Alice and Carol,
+// and Carol settled up 20 with Alice
+func march() []row {
+	at := time.Date(2024, 3, 10, 12, 0, 0, 0, time.UTC)
+	return []row{
+		{id: "1", timestamp: at, description: "Market", category: "groceries", splitType: "equal", payer: "alice", payerName: "Alice", userID: "alice", name: "Alice", share: 30},
+		{id: "1", timestamp: at, description: "Market", category: "groceries", splitType: "equal", payer: "alice", payerName: "Alice", userID: "bob", name: "Bob", share: 30},
+		{id: "1", timestamp: at, description: "Market", category: "groceries", splitType: "equal", payer: "alice", payerName: "Alice", userID: "carol", name: "Carol", share: 30},
+		{id: "2", timestamp: at, description: "Pizza", category: "dining", splitType: "equal", payer: "bob", payerName: "Bob", userID: "alice", name: "Alice", share: 20},
+		{id: "2", timestamp: at, description: "Pizza", category: "dining", splitType: "equal", payer: "bob", payerName: "Bob", userID: "bob", name: "Bob", share: 20},
+		{id: "2", timestamp: at, description: "Pizza", category: "dining", splitType: "equal", payer: "bob", payerName: "Bob", userID: "carol", name: "Carol", share: 20},
+		{id: "3", timestamp: at, description: "Bulbs", splitType: "exact", payer: "alice", payerName: "Alice", userID: "bob", name: "Bob", share: 10.01},
+		{id: "3", timestamp: at, description: "Bulbs", splitType: "exact", payer: "alice", payerName: "Alice", userID: "alice", name: "Alice", share: 19.99},
+		{id: "4", timestamp: at, splitType: "settlement", payer: "carol", payerName: "Carol", userID: "alice", name: "Alice", share: 20},
+	}
+}
+
+func TestSummarize(t *testing.T) {
+	lines, categories, spent, share := summarize("alice", march())
+	wantChanges := []float64{60, -20, 10.01, -20}
+	if len(lines) != len(wantChanges) {
+		t.Fatalf("got %d lines, want %d", len(lines), len(wantChanges))
+	}
+	for i, want := range wantChanges {
+		if lines[i].Change != want {
+			t.Errorf("line %s changes the balance by %v, want %v", lines[i].ID, lines[i].Change, want)
+		}
+	}
+	if lines[2].Amount != 30 || len(lines[0].Shares) != 3 {
+		t.Errorf("got %+v and %+v", lines[2], lines[0])
+	}
+
+	want := []categoryTotal{{"groceries", 90, 30}, {"dining", 60, 20}, {"", 30, 19.99}}
+	if len(categories) != len(want) {
+		t.Fatalf("got categories %+v, want %+v", categories, want)
+	}
+	for i := range want {
+		if categories[i] != want[i] {
+			t.Errorf("got %+v, want %+v", categories[i], want[i])
+		}
+	}
+	if spent != 180 || share != 69.99 {
+		t.Errorf("got %v spent and a share of %v, settlements shouldn't count", spent, share)
+	}
+}
+
+func TestMonth(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Skip("no time zone database")
+	}
+	from, to, err := Month("2024-03", berlin)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !from.Equal(time.Date(2024, 2, 29, 23, 0, 0, 0, time.UTC)) || !to.Equal(time.Date(2024, 3, 31, 22, 0, 0, 0, time.UTC)) {
+		t.Errorf("March in Berlin is from %v to %v", from.UTC(), to.UTC())
+	}
+	for _, month := range []string{"2024-3", "March", "2024-13", ""} {
+		if _, _, err = Month(month, time.UTC); err != ErrMonth {
+			t.Errorf("%q should be rejected", month)
+		}
+	}
+	if got := lastMonth(time.Date(2024, 1, 1, 0, 30, 0, 0, berlin)); got != "2023-12" {
+		t.Errorf("the month before January 2024 is %s", got)
+	}
+}
+
+func statement() Statement {
+	from, to, _ := Month("2024-03", time.UTC)
+	s := Statement{GroupID: 7, Group: "Flat <3", Name: "Alice", Month: "2024-03", From: from, To: to,
+		OpeningBalance: -5, ClosingBalance: 25.01}
+	s.Lines, s.Categories, s.Spent, s.Share = summarize("alice", march())
+	return s
+}
+
+func TestHTML(t *testing.T) {
+	page, err := statement().HTML()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"Flat &lt;3 – March 2024", "1 Mar 2024 to 31 Mar 2024", "you owe 5.00", "you are owed 25.01",
+		"Groceries", "Uncategorized", "-20.00", "Settlement", "Alice 30.00, Bob 30.00, Carol 30.00", "format=pdf"} {
+		if !strings.Contains(string(page), want) {
+			t.Errorf("the statement doesn't say %q", want)
+		}
+	}
+}
+
+func TestPDF(t *testing.T) {
+	s := statement()
+	for len(s.Lines) < 200 {
+		s.Lines = append(s.Lines, s.Lines...)
+	}
+	out := s.PDF()
+	if !bytes.HasPrefix(out, []byte("%PDF-")) || !bytes.Contains(out, []byte("(Closing balance) Tj")) {
+		t.Fatal("not a statement")
+	}
+	if bytes.Contains(out, []byte("/Count 1 ")) {
+		t.Error("200 lines should take more than one page")
+	}
+}
@@ -0,0 +1,170 @@
+package tokens
+
+import (
+	"database/sql"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+	"how-much-do-i-owe/database"
+	"how-much-do-i-owe/secrets"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	// ScopeRead Tokens that may only make GET requests
+	ScopeRead = "read"
+	// ScopeWrite Tokens that may make any request
+	ScopeWrite = "write"
+
+	// Prefix Every personal access token starts with this, so they are easy
+	// to spot in scripts and secret scanners
+	Prefix = "hmdio_"
+)
+
+type token struct {
+	ID         int        `json:"id"`
+	Name       string     `json:"name"`
+	Scope      string     `json:"scope"`
+	CreatedAt  time.Time  `json:"createdAt"`
+	ExpiresAt  *time.Time `json:"expiresAt"`
+	LastUsedAt *time.Time `json:"lastUsedAt"`
+	// Token The secret itself, only returned once when the token is created
+	Token string `json:"token,omitempty"`
+}
+
+// Routes All the routes created by the package nested in
+// api/v1/*
+func Routes(r *gin.RouterGroup, db *database.DB) {
+	r.GET("/tokens", getAllTokens(db))
+	r.PUT("/token", createToken(db))
+	r.DELETE("/token/:id", revokeToken(db))
+}
+
+// Authenticate Looks up the account a raw bearer token belongs to and records
+// that the token was used. Returns sql.ErrNoRows for unknown, expired or
+// revoked tokens.
+func Authenticate(db *database.DB, rawToken string) (userID string, scope string, err error) {
+	err = db.Db.QueryRow(`UPDATE api_token SET last_used_at=now()
+								WHERE token_hash=$1 AND revoked_at IS NULL AND (expires_at IS NULL OR expires_at > now())
+								RETURNING user_id, scope`, secrets.HashToken(rawToken)).Scan(&userID, &scope)
+	return userID, scope, err
+}
+
+// AllowsMethod Whether a token with the given scope may make a request with the given HTTP method
+func AllowsMethod(scope string, method string) bool {
+	if scope == ScopeWrite {
+		return true
+	}
+	return method == http.MethodGet || method == http.MethodHead || method == http.MethodOptions
+}
+
+// RequireSession Answers a request made with a token with a 403 and returns
+// false. Tokens can't be used to mint or revoke other tokens, or to change
+// how the account logs in.
+func RequireSession(c *gin.Context) bool {
+	if c.GetString("AuthMethod") == "token" {
+		c.AbortWithStatusJSON(http.StatusForbidden, "This can only be done from a browser session, not with an API token")
+		return false
+	}
+	return true
+}
+
+func getAllTokens(db *database.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.GetString("UserID")
+
+		queryRows, err := db.Db.Query(`SELECT id, name, scope, created_at, expires_at, last_used_at FROM api_token
+												WHERE user_id=$1 AND revoked_at IS NULL ORDER BY created_at`, userID)
+		if err != nil {
+			database.CheckDBErr(err.(*pq.Error), c)
+			return
+		}
+		defer queryRows.Close()
+
+		allTokens := []token{}
+		for queryRows.Next() {
+			var t token
+			err = queryRows.Scan(&t.ID, &t.Name, &t.Scope, &t.CreatedAt, &t.ExpiresAt, &t.LastUsedAt)
+			if err != nil {
+				c.AbortWithStatusJSON(500, "The server was unable to get API tokens")
+				return
+			}
+			allTokens = append(allTokens, t)
+		}
+
+		c.JSON(200, allTokens)
+	}
+}
+
+func createToken(db *database.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !RequireSession(c) {
+			return
+		}
+		userID := c.GetString("UserID")
+
+		var t token
+		if err := c.ShouldBindJSON(&t); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if t.Name == "" {
+			c.JSON(http.StatusBadRequest, "A token name is required")
+			return
+		}
+		if t.Scope != ScopeRead && t.Scope != ScopeWrite {
+			c.JSON(http.StatusBadRequest, fmt.Sprintf("Scope must be %q or %q", ScopeRead, ScopeWrite))
+			return
+		}
+		if t.ExpiresAt != nil && t.ExpiresAt.Before(time.Now()) {
+			c.JSON(http.StatusBadRequest, "Expiry date must be in the future")
+			return
+		}
+
+		rawToken, err := secrets.NewToken(Prefix)
+		if err != nil {
+			c.AbortWithStatusJSON(500, "The server was unable to generate a token")
+			return
+		}
+
+		err = db.Db.QueryRow(`INSERT INTO api_token (user_id, name, token_hash, scope, expires_at) VALUES ($1, $2, $3, $4, $5)
+								RETURNING id, created_at`, userID, t.Name, secrets.HashToken(rawToken), t.Scope, t.ExpiresAt).Scan(&t.ID, &t.CreatedAt)
+		if err != nil {
+			database.CheckDBErr(err.(*pq.Error), c)
+			return
+		}
+		t.LastUsedAt = nil
+		t.Token = rawToken
+
+		c.JSON(201, t)
+	}
+}
+
+func revokeToken(db *database.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !RequireSession(c) {
+			return
+		}
+		userID := c.GetString("UserID")
+		id, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.JSON(400, "Invalid token ID")
+			return
+		}
+
+		err = db.Db.QueryRow(`UPDATE api_token SET revoked_at=now() WHERE id=$1 AND user_id=$2 AND revoked_at IS NULL
+								RETURNING id`, id, userID).Scan(&id)
+		if err == sql.ErrNoRows {
+			c.AbortWithStatusJSON(404, "Token not found")
+			return
+		}
+		if err != nil {
+			database.CheckDBErr(err.(*pq.Error), c)
+			return
+		}
+
+		c.JSON(201, id)
+	}
+}
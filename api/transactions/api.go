@@ -1,13 +1,21 @@
 package transactions
 
 import (
-	"fmt"
+	"database/sql"
+	"errors"
 	"github.com/gin-gonic/gin"
 	"github.com/lib/pq"
+	"how-much-do-i-owe/api/analytics"
+	"how-much-do-i-owe/api/contacts"
+	"how-much-do-i-owe/api/groups"
 	"how-much-do-i-owe/database"
-	"math"
+	"how-much-do-i-owe/events"
+	"how-much-do-i-owe/money"
+	"how-much-do-i-owe/webhooks"
+	"log"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 )
 
@@ -18,6 +26,9 @@ type transaction struct {
 	Payer        string        `json:"payer" `
 	Participants []participant `json:"participants"`
 	SplitType    string        `json:"splitType"`
+	Description  string        `json:"description"`
+	Category     string        `json:"category"`
+	GroupID      *int          `json:"groupId"`
 }
 
 type participant struct {
@@ -36,36 +47,58 @@ func Routes(r *gin.RouterGroup, db *database.DB) {
 	r.DELETE("/transaction/:id", deleteTransaction(db))
 	r.PATCH("/transaction/:id", modifyTransaction(db))
 	r.PUT("/transaction", createTransaction(db))
+	r.GET("/balances", getBalances(db))
+	r.GET("/balance/:id/qr/:kind", getPaymentQR(db))
+	r.PUT("/settlement", createSettlement(db))
+	r.GET("/transaction/:id/comments", getComments(db))
+	r.PUT("/transaction/:id/comment", createComment(db))
+	r.DELETE("/comment/:id", deleteComment(db))
 }
 
 func getAllTransactions(db *database.DB) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		googleID, exists := c.Get("GoogleID")
+		userID, exists := c.Get("UserID")
 		if !exists {
 			c.JSON(http.StatusNotAcceptable, "Active Session Required")
 		}
-		queryRows, err := db.Db.Query(`SELECT id, payer, timestamp, split_type, a.google_id, email, name FROM transaction
-    											LEFT JOIN transaction_participants tp on transaction.id = tp.transaction_id
-                                                   JOIN account a on tp.google_id = a.google_id
-                                                   WHERE payer=$1 OR a.google_id=$1`, googleID)
+		var groupID *int
+		if c.Query("groupId") != "" {
+			id, err := strconv.Atoi(c.Query("groupId"))
+			if err != nil {
+				c.JSON(400, "Invalid group ID")
+				return
+			}
+			groupID = &id
+		}
+		queryRows, err := db.Db.Query(`SELECT transaction.id, payer, timestamp, split_type, description, category, group_id, a.id, email, name,
+       											dollar_share, fractional_share FROM transaction
+    											JOIN transaction_participants tp on transaction.id = tp.transaction_id
+                                                JOIN account a on tp.user_id = a.id
+                                                WHERE (payer=$1 OR transaction.id IN (SELECT transaction_id FROM transaction_participants WHERE user_id=$1))
+                                                  AND ($2::integer IS NULL OR group_id=$2)
+                                                ORDER BY timestamp DESC`, userID, groupID)
+		if err != nil {
+			database.CheckDBErr(err.(*pq.Error), c)
+			return
+		}
+		defer queryRows.Close()
+
 		allTrans := make(map[string]transaction)
 		for queryRows.Next() {
 			var trans transaction
 			var parti participant
-			err = queryRows.Scan(&trans.ID, &trans.Payer, &trans.Timestamp, &trans.SplitType, &parti.ID, &parti.Email, &parti.Name)
+			err = queryRows.Scan(&trans.ID, &trans.Payer, &trans.Timestamp, &trans.SplitType, &trans.Description, &trans.Category, &trans.GroupID,
+				&parti.ID, &parti.Email, &parti.Name, &parti.DollarShare, &parti.FractionalShare)
 			if err != nil {
 				c.AbortWithStatusJSON(500, "The server was unable to get transactions")
+				return
 			}
 			if val, ok := allTrans[trans.ID]; ok {
-				val.Participants = append(val.Participants, parti)
-				allTrans[trans.ID] = val
-			} else {
-				allTrans[trans.ID] = trans
+				trans = val
 			}
-		}
-		if err != nil {
-			database.CheckDBErr(err.(*pq.Error), c)
-			return
+			trans.Participants = append(trans.Participants, parti)
+			trans.Amount = money.FromCents(money.ToCents(trans.Amount) + money.ToCents(parti.DollarShare))
+			allTrans[trans.ID] = trans
 		}
 
 		c.JSON(200, allTrans)
@@ -74,30 +107,45 @@ func getAllTransactions(db *database.DB) gin.HandlerFunc {
 
 func getParticipants(id string, db *database.DB) ([]participant, float64, error) {
 	var participants []participant
-	var total float64
-	query, err := db.Db.Query("SELECT google_id, dollar_share, fractional_share FROM transaction_participants WHERE transaction_id=$2", id)
+	var total int64
+	query, err := db.Db.Query(`SELECT tp.user_id, name, email, dollar_share, fractional_share FROM transaction_participants tp
+										JOIN account a on tp.user_id = a.id WHERE transaction_id=$1`, id)
+	if err != nil {
+		return []participant{}, 0, err
+	}
+	defer query.Close()
 	for query.Next() {
 		var tempPart participant
-		err = query.Scan(&tempPart.ID, &tempPart.DollarShare, &tempPart.FractionalShare)
+		err = query.Scan(&tempPart.ID, &tempPart.Name, &tempPart.Email, &tempPart.DollarShare, &tempPart.FractionalShare)
 		if err != nil {
 			return []participant{}, 0, err
 		}
-		total += tempPart.DollarShare
+		total += money.ToCents(tempPart.DollarShare)
 		participants = append(participants, tempPart)
 	}
-	return participants, total, nil
+	return participants, money.FromCents(total), nil
 }
 
 func getTransaction(db *database.DB) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		googleID, exists := c.Get("GoogleID")
-		if !exists {
-			c.JSON(http.StatusNotAcceptable, "Active Session Required")
+		id, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.JSON(400, "Invalid transaction ID")
+			return
+		}
+		userID := c.GetString("UserID")
+		if !isPartOfTransaction(db, userID, id) {
+			c.AbortWithStatusJSON(404, "Transaction not found")
+			return
 		}
 		var trans transaction
 
-		err := db.Db.QueryRow("SELECT id, payer, timestamp, split_type FROM transaction WHERE payer=$1",
-			googleID).Scan(&trans.ID, &trans.Payer, &trans.Timestamp, &trans.SplitType)
+		err = db.Db.QueryRow("SELECT id, payer, timestamp, split_type, description, category, group_id FROM transaction WHERE id=$1",
+			id).Scan(&trans.ID, &trans.Payer, &trans.Timestamp, &trans.SplitType, &trans.Description, &trans.Category, &trans.GroupID)
+		if err == sql.ErrNoRows {
+			c.AbortWithStatusJSON(404, "Transaction not found")
+			return
+		}
 		if err != nil {
 			database.CheckDBErr(err.(*pq.Error), c)
 			return
@@ -121,109 +169,368 @@ func deleteTransaction(db *database.DB) gin.HandlerFunc {
 			c.JSON(400, "Invalid transaction ID")
 			return
 		}
-		googleID := c.GetString("GoogleID")
+		userID := c.GetString("UserID")
 
-		if !isPartOfTransaction(db, googleID, id) {
+		if !isPartOfTransaction(db, userID, id) {
 			c.JSON(400, "You are not a participant in this transaction")
+			return
 		}
-		_, err = db.Db.Query("DELETE FROM transaction WHERE id=$1", id)
+		users, err := involved(db, id)
 		if err != nil {
 			database.CheckDBErr(err.(*pq.Error), c)
 			return
 		}
+		err = removeTransaction(db, id, users)
+		if err == sql.ErrNoRows {
+			c.AbortWithStatusJSON(404, "Transaction not found")
+			return
+		}
+		if err != nil {
+			respondErr(c, err)
+			return
+		}
+		events.Publish(events.TransactionDeleted, gin.H{"id": strconv.Itoa(id)}, users...)
 		c.JSON(201, id)
 	}
 }
 
-func isPartOfTransaction(db *database.DB, googleID string, transactionID int) bool {
+func isPartOfTransaction(db *database.DB, userID string, transactionID int) bool {
 	count := 0
-	err := db.Db.QueryRow(`SELECT count(*) FROM transaction 
-    									FULL OUTER JOIN transaction_participants tp 
-    									    on transaction.id = tp.transaction_id 
-                					WHERE (google_id=$1 OR payer=$1) 
-                					  AND transaction_id=$2`, googleID, transactionID).Scan(&count)
+	err := db.Db.QueryRow(`SELECT count(*) FROM transaction
+    									FULL OUTER JOIN transaction_participants tp
+    									    on transaction.id = tp.transaction_id
+                					WHERE (user_id=$1 OR payer=$1)
+                					  AND transaction_id=$2`, userID, transactionID).Scan(&count)
 	if err != nil {
 		return false
 	}
 	return count > 0
 }
 
+// insertTransaction Stores a transaction whose shares have already been split,
+// together with all of its participants, and fills in trans.ID. Once it's
+// stored, enqueue queues the webhooks about it in the same transaction.
+func insertTransaction(db *database.DB, trans *transaction, enqueue func(tx *sql.Tx) error) error {
+	tx, err := db.Db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = tx.QueryRow(`INSERT INTO transaction (payer, timestamp, split_type, description, category, group_id) VALUES ($1, $2, $3, $4, $5, $6)
+							RETURNING id`, trans.Payer, trans.Timestamp, trans.SplitType, trans.Description, trans.Category, trans.GroupID).Scan(&trans.ID)
+	if err != nil {
+		return err
+	}
+	// After the transaction is created and ID is generated, add each participant to the DB
+	for _, participant := range trans.Participants {
+		_, err = tx.Exec("INSERT INTO transaction_participants (user_id, transaction_id, dollar_share, fractional_share) VALUES ($1, $2, $3, $4)",
+			participant.ID, trans.ID, participant.DollarShare, participant.FractionalShare)
+		if err != nil {
+			return err
+		}
+	}
+	if err = analytics.Refresh(tx, everyone(trans), []time.Time{trans.Timestamp}); err != nil {
+		return err
+	}
+	if err = enqueue(tx); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// removeTransaction Deletes a transaction that users were in
+func removeTransaction(db *database.DB, id int, users []string) error {
+	tx, err := db.Db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var timestamp time.Time
+	if err = tx.QueryRow("DELETE FROM transaction WHERE id=$1 RETURNING timestamp", id).Scan(&timestamp); err != nil {
+		return err
+	}
+	if err = analytics.Refresh(tx, users, []time.Time{timestamp}); err != nil {
+		return err
+	}
+	if err = webhooks.Enqueue(tx, webhooks.TransactionDeleted, gin.H{"id": strconv.Itoa(id)}, users...); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// Invalid Why a transaction or settlement can't be recorded, with the status
+// the API responds with
+type Invalid struct {
+	Status  int
+	Message string
+}
+
+func (e *Invalid) Error() string {
+	return e.Message
+}
+
+// respondErr Responds with why a transaction couldn't be changed. Errors
+// that aren't an *Invalid or from Postgres, like queuing a webhook, are a 500.
+func respondErr(c *gin.Context, err error) {
+	var invalid *Invalid
+	if errors.As(err, &invalid) {
+		c.JSON(invalid.Status, invalid.Message)
+		return
+	}
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		database.CheckDBErr(pqErr, c)
+		return
+	}
+	log.Println(err)
+	c.AbortWithStatusJSON(500, "The server was unable to complete the request")
+}
+
+// checkTransaction Fills in the defaults of a transaction the user is saving
+// and splits its shares. It fails with an *Invalid when it can't be saved.
+func checkTransaction(db *database.DB, userID string, trans *transaction) error {
+	if len(trans.Participants) == 0 {
+		return &Invalid{http.StatusBadRequest, "MUST HAVE AT LEAST 1 PARTICIPANT!!!"}
+	}
+	if trans.SplitType == SplitSettlement {
+		return &Invalid{http.StatusBadRequest, "Settlements must be recorded with PUT /settlement"}
+	}
+	if trans.Payer == "" {
+		trans.Payer = userID
+	}
+	if trans.Timestamp.IsZero() {
+		trans.Timestamp = time.Now()
+	}
+	trans.Category = strings.ToLower(strings.TrimSpace(trans.Category))
+	if !validCategory(trans.Category) {
+		return &Invalid{http.StatusBadRequest, "category must be one of " + strings.Join(Categories, ", ") + ", or empty"}
+	}
+	if !involves(trans, userID) {
+		return &Invalid{http.StatusBadRequest, "You must be the payer or a participant of a transaction you create"}
+	}
+	if others, err := contacts.OthersGhosts(db.Db, userID, everyone(trans)); err != nil {
+		return err
+	} else if others {
+		return &Invalid{http.StatusForbidden, "Only the user who made a placeholder can add it to transactions"}
+	}
+	if blocked, err := contacts.Blocked(db.Db, userID, everyone(trans)); err != nil {
+		return err
+	} else if blocked {
+		return &Invalid{http.StatusForbidden, "You can't add someone who has blocked you, or who you blocked, to a transaction"}
+	}
+	if trans.GroupID != nil {
+		if members, err := groups.Members(db.Db, *trans.GroupID, append(everyone(trans), userID)); err != nil {
+			return err
+		} else if !members {
+			return &Invalid{http.StatusBadRequest, "Everyone in a group transaction must be a member of the group"}
+		}
+	}
+	if err := applyDefaultSplit(db, userID, trans); err != nil {
+		return err
+	}
+	if err := splitShares(trans); err != nil {
+		return &Invalid{http.StatusBadRequest, err.Error()}
+	}
+	return nil
+}
+
+// recordTransaction Checks, splits and stores a new transaction for the user
+// and tells everyone in it
+func recordTransaction(db *database.DB, userID string, trans *transaction) error {
+	if err := checkTransaction(db, userID, trans); err != nil {
+		return err
+	}
+	err := insertTransaction(db, trans, func(tx *sql.Tx) error {
+		return webhooks.Enqueue(tx, webhooks.TransactionCreated, trans, everyone(trans)...)
+	})
+	if err != nil {
+		return err
+	}
+	events.Publish(events.TransactionCreated, trans, everyone(trans)...)
+	notifyTransaction(db, userID, trans)
+	return nil
+}
+
+// RecordDebt Records that userID owes creditorID amount, as an expense
+// creditorID paid with userID as the only participant. Returns the ID of the
+// transaction, or an *Invalid when it can't be recorded.
+func RecordDebt(db *database.DB, userID string, creditorID string, amount float64, description string) (string, error) {
+	if creditorID == userID {
+		return "", &Invalid{http.StatusBadRequest, "You can't owe yourself"}
+	}
+	trans := transaction{
+		Payer:        creditorID,
+		SplitType:    SplitExact,
+		Description:  description,
+		Participants: []participant{{ID: userID, DollarShare: amount}},
+	}
+	err := recordTransaction(db, userID, &trans)
+	return trans.ID, err
+}
+
 func createTransaction(db *database.DB) gin.HandlerFunc {
 	return func(c *gin.Context) {
+		userID := c.GetString("UserID")
 		var trans transaction
 		if err := c.ShouldBindJSON(&trans); err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
 		}
-		if len(trans.Participants) == 0 {
-			c.JSON(http.StatusBadRequest, "MUST HAVE AT LEAST 1 PARTICIPANT!!!")
+		if err := recordTransaction(db, userID, &trans); err != nil {
+			respondErr(c, err)
 			return
 		}
 
-		switch trans.SplitType {
-		case "equal":
-			roundedAmount := math.Round(trans.Amount * 100 / 100)
-			splitAmount := roundedAmount / float64(len(trans.Participants))
-			splitAmount = math.Floor(splitAmount * 100 / 100)
+		c.JSON(200, trans)
+	}
+}
 
-			for i, p := range trans.Participants {
-				if i == len(trans.Participants) {
-					p.DollarShare = splitAmount
-				} else {
-					p.DollarShare = splitAmount + math.Mod(roundedAmount, float64(len(trans.Participants)))
-				}
-			}
-		default:
-			c.JSON(400, "Invalid split type")
-			return
-		}
-		err := db.Db.QueryRow("INSERT INTO transaction (payer, timestamp, split_type) VALUES ($1, $2) RETURNING id",
-			trans.Payer, trans.Timestamp, trans.SplitType).Scan(&trans.ID)
-		if err != nil {
-			database.CheckDBErr(err.(*pq.Error), c)
-			return
-		}
-		// After the transaction is created and ID is generated, add each participant to the DB
-		sqlStr := "INSERT INTO transaction_participants (google_id, transaction_id, dollar_share, fractional_share) "
-		for _, participant := range trans.Participants {
-			sqlStr += fmt.Sprintf("(%s, %s, %.2f, %d),",
-				participant.ID, trans.ID, participant.DollarShare, participant.FractionalShare)
+// applyDefaultSplit Picks the split for a transaction that doesn't name one.
+// Between the user and one contact it is the default the user set for that
+// contact, otherwise it is equal.
+func applyDefaultSplit(db *database.DB, userID string, trans *transaction) error {
+	if trans.SplitType != "" {
+		return nil
+	}
+	trans.SplitType = SplitEqual
+	if len(trans.Participants) != 2 {
+		return nil
+	}
+	you, them := 0, 1
+	if trans.Participants[1].ID == userID {
+		you, them = 1, 0
+	} else if trans.Participants[0].ID != userID {
+		return nil
+	}
+	split, err := contacts.DefaultSplit(db.Db, userID, trans.Participants[them].ID)
+	if err != nil || split == nil {
+		return err
+	}
+	trans.SplitType = split.SplitType
+	trans.Participants[you].FractionalShare = split.YourShare
+	trans.Participants[them].FractionalShare = split.TheirShare
+	return nil
+}
+
+func involves(trans *transaction, userID string) bool {
+	if trans.Payer == userID {
+		return true
+	}
+	for _, p := range trans.Participants {
+		if p.ID == userID {
+			return true
 		}
-		sqlStr = sqlStr[0 : len(sqlStr)-1]
-		err = db.Db.QueryRow(sqlStr).Scan()
+	}
+	return false
+}
 
+// everyone The payer and participants of a transaction
+func everyone(trans *transaction) []string {
+	ids := []string{trans.Payer}
+	for _, p := range trans.Participants {
+		ids = append(ids, p.ID)
+	}
+	return ids
+}
+
+// updateTransaction Replaces a transaction whose shares have already been
+// split, together with all of its participants, and queues the webhooks
+// telling users about it
+func updateTransaction(db *database.DB, trans *transaction, users []string) error {
+	tx, err := db.Db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// Everyone who was in the transaction before, and when it was, to refresh
+	// their analytics too
+	var before time.Time
+	var was pq.StringArray
+	err = tx.QueryRow(`SELECT timestamp, ARRAY(SELECT t.payer UNION SELECT user_id FROM transaction_participants WHERE transaction_id = t.id)
+							FROM transaction t WHERE id=$1 FOR UPDATE`, trans.ID).Scan(&before, &was)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("UPDATE transaction SET payer=$2, timestamp=$3, split_type=$4, description=$5, category=$6, group_id=$7 WHERE id=$1",
+		trans.ID, trans.Payer, trans.Timestamp, trans.SplitType, trans.Description, trans.Category, trans.GroupID)
+	if err != nil {
+		return err
+	}
+	if _, err = tx.Exec("DELETE FROM transaction_participants WHERE transaction_id=$1", trans.ID); err != nil {
+		return err
+	}
+	for _, participant := range trans.Participants {
+		_, err = tx.Exec("INSERT INTO transaction_participants (user_id, transaction_id, dollar_share, fractional_share) VALUES ($1, $2, $3, $4)",
+			participant.ID, trans.ID, participant.DollarShare, participant.FractionalShare)
 		if err != nil {
-			database.CheckDBErr(err.(*pq.Error), c)
-			return
+			return err
 		}
-
-		c.JSON(200, nil)
 	}
+	if err = analytics.Refresh(tx, append(was, everyone(trans)...), []time.Time{before, trans.Timestamp}); err != nil {
+		return err
+	}
+	if err = webhooks.Enqueue(tx, webhooks.TransactionUpdated, trans, users...); err != nil {
+		return err
+	}
+	return tx.Commit()
 }
 
+// modifyTransaction Replaces a transaction with the one in the request, which
+// is checked and split like a new one. Everyone who was in it before is told
+// about the change too.
 func modifyTransaction(db *database.DB) gin.HandlerFunc {
 	return func(c *gin.Context) {
+		id, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.JSON(400, "Invalid transaction ID")
+			return
+		}
+		userID := c.GetString("UserID")
 		var trans transaction
 		if err := c.ShouldBindJSON(&trans); err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
 		}
-		if len(trans.Participants) == 0 {
-			c.JSON(http.StatusBadRequest, "MUST HAVE AT LEAST 1 PARTICIPANT!!!")
+		if !isPartOfTransaction(db, userID, id) {
+			c.AbortWithStatusJSON(404, "Transaction not found")
 			return
 		}
-		queryRows, err := db.Db.Query("UPDATE transaction SET payer=$2, timestamp=$3 WHERE id=$4")
-		id := 0
-		for queryRows.Next() {
-			err = queryRows.Scan(&id)
-			if err != nil {
-				c.AbortWithStatusJSON(500, "The server was unable to update transaction")
-			}
+		var splitType string
+		if err = db.Db.QueryRow("SELECT split_type FROM transaction WHERE id=$1", id).Scan(&splitType); err != nil {
+			database.CheckDBErr(err.(*pq.Error), c)
+			return
+		}
+		if splitType == SplitSettlement {
+			c.JSON(http.StatusBadRequest, "Settlements can't be changed, delete it and record a new one")
+			return
 		}
+		if err = checkTransaction(db, userID, &trans); err != nil {
+			respondErr(c, err)
+			return
+		}
+		before, err := involved(db, id)
 		if err != nil {
 			database.CheckDBErr(err.(*pq.Error), c)
 			return
 		}
-		c.JSON(200, nil)
+
+		trans.ID = strconv.Itoa(id)
+		users := everyone(&trans)
+		for _, u := range before {
+			if !involves(&trans, u) {
+				users = append(users, u)
+			}
+		}
+		if err = updateTransaction(db, &trans, users); err != nil {
+			respondErr(c, err)
+			return
+		}
+		events.Publish(events.TransactionUpdated, trans, users...)
+
+		c.JSON(200, trans)
 	}
 }
@@ -0,0 +1,193 @@
+package transactions
+
+import (
+	"database/sql"
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+	"how-much-do-i-owe/api/contacts"
+	"how-much-do-i-owe/api/payments"
+	"how-much-do-i-owe/database"
+	"how-much-do-i-owe/events"
+	"how-much-do-i-owe/money"
+	"how-much-do-i-owe/webhooks"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Balance What one other account and the user owe each other across every
+// transaction and settlement. A positive amount means they owe the user. The
+// name is the user's nickname for them when they set one. PaymentLinks pay
+// them what the user owes with the payment handles they set up.
+type Balance struct {
+	ID           string          `json:"id"`
+	Name         string          `json:"name"`
+	Email        string          `json:"email"`
+	Balance      float64         `json:"balance"`
+	PaymentLinks []payments.Link `json:"paymentLinks,omitempty"`
+}
+
+type settlement struct {
+	ID          string    `json:"id"`
+	From        string    `json:"from"`
+	To          string    `json:"to"`
+	Amount      float64   `json:"amount"`
+	Timestamp   time.Time `json:"timestamp"`
+	Description string    `json:"description"`
+}
+
+// Balances The net balance between userID and everyone they share a
+// transaction with. Accounts that are settled up are left out.
+func Balances(db *database.DB, userID string) ([]Balance, error) {
+	return BalancesIn(db, userID, nil, nil)
+}
+
+// BalancesIn The balances of userID counting only the transactions of a
+// group and before a time, when they are set
+func BalancesIn(db *database.DB, userID string, groupID *int, before *time.Time) ([]Balance, error) {
+	queryRows, err := db.Db.Query(`SELECT counterparty, COALESCE(NULLIF(c.nickname, ''), a.name), a.email, sum(amount) FROM (
+    											SELECT tp.user_id AS counterparty, tp.dollar_share AS amount, t.group_id, t.timestamp FROM transaction t
+    											    JOIN transaction_participants tp on t.id = tp.transaction_id
+    											    WHERE t.payer=$1 AND tp.user_id<>$1
+    											UNION ALL
+    											SELECT t.payer, -tp.dollar_share, t.group_id, t.timestamp FROM transaction t
+    											    JOIN transaction_participants tp on t.id = tp.transaction_id
+    											    WHERE tp.user_id=$1 AND t.payer<>$1
+    										) owed JOIN account a on a.id = owed.counterparty
+    										LEFT JOIN contact c on c.user_id=$1 AND c.contact_id = owed.counterparty
+    										WHERE ($2::integer IS NULL OR owed.group_id=$2) AND ($3::timestamptz IS NULL OR owed.timestamp < $3)
+    										GROUP BY counterparty, a.name, a.email, c.nickname
+    										HAVING sum(amount) <> 0
+    										ORDER BY 2`, userID, groupID, before)
+	if err != nil {
+		return nil, err
+	}
+	defer queryRows.Close()
+
+	balances := []Balance{}
+	for queryRows.Next() {
+		var b Balance
+		if err = queryRows.Scan(&b.ID, &b.Name, &b.Email, &b.Balance); err != nil {
+			return nil, err
+		}
+		b.Balance = money.FromCents(money.ToCents(b.Balance))
+		balances = append(balances, b)
+	}
+	return balances, queryRows.Err()
+}
+
+// getBalances What the user and everyone else owe each other. groupId counts
+// only the transactions of a group, and before only the ones before a time,
+// which is what monthly statements show.
+func getBalances(db *database.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.GetString("UserID")
+		var groupID *int
+		if c.Query("groupId") != "" {
+			id, err := strconv.Atoi(c.Query("groupId"))
+			if err != nil {
+				c.JSON(400, "Invalid group ID")
+				return
+			}
+			groupID = &id
+		}
+		var before *time.Time
+		if c.Query("before") != "" {
+			t, err := time.Parse(time.RFC3339, c.Query("before"))
+			if err != nil {
+				c.JSON(400, "before must be an RFC 3339 time")
+				return
+			}
+			before = &t
+		}
+		balances, err := BalancesIn(db, userID, groupID, before)
+		if err != nil {
+			database.CheckDBErr(err.(*pq.Error), c)
+			return
+		}
+		for i := range balances {
+			if balances[i].PaymentLinks, err = paymentLinks(db, userID, balances[i]); err != nil {
+				database.CheckDBErr(err.(*pq.Error), c)
+				return
+			}
+		}
+		c.JSON(200, balances)
+	}
+}
+
+// createSettlement Records money changing hands outside the app. It is stored as
+// a transaction paid by From with To as the only participant, which cancels
+// out what From owed To.
+func createSettlement(db *database.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var settle settlement
+		if err := c.ShouldBindJSON(&settle); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if err := recordSettlement(db, c.GetString("UserID"), &settle); err != nil {
+			respondErr(c, err)
+			return
+		}
+
+		c.JSON(201, settle)
+	}
+}
+
+// recordSettlement Checks and stores a settlement the user recorded and tells
+// both sides. It fails with an *Invalid when it can't be recorded.
+func recordSettlement(db *database.DB, userID string, settle *settlement) error {
+	if settle.From == "" {
+		settle.From = userID
+	}
+	if settle.To == "" {
+		settle.To = userID
+	}
+	if settle.From == settle.To || (settle.From != userID && settle.To != userID) {
+		return &Invalid{http.StatusBadRequest, "A settlement must be between you and one other account"}
+	}
+	if settle.Timestamp.IsZero() {
+		settle.Timestamp = time.Now()
+	}
+	if others, err := contacts.OthersGhosts(db.Db, userID, []string{settle.From, settle.To}); err != nil {
+		return err
+	} else if others {
+		return &Invalid{http.StatusForbidden, "Only the user who made a placeholder can record settlements with it"}
+	}
+	if blocked, err := contacts.Blocked(db.Db, settle.From, []string{settle.To}); err != nil {
+		return err
+	} else if blocked {
+		return &Invalid{http.StatusForbidden, "You can't record a settlement with someone who has blocked you, or who you blocked"}
+	}
+
+	trans := transaction{
+		Payer:        settle.From,
+		Timestamp:    settle.Timestamp,
+		SplitType:    SplitSettlement,
+		Description:  settle.Description,
+		Participants: []participant{{ID: settle.To, DollarShare: settle.Amount}},
+	}
+	if err := splitShares(&trans); err != nil {
+		return &Invalid{http.StatusBadRequest, err.Error()}
+	}
+	err := insertTransaction(db, &trans, func(tx *sql.Tx) error {
+		settle.ID = trans.ID
+		settle.Amount = trans.Amount
+		return webhooks.Enqueue(tx, webhooks.SettlementCreated, settle, settle.From, settle.To)
+	})
+	if err != nil {
+		return err
+	}
+	events.Publish(events.SettlementCreated, settle, settle.From, settle.To)
+	notifySettlement(db, userID, settle)
+	return nil
+}
+
+// RecordSettlement Records that from paid to amount, where one of them is
+// userID. Returns the ID of the settlement, or an *Invalid when it can't be
+// recorded.
+func RecordSettlement(db *database.DB, userID string, from string, to string, amount float64, description string) (string, error) {
+	settle := settlement{From: from, To: to, Amount: amount, Description: description}
+	err := recordSettlement(db, userID, &settle)
+	return settle.ID, err
+}
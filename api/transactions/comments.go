@@ -0,0 +1,160 @@
+package transactions
+
+import (
+	"database/sql"
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+	"how-much-do-i-owe/database"
+	"how-much-do-i-owe/events"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type comment struct {
+	ID            int       `json:"id"`
+	TransactionID int       `json:"transactionId"`
+	AuthorID      *string   `json:"authorId"`
+	AuthorName    string    `json:"authorName"`
+	Body          string    `json:"body"`
+	CreatedAt     time.Time `json:"createdAt"`
+}
+
+type commentRequest struct {
+	Body string `json:"body"`
+}
+
+const commentQuery = `SELECT c.id, c.transaction_id, c.author_id, COALESCE(a.name, ''), c.body, c.created_at
+	FROM transaction_comment c LEFT JOIN account a ON a.id = c.author_id`
+
+func scanComment(row interface{ Scan(...interface{}) error }) (comment, error) {
+	var com comment
+	err := row.Scan(&com.ID, &com.TransactionID, &com.AuthorID, &com.AuthorName, &com.Body, &com.CreatedAt)
+	return com, err
+}
+
+// involved The payer and participants of a transaction, who all get its events
+func involved(db *database.DB, transactionID int) ([]string, error) {
+	queryRows, err := db.Db.Query(`SELECT payer FROM transaction WHERE id=$1
+									UNION SELECT user_id FROM transaction_participants WHERE transaction_id=$1`, transactionID)
+	if err != nil {
+		return nil, err
+	}
+	defer queryRows.Close()
+	var users []string
+	for queryRows.Next() {
+		var user string
+		if err = queryRows.Scan(&user); err != nil {
+			return nil, err
+		}
+		users = append(users, user)
+	}
+	return users, queryRows.Err()
+}
+
+// transactionParam The transaction in the URL, if the user is part of it
+func transactionParam(c *gin.Context, db *database.DB) (int, bool) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(400, "Invalid transaction ID")
+		return 0, false
+	}
+	if !isPartOfTransaction(db, c.GetString("UserID"), id) {
+		c.AbortWithStatusJSON(404, "Transaction not found")
+		return 0, false
+	}
+	return id, true
+}
+
+// getComments The comments on a transaction, oldest first
+func getComments(db *database.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, ok := transactionParam(c, db)
+		if !ok {
+			return
+		}
+		queryRows, err := db.Db.Query(commentQuery+" WHERE c.transaction_id=$1 ORDER BY c.created_at, c.id", id)
+		if err != nil {
+			database.CheckDBErr(err.(*pq.Error), c)
+			return
+		}
+		defer queryRows.Close()
+
+		comments := []comment{}
+		for queryRows.Next() {
+			com, err := scanComment(queryRows)
+			if err != nil {
+				c.AbortWithStatusJSON(500, "The server was unable to get comments")
+				return
+			}
+			comments = append(comments, com)
+		}
+
+		c.JSON(200, comments)
+	}
+}
+
+func createComment(db *database.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, ok := transactionParam(c, db)
+		if !ok {
+			return
+		}
+		var req commentRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		req.Body = strings.TrimSpace(req.Body)
+		if req.Body == "" || len(req.Body) > 2000 {
+			c.JSON(http.StatusBadRequest, "A comment needs between 1 and 2000 characters")
+			return
+		}
+
+		var commentID int
+		err := db.Db.QueryRow("INSERT INTO transaction_comment (transaction_id, author_id, body) VALUES ($1, $2, $3) RETURNING id",
+			id, c.GetString("UserID"), req.Body).Scan(&commentID)
+		if err != nil {
+			database.CheckDBErr(err.(*pq.Error), c)
+			return
+		}
+		com, err := scanComment(db.Db.QueryRow(commentQuery+" WHERE c.id=$1", commentID))
+		if err != nil {
+			database.CheckDBErr(err.(*pq.Error), c)
+			return
+		}
+		if users, err := involved(db, id); err == nil {
+			events.Publish(events.CommentCreated, com, users...)
+		}
+
+		c.JSON(201, com)
+	}
+}
+
+// deleteComment Only the author can take a comment back
+func deleteComment(db *database.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.JSON(400, "Invalid comment ID")
+			return
+		}
+		var transactionID int
+		err = db.Db.QueryRow("DELETE FROM transaction_comment WHERE id=$1 AND author_id=$2 RETURNING transaction_id",
+			id, c.GetString("UserID")).Scan(&transactionID)
+		if err == sql.ErrNoRows {
+			c.AbortWithStatusJSON(404, "Comment not found")
+			return
+		}
+		if err != nil {
+			database.CheckDBErr(err.(*pq.Error), c)
+			return
+		}
+		if users, err := involved(db, transactionID); err == nil {
+			events.Publish(events.CommentDeleted, gin.H{"id": id, "transactionId": transactionID}, users...)
+		}
+
+		c.JSON(201, id)
+	}
+}
@@ -0,0 +1,73 @@
+package transactions
+
+import (
+	"fmt"
+	"how-much-do-i-owe/database"
+	"how-much-do-i-owe/notifications"
+)
+
+// accountName The name of an account for notifications, "Someone" when it
+// can't be found
+func accountName(db *database.DB, id string) string {
+	var name string
+	if err := db.Db.QueryRow("SELECT name FROM account WHERE id=$1", id).Scan(&name); err != nil || name == "" {
+		return "Someone"
+	}
+	return name
+}
+
+// notifyTransaction Tells everyone in a new transaction except the user who
+// added it
+func notifyTransaction(db *database.DB, userID string, trans *transaction) {
+	name := accountName(db, userID)
+	description := trans.Description
+	if description == "" {
+		description = "An expense"
+	}
+	link := "/?transaction=" + trans.ID
+	told := map[string]bool{userID: true}
+	for _, p := range trans.Participants {
+		if told[p.ID] {
+			continue
+		}
+		told[p.ID] = true
+		body := fmt.Sprintf("%s: your share is %.2f of %.2f", description, p.DollarShare, trans.Amount)
+		if p.ID == trans.Payer {
+			body += ", which you paid"
+		}
+		notifications.Notify(db.Db, notifications.Notification{
+			UserID: p.ID,
+			Type:   notifications.TransactionAdded,
+			Title:  name + " added you to an expense",
+			Body:   body,
+			Link:   link,
+		})
+	}
+	if !told[trans.Payer] {
+		notifications.Notify(db.Db, notifications.Notification{
+			UserID: trans.Payer,
+			Type:   notifications.TransactionAdded,
+			Title:  name + " recorded an expense you paid",
+			Body:   fmt.Sprintf("%s: %.2f", description, trans.Amount),
+			Link:   link,
+		})
+	}
+}
+
+// notifySettlement Tells the other side of a settlement the user recorded
+func notifySettlement(db *database.DB, userID string, settle *settlement) {
+	name := accountName(db, userID)
+	n := notifications.Notification{
+		Type: notifications.SettlementReceived,
+		Body: settle.Description,
+		Link: "/?transaction=" + settle.ID,
+	}
+	if settle.From == userID {
+		n.UserID = settle.To
+		n.Title = fmt.Sprintf("%s paid you %.2f", name, settle.Amount)
+	} else {
+		n.UserID = settle.From
+		n.Title = fmt.Sprintf("%s recorded that you paid them %.2f", name, settle.Amount)
+	}
+	notifications.Notify(db.Db, n)
+}
@@ -0,0 +1,137 @@
+package transactions
+
+import (
+	"database/sql"
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+	"how-much-do-i-owe/api/payments"
+	"how-much-do-i-owe/database"
+	"how-much-do-i-owe/qr"
+	"net/http"
+	"strconv"
+)
+
+// settlingQuery The transactions between two accounts since they last
+// settled up, which a payment between them settles
+const settlingQuery = `SELECT t.id, t.description FROM transaction t
+    WHERE t.split_type <> 'settlement'
+      AND ((t.payer=$1 AND EXISTS(SELECT 1 FROM transaction_participants tp WHERE tp.transaction_id = t.id AND tp.user_id=$2))
+        OR (t.payer=$2 AND EXISTS(SELECT 1 FROM transaction_participants tp WHERE tp.transaction_id = t.id AND tp.user_id=$1)))
+      AND t.timestamp > COALESCE((SELECT max(s.timestamp) FROM transaction s
+            JOIN transaction_participants sp ON sp.transaction_id = s.id
+            WHERE s.split_type = 'settlement' AND ((s.payer=$1 AND sp.user_id=$2) OR (s.payer=$2 AND sp.user_id=$1))),
+          '-infinity')
+    ORDER BY t.timestamp`
+
+// paymentLinks The links that pay what the user owes in b, with the
+// transactions being settled in the memo. Nothing is returned when the
+// user doesn't owe them anything, or isn't someone payments.Visible lets
+// see their handles.
+func paymentLinks(db *database.DB, userID string, b Balance) ([]payments.Link, error) {
+	if b.Balance >= 0 {
+		return nil, nil
+	}
+	if visible, err := payments.Visible(db.Db, userID, b.ID); err != nil || !visible {
+		return nil, err
+	}
+	handles, err := payments.Handles(db.Db, b.ID)
+	if err != nil || len(handles) == 0 {
+		return nil, err
+	}
+
+	var currency string
+	err = db.Db.QueryRow("SELECT currency FROM contact WHERE user_id=$1 AND contact_id=$2", userID, b.ID).Scan(&currency)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, err
+	}
+	queryRows, err := db.Db.Query(settlingQuery, userID, b.ID)
+	if err != nil {
+		return nil, err
+	}
+	defer queryRows.Close()
+	var refs []string
+	for queryRows.Next() {
+		var id, description string
+		if err = queryRows.Scan(&id, &description); err != nil {
+			return nil, err
+		}
+		// Transactions are referred to by what they were for when they say
+		if description == "" {
+			description = "#" + id
+		}
+		refs = append(refs, description)
+	}
+	if err = queryRows.Err(); err != nil {
+		return nil, err
+	}
+
+	links := payments.Links(handles, -b.Balance, currency, refs)
+	for i := range links {
+		links[i].QRCode = "/api/v1/balance/" + b.ID + "/qr/" + links[i].Kind
+	}
+	return links, nil
+}
+
+// getPaymentQR The QR code of a payment link of a balance the user owes, a
+// PNG or with format=svg an SVG
+func getPaymentQR(db *database.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.GetString("UserID")
+		format := c.DefaultQuery("format", "png")
+		if format != "png" && format != "svg" {
+			c.JSON(http.StatusBadRequest, "format must be png or svg")
+			return
+		}
+		scale := 8
+		if c.Query("scale") != "" {
+			var err error
+			if scale, err = strconv.Atoi(c.Query("scale")); err != nil || scale < 1 || scale > 32 {
+				c.JSON(http.StatusBadRequest, "scale must be between 1 and 32")
+				return
+			}
+		}
+
+		balances, err := Balances(db, userID)
+		if err != nil {
+			database.CheckDBErr(err.(*pq.Error), c)
+			return
+		}
+		var links []payments.Link
+		for _, b := range balances {
+			if b.ID == c.Param("id") {
+				if links, err = paymentLinks(db, userID, b); err != nil {
+					database.CheckDBErr(err.(*pq.Error), c)
+					return
+				}
+			}
+		}
+		var link *payments.Link
+		for i := range links {
+			if links[i].Kind == c.Param("kind") {
+				link = &links[i]
+			}
+		}
+		if link == nil {
+			c.AbortWithStatusJSON(404, "You don't owe this contact anything you can pay this way")
+			return
+		}
+
+		code, err := qr.Encode(link.Payload)
+		if err != nil {
+			c.AbortWithStatusJSON(500, "The server was unable to make the QR code")
+			return
+		}
+		// The code holds the amount owed right now, which changes
+		c.Header("Cache-Control", "no-store")
+		if format == "svg" {
+			c.Data(200, "image/svg+xml", []byte(code.SVG()))
+			return
+		}
+		data, err := code.PNG(scale)
+		if err != nil {
+			c.AbortWithStatusJSON(500, "The server was unable to make the QR code")
+			return
+		}
+		c.Data(200, "image/png", data)
+	}
+}
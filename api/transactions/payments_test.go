@@ -0,0 +1,131 @@
+package transactions
+
+import (
+	"bytes"
+	"database/sql/driver"
+	"github.com/gin-gonic/gin"
+	"how-much-do-i-owe/database/databasetest"
+	"how-much-do-i-owe/qr/qrtest"
+	"image/png"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// handleOwner Answers the queries of paymentLinks for a creditor with a PayPal
+// handle, whose handles the user may see when visible
+func handleOwner(visible bool) databasetest.Answerer {
+	return func(t *testing.T, query string, args []driver.Value) databasetest.Answer {
+		switch {
+		case databasetest.Has(query, "FROM contact WHERE user_id=$1 AND contact_id=$2", "group_member", "contact_block"):
+			if args[0] != "me" || args[1] != "creditor" {
+				t.Errorf("checked whether %v may see the handles of %v", args[0], args[1])
+			}
+			return databasetest.Answer{Columns: []string{"visible"}, Rows: [][]driver.Value{{visible}}}
+		case databasetest.Has(query, "FROM payment_handle"):
+			if !visible {
+				t.Error("read the handles of someone the user may not see them of")
+			}
+			return databasetest.Answer{Columns: []string{"kind", "handle", "name", "bic", "created_at"},
+				Rows: [][]driver.Value{{"paypal", "creditor", "", "", time.Now()}}}
+		case databasetest.Has(query, "SELECT currency FROM contact"):
+			return databasetest.Answer{Columns: []string{"currency"}}
+		case databasetest.Has(query, "t.split_type <> 'settlement'"):
+			return databasetest.Answer{Columns: []string{"id", "description"}}
+		}
+		t.Errorf("unexpected query %s", query)
+		return databasetest.Answer{}
+	}
+}
+
+func TestPaymentLinks(t *testing.T) {
+	owed := Balance{ID: "creditor", Name: "Creditor", Balance: -0.01}
+
+	t.Run("not a contact", func(t *testing.T) {
+		links, err := paymentLinks(databasetest.New(t, handleOwner(false)), "me", owed)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(links) != 0 {
+			t.Errorf("got links %+v to someone who isn't a contact", links)
+		}
+	})
+
+	t.Run("contact", func(t *testing.T) {
+		links, err := paymentLinks(databasetest.New(t, handleOwner(true)), "me", owed)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(links) != 1 || links[0].URL != "https://paypal.me/creditor/0.01" ||
+			links[0].QRCode != "/api/v1/balance/creditor/qr/paypal" {
+			t.Errorf("got links %+v, want the PayPal link", links)
+		}
+	})
+
+	t.Run("owed money", func(t *testing.T) {
+		db := databasetest.New(t, func(t *testing.T, query string, args []driver.Value) databasetest.Answer {
+			t.Errorf("looked up %s for a balance the user is owed", query)
+			return databasetest.Answer{}
+		})
+		links, err := paymentLinks(db, "me", Balance{ID: "creditor", Balance: 5})
+		if err != nil || links != nil {
+			t.Errorf("got %+v, %v, want nothing", links, err)
+		}
+	})
+}
+
+// TestPaymentQR Reads back the QR codes banking apps scan for SEPA transfers
+// and UPI payments
+func TestPaymentQR(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	tests := []struct {
+		kind, handle, name, bic string
+		want                    string
+	}{
+		{"sepa", "DE89370400440532013000", "Alice Example", "BFSWDE33BER",
+			"BCD\n002\n1\nSCT\nBFSWDE33BER\nAlice Example\nDE89370400440532013000\nEUR24.50\n\n\nhow much do i owe: Dinner, #7"},
+		{"upi", "alice@upi", "Alice Example", "",
+			"upi://pay?pa=alice%40upi&pn=Alice%20Example&am=24.50&cu=INR&tn=how%20much%20do%20i%20owe%3A%20Dinner%2C%20%237"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.kind, func(t *testing.T) {
+			db := databasetest.New(t, func(t *testing.T, query string, args []driver.Value) databasetest.Answer {
+				switch {
+				case databasetest.Has(query, "HAVING sum(amount) <> 0"):
+					return databasetest.Answer{Columns: []string{"counterparty", "name", "email", "sum"},
+						Rows: [][]driver.Value{{"creditor", "Alice", "alice@example.com", -24.5}}}
+				case databasetest.Has(query, "FROM contact WHERE user_id=$1 AND contact_id=$2", "contact_block"):
+					return databasetest.Answer{Columns: []string{"visible"}, Rows: [][]driver.Value{{true}}}
+				case databasetest.Has(query, "FROM payment_handle"):
+					return databasetest.Answer{Columns: []string{"kind", "handle", "name", "bic", "created_at"},
+						Rows: [][]driver.Value{{tt.kind, tt.handle, tt.name, tt.bic, time.Now()}}}
+				case databasetest.Has(query, "SELECT currency FROM contact"):
+					return databasetest.Answer{Columns: []string{"currency"}}
+				case databasetest.Has(query, "t.split_type <> 'settlement'"):
+					return databasetest.Answer{Columns: []string{"id", "description"}, Rows: [][]driver.Value{{"3", "Dinner"}, {"7", ""}}}
+				}
+				t.Errorf("unexpected query %s", query)
+				return databasetest.Answer{}
+			})
+			router := gin.New()
+			router.GET("/balance/:id/qr/:kind", func(c *gin.Context) { c.Set("UserID", "me") }, getPaymentQR(db))
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest("GET", "/balance/creditor/qr/"+tt.kind+"?scale=3", nil))
+			if w.Code != 200 || w.Header().Get("Content-Type") != "image/png" {
+				t.Fatalf("got %d %s: %s", w.Code, w.Header().Get("Content-Type"), w.Body.String())
+			}
+			img, err := png.Decode(bytes.NewReader(w.Body.Bytes()))
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := qrtest.Decode(img)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("the QR code holds %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
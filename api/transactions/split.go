@@ -0,0 +1,114 @@
+package transactions
+
+import (
+	"fmt"
+	"how-much-do-i-owe/money"
+)
+
+// Split types accepted by createTransaction. Settlements are recorded through
+// createSettlement and always have exactly one participant.
+const (
+	SplitEqual      = "equal"
+	SplitExact      = "exact"
+	SplitPercent    = "percent"
+	SplitShares     = "shares"
+	SplitSettlement = "settlement"
+)
+
+// Categories What an expense can be for. A transaction without one is
+// uncategorized, settlements never have one.
+var Categories = []string{"groceries", "dining", "housing", "utilities", "transport", "travel",
+	"entertainment", "shopping", "health", "other"}
+
+func validCategory(category string) bool {
+	if category == "" {
+		return true
+	}
+	for _, c := range Categories {
+		if c == category {
+			return true
+		}
+	}
+	return false
+}
+
+// splitShares Fills in the DollarShare of every participant according to
+// trans.SplitType. Amounts are handled in whole cents, and cents that can't be
+// divided evenly go to the first participants so shares always add up to the
+// amount exactly.
+//
+//   - equal: the amount is divided evenly
+//   - exact: every participant's dollarShare is taken as given, the amount is their sum
+//   - percent: fractionalShare is a percentage, they must add up to 100
+//   - shares: fractionalShare is a weight, e.g. 2 and 1 for a 2/3 and 1/3 split
+func splitShares(trans *transaction) error {
+	if len(trans.Participants) == 0 {
+		return fmt.Errorf("MUST HAVE AT LEAST 1 PARTICIPANT!!!")
+	}
+	weights := make([]int64, len(trans.Participants))
+	switch trans.SplitType {
+	case SplitEqual:
+		for i := range weights {
+			weights[i] = 1
+		}
+	case SplitExact, SplitSettlement:
+		var total int64
+		for i, p := range trans.Participants {
+			cents := money.ToCents(p.DollarShare)
+			if cents <= 0 {
+				return fmt.Errorf("every participant must have a positive dollarShare")
+			}
+			trans.Participants[i].DollarShare = money.FromCents(cents)
+			total += cents
+		}
+		if trans.Amount != 0 && money.ToCents(trans.Amount) != total {
+			return fmt.Errorf("shares add up to %.2f but the amount is %.2f", money.FromCents(total), trans.Amount)
+		}
+		trans.Amount = money.FromCents(total)
+		return nil
+	case SplitPercent, SplitShares:
+		var total int64
+		for i, p := range trans.Participants {
+			if p.FractionalShare <= 0 {
+				return fmt.Errorf("every participant must have a positive fractionalShare")
+			}
+			weights[i] = int64(p.FractionalShare)
+			total += weights[i]
+		}
+		if trans.SplitType == SplitPercent && total != 100 {
+			return fmt.Errorf("percentages add up to %d, not 100", total)
+		}
+	default:
+		return fmt.Errorf("invalid split type")
+	}
+
+	amount := money.ToCents(trans.Amount)
+	if amount <= 0 {
+		return fmt.Errorf("amount must be positive")
+	}
+	for i, cents := range distribute(amount, weights) {
+		trans.Participants[i].DollarShare = money.FromCents(cents)
+	}
+	trans.Amount = money.FromCents(amount)
+	return nil
+}
+
+// distribute Divides amount proportionally to weights, handing out the
+// leftover cents one at a time in order
+func distribute(amount int64, weights []int64) []int64 {
+	var totalWeight int64
+	for _, w := range weights {
+		totalWeight += w
+	}
+	shares := make([]int64, len(weights))
+	remaining := amount
+	for i, w := range weights {
+		shares[i] = amount * w / totalWeight
+		remaining -= shares[i]
+	}
+	for i := 0; remaining > 0; i = (i + 1) % len(shares) {
+		shares[i]++
+		remaining--
+	}
+	return shares
+}
@@ -0,0 +1,201 @@
+package transactions
+
+import (
+	"database/sql/driver"
+	"how-much-do-i-owe/database/databasetest"
+	"reflect"
+	"testing"
+)
+
+func TestDistribute(t *testing.T) {
+	tests := []struct {
+		name    string
+		amount  int64
+		weights []int64
+		want    []int64
+	}{
+		{"even", 900, []int64{1, 1, 1}, []int64{300, 300, 300}},
+		{"one cent left over", 1000, []int64{1, 1, 1}, []int64{334, 333, 333}},
+		{"two cents left over", 1001, []int64{1, 1, 1}, []int64{334, 334, 333}},
+		{"less than a cent each", 2, []int64{1, 1, 1}, []int64{1, 1, 0}},
+		{"weighted", 1000, []int64{2, 1}, []int64{667, 333}},
+		{"percentages", 9999, []int64{50, 30, 20}, []int64{5000, 3000, 1999}},
+		{"one participant", 1234, []int64{5}, []int64{1234}},
+		{"nothing", 0, []int64{1, 1}, []int64{0, 0}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := distribute(tt.amount, tt.weights)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+			var sum int64
+			for _, cents := range got {
+				sum += cents
+			}
+			if sum != tt.amount {
+				t.Errorf("shares add up to %d, not %d", sum, tt.amount)
+			}
+		})
+	}
+}
+
+// shares Participants with the given dollar or fractional shares
+func shares(dollar []float64, fractional []int) []participant {
+	n := len(dollar)
+	if len(fractional) > n {
+		n = len(fractional)
+	}
+	p := make([]participant, n)
+	for i := range p {
+		if i < len(dollar) {
+			p[i].DollarShare = dollar[i]
+		}
+		if i < len(fractional) {
+			p[i].FractionalShare = fractional[i]
+		}
+	}
+	return p
+}
+
+func TestSplitShares(t *testing.T) {
+	tests := []struct {
+		name         string
+		splitType    string
+		amount       float64
+		participants []participant
+		want         []float64
+		wantAmount   float64
+		wantErr      bool
+	}{
+		{"equal", SplitEqual, 30, shares(nil, []int{0, 0, 0}), []float64{10, 10, 10}, 30, false},
+		{"equal with a remainder", SplitEqual, 10, shares(nil, []int{0, 0, 0}), []float64{3.34, 3.33, 3.33}, 10, false},
+		{"equal rounds the amount to cents", SplitEqual, 10.004, shares(nil, []int{0, 0}), []float64{5, 5}, 10, false},
+		{"equal of zero", SplitEqual, 0, shares(nil, []int{0, 0}), nil, 0, true},
+		{"equal of a negative amount", SplitEqual, -10, shares(nil, []int{0, 0}), nil, 0, true},
+
+		{"exact", SplitExact, 0, shares([]float64{2.5, 7.5}, nil), []float64{2.5, 7.5}, 10, false},
+		{"exact matching the amount", SplitExact, 10, shares([]float64{2.5, 7.5}, nil), []float64{2.5, 7.5}, 10, false},
+		{"exact not matching the amount", SplitExact, 12, shares([]float64{2.5, 7.5}, nil), nil, 0, true},
+		{"exact with a zero share", SplitExact, 0, shares([]float64{10, 0}, nil), nil, 0, true},
+		{"exact with a negative share", SplitExact, 0, shares([]float64{15, -5}, nil), nil, 0, true},
+		{"settlement", SplitSettlement, 0, shares([]float64{42.42}, nil), []float64{42.42}, 42.42, false},
+
+		{"percent", SplitPercent, 200, shares(nil, []int{50, 25, 25}), []float64{100, 50, 50}, 200, false},
+		{"percent with a remainder", SplitPercent, 99.99, shares(nil, []int{50, 30, 20}), []float64{50, 30, 19.99}, 99.99, false},
+		{"percent not adding up to 100", SplitPercent, 100, shares(nil, []int{50, 40}), nil, 0, true},
+		{"percent over 100", SplitPercent, 100, shares(nil, []int{60, 60}), nil, 0, true},
+		{"percent with a zero share", SplitPercent, 100, shares(nil, []int{100, 0}), nil, 0, true},
+		{"percent with a negative share", SplitPercent, 100, shares(nil, []int{110, -10}), nil, 0, true},
+		{"percent of zero", SplitPercent, 0, shares(nil, []int{50, 50}), nil, 0, true},
+
+		{"shares", SplitShares, 10, shares(nil, []int{2, 1}), []float64{6.67, 3.33}, 10, false},
+		{"shares with a remainder", SplitShares, 0.05, shares(nil, []int{1, 1, 1}), []float64{0.02, 0.02, 0.01}, 0.05, false},
+		{"shares with a zero share", SplitShares, 10, shares(nil, []int{2, 0}), nil, 0, true},
+		{"shares with a negative share", SplitShares, 10, shares(nil, []int{3, -1}), nil, 0, true},
+		{"shares of a negative amount", SplitShares, -10, shares(nil, []int{1, 1}), nil, 0, true},
+
+		{"no participants", SplitEqual, 10, nil, nil, 0, true},
+		{"unknown split type", "halves", 10, shares(nil, []int{1, 1}), nil, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			trans := transaction{SplitType: tt.splitType, Amount: tt.amount, Participants: tt.participants}
+			err := splitShares(&trans)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, want error %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			got := make([]float64, len(trans.Participants))
+			for i, p := range trans.Participants {
+				got[i] = p.DollarShare
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got shares %v, want %v", got, tt.want)
+			}
+			if trans.Amount != tt.wantAmount {
+				t.Errorf("got amount %v, want %v", trans.Amount, tt.wantAmount)
+			}
+		})
+	}
+}
+
+// contactSplit Answers the lookup of the default split the user set for
+// "contact", which is 70% for the user when set
+func contactSplit(set bool) databasetest.Answerer {
+	return func(t *testing.T, query string, args []driver.Value) databasetest.Answer {
+		if !databasetest.Has(query, "SELECT split_type, your_share, their_share FROM contact") {
+			t.Errorf("unexpected query %s", query)
+			return databasetest.Answer{}
+		}
+		if args[0] != "me" || args[1] != "contact" {
+			t.Errorf("looked up the split %v set for %v", args[0], args[1])
+		}
+		a := databasetest.Answer{Columns: []string{"split_type", "your_share", "their_share"}}
+		if set {
+			a.Rows = [][]driver.Value{{SplitPercent, int64(70), int64(30)}}
+		}
+		return a
+	}
+}
+
+func TestApplyDefaultSplit(t *testing.T) {
+	tests := []struct {
+		name         string
+		splitType    string
+		participants []string
+		set          bool
+		wantType     string
+		wantShares   []int
+		wantDollars  []float64
+	}{
+		{"with the contact", "", []string{"me", "contact"}, true, SplitPercent, []int{70, 30}, []float64{70, 30}},
+		{"with the contact listed first", "", []string{"contact", "me"}, true, SplitPercent, []int{30, 70}, []float64{30, 70}},
+		{"no default set", "", []string{"me", "contact"}, false, SplitEqual, []int{0, 0}, []float64{50, 50}},
+		{"a split was named", SplitShares, []string{"me", "contact"}, true, SplitShares, []int{1, 1}, []float64{50, 50}},
+		{"more than one contact", "", []string{"me", "contact", "other"}, true, SplitEqual, []int{0, 0, 0}, []float64{33.34, 33.33, 33.33}},
+		{"without the user", "", []string{"contact", "other"}, true, SplitEqual, []int{0, 0}, []float64{50, 50}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			trans := transaction{SplitType: tt.splitType, Amount: 100}
+			for _, id := range tt.participants {
+				p := participant{ID: id}
+				if tt.splitType == SplitShares {
+					p.FractionalShare = 1
+				}
+				trans.Participants = append(trans.Participants, p)
+			}
+			lookup := tt.splitType == "" && len(tt.participants) == 2 && (tt.participants[0] == "me" || tt.participants[1] == "me")
+			db := databasetest.New(t, func(t *testing.T, query string, args []driver.Value) databasetest.Answer {
+				if !lookup {
+					t.Errorf("looked up a default split for %v", tt.participants)
+				}
+				return contactSplit(tt.set)(t, query, args)
+			})
+
+			if err := applyDefaultSplit(db, "me", &trans); err != nil {
+				t.Fatal(err)
+			}
+			if trans.SplitType != tt.wantType {
+				t.Errorf("got split %q, want %q", trans.SplitType, tt.wantType)
+			}
+			for i, p := range trans.Participants {
+				if p.FractionalShare != tt.wantShares[i] {
+					t.Errorf("%s got share %d, want %d", p.ID, p.FractionalShare, tt.wantShares[i])
+				}
+			}
+			// The split it picked has to work for the transaction
+			if err := splitShares(&trans); err != nil {
+				t.Fatal(err)
+			}
+			for i, p := range trans.Participants {
+				if p.DollarShare != tt.wantDollars[i] {
+					t.Errorf("%s pays %v, want %v", p.ID, p.DollarShare, tt.wantDollars[i])
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,217 @@
+package authentication
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+	"how-much-do-i-owe/api/tokens"
+	"how-much-do-i-owe/database"
+	"net/http"
+	"time"
+)
+
+// errIdentityInUse The identity already logs in to a different account
+var errIdentityInUse = errors.New("this login is already linked to another account")
+
+type linkedIdentity struct {
+	Provider  string    `json:"provider"`
+	Subject   string    `json:"subject"`
+	Email     string    `json:"email"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+type mergeRequest struct {
+	// From The account that is merged away and deleted
+	From string `json:"from"`
+	// Into The account that receives everything From had
+	Into string `json:"into"`
+}
+
+// AdminRoutes The routes created by the package nested in
+// api/v1/admin/*, they must be behind RequireAdmin
+func AdminRoutes(r *gin.RouterGroup, db *database.DB) {
+	r.PUT("/merge", mergeAccountsHandler(db))
+}
+
+// RequireAdmin Only lets accounts flagged with is_admin through
+func RequireAdmin(db *database.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		isAdmin := false
+		err := db.Db.QueryRow("SELECT is_admin FROM account WHERE id=$1", c.GetString("UserID")).Scan(&isAdmin)
+		if err != nil && err != sql.ErrNoRows {
+			database.CheckDBErr(err.(*pq.Error), c)
+			return
+		}
+		if !isAdmin {
+			c.AbortWithStatusJSON(http.StatusForbidden, "Only administrators can do this")
+			return
+		}
+		c.Next()
+	}
+}
+
+// handleLink Starts a login with another provider whose identity is added to
+// the account of the current session instead of logging in
+func handleLink(db *database.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, _, err := CheckSession(c, db)
+		if err == ErrNoSession {
+			c.AbortWithStatusJSON(401, "Active Session Required")
+			return
+		}
+		if err != nil {
+			c.AbortWithStatusJSON(500, "The server was unable to retrieve this session")
+			return
+		}
+		startLogin(c, db, userID)
+	}
+}
+
+// linkIdentity Adds an identity to an account, or refreshes its tokens if it's already there
+func linkIdentity(ctx context.Context, identity Identity, userID string, db *database.DB) error {
+	var owner string
+	err := db.Db.QueryRowContext(ctx, "SELECT user_id FROM identity WHERE provider=$1 AND subject=$2",
+		identity.Provider, identity.Subject).Scan(&owner)
+	switch {
+	case err == sql.ErrNoRows:
+		_, err = db.Db.ExecContext(ctx, `INSERT INTO identity (provider, subject, user_id, email, email_verified)
+											VALUES ($1, $2, $3, $4, $5)`,
+			identity.Provider, identity.Subject, userID, identity.Email, identity.EmailVerified)
+		if err != nil {
+			return err
+		}
+		return saveTokens(ctx, db.Db, identity)
+	case err != nil:
+		return err
+	case owner != userID:
+		return errIdentityInUse
+	}
+	_, err = db.Db.ExecContext(ctx, "UPDATE identity SET email=$1, email_verified=$4 WHERE provider=$2 AND subject=$3",
+		identity.Email, identity.Provider, identity.Subject, identity.EmailVerified)
+	if err != nil {
+		return err
+	}
+	return saveTokens(ctx, db.Db, identity)
+}
+
+func getIdentities(db *database.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		queryRows, err := db.Db.Query(`SELECT provider, subject, email, created_at FROM identity
+												WHERE user_id=$1 ORDER BY created_at`, c.GetString("UserID"))
+		if err != nil {
+			database.CheckDBErr(err.(*pq.Error), c)
+			return
+		}
+		defer queryRows.Close()
+
+		identities := []linkedIdentity{}
+		for queryRows.Next() {
+			var identity linkedIdentity
+			if err = queryRows.Scan(&identity.Provider, &identity.Subject, &identity.Email, &identity.CreatedAt); err != nil {
+				c.AbortWithStatusJSON(500, "The server was unable to get linked logins")
+				return
+			}
+			identities = append(identities, identity)
+		}
+
+		c.JSON(200, identities)
+	}
+}
+
+// unlinkIdentity Removes a login from the account. The last one can't be
+// removed, the account would be impossible to log in to.
+func unlinkIdentity(db *database.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !tokens.RequireSession(c) {
+			return
+		}
+		userID := c.GetString("UserID")
+		tx, err := db.Db.BeginTx(c.Request.Context(), nil)
+		if err != nil {
+			c.AbortWithStatusJSON(503, "There was an error contacting the database.")
+			return
+		}
+		defer tx.Rollback()
+
+		// Lock every identity of the account so two unlinks at once can't both
+		// see a second identity and remove the last two
+		count := 0
+		err = tx.QueryRow(`SELECT count(*) FROM (SELECT 1 FROM identity WHERE user_id=$1 FOR UPDATE) identities`,
+			userID).Scan(&count)
+		if err != nil {
+			database.CheckDBErr(err.(*pq.Error), c)
+			return
+		}
+		if count <= 1 {
+			c.AbortWithStatusJSON(http.StatusConflict, "This is the only way to log in to your account and can't be removed")
+			return
+		}
+
+		result, err := tx.Exec("DELETE FROM identity WHERE user_id=$1 AND provider=$2 AND subject=$3",
+			userID, c.Param("provider"), c.Param("subject"))
+		if err != nil {
+			database.CheckDBErr(err.(*pq.Error), c)
+			return
+		}
+		if removed, _ := result.RowsAffected(); removed == 0 {
+			c.AbortWithStatusJSON(404, "Login not found")
+			return
+		}
+		if err = tx.Commit(); err != nil {
+			database.CheckDBErr(err.(*pq.Error), c)
+			return
+		}
+
+		c.JSON(201, "success")
+	}
+}
+
+func mergeAccountsHandler(db *database.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var merge mergeRequest
+		if err := c.ShouldBindJSON(&merge); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if merge.From == "" || merge.Into == "" || merge.From == merge.Into {
+			c.JSON(http.StatusBadRequest, "from and into must be two different accounts")
+			return
+		}
+
+		err := MergeAccounts(c.Request.Context(), db, merge.From, merge.Into)
+		if err == sql.ErrNoRows {
+			c.AbortWithStatusJSON(404, "Account not found")
+			return
+		}
+		if err != nil {
+			database.RespondErr(err, c)
+			return
+		}
+
+		c.JSON(201, merge)
+	}
+}
+
+// MergeAccounts Moves every transaction, contact, login and token of the
+// account from into the account into, then deletes from. When both accounts
+// took part in the same transaction their shares are added together.
+func MergeAccounts(ctx context.Context, db *database.DB, from string, into string) error {
+	tx, err := db.Db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, id := range []string{from, into} {
+		if err = tx.QueryRow("SELECT id FROM account WHERE id=$1 FOR UPDATE", id).Scan(&id); err != nil {
+			return err
+		}
+	}
+
+	if err = database.MergeAccount(ctx, tx, from, into); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,39 @@
+package authentication
+
+import (
+	"github.com/gin-gonic/gin"
+	"how-much-do-i-owe/database"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// TestTokensCantChangeLogins A stolen API token mustn't be enough to lock the
+// owner out of their account or log them out. The routes are answered before
+// the database is used, so none is needed.
+func TestTokensCantChangeLogins(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	api := router.Group("/api/v1", func(c *gin.Context) {
+		c.Set("UserID", "me")
+		c.Set("AuthMethod", "token")
+	})
+	AccountRoutes(api, &database.DB{})
+
+	tests := []struct {
+		method, path string
+	}{
+		{"DELETE", "/api/v1/identity/google/42"},
+		{"DELETE", "/api/v1/sessions"},
+		{"DELETE", "/api/v1/session/abc"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.method+" "+tt.path, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest(tt.method, tt.path, nil))
+			if w.Code != http.StatusForbidden {
+				t.Errorf("got status %d, want %d", w.Code, http.StatusForbidden)
+			}
+		})
+	}
+}
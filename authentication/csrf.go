@@ -0,0 +1,157 @@
+package authentication
+
+import (
+	"crypto/subtle"
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/sessions"
+	"how-much-do-i-owe/database"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+)
+
+const (
+	// CSRFHeader Where the browser app sends the CSRF token with every request
+	// that changes something
+	CSRFHeader = "X-CSRF-Token"
+	// csrfCookie Where the browser app reads the token from. It's a copy, the
+	// token that counts is the one kept in the session.
+	csrfCookie = "csrf_token"
+)
+
+// CSRFProtect Rejects requests that change something on behalf of a cookie
+// session unless they come from this site's origin and carry the session's
+// CSRF token. Requests with a bearer token can't be forged by another site,
+// so they are left to HasValidSession.
+func CSRFProtect(db *database.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		switch c.Request.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			c.Next()
+			return
+		}
+		if strings.HasPrefix(c.GetHeader("Authorization"), "Bearer ") {
+			c.Next()
+			return
+		}
+
+		if !sameOrigin(c.Request) {
+			c.AbortWithStatusJSON(http.StatusForbidden, "Cross-origin requests aren't allowed")
+			return
+		}
+
+		session, err := db.SessionStore.Get(c.Request, "session")
+		if err != nil {
+			c.AbortWithStatusJSON(500, "The server was unable to retrieve this session")
+			return
+		}
+		// Without a logged in session there's nothing for another site to
+		// borrow, routes that need one reject the request themselves
+		if sessionID, _ := session.Values["SessionID"].(string); sessionID == "" {
+			c.Next()
+			return
+		}
+		expected, _ := session.Values["CSRFToken"].(string)
+		given := c.GetHeader(CSRFHeader)
+		if expected == "" || subtle.ConstantTimeCompare([]byte(expected), []byte(given)) != 1 {
+			c.AbortWithStatusJSON(http.StatusForbidden, "Missing or invalid CSRF token")
+			return
+		}
+		c.Next()
+	}
+}
+
+// sameOrigin If the Origin, or failing that the Referer, of a request is this
+// site or one listed in CSRF_TRUSTED_ORIGINS. Browsers send at least one of
+// them with every request that changes something, a request with neither
+// isn't from a browser and has to pass the token check on its own.
+func sameOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		referer, err := url.Parse(r.Header.Get("Referer"))
+		if err != nil {
+			return false
+		}
+		if referer.Host == "" {
+			return true
+		}
+		origin = referer.Scheme + "://" + referer.Host
+	}
+
+	scheme := "http"
+	if r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https" {
+		scheme = "https"
+	}
+	if strings.EqualFold(origin, scheme+"://"+r.Host) {
+		return true
+	}
+	for _, trusted := range strings.Split(os.Getenv("CSRF_TRUSTED_ORIGINS"), ",") {
+		if trusted = strings.TrimSpace(trusted); trusted != "" && strings.EqualFold(origin, trusted) {
+			return true
+		}
+	}
+	return false
+}
+
+// issueCSRFToken Gives a session a new CSRF token, the session still has to be saved
+func issueCSRFToken(c *gin.Context, session *sessions.Session) error {
+	token, err := randomString(32)
+	if err != nil {
+		return err
+	}
+	session.Values["CSRFToken"] = token
+	setCSRFCookie(c, token)
+	return nil
+}
+
+// setCSRFCookie Hands the token to the browser app. Unlike the session cookie
+// scripts can read it, which is what makes another site unable to.
+func setCSRFCookie(c *gin.Context, token string) {
+	http.SetCookie(c.Writer, &http.Cookie{
+		Name:     csrfCookie,
+		Value:    token,
+		Path:     "/",
+		MaxAge:   int(SessionLifetime.Seconds()),
+		Secure:   os.Getenv("ENV") != "DEV",
+		SameSite: http.SameSiteStrictMode,
+	})
+}
+
+// getCSRFToken The session's CSRF token, for sessions that started before
+// they had one and for clients that don't read cookies
+func getCSRFToken(db *database.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		_, _, err := CheckSession(c, db)
+		if err == ErrNoSession {
+			c.AbortWithStatusJSON(401, "Active Session Required")
+			return
+		}
+		if err != nil {
+			c.AbortWithStatusJSON(500, "The server was unable to retrieve this session")
+			return
+		}
+		session, err := db.SessionStore.Get(c.Request, "session")
+		if err != nil {
+			c.AbortWithStatusJSON(500, "The server was unable to retrieve this session")
+			return
+		}
+
+		token, _ := session.Values["CSRFToken"].(string)
+		if token == "" {
+			if err = issueCSRFToken(c, session); err != nil {
+				c.AbortWithStatusJSON(500, "The server was unable to create a CSRF token")
+				return
+			}
+			if err = session.Save(c.Request, c.Writer); err != nil {
+				c.AbortWithStatusJSON(500, "Unable to store session data")
+				return
+			}
+			token = session.Values["CSRFToken"].(string)
+		} else {
+			setCSRFCookie(c, token)
+		}
+
+		c.JSON(200, token)
+	}
+}
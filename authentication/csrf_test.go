@@ -0,0 +1,130 @@
+package authentication
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/sessions"
+	"how-much-do-i-owe/database"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+const csrfTestToken = "session-csrf-token"
+
+// newCSRFRouter A router with CSRFProtect in front of a route that changes
+// nothing, and the cookie of a logged in session
+func newCSRFRouter(t *testing.T) (*gin.Engine, *http.Cookie) {
+	gin.SetMode(gin.TestMode)
+	store := sessions.NewFilesystemStore(t.TempDir(), []byte("0123456789abcdef0123456789abcdef"))
+	db := &database.DB{SessionStore: store}
+
+	req := httptest.NewRequest("GET", "/", nil)
+	w := httptest.NewRecorder()
+	session, err := store.New(req, "session")
+	if err != nil {
+		t.Fatal(err)
+	}
+	session.Values["SessionID"] = "session-id"
+	session.Values["UserID"] = "user-id"
+	session.Values["CSRFToken"] = csrfTestToken
+	if err = session.Save(req, w); err != nil {
+		t.Fatal(err)
+	}
+
+	router := gin.New()
+	router.Use(CSRFProtect(db))
+	ok := func(c *gin.Context) { c.JSON(200, "ok") }
+	router.GET("/api/v1/transactions", ok)
+	router.PUT("/api/v1/transaction", ok)
+	router.DELETE("/api/v1/transaction/:id", ok)
+	router.POST("/oauth/v1/logout", ok)
+	return router, w.Result().Cookies()[0]
+}
+
+func TestCSRFProtect(t *testing.T) {
+	tests := []struct {
+		name    string
+		method  string
+		path    string
+		cookie  bool
+		headers map[string]string
+		want    int
+	}{
+		{"same origin with token", "PUT", "/api/v1/transaction", true,
+			map[string]string{"Origin": "http://example.com", CSRFHeader: csrfTestToken}, 200},
+		{"same origin logout with token", "POST", "/oauth/v1/logout", true,
+			map[string]string{"Origin": "http://example.com", CSRFHeader: csrfTestToken}, 200},
+		{"same origin without token", "PUT", "/api/v1/transaction", true,
+			map[string]string{"Origin": "http://example.com"}, 403},
+		{"same origin with wrong token", "DELETE", "/api/v1/transaction/1", true,
+			map[string]string{"Origin": "http://example.com", CSRFHeader: "guess"}, 403},
+		{"cross origin with token", "PUT", "/api/v1/transaction", true,
+			map[string]string{"Origin": "https://evil.example", CSRFHeader: csrfTestToken}, 403},
+		{"cross origin logout", "POST", "/oauth/v1/logout", true,
+			map[string]string{"Origin": "https://evil.example"}, 403},
+		{"null origin", "PUT", "/api/v1/transaction", true,
+			map[string]string{"Origin": "null", CSRFHeader: csrfTestToken}, 403},
+		{"other scheme", "PUT", "/api/v1/transaction", true,
+			map[string]string{"Origin": "https://example.com", CSRFHeader: csrfTestToken}, 403},
+		{"cross origin referer", "DELETE", "/api/v1/transaction/1", true,
+			map[string]string{"Referer": "https://evil.example/page", CSRFHeader: csrfTestToken}, 403},
+		{"same origin referer", "DELETE", "/api/v1/transaction/1", true,
+			map[string]string{"Referer": "http://example.com/", CSRFHeader: csrfTestToken}, 200},
+		{"cross origin read", "GET", "/api/v1/transactions", true,
+			map[string]string{"Origin": "https://evil.example"}, 200},
+		{"bearer token from anywhere", "PUT", "/api/v1/transaction", false,
+			map[string]string{"Origin": "https://evil.example", "Authorization": "Bearer hmdio_token"}, 200},
+		{"bearer token doesn't excuse a cookie from another origin", "PUT", "/api/v1/transaction", true,
+			map[string]string{"Origin": "https://evil.example", "Authorization": "Basic dXNlcjpwYXNz"}, 403},
+		{"no session", "PUT", "/api/v1/transaction", false,
+			map[string]string{"Origin": "http://example.com"}, 200},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			router, cookie := newCSRFRouter(t)
+			req := httptest.NewRequest(test.method, "http://example.com"+test.path, nil)
+			if test.cookie {
+				req.AddCookie(cookie)
+			}
+			for key, value := range test.headers {
+				req.Header.Set(key, value)
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+			if w.Code != test.want {
+				t.Errorf("expected %d, got %d %s", test.want, w.Code, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestTrustedOrigins(t *testing.T) {
+	t.Setenv("CSRF_TRUSTED_ORIGINS", "http://localhost:3000, https://app.example.com")
+	router, cookie := newCSRFRouter(t)
+	for origin, want := range map[string]int{
+		"http://localhost:3000":   200,
+		"https://app.example.com": 200,
+		"https://evil.example":    403,
+	} {
+		req := httptest.NewRequest("PUT", "http://example.com/api/v1/transaction", nil)
+		req.AddCookie(cookie)
+		req.Header.Set("Origin", origin)
+		req.Header.Set(CSRFHeader, csrfTestToken)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		if w.Code != want {
+			t.Errorf("origin %s: expected %d, got %d", origin, want, w.Code)
+		}
+	}
+}
+
+func TestLogoutRequiresPost(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	Routes(router.Group("oauth/v1"), &database.DB{})
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/oauth/v1/logout", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("GET /oauth/v1/logout should no longer log out, got %d", w.Code)
+	}
+}
@@ -0,0 +1,222 @@
+package authentication
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+	"how-much-do-i-owe/database"
+	"how-much-do-i-owe/mail"
+	"how-much-do-i-owe/secrets"
+	"net/http"
+	netmail "net/mail"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	emailLinkLifetime = 15 * time.Minute
+	// At most this many links are sent to one address, and requested from one
+	// IP address, within emailRateWindow
+	emailRatePerAddress = 3
+	emailRatePerIP      = 10
+	emailRateWindow     = 15 * time.Minute
+)
+
+type emailLoginRequest struct {
+	Email string `json:"email"`
+	// Link Add the address to the account of the current session instead of logging in with it
+	Link bool `json:"link"`
+}
+
+// emailClaims What a magic link carries. The nonce ties it to a row in
+// email_login so it can only be used once.
+type emailClaims struct {
+	Email  string `json:"email"`
+	Expiry int64  `json:"exp"`
+	Nonce  string `json:"nonce"`
+}
+
+func emailLoginSecret() []byte {
+	if secret := os.Getenv("EMAIL_LOGIN_SECRET"); secret != "" {
+		return []byte(secret)
+	}
+	return secrets.SigningKey("email login")
+}
+
+// verifyEmailLink Checks the signature and expiry of a magic link token
+func verifyEmailLink(token string) (emailClaims, error) {
+	var claims emailClaims
+	if err := secrets.Verify(emailLoginSecret(), token, &claims); err != nil {
+		return claims, fmt.Errorf("invalid login link: %s", err.Error())
+	}
+	if time.Now().After(time.Unix(claims.Expiry, 0)) {
+		return claims, fmt.Errorf("login link has expired")
+	}
+	return claims, nil
+}
+
+func hashNonce(nonce string) string {
+	sum := sha256.Sum256([]byte(nonce))
+	return hex.EncodeToString(sum[:])
+}
+
+// accountLabel How an email names the account an address is being added to
+type accountLabel struct {
+	name  string
+	email string
+}
+
+func (a accountLabel) String() string {
+	if a.name == "" {
+		return a.email
+	}
+	if a.email == "" {
+		return a.name
+	}
+	return a.name + " (" + a.email + ")"
+}
+
+// requestEmailLogin Emails a single-use login link. The response is the same
+// whether or not the address has an account. A link that adds the address to
+// the logged in account says so, and names that account.
+func requestEmailLogin(db *database.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req emailLoginRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		address, err := netmail.ParseAddress(req.Email)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, "Invalid email address")
+			return
+		}
+		email := strings.ToLower(address.Address)
+
+		var linkTo *string
+		var account accountLabel
+		if req.Link {
+			userID, _, err := CheckSession(c, db)
+			if err == ErrNoSession {
+				c.AbortWithStatusJSON(401, "Active Session Required")
+				return
+			}
+			if err != nil {
+				c.AbortWithStatusJSON(500, "The server was unable to retrieve this session")
+				return
+			}
+			linkTo = &userID
+			err = db.Db.QueryRow("SELECT name, email FROM account WHERE id=$1", userID).Scan(&account.name, &account.email)
+			if err != nil {
+				database.CheckDBErr(err.(*pq.Error), c)
+				return
+			}
+		}
+
+		var sentToAddress, sentToIP int
+		err = db.Db.QueryRow(`SELECT count(*) FILTER (WHERE email=$1), count(*) FILTER (WHERE requested_ip=$2)
+								FROM email_login WHERE created_at > $3`,
+			email, c.ClientIP(), time.Now().Add(-emailRateWindow)).Scan(&sentToAddress, &sentToIP)
+		if err != nil {
+			database.CheckDBErr(err.(*pq.Error), c)
+			return
+		}
+		if sentToAddress >= emailRatePerAddress || sentToIP >= emailRatePerIP {
+			c.AbortWithStatusJSON(http.StatusTooManyRequests, "Too many login links have been requested, try again later")
+			return
+		}
+
+		nonce := make([]byte, 32)
+		if _, err = rand.Read(nonce); err != nil {
+			c.AbortWithStatusJSON(500, "The server was unable to create a login link")
+			return
+		}
+		claims := emailClaims{
+			Email:  email,
+			Expiry: time.Now().Add(emailLinkLifetime).Unix(),
+			Nonce:  base64.RawURLEncoding.EncodeToString(nonce),
+		}
+		token, err := secrets.Sign(emailLoginSecret(), claims)
+		if err != nil {
+			c.AbortWithStatusJSON(500, "The server was unable to create a login link")
+			return
+		}
+
+		// Old links are of no use to anyone, clear them out while we're here
+		_, _ = db.Db.Exec("DELETE FROM email_login WHERE expires_at < now() - interval '1 day'")
+		_, err = db.Db.Exec(`INSERT INTO email_login (nonce_hash, email, link_user_id, requested_ip, expires_at)
+								VALUES ($1, $2, $3, $4, $5)`,
+			hashNonce(claims.Nonce), email, linkTo, c.ClientIP(), time.Unix(claims.Expiry, 0))
+		if err != nil {
+			database.CheckDBErr(err.(*pq.Error), c)
+			return
+		}
+
+		link := mail.Link("/oauth/v1/email/callback?token=" + url.QueryEscape(token))
+		msg := mail.Message{
+			To:      email,
+			Subject: "Your login link for how much do i owe?",
+			Text: fmt.Sprintf("Follow this link to log in to how much do i owe?\n\n%s\n\n"+
+				"It can only be used once and expires in %d minutes. If you didn't ask for it, you can ignore this email.\n",
+				link, int(emailLinkLifetime.Minutes())),
+		}
+		if linkTo != nil {
+			msg.Subject = "Add this address to your how much do i owe? account"
+			msg.Text = fmt.Sprintf("Follow this link to add %s as a way to log in to the how much do i owe? account of %s.\n\n%s\n\n"+
+				"Once you do, this address logs in to that account. The link can only be used once and expires in %d minutes. "+
+				"If you didn't ask for it, don't follow it and ignore this email.\n",
+				email, account, link, int(emailLinkLifetime.Minutes()))
+		}
+		err = mail.Send(c.Request.Context(), msg)
+		if err != nil {
+			fmt.Println("Unable to send login link:", err)
+			c.AbortWithStatusJSON(503, "The server was unable to send the login link")
+			return
+		}
+
+		c.JSON(202, "Check your email for a login link")
+	}
+}
+
+// handleEmailCallback Logs in, or links the address, when a magic link is followed
+func handleEmailCallback(db *database.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		claims, err := verifyEmailLink(c.Query("token"))
+		if err != nil {
+			fmt.Println("Error getting content: " + err.Error())
+			c.Redirect(http.StatusTemporaryRedirect, "/")
+			return
+		}
+
+		// Marking the link used and reading it is one statement, so the same
+		// link followed twice at once still only logs in once
+		var linkTo sql.NullString
+		err = db.Db.QueryRow(`UPDATE email_login SET used_at=now()
+								WHERE nonce_hash=$1 AND email=$2 AND used_at IS NULL AND expires_at > now()
+								RETURNING link_user_id`, hashNonce(claims.Nonce), claims.Email).Scan(&linkTo)
+		if err == sql.ErrNoRows {
+			fmt.Println("Error getting content: login link was already used")
+			c.Redirect(http.StatusTemporaryRedirect, "/")
+			return
+		}
+		if err != nil {
+			database.CheckDBErr(err.(*pq.Error), c)
+			return
+		}
+
+		identity := Identity{
+			Provider:      "email",
+			Subject:       claims.Email,
+			Email:         claims.Email,
+			EmailVerified: true,
+		}
+		completeLogin(c, db, identity, linkTo.String)
+	}
+}
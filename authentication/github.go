@@ -0,0 +1,82 @@
+package authentication
+
+import (
+	"context"
+	"fmt"
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/github"
+	"net/http"
+	"strconv"
+)
+
+type gitHubProvider struct {
+	config *oauth2.Config
+}
+
+func newGitHubProvider(clientID string, clientSecret string) *gitHubProvider {
+	return &gitHubProvider{config: &oauth2.Config{
+		RedirectURL:  redirectURL("/oauth/v1/callback/github"),
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		Scopes:       []string{"read:user", "user:email"},
+		Endpoint:     github.Endpoint,
+	}}
+}
+
+func (p *gitHubProvider) Name() string {
+	return "github"
+}
+
+func (p *gitHubProvider) AuthCodeURL(state string, verifier string) string {
+	return authCodeURL(p.config, state, verifier)
+}
+
+func (p *gitHubProvider) TokenSource(ctx context.Context, token *oauth2.Token) oauth2.TokenSource {
+	return p.config.TokenSource(ctx, token)
+}
+
+func (p *gitHubProvider) Identify(ctx context.Context, code string, verifier string) (Identity, error) {
+	token, err := exchange(ctx, p.config, code, verifier)
+	if err != nil {
+		return Identity{}, fmt.Errorf("code exchange failed: %s", err.Error())
+	}
+
+	var user struct {
+		ID        int64  `json:"id"`
+		Login     string `json:"login"`
+		Name      string `json:"name"`
+		AvatarURL string `json:"avatar_url"`
+	}
+	if err = getJSON(ctx, http.DefaultClient, "https://api.github.com/user", token.AccessToken, &user); err != nil {
+		return Identity{}, err
+	}
+
+	// The profile email is optional and may be hidden, the primary address
+	// from the emails endpoint is always there and says if it's verified
+	var emails []struct {
+		Email    string `json:"email"`
+		Primary  bool   `json:"primary"`
+		Verified bool   `json:"verified"`
+	}
+	if err = getJSON(ctx, http.DefaultClient, "https://api.github.com/user/emails", token.AccessToken, &emails); err != nil {
+		return Identity{}, err
+	}
+
+	identity := Identity{
+		Provider: p.Name(),
+		Subject:  strconv.FormatInt(user.ID, 10),
+		Name:     user.Name,
+		Picture:  user.AvatarURL,
+		Token:    token,
+	}
+	if identity.Name == "" {
+		identity.Name = user.Login
+	}
+	for _, email := range emails {
+		if email.Primary {
+			identity.Email = email.Email
+			identity.EmailVerified = email.Verified
+		}
+	}
+	return identity, nil
+}
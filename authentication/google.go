@@ -0,0 +1,67 @@
+package authentication
+
+import (
+	"context"
+	"fmt"
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/google"
+	"net/http"
+)
+
+type googleProvider struct {
+	config *oauth2.Config
+}
+
+func newGoogleProvider(clientID string, clientSecret string) *googleProvider {
+	return &googleProvider{config: &oauth2.Config{
+		// Google keeps the original callback URL so the redirect URI registered
+		// with Google doesn't have to change
+		RedirectURL:  redirectURL("/oauth/v1/callback"),
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		Scopes:       []string{"https://www.googleapis.com/auth/userinfo.email https://www.googleapis.com/auth/userinfo.profile"},
+		Endpoint:     google.Endpoint,
+	}}
+}
+
+func (p *googleProvider) Name() string {
+	return "google"
+}
+
+func (p *googleProvider) AuthCodeURL(state string, verifier string) string {
+	// Google only hands out a refresh token for offline access
+	return authCodeURL(p.config, state, verifier, oauth2.AccessTypeOffline)
+}
+
+func (p *googleProvider) TokenSource(ctx context.Context, token *oauth2.Token) oauth2.TokenSource {
+	return p.config.TokenSource(ctx, token)
+}
+
+func (p *googleProvider) Identify(ctx context.Context, code string, verifier string) (Identity, error) {
+	token, err := exchange(ctx, p.config, code, verifier)
+	if err != nil {
+		return Identity{}, fmt.Errorf("code exchange failed: %s", err.Error())
+	}
+
+	var userData struct {
+		ID            string `json:"id"`
+		Email         string `json:"email"`
+		VerifiedEmail bool   `json:"verified_email"`
+		Name          string `json:"name"`
+		Picture       string `json:"picture"`
+	}
+	err = getJSON(ctx, http.DefaultClient, "https://www.googleapis.com/oauth2/v2/userinfo", token.AccessToken, &userData)
+	if err != nil {
+		return Identity{}, err
+	}
+
+	return Identity{
+		Provider:      p.Name(),
+		Subject:       userData.ID,
+		Email:         userData.Email,
+		EmailVerified: userData.VerifiedEmail,
+		Name:          userData.Name,
+		Picture:       userData.Picture,
+		Token:         token,
+	}, nil
+}
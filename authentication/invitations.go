@@ -0,0 +1,141 @@
+package authentication
+
+import (
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"how-much-do-i-owe/api/contacts"
+	"how-much-do-i-owe/database"
+	"net/http"
+	"net/url"
+	"os"
+)
+
+// invitationCookie Holds an invitation link's token until whoever followed it
+// has logged in or signed up
+const invitationCookie = "invitation"
+
+type invitationRequest struct {
+	Token string `json:"token"`
+}
+
+// followInvitation Where invitation emails link to. It only sends the browser
+// to the app with the token, which shows what the invitation is and accepts
+// it once the user says so. Someone who isn't logged in is sent back with it
+// once they log in or sign up, with whichever address they like.
+func followInvitation(db *database.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		token := c.Query("token")
+		_, err := contacts.CheckInvitation(db.Db, token)
+		if err == contacts.ErrInvalidInvitation {
+			c.AbortWithStatusJSON(400, "This invitation is invalid or has expired, ask for a new one")
+			return
+		}
+		if err != nil {
+			c.AbortWithStatusJSON(500, "The server was unable to check the invitation")
+			return
+		}
+
+		if _, _, err = CheckSession(c, db); err != nil {
+			http.SetCookie(c.Writer, &http.Cookie{
+				Name:     invitationCookie,
+				Value:    token,
+				Path:     "/oauth/",
+				MaxAge:   int(loginStateLifetime.Seconds()) * 3,
+				HttpOnly: true,
+				Secure:   os.Getenv("ENV") != "DEV",
+				SameSite: http.SameSiteLaxMode,
+			})
+		}
+		c.Redirect(http.StatusTemporaryRedirect, invitationPage(token))
+	}
+}
+
+// invitationPage Where the app asks the user about an invitation
+func invitationPage(token string) string {
+	return "/?invitation=" + url.QueryEscape(token)
+}
+
+// previewInvitation Who sent an invitation, and the placeholder and balance
+// accepting it brings, for the user to confirm
+func previewInvitation(db *database.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, ok := invitationUser(c, db)
+		if !ok {
+			return
+		}
+		id, err := contacts.CheckInvitation(db.Db, c.Query("token"))
+		if err == nil {
+			var preview contacts.InvitationPreview
+			if preview, err = contacts.PreviewInvitation(db.Db, id, userID); err == nil {
+				c.JSON(200, preview)
+				return
+			}
+		}
+		if err == contacts.ErrInvalidInvitation {
+			c.AbortWithStatusJSON(400, "This invitation is invalid or has expired, ask for a new one")
+			return
+		}
+		fmt.Println("Unable to preview invitation:", err)
+		c.AbortWithStatusJSON(500, "The server was unable to check the invitation")
+	}
+}
+
+// acceptInvitation Accepts an invitation once the user confirmed it. Like any
+// request that changes something from a browser it needs the CSRF token, so
+// another site can't accept one on a user's behalf.
+func acceptInvitation(db *database.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, ok := invitationUser(c, db)
+		if !ok {
+			return
+		}
+		var req invitationRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		http.SetCookie(c.Writer, &http.Cookie{Name: invitationCookie, Path: "/oauth/", MaxAge: -1})
+
+		id, err := contacts.CheckInvitation(db.Db, req.Token)
+		if err == nil {
+			err = contacts.AcceptInvitation(db.Db, id, userID)
+		}
+		if err == contacts.ErrInvalidInvitation {
+			c.AbortWithStatusJSON(400, "This invitation is invalid or has expired, ask for a new one")
+			return
+		}
+		if err != nil {
+			fmt.Println("Unable to accept invitation:", err)
+			c.AbortWithStatusJSON(500, "The server was unable to accept the invitation")
+			return
+		}
+
+		c.JSON(201, "Invitation accepted")
+	}
+}
+
+// invitationUser The logged in user, invitations are only shown and accepted
+// for one
+func invitationUser(c *gin.Context, db *database.DB) (string, bool) {
+	userID, _, err := CheckSession(c, db)
+	if err == ErrNoSession {
+		c.AbortWithStatusJSON(401, "Active Session Required")
+		return "", false
+	}
+	if err != nil {
+		c.AbortWithStatusJSON(500, "The server was unable to retrieve this session")
+		return "", false
+	}
+	return userID, true
+}
+
+// afterLogin Where a login sends the browser: back to the invitation it
+// followed before logging in, if any, for the user to confirm
+func afterLogin(c *gin.Context) string {
+	cookie, err := c.Request.Cookie(invitationCookie)
+	if err != nil || cookie.Value == "" {
+		return "/"
+	}
+	http.SetCookie(c.Writer, &http.Cookie{Name: invitationCookie, Path: "/oauth/", MaxAge: -1})
+	return invitationPage(cookie.Value)
+}
@@ -2,219 +2,343 @@ package authentication
 
 import (
 	"context"
+	"crypto/rand"
+	"crypto/subtle"
 	"database/sql"
-	"encoding/json"
+	"encoding/base64"
+	"errors"
 	"fmt"
 	"github.com/gin-gonic/gin"
 	"github.com/lib/pq"
-	"golang.org/x/oauth2"
-	"golang.org/x/oauth2/google"
+	"how-much-do-i-owe/api/contacts"
 	"how-much-do-i-owe/database"
-	"io/ioutil"
-	"log"
-	"math/rand"
 	"net/http"
-	"os"
-	"strconv"
 	"time"
 )
 
-var GoogleOauthConfig *oauth2.Config
-
-func ConfigOauth() {
-	redirectURL := "https://" + os.Getenv("HOST") + "/oauth/v1/callback"
-
-	if os.Getenv("ENV") == "DEV" {
-		redirectURL = "http://localhost:5000/oauth/v1/callback"
-	}
-	GoogleOauthConfig = &oauth2.Config{
-		RedirectURL:  redirectURL,
-		ClientID:     os.Getenv("GOOGLE_CLIENT_ID"),
-		ClientSecret: os.Getenv("GOOGLE_CLIENT_SECRET"),
-		Scopes:       []string{"https://www.googleapis.com/auth/userinfo.email https://www.googleapis.com/auth/userinfo.profile"},
-		Endpoint:     google.Endpoint,
-	}
-}
-
 type Error struct {
 	StatusCode   int    `json:"status_code"`
 	ErrorMessage string `json:"error_msg"`
 }
 
+// errEmailTaken The provider reported an unverified email address that
+// already belongs to another account, so it can't be used to log in to it
+var errEmailTaken = errors.New("an account with this email address already exists")
+
 // Routes All the routes created by the package nested in
 // oauth/v1/*
 func Routes(r *gin.RouterGroup, db *database.DB) {
-	r.GET("/login", handleGoogleLogin(db))
-	r.GET("/callback", handleGoogleCallback(db))
-	r.GET("/logout", handleGoogleLogout(db))
+	r.GET("/providers", getProviders())
+	// /login and /callback without a provider are Google, as they were before
+	// other providers existed
+	r.GET("/login", handleLogin(db))
+	r.GET("/login/:provider", handleLogin(db))
+	r.GET("/callback", handleCallback(db))
+	r.GET("/callback/:provider", handleCallback(db))
+	r.GET("/link/:provider", handleLink(db))
+	r.PUT("/email", requestEmailLogin(db))
+	r.GET("/email/callback", handleEmailCallback(db))
+	r.GET("/invitation", followInvitation(db))
+	r.GET("/invitation/preview", previewInvitation(db))
+	r.POST("/invitation", acceptInvitation(db))
+	r.POST("/logout", handleLogout(db))
+	r.GET("/csrf", getCSRFToken(db))
 	r.GET("/account", getAccount(db))
 	r.GET("/refresh", refreshSession(db))
 }
 
-func getSeed() int64 {
-	seed := time.Now().UnixNano() // A new random seed (independent from state)
-	rand.Seed(seed)
-	return seed
+// AccountRoutes The routes created by the package nested in
+// api/v1/*, these work with personal access tokens as well as sessions
+func AccountRoutes(r *gin.RouterGroup, db *database.DB) {
+	r.GET("/account", getCurrentAccount(db))
+	r.GET("/identities", getIdentities(db))
+	r.DELETE("/identity/:provider/:subject", unlinkIdentity(db))
+	r.GET("/sessions", getSessions(db))
+	r.DELETE("/sessions", revokeOtherSessions(db))
+	r.DELETE("/session/:id", revokeSession(db))
 }
 
-func handleGoogleLogin(db *database.DB) gin.HandlerFunc {
+// loginStateLifetime How long a user has to log in at the provider
+const loginStateLifetime = 10 * time.Minute
+
+// randomString A URL safe string of n random bytes
+func randomString(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func providerParam(c *gin.Context) (Provider, bool) {
+	name := c.Param("provider")
+	if name == "" {
+		name = "google"
+	}
+	provider, ok := Providers[name]
+	if !ok {
+		c.AbortWithStatusJSON(404, "Unknown login provider")
+	}
+	return provider, ok
+}
+
+func getProviders() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		state, err := db.SessionStore.Get(c.Request, "state")
-		if err != nil {
-			c.AbortWithStatusJSON(500, "Server was unable to connect to session database")
-			return
-		}
+		c.JSON(200, providerNames())
+	}
+}
 
-		stateString := strconv.FormatInt(getSeed(), 10)
-		state.Values["state"] = stateString
-		err = state.Save(c.Request, c.Writer)
+func handleLogin(db *database.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		startLogin(c, db, "")
+	}
+}
 
-		if err != nil {
-			print("Unable to store state data")
-			c.AbortWithStatusJSON(500, "Unable to store state data")
-		}
+// startLogin Redirects to the provider in the URL. When linkTo is set the
+// identity the provider returns is added to that account instead of logging in.
+func startLogin(c *gin.Context, db *database.DB, linkTo string) {
+	provider, ok := providerParam(c)
+	if !ok {
+		return
+	}
+	state, err := db.SessionStore.Get(c.Request, "state")
+	if err != nil {
+		c.AbortWithStatusJSON(500, "Server was unable to connect to session database")
+		return
+	}
+
+	// The state and PKCE verifier only live in this browser's state session,
+	// so a callback is only accepted from the browser that started the login
+	stateString, err := randomString(32)
+	if err != nil {
+		c.AbortWithStatusJSON(500, "Unable to create state data")
+		return
+	}
+	verifier, err := randomString(32)
+	if err != nil {
+		c.AbortWithStatusJSON(500, "Unable to create state data")
+		return
+	}
+	state.Values["state"] = stateString
+	state.Values["verifier"] = verifier
+	state.Values["provider"] = provider.Name()
+	state.Values["link"] = linkTo
+	state.Values["started"] = time.Now().Unix()
+	err = state.Save(c.Request, c.Writer)
 
-		redirectCallbackURL := GoogleOauthConfig.AuthCodeURL(stateString)
-		c.Redirect(http.StatusTemporaryRedirect, redirectCallbackURL)
+	if err != nil {
+		print("Unable to store state data")
+		c.AbortWithStatusJSON(500, "Unable to store state data")
+		return
 	}
 
+	redirectCallbackURL := provider.AuthCodeURL(stateString, verifier)
+	c.Redirect(http.StatusTemporaryRedirect, redirectCallbackURL)
 }
 
-func handleGoogleCallback(db *database.DB) gin.HandlerFunc {
+func handleCallback(db *database.DB) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		stateSession, err := db.SessionStore.Get(c.Request, "state")
-		if err != nil {
-			c.AbortWithStatusJSON(500, "The server was unable to retrieve session state")
+		provider, ok := providerParam(c)
+		if !ok {
 			return
 		}
-		state := fmt.Sprintf("%v", stateSession.Values["state"])
-		userData, err := getUserInfo(state, c.Request.FormValue("code"), c.Request)
+		stateSession, err := db.SessionStore.Get(c.Request, "state")
 		if err != nil {
-			fmt.Println("Error getting content: " + err.Error())
-			c.Redirect(http.StatusTemporaryRedirect, "/")
+			c.AbortWithStatusJSON(500, "The server was unable to retrieve session state")
 			return
 		}
-
-		stateSession.Options.MaxAge = -1
-		_ = stateSession.Save(c.Request, c.Writer)
-		fmt.Println(userData)
-		if !userExists(userData.Email, db) {
-			err = createUser(userData, db)
-			if err != nil {
-				database.CheckDBErr(err.(*pq.Error), c)
+		expected, _ := stateSession.Values["state"].(string)
+		verifier, _ := stateSession.Values["verifier"].(string)
+		started, _ := stateSession.Values["started"].(int64)
+		linkTo, _ := stateSession.Values["link"].(string)
+
+		// Every state is single-use, it's gone before anything else happens
+		// so the same callback can't be replayed whether or not it succeeds
+		if !stateSession.IsNew {
+			stateSession.Options.MaxAge = -1
+			if err = stateSession.Save(c.Request, c.Writer); err != nil {
+				c.AbortWithStatusJSON(500, "The server was unable to clear session state")
 				return
 			}
-		} else {
-			replaceAccessToken(userData, db)
 		}
 
-		// set the user information
-		session, err := db.SessionStore.Get(c.Request, "session")
-		if err != nil {
-			c.AbortWithStatusJSON(500, "Server was unable to connect to session database")
+		if !validState(expected, c.Request.FormValue("state"), started) || stateSession.Values["provider"] != provider.Name() {
+			fmt.Println("Error getting content: invalid oauth state")
+			c.Redirect(http.StatusTemporaryRedirect, "/")
+			return
 		}
-
-		session.Values["GoogleID"] = userData.GoogleID
-		session.Values["Email"] = userData.Email
-		session.Values["Name"] = userData.Name
-		session.Values["Picture"] = userData.Picture
-
-		err = session.Save(c.Request, c.Writer)
+		identity, err := provider.Identify(c.Request.Context(), c.Request.FormValue("code"), verifier)
 		if err != nil {
-			fmt.Print("Unable to store session data")
-			c.AbortWithStatusJSON(500, "Unable to store session data")
+			fmt.Println("Error getting content: " + err.Error())
+			c.Redirect(http.StatusTemporaryRedirect, "/")
+			return
 		}
 
-		c.Redirect(http.StatusPermanentRedirect, "/")
+		completeLogin(c, db, identity, linkTo)
 	}
 }
 
-func createUser(userData User, db *database.DB) error {
-	// Prepare the sql query for later
-	insert, err := db.Db.Prepare(`INSERT INTO account (email, access_token, google_id, expires_in, picture, name) VALUES ($1, $2, $3, $4, $5, $6)`)
-	if err != nil {
-		return err
+// validState If the state a provider sent back is the one this browser's
+// login started with, and that login hasn't taken too long
+func validState(expected string, given string, started int64) bool {
+	if expected == "" || subtle.ConstantTimeCompare([]byte(expected), []byte(given)) != 1 {
+		return false
 	}
+	return time.Since(time.Unix(started, 0)) < loginStateLifetime
+}
 
-	//Execute the previous sql query using data from the
-	// userData struct being passed into the function
-	_, err = insert.Exec(userData.Email, userData.AccessToken, userData.GoogleID, userData.ExpiresIn, userData.Picture, userData.Name)
+// completeLogin Finishes a login once the identity is known, whichever way it
+// was proven. When linkTo is set the identity is added to that account instead.
+func completeLogin(c *gin.Context, db *database.DB, identity Identity, linkTo string) {
+	if linkTo != "" {
+		err := linkIdentity(c.Request.Context(), identity, linkTo, db)
+		if err == errIdentityInUse {
+			c.AbortWithStatusJSON(409, "This login already belongs to another account, ask an administrator to merge the two accounts")
+			return
+		}
+		if err != nil {
+			loginErr(c, err)
+			return
+		}
+		c.Redirect(http.StatusTemporaryRedirect, "/")
+		return
+	}
 
+	userID, err := findOrCreateAccount(c.Request.Context(), identity, db)
+	if err == errEmailTaken {
+		c.AbortWithStatusJSON(409, "An account with this email address already exists, log in with the method you used before")
+		return
+	}
 	if err != nil {
-		return err
+		loginErr(c, err)
+		return
 	}
-	return nil
-}
-
-func userExists(email string, db *database.DB) bool {
-	// Prepare the sql query for later
-	rows, err := db.Db.Query("SELECT COUNT(*) as count FROM account WHERE email = $1", email)
-	PanicOnErr(err)
-
-	return checkCount(rows) > 0
-}
 
-func checkCount(rows *sql.Rows) (count int) {
-	for rows.Next() {
-		err := rows.Scan(&count)
-		PanicOnErr(err)
+	// set the user information
+	session, err := db.SessionStore.Get(c.Request, "session")
+	if err != nil {
+		c.AbortWithStatusJSON(500, "Server was unable to connect to session database")
+		return
 	}
-	return count
-}
+	// Whatever session the browser had before ends, and the login gets a new
+	// session key so one planted in the browser beforehand is no use
+	if err = endSession(c, db); err != nil {
+		loginErr(c, err)
+		return
+	}
+	sessionID, err := startSession(c, db, userID)
+	if err != nil {
+		loginErr(c, err)
+		return
+	}
+	session.ID = ""
+	session.IsNew = true
+	session.Values = map[interface{}]interface{}{}
+
+	session.Values["SessionID"] = sessionID
+	if err = issueCSRFToken(c, session); err != nil {
+		c.AbortWithStatusJSON(500, "Unable to create a CSRF token")
+		return
+	}
+	session.Values["UserID"] = userID
+	session.Values["Provider"] = identity.Provider
+	session.Values["Email"] = identity.Email
+	session.Values["Name"] = identity.Name
+	session.Values["Picture"] = identity.Picture
 
-func replaceAccessToken(userData User, db *database.DB) {
-	_, err := db.Db.Query("UPDATE account SET access_token=$1,expires_in=$2, picture=$3, name=$4 WHERE email = $5",
-		userData.AccessToken, userData.ExpiresIn, userData.Picture, userData.Name, userData.Email)
+	err = session.Save(c.Request, c.Writer)
 	if err != nil {
-		fmt.Println("Unable to update access token", err)
+		fmt.Print("Unable to store session data")
+		c.AbortWithStatusJSON(500, "Unable to store session data")
+		return
 	}
-}
 
-type User struct {
-	GoogleID     string    `json:"id"`
-	Email        string    `json:"email"`
-	Name         string    `json:"name"`
-	Picture      string    `json:"picture"`
-	ExpiresIn    time.Time `json:"expires_in"`
-	AccessToken  string    `json:"access_token"`
-	RefreshToken string    `json:"refresh_token"`
+	c.Redirect(http.StatusPermanentRedirect, afterLogin(c))
 }
 
-func getUserInfo(state string, code string, r *http.Request) (User, error) {
-	var userData User
-
-	if state != r.FormValue("state") {
-		return userData, fmt.Errorf("invalid oauth state")
+// loginErr Responds to an error completing a login. Besides the database,
+// they come from providers and the session store, which aren't *pq.Errors.
+func loginErr(c *gin.Context, err error) {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		database.CheckDBErr(pqErr, c)
+		return
 	}
+	fmt.Println("Unable to complete login:", err)
+	c.AbortWithStatusJSON(500, "The server was unable to complete the login")
+}
 
-	token, err := GoogleOauthConfig.Exchange(context.Background(), code)
-	fmt.Println(token.RefreshToken)
+// findOrCreateAccount The account an identity belongs to. An identity seen for
+// the first time is linked to the account with the same verified email
+// address, or gets a new account if there is none.
+func findOrCreateAccount(ctx context.Context, identity Identity, db *database.DB) (string, error) {
+	tx, err := db.Db.BeginTx(ctx, nil)
 	if err != nil {
-		return userData, fmt.Errorf("code exchange failed: %s", err.Error())
+		return "", err
 	}
-	//Send access token to Spotify's user api in return for a user's data!
-	response, err := http.Get("https://www.googleapis.com/oauth2/v2/userinfo?access_token=" + token.AccessToken)
-	if err != nil {
-		return userData, fmt.Errorf("failed getting user info: %s", err.Error())
+	defer tx.Rollback()
+
+	var userID string
+	err = tx.QueryRow("SELECT user_id FROM identity WHERE provider=$1 AND subject=$2",
+		identity.Provider, identity.Subject).Scan(&userID)
+	switch {
+	case err == nil:
+		_, err = tx.Exec("UPDATE identity SET email=$1, email_verified=$4 WHERE provider=$2 AND subject=$3",
+			identity.Email, identity.Provider, identity.Subject, identity.EmailVerified)
+		if err != nil {
+			return "", err
+		}
+		if err = saveTokens(ctx, tx, identity); err != nil {
+			return "", err
+		}
+		_, err = tx.Exec("UPDATE account SET picture=$1, name=$2 WHERE id=$3", identity.Picture, identity.Name, userID)
+		if err != nil {
+			return "", err
+		}
+		return userID, tx.Commit()
+	case err != sql.ErrNoRows:
+		return "", err
 	}
 
-	contents, err := ioutil.ReadAll(response.Body)
-	if err != nil {
-		return userData, fmt.Errorf("failed reading response body: %s", err.Error())
+	err = tx.QueryRow("SELECT id FROM account WHERE email=$1 AND id NOT IN (SELECT id FROM ghost)", identity.Email).Scan(&userID)
+	switch {
+	case err == nil && !identity.EmailVerified:
+		return "", errEmailTaken
+	case err == sql.ErrNoRows:
+		if userID, err = database.NewUserID(); err != nil {
+			return "", err
+		}
+		_, err = tx.Exec("INSERT INTO account (id, email, picture, name) VALUES ($1, $2, $3, $4)",
+			userID, identity.Email, identity.Picture, identity.Name)
+		if err != nil {
+			return "", err
+		}
+		// Whoever invited this address gets a contact request, and placeholders
+		// made for it become this account
+		if identity.EmailVerified {
+			if err = contacts.ClaimInvitations(tx, userID, identity.Email); err != nil {
+				return "", err
+			}
+			if err = contacts.ClaimGhosts(tx, userID, identity.Email); err != nil {
+				return "", err
+			}
+		}
+	case err != nil:
+		return "", err
 	}
 
-	err = json.Unmarshal(contents, &userData)
+	_, err = tx.Exec("INSERT INTO identity (provider, subject, user_id, email, email_verified) VALUES ($1, $2, $3, $4, $5)",
+		identity.Provider, identity.Subject, userID, identity.Email, identity.EmailVerified)
 	if err != nil {
-		log.Println(err)
+		return "", err
 	}
-
-	userData.ExpiresIn = token.Expiry
-	userData.AccessToken = token.AccessToken
-	userData.RefreshToken = token.RefreshToken
-	return userData, nil
+	if err = saveTokens(ctx, tx, identity); err != nil {
+		return "", err
+	}
+	return userID, tx.Commit()
 }
 
-func handleGoogleLogout(db *database.DB) gin.HandlerFunc {
+func handleLogout(db *database.DB) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		fmt.Println("Attempting to expire session")
 
@@ -225,7 +349,12 @@ func handleGoogleLogout(db *database.DB) gin.HandlerFunc {
 		}
 
 		if session.ID != "" {
+			if err = endSession(c, db); err != nil {
+				c.AbortWithStatusJSON(500, "The server was unable to revoke this session")
+				return
+			}
 			session.Options.MaxAge = -1
+			http.SetCookie(c.Writer, &http.Cookie{Name: csrfCookie, Path: "/", MaxAge: -1})
 
 			err = session.Save(c.Request, c.Writer)
 
@@ -248,62 +377,88 @@ type Account struct {
 	ID      string `json:"user_id"`
 }
 
+// refreshSession Keeps the session cookie alive while the app is open. It
+// never outlives the session's absolute lifetime, and a revoked session isn't
+// refreshed.
 func refreshSession(db *database.DB) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		session, err := db.SessionStore.Get(c.Request, "session")
+		_, sessionID, err := CheckSession(c, db)
+		if err == ErrNoSession {
+			c.Redirect(http.StatusTemporaryRedirect, "./login")
+			return
+		}
 		if err != nil {
 			c.AbortWithStatusJSON(500, "The server was unable to retrieve this session")
 			return
 		}
 
+		var expiresAt time.Time
+		err = db.Db.QueryRow("SELECT expires_at FROM user_session WHERE id=$1", sessionID).Scan(&expiresAt)
 		if err != nil {
-			c.AbortWithStatusJSON(500, "The server was unable to refresh Spotify session")
+			c.AbortWithStatusJSON(500, "The server was unable to refresh this session")
 			return
 		}
-		if session.ID != "" {
-			session.Options.MaxAge = 3600
-
-			err = session.Save(c.Request, c.Writer)
-			if err != nil {
-				c.AbortWithStatusJSON(500, "The server was unable to refresh this session")
-			} else {
-				c.JSON(200, "successful refresh")
-			}
+		session, err := db.SessionStore.Get(c.Request, "session")
+		if err != nil {
+			c.AbortWithStatusJSON(500, "The server was unable to retrieve this session")
+			return
+		}
+		session.Options.MaxAge = int(time.Until(expiresAt).Seconds())
+		err = session.Save(c.Request, c.Writer)
+		if err != nil {
+			c.AbortWithStatusJSON(500, "The server was unable to refresh this session")
 		} else {
-			c.Redirect(http.StatusTemporaryRedirect, "./login")
+			c.JSON(200, "successful refresh")
 		}
 	}
 }
 
 func getAccount(db *database.DB) gin.HandlerFunc {
 	return func(c *gin.Context) {
+		userID, _, err := CheckSession(c, db)
+		if err == ErrNoSession {
+			c.AbortWithStatusJSON(401, "Session not found. Session may be expired or non-existent")
+			return
+		}
+		if err != nil {
+			c.AbortWithStatusJSON(500, "The server was unable to retrieve this session")
+			return
+		}
 		session, err := db.SessionStore.Get(c.Request, "session")
 		if err != nil {
 			c.AbortWithStatusJSON(500, "The server was unable to retrieve this session")
 			return
 		}
 
-		if session.ID != "" {
-			// get some session values
-			Email := session.Values["Email"]
-			EmailStr := fmt.Sprintf("%v", Email)
-			Name := session.Values["Name"]
-			NameStr := fmt.Sprintf("%v", Name)
-			PictureUrl := session.Values["Picture"]
-			PictureUrlStr := fmt.Sprintf("%v", PictureUrl)
-			GoogleID := session.Values["GoogleID"]
-			GoogleIDStr := fmt.Sprintf("%v", GoogleID)
-			if err != nil {
-				database.CheckDBErr(err.(*pq.Error), c)
-				return
-			}
+		// get some session values
+		Email := session.Values["Email"]
+		EmailStr := fmt.Sprintf("%v", Email)
+		Name := session.Values["Name"]
+		NameStr := fmt.Sprintf("%v", Name)
+		PictureUrl := session.Values["Picture"]
+		PictureUrlStr := fmt.Sprintf("%v", PictureUrl)
 
-			userData := Account{EmailStr, NameStr, PictureUrlStr, GoogleIDStr}
+		userData := Account{EmailStr, NameStr, PictureUrlStr, userID}
 
-			c.JSON(200, userData)
-		} else {
-			c.AbortWithStatusJSON(401, "Session not found. Session may be expired or non-existent")
+		c.JSON(200, userData)
+	}
+}
+
+func getCurrentAccount(db *database.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var userData Account
+		err := db.Db.QueryRow("SELECT email, name, picture, id FROM account WHERE id=$1",
+			c.GetString("UserID")).Scan(&userData.Email, &userData.Name, &userData.Picture, &userData.ID)
+		if err == sql.ErrNoRows {
+			c.AbortWithStatusJSON(404, "Account not found")
+			return
 		}
+		if err != nil {
+			database.CheckDBErr(err.(*pq.Error), c)
+			return
+		}
+
+		c.JSON(200, userData)
 	}
 }
 
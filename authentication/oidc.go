@@ -0,0 +1,292 @@
+package authentication
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"golang.org/x/oauth2"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// oidcProvider Any OpenID Connect issuer, configured through its discovery
+// document. The ID token is verified against the issuer's published keys.
+type oidcProvider struct {
+	name        string
+	issuer      string
+	config      *oauth2.Config
+	userinfoURL string
+	jwksURL     string
+	client      *http.Client
+
+	mu   sync.Mutex
+	keys map[string]crypto.PublicKey
+}
+
+func newOIDCProvider(ctx context.Context, name string, issuer string, clientID string, clientSecret string, scopes string) (*oidcProvider, error) {
+	p := &oidcProvider{name: name, issuer: issuer, client: http.DefaultClient}
+
+	var discovery struct {
+		Issuer                string `json:"issuer"`
+		AuthorizationEndpoint string `json:"authorization_endpoint"`
+		TokenEndpoint         string `json:"token_endpoint"`
+		UserinfoEndpoint      string `json:"userinfo_endpoint"`
+		JwksURI               string `json:"jwks_uri"`
+	}
+	err := getJSON(ctx, p.client, strings.TrimSuffix(issuer, "/")+"/.well-known/openid-configuration", "", &discovery)
+	if err != nil {
+		return nil, err
+	}
+	if discovery.Issuer != issuer {
+		return nil, fmt.Errorf("discovery document is for issuer %q, not %q", discovery.Issuer, issuer)
+	}
+	if discovery.AuthorizationEndpoint == "" || discovery.TokenEndpoint == "" || discovery.JwksURI == "" {
+		return nil, fmt.Errorf("discovery document for %s is missing endpoints", issuer)
+	}
+
+	scopeList := []string{"openid", "email", "profile"}
+	if scopes != "" {
+		scopeList = strings.Fields(scopes)
+	}
+	p.userinfoURL = discovery.UserinfoEndpoint
+	p.jwksURL = discovery.JwksURI
+	p.config = &oauth2.Config{
+		RedirectURL:  redirectURL("/oauth/v1/callback/" + name),
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		Scopes:       scopeList,
+		Endpoint: oauth2.Endpoint{
+			AuthURL:  discovery.AuthorizationEndpoint,
+			TokenURL: discovery.TokenEndpoint,
+		},
+	}
+	return p, nil
+}
+
+func (p *oidcProvider) Name() string {
+	return p.name
+}
+
+func (p *oidcProvider) AuthCodeURL(state string, verifier string) string {
+	return authCodeURL(p.config, state, verifier)
+}
+
+type idTokenClaims struct {
+	Issuer        string      `json:"iss"`
+	Subject       string      `json:"sub"`
+	Audience      audience    `json:"aud"`
+	Expiry        int64       `json:"exp"`
+	IssuedAt      int64       `json:"iat"`
+	Email         string      `json:"email"`
+	EmailVerified interface{} `json:"email_verified"`
+	Name          string      `json:"name"`
+	Picture       string      `json:"picture"`
+}
+
+// audience The aud claim may be a single string or a list of them
+type audience []string
+
+func (a *audience) UnmarshalJSON(data []byte) error {
+	var single string
+	if json.Unmarshal(data, &single) == nil {
+		*a = audience{single}
+		return nil
+	}
+	var list []string
+	if err := json.Unmarshal(data, &list); err != nil {
+		return err
+	}
+	*a = list
+	return nil
+}
+
+func (p *oidcProvider) TokenSource(ctx context.Context, token *oauth2.Token) oauth2.TokenSource {
+	return p.config.TokenSource(context.WithValue(ctx, oauth2.HTTPClient, p.client), token)
+}
+
+func (p *oidcProvider) Identify(ctx context.Context, code string, verifier string) (Identity, error) {
+	token, err := exchange(context.WithValue(ctx, oauth2.HTTPClient, p.client), p.config, code, verifier)
+	if err != nil {
+		return Identity{}, fmt.Errorf("code exchange failed: %s", err.Error())
+	}
+	rawIDToken, ok := token.Extra("id_token").(string)
+	if !ok {
+		return Identity{}, fmt.Errorf("token response has no id_token")
+	}
+	claims, err := p.verify(ctx, rawIDToken)
+	if err != nil {
+		return Identity{}, fmt.Errorf("invalid id_token: %s", err.Error())
+	}
+
+	identity := Identity{
+		Provider:      p.name,
+		Subject:       claims.Subject,
+		Email:         claims.Email,
+		EmailVerified: claims.EmailVerified == true || claims.EmailVerified == "true",
+		Name:          claims.Name,
+		Picture:       claims.Picture,
+		Token:         token,
+	}
+	// Some issuers keep the ID token small and only put the profile in userinfo
+	if (identity.Email == "" || identity.Name == "") && p.userinfoURL != "" {
+		var userinfo idTokenClaims
+		if err = getJSON(ctx, p.client, p.userinfoURL, token.AccessToken, &userinfo); err == nil && userinfo.Subject == claims.Subject {
+			if identity.Email == "" {
+				identity.Email = userinfo.Email
+				identity.EmailVerified = userinfo.EmailVerified == true || userinfo.EmailVerified == "true"
+			}
+			if identity.Name == "" {
+				identity.Name = userinfo.Name
+			}
+			if identity.Picture == "" {
+				identity.Picture = userinfo.Picture
+			}
+		}
+	}
+	return identity, nil
+}
+
+// verify Checks the signature, issuer, audience and expiry of a JWT ID token
+// and returns its claims
+func (p *oidcProvider) verify(ctx context.Context, rawIDToken string) (*idTokenClaims, error) {
+	parts := strings.Split(rawIDToken, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("malformed token")
+	}
+	var header struct {
+		Algorithm string `json:"alg"`
+		KeyID     string `json:"kid"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, err
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("malformed signature")
+	}
+
+	key, err := p.key(ctx, header.KeyID)
+	if err != nil {
+		return nil, err
+	}
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	switch pub := key.(type) {
+	case *rsa.PublicKey:
+		if header.Algorithm != "RS256" {
+			return nil, fmt.Errorf("unsupported algorithm %q for an RSA key", header.Algorithm)
+		}
+		if err = rsa.VerifyPKCS1v15(pub, crypto.SHA256, digest[:], signature); err != nil {
+			return nil, fmt.Errorf("bad signature")
+		}
+	case *ecdsa.PublicKey:
+		if header.Algorithm != "ES256" || len(signature) != 64 {
+			return nil, fmt.Errorf("unsupported algorithm %q for an EC key", header.Algorithm)
+		}
+		r := new(big.Int).SetBytes(signature[:32])
+		s := new(big.Int).SetBytes(signature[32:])
+		if !ecdsa.Verify(pub, digest[:], r, s) {
+			return nil, fmt.Errorf("bad signature")
+		}
+	default:
+		return nil, fmt.Errorf("unsupported key type")
+	}
+
+	var claims idTokenClaims
+	if err = decodeSegment(parts[1], &claims); err != nil {
+		return nil, err
+	}
+	if claims.Issuer != p.issuer {
+		return nil, fmt.Errorf("issued by %q", claims.Issuer)
+	}
+	intended := false
+	for _, aud := range claims.Audience {
+		intended = intended || aud == p.config.ClientID
+	}
+	if !intended {
+		return nil, fmt.Errorf("not issued for this client")
+	}
+	// Allow for a little clock skew between us and the issuer
+	now := time.Now()
+	if now.After(time.Unix(claims.Expiry, 0).Add(time.Minute)) {
+		return nil, fmt.Errorf("expired")
+	}
+	if time.Unix(claims.IssuedAt, 0).After(now.Add(time.Minute)) {
+		return nil, fmt.Errorf("issued in the future")
+	}
+	if claims.Subject == "" {
+		return nil, fmt.Errorf("no subject")
+	}
+	return &claims, nil
+}
+
+func decodeSegment(segment string, v interface{}) error {
+	decoded, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return fmt.Errorf("malformed token")
+	}
+	return json.Unmarshal(decoded, v)
+}
+
+// key The issuer's public key with the given ID. Keys are fetched again when an
+// unknown ID shows up, which is how issuers roll their keys.
+func (p *oidcProvider) key(ctx context.Context, keyID string) (crypto.PublicKey, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if key, ok := p.keys[keyID]; ok {
+		return key, nil
+	}
+
+	var jwks struct {
+		Keys []struct {
+			KeyType string `json:"kty"`
+			KeyID   string `json:"kid"`
+			Use     string `json:"use"`
+			N       string `json:"n"`
+			E       string `json:"e"`
+			Curve   string `json:"crv"`
+			X       string `json:"x"`
+			Y       string `json:"y"`
+		} `json:"keys"`
+	}
+	if err := getJSON(ctx, p.client, p.jwksURL, "", &jwks); err != nil {
+		return nil, err
+	}
+	p.keys = make(map[string]crypto.PublicKey)
+	for _, k := range jwks.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		switch k.KeyType {
+		case "RSA":
+			n, errN := base64.RawURLEncoding.DecodeString(k.N)
+			e, errE := base64.RawURLEncoding.DecodeString(k.E)
+			if errN != nil || errE != nil {
+				continue
+			}
+			p.keys[k.KeyID] = &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+		case "EC":
+			x, errX := base64.RawURLEncoding.DecodeString(k.X)
+			y, errY := base64.RawURLEncoding.DecodeString(k.Y)
+			if k.Curve != "P-256" || errX != nil || errY != nil {
+				continue
+			}
+			p.keys[k.KeyID] = &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		}
+	}
+
+	key, ok := p.keys[keyID]
+	if !ok {
+		return nil, fmt.Errorf("unknown signing key %q", keyID)
+	}
+	return key, nil
+}
@@ -0,0 +1,148 @@
+package authentication
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// standIn A minimal OpenID Connect issuer that hands out whatever ID token the
+// test sets, signed with its own key
+type standIn struct {
+	server  *httptest.Server
+	key     *rsa.PrivateKey
+	idToken string
+	// exchanges The code_verifier sent with every code exchange
+	exchanges []string
+}
+
+func newStandIn(t *testing.T) *standIn {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &standIn{key: key}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 s.server.URL,
+			"authorization_endpoint": s.server.URL + "/authorize",
+			"token_endpoint":         s.server.URL + "/token",
+			"jwks_uri":               s.server.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": "stand-in",
+			"use": "sig",
+			"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		s.exchanges = append(s.exchanges, r.FormValue("code_verifier"))
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"access_token": "stand-in-access-token",
+			"token_type":   "Bearer",
+			"expires_in":   3600,
+			"id_token":     s.idToken,
+		})
+	})
+	s.server = httptest.NewServer(mux)
+	t.Cleanup(s.server.Close)
+	return s
+}
+
+func (s *standIn) sign(t *testing.T, key *rsa.PrivateKey, claims map[string]interface{}) string {
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "kid": "stand-in", "typ": "JWT"})
+	payload, _ := json.Marshal(claims)
+	signingInput := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(signingInput))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func (s *standIn) claims() map[string]interface{} {
+	return map[string]interface{}{
+		"iss":            s.server.URL,
+		"sub":            "user-1",
+		"aud":            "client-id",
+		"exp":            time.Now().Add(time.Hour).Unix(),
+		"iat":            time.Now().Unix(),
+		"email":          "alice@example.com",
+		"email_verified": true,
+		"name":           "Alice",
+	}
+}
+
+func TestOIDCProviderIdentify(t *testing.T) {
+	s := newStandIn(t)
+	provider, err := newOIDCProvider(context.Background(), "standin", s.server.URL, "client-id", "secret", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(provider.AuthCodeURL("state", "verifier"), s.server.URL+"/authorize?") {
+		t.Errorf("login should redirect to the discovered authorization endpoint, got %s", provider.AuthCodeURL("state", "verifier"))
+	}
+
+	s.idToken = s.sign(t, s.key, s.claims())
+	identity, err := provider.Identify(context.Background(), "code", "verifier")
+	if err != nil {
+		t.Fatalf("valid ID token rejected: %v", err)
+	}
+	if identity.Provider != "standin" || identity.Subject != "user-1" || identity.Email != "alice@example.com" ||
+		!identity.EmailVerified || identity.Name != "Alice" {
+		t.Errorf("unexpected identity %+v", identity)
+	}
+
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rejected := map[string]func() string{
+		"wrong signing key": func() string { return s.sign(t, otherKey, s.claims()) },
+		"wrong audience": func() string {
+			claims := s.claims()
+			claims["aud"] = []string{"someone-else"}
+			return s.sign(t, s.key, claims)
+		},
+		"wrong issuer": func() string {
+			claims := s.claims()
+			claims["iss"] = "https://evil.example.com"
+			return s.sign(t, s.key, claims)
+		},
+		"expired": func() string {
+			claims := s.claims()
+			claims["exp"] = time.Now().Add(-time.Hour).Unix()
+			return s.sign(t, s.key, claims)
+		},
+		"tampered payload": func() string {
+			parts := strings.Split(s.sign(t, s.key, s.claims()), ".")
+			claims := s.claims()
+			claims["sub"] = "admin"
+			payload, _ := json.Marshal(claims)
+			return parts[0] + "." + base64.RawURLEncoding.EncodeToString(payload) + "." + parts[2]
+		},
+	}
+	for name, idToken := range rejected {
+		s.idToken = idToken()
+		if _, err = provider.Identify(context.Background(), "code", "verifier"); err == nil {
+			t.Errorf("%s: ID token was accepted", name)
+		}
+	}
+}
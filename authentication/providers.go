@@ -0,0 +1,151 @@
+package authentication
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"golang.org/x/oauth2"
+	"how-much-do-i-owe/mail"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"sort"
+)
+
+// Provider An identity provider users can log in with
+type Provider interface {
+	// Name The name used in login URLs and stored with every identity, e.g. "google"
+	Name() string
+	// AuthCodeURL Where to send the browser to log in. The PKCE challenge for
+	// verifier goes along with the request.
+	AuthCodeURL(state string, verifier string) string
+	// Identify Exchanges the code the provider redirected back with, and the
+	// verifier the login started with, for the identity of the user who logged in
+	Identify(ctx context.Context, code string, verifier string) (Identity, error)
+	// TokenSource Tokens starting from token, refreshed with the provider once they expire
+	TokenSource(ctx context.Context, token *oauth2.Token) oauth2.TokenSource
+}
+
+// Identity Who a provider says the user is. Subject is the provider's stable
+// ID for the user and never changes, unlike the email address.
+type Identity struct {
+	Provider      string
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Name          string
+	Picture       string
+	Token         *oauth2.Token
+}
+
+// authCodeURL The provider's login page with a PKCE (RFC 7636) challenge, so
+// an intercepted code is useless without the verifier kept in the session
+func authCodeURL(config *oauth2.Config, state string, verifier string, opts ...oauth2.AuthCodeOption) string {
+	opts = append(opts,
+		oauth2.SetAuthURLParam("code_challenge", pkceChallenge(verifier)),
+		oauth2.SetAuthURLParam("code_challenge_method", "S256"))
+	return config.AuthCodeURL(state, opts...)
+}
+
+// exchange Trades a code for a token, proving this is the login that asked for it
+func exchange(ctx context.Context, config *oauth2.Config, code string, verifier string) (*oauth2.Token, error) {
+	token, err := config.Exchange(ctx, code, oauth2.SetAuthURLParam("code_verifier", verifier))
+	return token, redactTokenError(err)
+}
+
+// redactTokenError Token endpoint errors include the response body, which
+// has no business in the logs
+func redactTokenError(err error) error {
+	var retrieveErr *oauth2.RetrieveError
+	if errors.As(err, &retrieveErr) {
+		return fmt.Errorf("token endpoint responded with %s", retrieveErr.Response.Status)
+	}
+	return err
+}
+
+func pkceChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// Providers Every identity provider that has been configured, by name
+var Providers = map[string]Provider{}
+
+// ConfigOauth Sets up every identity provider that has credentials in the environment
+//
+//   - Google: GOOGLE_CLIENT_ID and GOOGLE_CLIENT_SECRET
+//   - GitHub: GITHUB_CLIENT_ID and GITHUB_CLIENT_SECRET
+//   - OpenID Connect: OIDC_ISSUER, OIDC_CLIENT_ID and OIDC_CLIENT_SECRET,
+//     optionally OIDC_NAME (defaults to "oidc") and OIDC_SCOPES
+func ConfigOauth() {
+	Providers = map[string]Provider{}
+
+	if os.Getenv("GOOGLE_CLIENT_ID") != "" {
+		register(newGoogleProvider(os.Getenv("GOOGLE_CLIENT_ID"), os.Getenv("GOOGLE_CLIENT_SECRET")))
+	}
+	if os.Getenv("GITHUB_CLIENT_ID") != "" {
+		register(newGitHubProvider(os.Getenv("GITHUB_CLIENT_ID"), os.Getenv("GITHUB_CLIENT_SECRET")))
+	}
+	if os.Getenv("OIDC_ISSUER") != "" {
+		name := os.Getenv("OIDC_NAME")
+		if name == "" {
+			name = "oidc"
+		}
+		provider, err := newOIDCProvider(context.Background(), name, os.Getenv("OIDC_ISSUER"),
+			os.Getenv("OIDC_CLIENT_ID"), os.Getenv("OIDC_CLIENT_SECRET"), os.Getenv("OIDC_SCOPES"))
+		if err != nil {
+			// The rest of the app still works, just not this way of logging in
+			fmt.Println("Unable to configure OpenID Connect provider:", err)
+		} else {
+			register(provider)
+		}
+	}
+}
+
+func register(provider Provider) {
+	Providers[provider.Name()] = provider
+}
+
+// redirectURL Where a provider sends the browser back to after login
+func redirectURL(path string) string {
+	return mail.Link(path)
+}
+
+// providerNames The names of every configured provider, sorted
+func providerNames() []string {
+	names := make([]string, 0, len(Providers))
+	for name := range Providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// getJSON Fetches url with an access token and decodes the JSON response into v
+func getJSON(ctx context.Context, client *http.Client, url string, accessToken string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	if accessToken != "" {
+		req.Header.Set("Authorization", "Bearer "+accessToken)
+	}
+	response, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed getting %s: %s", url, err.Error())
+	}
+	defer response.Body.Close()
+
+	contents, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		return fmt.Errorf("failed reading response body: %s", err.Error())
+	}
+	if response.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s responded with %s", url, response.Status)
+	}
+	return json.Unmarshal(contents, v)
+}
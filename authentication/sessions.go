@@ -0,0 +1,161 @@
+package authentication
+
+import (
+	"database/sql"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+	"how-much-do-i-owe/api/tokens"
+	"how-much-do-i-owe/database"
+	"time"
+)
+
+const (
+	// SessionIdleTimeout A session that hasn't been used for this long has ended
+	SessionIdleTimeout = 30 * time.Minute
+	// SessionLifetime No session lasts longer than this, however active it is
+	SessionLifetime = 7 * 24 * time.Hour
+)
+
+// ErrNoSession The request has no session cookie, or its session has been
+// revoked or has expired
+var ErrNoSession = errors.New("no active session")
+
+// userSession A login as listed to its account. IP is where the session was
+// last used from: the address of the connection unless that is one of the
+// TRUSTED_PROXIES, so a client can't put another address there with
+// X-Forwarded-For.
+type userSession struct {
+	ID         string    `json:"id"`
+	UserAgent  string    `json:"userAgent"`
+	IP         string    `json:"ip"`
+	CreatedAt  time.Time `json:"createdAt"`
+	LastSeenAt time.Time `json:"lastSeenAt"`
+	ExpiresAt  time.Time `json:"expiresAt"`
+	// Current If this is the session making the request
+	Current bool `json:"current"`
+}
+
+// startSession Records a login from this request and returns its ID for the session cookie
+func startSession(c *gin.Context, db *database.DB, userID string) (string, error) {
+	sessionID, err := randomString(32)
+	if err != nil {
+		return "", err
+	}
+	_, err = db.Db.Exec("INSERT INTO user_session (id, user_id, user_agent, ip, expires_at) VALUES ($1, $2, $3, $4, $5)",
+		sessionID, userID, c.Request.UserAgent(), c.ClientIP(), time.Now().Add(SessionLifetime))
+	return sessionID, err
+}
+
+// CheckSession The account of the request's session cookie and the ID of the
+// session. The session counts as used, so it isn't idle anymore. A revoked or
+// expired session is removed from the browser and gives ErrNoSession.
+func CheckSession(c *gin.Context, db *database.DB) (userID string, sessionID string, err error) {
+	session, err := db.SessionStore.Get(c.Request, "session")
+	if err != nil {
+		return "", "", err
+	}
+	sessionID, _ = session.Values["SessionID"].(string)
+	if sessionID == "" {
+		return "", "", ErrNoSession
+	}
+
+	// The account comes from the session row rather than the cookie, so
+	// sessions follow an account that has been merged into another
+	err = db.Db.QueryRow(`UPDATE user_session SET last_seen_at=now(), ip=$2
+							WHERE id=$1 AND revoked_at IS NULL AND expires_at > now() AND last_seen_at > $3
+							RETURNING user_id`, sessionID, c.ClientIP(), time.Now().Add(-SessionIdleTimeout)).Scan(&userID)
+	if err == sql.ErrNoRows {
+		session.Options.MaxAge = -1
+		_ = session.Save(c.Request, c.Writer)
+		return "", "", ErrNoSession
+	}
+	if err != nil {
+		return "", "", err
+	}
+	return userID, sessionID, nil
+}
+
+// endSession Revokes the session of the request, if it has one
+func endSession(c *gin.Context, db *database.DB) error {
+	session, err := db.SessionStore.Get(c.Request, "session")
+	if err != nil {
+		return err
+	}
+	if sessionID, _ := session.Values["SessionID"].(string); sessionID != "" {
+		_, err = db.Db.Exec("UPDATE user_session SET revoked_at=now() WHERE id=$1 AND revoked_at IS NULL", sessionID)
+	}
+	return err
+}
+
+func getSessions(db *database.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		rows, err := db.Db.Query(`SELECT id, user_agent, ip, created_at, last_seen_at, expires_at FROM user_session
+									WHERE user_id=$1 AND revoked_at IS NULL AND expires_at > now() AND last_seen_at > $2
+									ORDER BY last_seen_at DESC`, c.GetString("UserID"), time.Now().Add(-SessionIdleTimeout))
+		if err != nil {
+			database.CheckDBErr(err.(*pq.Error), c)
+			return
+		}
+		defer rows.Close()
+
+		sessions := []userSession{}
+		for rows.Next() {
+			var s userSession
+			if err = rows.Scan(&s.ID, &s.UserAgent, &s.IP, &s.CreatedAt, &s.LastSeenAt, &s.ExpiresAt); err != nil {
+				c.AbortWithStatusJSON(500, "The server was unable to get sessions")
+				return
+			}
+			// A session also ends once it's idle for too long
+			if idle := s.LastSeenAt.Add(SessionIdleTimeout); idle.Before(s.ExpiresAt) {
+				s.ExpiresAt = idle
+			}
+			s.Current = s.ID == c.GetString("SessionID")
+			sessions = append(sessions, s)
+		}
+
+		c.JSON(200, sessions)
+	}
+}
+
+// revokeSession Logs out a session of the account. Only a session can do it,
+// so a leaked API token can't log its owner out.
+func revokeSession(db *database.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !tokens.RequireSession(c) {
+			return
+		}
+		var id string
+		err := db.Db.QueryRow(`UPDATE user_session SET revoked_at=now() WHERE id=$1 AND user_id=$2 AND revoked_at IS NULL
+								RETURNING id`, c.Param("id"), c.GetString("UserID")).Scan(&id)
+		if err == sql.ErrNoRows {
+			c.AbortWithStatusJSON(404, "Session not found")
+			return
+		}
+		if err != nil {
+			database.CheckDBErr(err.(*pq.Error), c)
+			return
+		}
+
+		c.JSON(200, "Session revoked")
+	}
+}
+
+// revokeOtherSessions Logs out everywhere except the session making the
+// request. API tokens can't, they would log out every session.
+func revokeOtherSessions(db *database.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !tokens.RequireSession(c) {
+			return
+		}
+		result, err := db.Db.Exec("UPDATE user_session SET revoked_at=now() WHERE user_id=$1 AND id<>$2 AND revoked_at IS NULL",
+			c.GetString("UserID"), c.GetString("SessionID"))
+		if err != nil {
+			database.CheckDBErr(err.(*pq.Error), c)
+			return
+		}
+		revoked, _ := result.RowsAffected()
+
+		c.JSON(200, revoked)
+	}
+}
@@ -0,0 +1,159 @@
+package authentication
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/sessions"
+	"how-much-do-i-owe/database"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+// loginFlow The oauth/v1 routes logging in with a stand-in issuer. Its ID
+// tokens are never valid, so a callback that gets as far as the code exchange
+// is recorded by the stand-in and then fails without needing a database.
+type loginFlow struct {
+	t      *testing.T
+	router *gin.Engine
+	issuer *standIn
+}
+
+func newLoginFlow(t *testing.T) *loginFlow {
+	gin.SetMode(gin.TestMode)
+	issuer := newStandIn(t)
+	provider, err := newOIDCProvider(context.Background(), "standin", issuer.server.URL, "client-id", "secret", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	previous := Providers
+	Providers = map[string]Provider{"standin": provider}
+	t.Cleanup(func() { Providers = previous })
+
+	// A server side store like the Postgres one, deleting a session deletes its data
+	store := sessions.NewFilesystemStore(t.TempDir(), []byte("0123456789abcdef0123456789abcdef"))
+	router := gin.New()
+	Routes(router.Group("oauth/v1"), &database.DB{SessionStore: store})
+	return &loginFlow{t: t, router: router, issuer: issuer}
+}
+
+// start Begins a login and returns the browser's cookies and what was sent to the provider
+func (f *loginFlow) start() ([]*http.Cookie, url.Values) {
+	w := httptest.NewRecorder()
+	f.router.ServeHTTP(w, httptest.NewRequest("GET", "/oauth/v1/login/standin", nil))
+	if w.Code != http.StatusTemporaryRedirect {
+		f.t.Fatalf("login should redirect to the provider, got %d", w.Code)
+	}
+	location, err := url.Parse(w.Header().Get("Location"))
+	if err != nil {
+		f.t.Fatal(err)
+	}
+	return w.Result().Cookies(), location.Query()
+}
+
+func (f *loginFlow) callback(cookies []*http.Cookie, state string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("GET", "/oauth/v1/callback/standin?code=code&state="+url.QueryEscape(state), nil)
+	for _, cookie := range cookies {
+		req.AddCookie(cookie)
+	}
+	w := httptest.NewRecorder()
+	f.router.ServeHTTP(w, req)
+	return w
+}
+
+func TestLoginStateAndPKCE(t *testing.T) {
+	f := newLoginFlow(t)
+	cookies, params := f.start()
+	_, other := f.start()
+
+	state := params.Get("state")
+	if len(state) < 43 || state == other.Get("state") {
+		t.Errorf("state should be 32 random bytes, got %q and %q", state, other.Get("state"))
+	}
+	if params.Get("code_challenge_method") != "S256" || params.Get("code_challenge") == "" {
+		t.Fatalf("login should send an S256 PKCE challenge, got %v", params)
+	}
+	if params.Get("code_challenge") == other.Get("code_challenge") {
+		t.Error("every login should have its own PKCE verifier")
+	}
+
+	f.callback(cookies, state)
+	if len(f.issuer.exchanges) != 1 {
+		t.Fatalf("a valid callback should exchange the code, got %d exchanges", len(f.issuer.exchanges))
+	}
+	sum := sha256.Sum256([]byte(f.issuer.exchanges[0]))
+	if base64.RawURLEncoding.EncodeToString(sum[:]) != params.Get("code_challenge") {
+		t.Error("the code exchange should send the verifier for the login's challenge")
+	}
+}
+
+func TestCallbackRejectsTamperedState(t *testing.T) {
+	tests := []struct {
+		name     string
+		callback func(f *loginFlow) *httptest.ResponseRecorder
+	}{
+		{"modified state", func(f *loginFlow) *httptest.ResponseRecorder {
+			cookies, params := f.start()
+			return f.callback(cookies, params.Get("state")+"x")
+		}},
+		{"missing state", func(f *loginFlow) *httptest.ResponseRecorder {
+			cookies, _ := f.start()
+			return f.callback(cookies, "")
+		}},
+		{"state from another browser", func(f *loginFlow) *httptest.ResponseRecorder {
+			cookies, _ := f.start()
+			_, params := f.start()
+			return f.callback(cookies, params.Get("state"))
+		}},
+		{"no state session", func(f *loginFlow) *httptest.ResponseRecorder {
+			_, params := f.start()
+			return f.callback(nil, params.Get("state"))
+		}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			f := newLoginFlow(t)
+			w := test.callback(f)
+			if len(f.issuer.exchanges) != 0 {
+				t.Error("the code should not be exchanged")
+			}
+			if w.Code != http.StatusTemporaryRedirect || w.Header().Get("Location") != "/" {
+				t.Errorf("expected a redirect back to the app, got %d %s", w.Code, w.Header().Get("Location"))
+			}
+		})
+	}
+}
+
+func TestCallbackRejectsReplay(t *testing.T) {
+	f := newLoginFlow(t)
+	cookies, params := f.start()
+
+	f.callback(cookies, params.Get("state"))
+	if len(f.issuer.exchanges) != 1 {
+		t.Fatalf("the first callback should exchange the code, got %d exchanges", len(f.issuer.exchanges))
+	}
+
+	w := f.callback(cookies, params.Get("state"))
+	if len(f.issuer.exchanges) != 1 {
+		t.Error("a replayed callback should not exchange the code again")
+	}
+	if w.Code == http.StatusPermanentRedirect {
+		t.Error("a replayed callback should not log in")
+	}
+}
+
+func TestValidStateExpires(t *testing.T) {
+	if !validState("state", "state", time.Now().Unix()) {
+		t.Error("a fresh matching state should be valid")
+	}
+	if validState("state", "state", time.Now().Add(-loginStateLifetime-time.Minute).Unix()) {
+		t.Error("a state older than loginStateLifetime should be rejected")
+	}
+	if validState("", "", time.Now().Unix()) {
+		t.Error("an empty state should never be valid")
+	}
+}
@@ -0,0 +1,161 @@
+package authentication
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"golang.org/x/oauth2"
+	"how-much-do-i-owe/database"
+	"how-much-do-i-owe/secrets"
+	"sync"
+	"time"
+)
+
+// tokenContext Binds an encrypted token to the identity it belongs to
+func tokenContext(provider string, subject string) string {
+	return "identity:" + provider + ":" + subject
+}
+
+// saveTokens Stores the provider's tokens for an identity, encrypted. Providers
+// usually only send a refresh token the first time, so one that isn't sent
+// again is kept.
+func saveTokens(ctx context.Context, db database.Execer, identity Identity) error {
+	if identity.Token == nil {
+		return nil
+	}
+	binding := tokenContext(identity.Provider, identity.Subject)
+	accessToken, err := secrets.Default.Encrypt(identity.Token.AccessToken, binding)
+	if err != nil {
+		return err
+	}
+	refreshToken, err := secrets.Default.Encrypt(identity.Token.RefreshToken, binding)
+	if err != nil {
+		return err
+	}
+	var expiry *time.Time
+	if !identity.Token.Expiry.IsZero() {
+		expiry = &identity.Token.Expiry
+	}
+	_, err = db.ExecContext(ctx, `UPDATE identity SET access_token=$1, refresh_token=COALESCE(NULLIF($2, ''), refresh_token), expires_in=$3
+									WHERE provider=$4 AND subject=$5`,
+		accessToken, refreshToken, expiry, identity.Provider, identity.Subject)
+	return err
+}
+
+// TokenSource Access tokens for an identity that are refreshed with the
+// provider once they expire. Refreshed tokens are saved for next time.
+func TokenSource(ctx context.Context, db *database.DB, provider string, subject string) (oauth2.TokenSource, error) {
+	p, ok := Providers[provider]
+	if !ok {
+		return nil, fmt.Errorf("login provider %q isn't configured", provider)
+	}
+
+	var accessToken, refreshToken string
+	var expiry sql.NullTime
+	err := db.Db.QueryRowContext(ctx, "SELECT access_token, refresh_token, expires_in FROM identity WHERE provider=$1 AND subject=$2",
+		provider, subject).Scan(&accessToken, &refreshToken, &expiry)
+	if err != nil {
+		return nil, err
+	}
+	binding := tokenContext(provider, subject)
+	token := &oauth2.Token{TokenType: "Bearer", Expiry: expiry.Time}
+	if token.AccessToken, err = secrets.Default.Decrypt(accessToken, binding); err != nil {
+		return nil, err
+	}
+	if token.RefreshToken, err = secrets.Default.Decrypt(refreshToken, binding); err != nil {
+		return nil, err
+	}
+	if token.AccessToken == "" && token.RefreshToken == "" {
+		return nil, fmt.Errorf("no tokens are stored for this %s login", provider)
+	}
+
+	return newSavingTokenSource(ctx, db.Db, p, Identity{Provider: provider, Subject: subject}, token), nil
+}
+
+// newSavingTokenSource Tokens for identity starting from token, refreshed with
+// p once they expire and saved to db encrypted
+func newSavingTokenSource(ctx context.Context, db database.Execer, p Provider, identity Identity, token *oauth2.Token) *savingTokenSource {
+	return &savingTokenSource{
+		ctx:      ctx,
+		db:       db,
+		identity: identity,
+		source:   oauth2.ReuseTokenSource(token, p.TokenSource(ctx, token)),
+		last:     token.AccessToken,
+	}
+}
+
+// savingTokenSource Saves every token the provider refreshes
+type savingTokenSource struct {
+	ctx      context.Context
+	db       database.Execer
+	identity Identity
+	source   oauth2.TokenSource
+
+	mu   sync.Mutex
+	last string
+}
+
+func (s *savingTokenSource) Token() (*oauth2.Token, error) {
+	token, err := s.source.Token()
+	if err != nil {
+		return nil, redactTokenError(err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if token.AccessToken != s.last {
+		identity := s.identity
+		identity.Token = token
+		if err = saveTokens(s.ctx, s.db, identity); err != nil {
+			return nil, err
+		}
+		s.last = token.AccessToken
+	}
+	return token, nil
+}
+
+// RotateTokenKeys Re-encrypts every stored token that isn't encrypted with the
+// current key, so old keys can be removed. Returns how many identities changed.
+func RotateTokenKeys(ctx context.Context, db *database.DB) (int, error) {
+	rows, err := db.Db.QueryContext(ctx, "SELECT provider, subject, access_token, refresh_token FROM identity")
+	if err != nil {
+		return 0, err
+	}
+	type stale struct{ provider, subject, accessToken, refreshToken string }
+	var rotate []stale
+	for rows.Next() {
+		var row stale
+		if err = rows.Scan(&row.provider, &row.subject, &row.accessToken, &row.refreshToken); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		if !secrets.Default.Current(row.accessToken) || !secrets.Default.Current(row.refreshToken) {
+			rotate = append(rotate, row)
+		}
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return 0, err
+	}
+
+	for _, row := range rotate {
+		binding := tokenContext(row.provider, row.subject)
+		accessToken, err := secrets.Default.Rotate(row.accessToken, binding)
+		if err != nil {
+			return 0, fmt.Errorf("%s identity %s: %s", row.provider, row.subject, err.Error())
+		}
+		refreshToken, err := secrets.Default.Rotate(row.refreshToken, binding)
+		if err != nil {
+			return 0, fmt.Errorf("%s identity %s: %s", row.provider, row.subject, err.Error())
+		}
+		// Only rows that still hold what was read are changed, a login in the
+		// meantime already saved tokens with the current key
+		_, err = db.Db.ExecContext(ctx, `UPDATE identity SET access_token=$1, refresh_token=$2
+											WHERE provider=$3 AND subject=$4 AND access_token=$5 AND refresh_token=$6`,
+			accessToken, refreshToken, row.provider, row.subject, row.accessToken, row.refreshToken)
+		if err != nil {
+			return 0, err
+		}
+	}
+	return len(rotate), nil
+}
@@ -0,0 +1,116 @@
+package authentication
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"golang.org/x/oauth2"
+	"how-much-do-i-owe/secrets"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// savedTokens Records the arguments of every statement instead of running it
+type savedTokens struct {
+	args [][]interface{}
+}
+
+func (s *savedTokens) ExecContext(_ context.Context, _ string, args ...interface{}) (sql.Result, error) {
+	s.args = append(s.args, args)
+	return nil, nil
+}
+
+func TestSavingTokenSourceRefreshes(t *testing.T) {
+	keyring, err := secrets.NewKeyring("test", map[string][]byte{"test": bytes.Repeat([]byte{7}, 32)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	previous := secrets.Default
+	secrets.Default = keyring
+	t.Cleanup(func() { secrets.Default = previous })
+
+	var refreshes []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			t.Fatal(err)
+		}
+		if r.Form.Get("grant_type") != "refresh_token" {
+			t.Errorf("got grant_type %q, want refresh_token", r.Form.Get("grant_type"))
+		}
+		refreshes = append(refreshes, r.Form.Get("refresh_token"))
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"access_token":  "fresh-access",
+			"refresh_token": "fresh-refresh",
+			"token_type":    "Bearer",
+			"expires_in":    3600,
+		})
+	}))
+	defer server.Close()
+
+	p := &googleProvider{config: &oauth2.Config{
+		ClientID:     "client",
+		ClientSecret: "secret",
+		Endpoint:     oauth2.Endpoint{TokenURL: server.URL, AuthStyle: oauth2.AuthStyleInParams},
+	}}
+	expired := &oauth2.Token{
+		AccessToken:  "stale-access",
+		RefreshToken: "stored-refresh",
+		TokenType:    "Bearer",
+		Expiry:       time.Now().Add(-time.Hour),
+	}
+	db := &savedTokens{}
+	source := newSavingTokenSource(context.Background(), db, p, Identity{Provider: "google", Subject: "42"}, expired)
+
+	for i := 0; i < 2; i++ {
+		token, err := source.Token()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if token.AccessToken != "fresh-access" {
+			t.Errorf("got access token %q, want fresh-access", token.AccessToken)
+		}
+	}
+	if len(refreshes) != 1 || refreshes[0] != "stored-refresh" {
+		t.Fatalf("refreshed with %v, want once with stored-refresh", refreshes)
+	}
+	if len(db.args) != 1 {
+		t.Fatalf("saved %d times, want once", len(db.args))
+	}
+
+	saved := db.args[0]
+	binding := tokenContext("google", "42")
+	for i, want := range []string{"fresh-access", "fresh-refresh"} {
+		value := saved[i].(string)
+		if value == want {
+			t.Errorf("%s was saved unencrypted", want)
+		}
+		if got, err := keyring.Decrypt(value, binding); err != nil || got != want {
+			t.Errorf("saved %q, which decrypts to %q, %v, want %q", value, got, err, want)
+		}
+	}
+	if saved[3] != "google" || saved[4] != "42" {
+		t.Errorf("saved tokens for %v %v, want google 42", saved[3], saved[4])
+	}
+}
+
+func TestSavingTokenSourceKeepsValidToken(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("a token that hasn't expired was refreshed")
+	}))
+	defer server.Close()
+
+	p := &googleProvider{config: &oauth2.Config{Endpoint: oauth2.Endpoint{TokenURL: server.URL}}}
+	valid := &oauth2.Token{AccessToken: "access", RefreshToken: "refresh", Expiry: time.Now().Add(time.Hour)}
+	db := &savedTokens{}
+	token, err := newSavingTokenSource(context.Background(), db, p, Identity{Provider: "google", Subject: "42"}, valid).Token()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token.AccessToken != "access" || len(db.args) != 0 {
+		t.Errorf("got %q and %d saves, want the stored token and none", token.AccessToken, len(db.args))
+	}
+}
@@ -0,0 +1,105 @@
+// Package client A typed Go client for the how much do i owe? HTTP API.
+// The types and methods in client_gen.go are generated from
+// api/openapi/openapi.json, run go generate after changing the spec.
+package client
+
+//go:generate go run ../api/openapi/gen -spec ../api/openapi/openapi.json -out client_gen.go
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+type Client struct {
+	// BaseURL The scheme and host of the server, e.g. https://example.com
+	BaseURL string
+	// Token A personal access token, sent as a Bearer token when set
+	Token      string
+	HTTPClient *http.Client
+}
+
+// Error A non 2xx response returned by the API
+type Error struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%d: %s", e.StatusCode, e.Message)
+}
+
+// New Creates a client for the server at baseURL using http.DefaultClient
+func New(baseURL string) *Client {
+	return &Client{BaseURL: strings.TrimSuffix(baseURL, "/"), HTTPClient: http.DefaultClient}
+}
+
+func (c *Client) send(ctx context.Context, method string, path string, query url.Values, body interface{}) (*http.Response, error) {
+	var reader io.Reader
+	if body != nil {
+		encoded, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		reader = bytes.NewReader(encoded)
+	}
+	target := c.BaseURL + path
+	if len(query) > 0 {
+		target += "?" + query.Encode()
+	}
+	req, err := http.NewRequestWithContext(ctx, method, target, reader)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	req.Header.Set("Accept", "application/json")
+	if c.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.Token)
+	}
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 300 {
+		defer resp.Body.Close()
+		contents, _ := io.ReadAll(resp.Body)
+		apiErr := &Error{StatusCode: resp.StatusCode, Message: strings.TrimSpace(string(contents))}
+		// Most handlers respond with a bare JSON string
+		var message string
+		if json.Unmarshal(contents, &message) == nil {
+			apiErr.Message = message
+		}
+		return nil, apiErr
+	}
+	return resp, nil
+}
+
+func (c *Client) do(ctx context.Context, method string, path string, query url.Values, body interface{}, out interface{}) error {
+	resp, err := c.send(ctx, method, path, query, body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if out == nil {
+		_, err = io.Copy(io.Discard, resp.Body)
+		return err
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+func (c *Client) doRaw(ctx context.Context, method string, path string, query url.Values, body interface{}) ([]byte, error) {
+	resp, err := c.send(ctx, method, path, query, body)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	return io.ReadAll(resp.Body)
+}
@@ -0,0 +1,1407 @@
+// Code generated by api/openapi/gen from api/openapi/openapi.json; DO NOT EDIT.
+
+package client
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"time"
+)
+
+type Account struct {
+	Email   string `json:"email"`
+	Name    string `json:"name"`
+	Picture string `json:"picture"`
+	UserID  string `json:"user_id"`
+}
+
+type Analytics struct {
+	AverageExpense float64             `json:"averageExpense"`
+	AverageShare   float64             `json:"averageShare"`
+	Bucket         string              `json:"bucket"`
+	Buckets        []AnalyticsBucket   `json:"buckets"`
+	Categories     []AnalyticsCategory `json:"categories"`
+	Contacts       []AnalyticsContact  `json:"contacts"`
+	Expenses       int                 `json:"expenses"`
+	From           string              `json:"from"`
+	Groups         []AnalyticsGroup    `json:"groups"`
+	Share          float64             `json:"share"`
+	TimeZone       string              `json:"timeZone"`
+	To             string              `json:"to"`
+	TopPayers      []AnalyticsPayer    `json:"topPayers"`
+	Total          float64             `json:"total"`
+}
+
+type AnalyticsBucket struct {
+	Expenses int     `json:"expenses"`
+	Share    float64 `json:"share"`
+	Start    string  `json:"start"`
+	Total    float64 `json:"total"`
+}
+
+type AnalyticsCategory struct {
+	Category string  `json:"category"`
+	Expenses int     `json:"expenses"`
+	Share    float64 `json:"share"`
+}
+
+type AnalyticsContact struct {
+	Expenses int     `json:"expenses"`
+	ID       string  `json:"id"`
+	Name     string  `json:"name"`
+	Share    float64 `json:"share"`
+}
+
+type AnalyticsGroup struct {
+	Expenses int     `json:"expenses"`
+	GroupID  *int    `json:"groupId"`
+	Name     string  `json:"name"`
+	Share    float64 `json:"share"`
+}
+
+type AnalyticsPayer struct {
+	Expenses int     `json:"expenses"`
+	ID       string  `json:"id"`
+	Name     string  `json:"name"`
+	Paid     float64 `json:"paid"`
+	Share    float64 `json:"share"`
+}
+
+type Balance struct {
+	Balance      float64       `json:"balance"`
+	Email        string        `json:"email"`
+	ID           string        `json:"id"`
+	Name         string        `json:"name"`
+	PaymentLinks []PaymentLink `json:"paymentLinks"`
+}
+
+type Block struct {
+	CreatedAt time.Time `json:"createdAt"`
+	Email     string    `json:"email"`
+	Name      string    `json:"name"`
+	UserID    string    `json:"userId"`
+}
+
+type Budget struct {
+	Active      bool       `json:"active"`
+	Amount      float64    `json:"amount"`
+	Category    *string    `json:"category"`
+	CreatedAt   time.Time  `json:"createdAt"`
+	From        *time.Time `json:"from"`
+	Group       string     `json:"group"`
+	GroupID     int        `json:"groupId"`
+	ID          int        `json:"id"`
+	Name        string     `json:"name"`
+	Percent     float64    `json:"percent"`
+	Period      string     `json:"period"`
+	PeriodEnd   time.Time  `json:"periodEnd"`
+	PeriodStart time.Time  `json:"periodStart"`
+	Reached     []int      `json:"reached"`
+	Remaining   float64    `json:"remaining"`
+	Share       float64    `json:"share"`
+	Spent       float64    `json:"spent"`
+	Thresholds  []int      `json:"thresholds"`
+	TimeZone    string     `json:"timeZone"`
+	To          *time.Time `json:"to"`
+}
+
+type BudgetRequest struct {
+	Amount     float64    `json:"amount"`
+	Category   *string    `json:"category"`
+	From       *time.Time `json:"from"`
+	Name       string     `json:"name"`
+	Period     string     `json:"period"`
+	Thresholds []int      `json:"thresholds"`
+	TimeZone   string     `json:"timeZone"`
+	To         *time.Time `json:"to"`
+}
+
+type ChatAccount struct {
+	ChatName   string    `json:"chatName"`
+	ChatUserID string    `json:"chatUserId"`
+	CreatedAt  time.Time `json:"createdAt"`
+	ID         int       `json:"id"`
+	Provider   string    `json:"provider"`
+	TeamID     string    `json:"teamId"`
+}
+
+type ChatLinkPreview struct {
+	ChatName   string `json:"chatName"`
+	ChatUserID string `json:"chatUserId"`
+	Provider   string `json:"provider"`
+	TeamID     string `json:"teamId"`
+	TeamName   string `json:"teamName"`
+}
+
+type ChatLinkRequest struct {
+	Code string `json:"code"`
+}
+
+type Comment struct {
+	AuthorID      *string   `json:"authorId"`
+	AuthorName    string    `json:"authorName"`
+	Body          string    `json:"body"`
+	CreatedAt     time.Time `json:"createdAt"`
+	ID            int       `json:"id"`
+	TransactionID int       `json:"transactionId"`
+}
+
+type CommentRequest struct {
+	Body string `json:"body"`
+}
+
+type Contact struct {
+	Currency     string    `json:"currency"`
+	DefaultSplit *Split    `json:"defaultSplit"`
+	Email        string    `json:"email"`
+	Ghost        bool      `json:"ghost"`
+	Name         string    `json:"name"`
+	Nickname     string    `json:"nickname"`
+	Notes        string    `json:"notes"`
+	Since        time.Time `json:"since"`
+}
+
+type ContactRequest struct {
+	CreatedAt   time.Time  `json:"createdAt"`
+	Direction   string     `json:"direction"`
+	Email       string     `json:"email"`
+	GhostName   *string    `json:"ghostName"`
+	ID          int        `json:"id"`
+	Name        string     `json:"name"`
+	RespondedAt *time.Time `json:"respondedAt"`
+	Status      string     `json:"status"`
+	UserID      string     `json:"userId"`
+}
+
+type ContactUpdate struct {
+	Currency     *string `json:"currency"`
+	DefaultSplit *Split  `json:"defaultSplit"`
+	Nickname     *string `json:"nickname"`
+	Notes        *string `json:"notes"`
+}
+
+type EmailLoginRequest struct {
+	Email string `json:"email"`
+	Link  bool   `json:"link"`
+}
+
+type Ghost struct {
+	CreatedAt time.Time `json:"createdAt"`
+	Email     string    `json:"email"`
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+}
+
+type GhostRequest struct {
+	Email string `json:"email"`
+	Name  string `json:"name"`
+}
+
+type Group struct {
+	CreatedAt time.Time `json:"createdAt"`
+	CreatedBy *string   `json:"createdBy"`
+	ID        int       `json:"id"`
+	Members   []Member  `json:"members"`
+	Name      string    `json:"name"`
+}
+
+type GroupRequest struct {
+	Members []string `json:"members"`
+	Name    string   `json:"name"`
+}
+
+type Identity struct {
+	CreatedAt time.Time `json:"createdAt"`
+	Email     string    `json:"email"`
+	Provider  string    `json:"provider"`
+	Subject   string    `json:"subject"`
+}
+
+type Invitation struct {
+	CreatedAt  time.Time `json:"createdAt"`
+	Email      string    `json:"email"`
+	ExpiresAt  time.Time `json:"expiresAt"`
+	GhostID    *string   `json:"ghostId"`
+	ID         int       `json:"id"`
+	LastSentAt time.Time `json:"lastSentAt"`
+	Sends      int       `json:"sends"`
+}
+
+type InvitationAcceptRequest struct {
+	Token string `json:"token"`
+}
+
+type InvitationPreview struct {
+	Balance      float64 `json:"balance"`
+	ClaimsGhost  bool    `json:"claimsGhost"`
+	Email        string  `json:"email"`
+	Ghost        *string `json:"ghost"`
+	Inviter      string  `json:"inviter"`
+	InviterEmail string  `json:"inviterEmail"`
+}
+
+type InviteRequest struct {
+	Email   string `json:"email"`
+	GhostID string `json:"ghostId"`
+}
+
+type InviteResult struct {
+	ContactRequest *ContactRequest `json:"contactRequest"`
+	Invitation     *Invitation     `json:"invitation"`
+}
+
+type Member struct {
+	Email    string    `json:"email"`
+	ID       string    `json:"id"`
+	JoinedAt time.Time `json:"joinedAt"`
+	Name     string    `json:"name"`
+}
+
+type MergeRequest struct {
+	From string `json:"from"`
+	Into string `json:"into"`
+}
+
+type Notification struct {
+	Body      string     `json:"body"`
+	CreatedAt time.Time  `json:"createdAt"`
+	ID        int        `json:"id"`
+	Link      string     `json:"link"`
+	ReadAt    *time.Time `json:"readAt"`
+	Title     string     `json:"title"`
+	Type      string     `json:"type"`
+}
+
+type NotificationPreference struct {
+	Email   bool   `json:"email"`
+	Inbox   bool   `json:"inbox"`
+	Type    string `json:"type"`
+	Webhook bool   `json:"webhook"`
+}
+
+type NotificationPreferences struct {
+	Digest   string                   `json:"digest"`
+	TimeZone string                   `json:"timeZone"`
+	Types    []NotificationPreference `json:"types"`
+}
+
+type NotificationPreferencesUpdate struct {
+	Digest   *string                  `json:"digest"`
+	TimeZone *string                  `json:"timeZone"`
+	Types    []NotificationPreference `json:"types"`
+}
+
+type Participant struct {
+	DollarShare     float64 `json:"dollarShare"`
+	Email           string  `json:"email"`
+	FractionalShare int     `json:"fractionalShare"`
+	ID              string  `json:"id"`
+	Name            string  `json:"name"`
+}
+
+type PaymentHandle struct {
+	Bic       string    `json:"bic"`
+	CreatedAt time.Time `json:"createdAt"`
+	Handle    string    `json:"handle"`
+	Kind      string    `json:"kind"`
+	Name      string    `json:"name"`
+}
+
+type PaymentHandleRequest struct {
+	Bic    string `json:"bic"`
+	Handle string `json:"handle"`
+	Kind   string `json:"kind"`
+	Name   string `json:"name"`
+}
+
+type PaymentLink struct {
+	Amount   float64 `json:"amount"`
+	Currency string  `json:"currency"`
+	Kind     string  `json:"kind"`
+	Memo     string  `json:"memo"`
+	Payload  string  `json:"payload"`
+	QRCode   string  `json:"qrCode"`
+	URL      string  `json:"url"`
+}
+
+type Reminder struct {
+	Amount    float64   `json:"amount"`
+	ContactID string    `json:"contactId"`
+	ID        int       `json:"id"`
+	Name      string    `json:"name"`
+	SentAt    time.Time `json:"sentAt"`
+	Stage     int       `json:"stage"`
+}
+
+type ReminderRule struct {
+	AfterDays  int       `json:"afterDays"`
+	ContactID  *string   `json:"contactId"`
+	CreatedAt  time.Time `json:"createdAt"`
+	Enabled    bool      `json:"enabled"`
+	ID         int       `json:"id"`
+	QuietEnd   int       `json:"quietEnd"`
+	QuietStart int       `json:"quietStart"`
+	Schedule   []int     `json:"schedule"`
+	Threshold  float64   `json:"threshold"`
+}
+
+type ReminderRuleRequest struct {
+	AfterDays  int     `json:"afterDays"`
+	ContactID  *string `json:"contactId"`
+	Enabled    *bool   `json:"enabled"`
+	QuietEnd   *int    `json:"quietEnd"`
+	QuietStart *int    `json:"quietStart"`
+	Schedule   []int   `json:"schedule"`
+	Threshold  float64 `json:"threshold"`
+}
+
+type ReminderStatus struct {
+	Amount         float64    `json:"amount"`
+	ContactID      string     `json:"contactId"`
+	LastRemindedAt *time.Time `json:"lastRemindedAt"`
+	Name           string     `json:"name"`
+	NextReminderAt *time.Time `json:"nextReminderAt"`
+	OverSince      time.Time  `json:"overSince"`
+	Sent           int        `json:"sent"`
+}
+
+type SearchResult struct {
+	Email           string     `json:"email"`
+	Ghost           bool       `json:"ghost"`
+	ID              string     `json:"id"`
+	LastTransaction *time.Time `json:"lastTransaction"`
+	Members         []string   `json:"members"`
+	Name            string     `json:"name"`
+	Nickname        string     `json:"nickname"`
+	Transactions    int        `json:"transactions"`
+	Type            string     `json:"type"`
+}
+
+type Session struct {
+	CreatedAt  time.Time `json:"createdAt"`
+	Current    bool      `json:"current"`
+	ExpiresAt  time.Time `json:"expiresAt"`
+	ID         string    `json:"id"`
+	IP         string    `json:"ip"`
+	LastSeenAt time.Time `json:"lastSeenAt"`
+	UserAgent  string    `json:"userAgent"`
+}
+
+type Settlement struct {
+	Amount      float64   `json:"amount"`
+	Description string    `json:"description"`
+	From        string    `json:"from"`
+	ID          string    `json:"id"`
+	Timestamp   time.Time `json:"timestamp"`
+	To          string    `json:"to"`
+}
+
+type ShareLink struct {
+	CreatedAt    time.Time  `json:"createdAt"`
+	ExpiresAt    time.Time  `json:"expiresAt"`
+	From         *time.Time `json:"from"`
+	GroupID      *int       `json:"groupId"`
+	ID           int        `json:"id"`
+	LastViewedAt *time.Time `json:"lastViewedAt"`
+	RevokedAt    *time.Time `json:"revokedAt"`
+	ShowEmails   bool       `json:"showEmails"`
+	Title        string     `json:"title"`
+	To           *time.Time `json:"to"`
+	URL          string     `json:"url"`
+	Views        int        `json:"views"`
+}
+
+type ShareLinkRequest struct {
+	ExpiresAt  *time.Time `json:"expiresAt"`
+	From       *time.Time `json:"from"`
+	GroupID    *int       `json:"groupId"`
+	ShowEmails bool       `json:"showEmails"`
+	Title      string     `json:"title"`
+	To         *time.Time `json:"to"`
+}
+
+type Shared struct {
+	ExpiresAt    time.Time           `json:"expiresAt"`
+	From         *time.Time          `json:"from"`
+	Group        string              `json:"group"`
+	Payments     []SharedPayment     `json:"payments"`
+	People       []SharedPerson      `json:"people"`
+	Title        string              `json:"title"`
+	To           *time.Time          `json:"to"`
+	Total        float64             `json:"total"`
+	Transactions []SharedTransaction `json:"transactions"`
+}
+
+type SharedPayment struct {
+	Amount float64 `json:"amount"`
+	From   string  `json:"from"`
+	To     string  `json:"to"`
+}
+
+type SharedPerson struct {
+	Balance float64 `json:"balance"`
+	Email   string  `json:"email"`
+	Name    string  `json:"name"`
+	Paid    float64 `json:"paid"`
+	Share   float64 `json:"share"`
+}
+
+type SharedShare struct {
+	Amount float64 `json:"amount"`
+	Name   string  `json:"name"`
+}
+
+type SharedTransaction struct {
+	Amount      float64       `json:"amount"`
+	Description string        `json:"description"`
+	PaidBy      string        `json:"paidBy"`
+	Shares      []SharedShare `json:"shares"`
+	SplitType   string        `json:"splitType"`
+	Timestamp   time.Time     `json:"timestamp"`
+}
+
+type Split struct {
+	SplitType  string `json:"splitType"`
+	TheirShare int    `json:"theirShare"`
+	YourShare  int    `json:"yourShare"`
+}
+
+type Statement struct {
+	Categories     []StatementCategory `json:"categories"`
+	Closing        []Balance           `json:"closing"`
+	ClosingBalance float64             `json:"closingBalance"`
+	From           time.Time           `json:"from"`
+	Group          string              `json:"group"`
+	GroupID        int                 `json:"groupId"`
+	Lines          []StatementLine     `json:"lines"`
+	Month          string              `json:"month"`
+	Name           string              `json:"name"`
+	Opening        []Balance           `json:"opening"`
+	OpeningBalance float64             `json:"openingBalance"`
+	Share          float64             `json:"share"`
+	Spent          float64             `json:"spent"`
+	To             time.Time           `json:"to"`
+}
+
+type StatementCategory struct {
+	Category string  `json:"category"`
+	Share    float64 `json:"share"`
+	Spent    float64 `json:"spent"`
+}
+
+type StatementLine struct {
+	Amount      float64          `json:"amount"`
+	Category    string           `json:"category"`
+	Change      float64          `json:"change"`
+	Description string           `json:"description"`
+	ID          string           `json:"id"`
+	PaidBy      string           `json:"paidBy"`
+	Shares      []StatementShare `json:"shares"`
+	SplitType   string           `json:"splitType"`
+	Timestamp   time.Time        `json:"timestamp"`
+}
+
+type StatementShare struct {
+	Amount float64 `json:"amount"`
+	ID     string  `json:"id"`
+	Name   string  `json:"name"`
+}
+
+type StatementSubscription struct {
+	CreatedAt time.Time `json:"createdAt"`
+	Group     string    `json:"group"`
+	GroupID   int       `json:"groupId"`
+	LastSent  *string   `json:"lastSent"`
+}
+
+type Token struct {
+	CreatedAt  time.Time  `json:"createdAt"`
+	ExpiresAt  *time.Time `json:"expiresAt"`
+	ID         int        `json:"id"`
+	LastUsedAt *time.Time `json:"lastUsedAt"`
+	Name       string     `json:"name"`
+	Scope      string     `json:"scope"`
+	Token      string     `json:"token"`
+}
+
+type Transaction struct {
+	Amount       float64       `json:"amount"`
+	Category     string        `json:"category"`
+	Description  string        `json:"description"`
+	GroupID      *int          `json:"groupId"`
+	ID           string        `json:"id"`
+	Participants []Participant `json:"participants"`
+	Payer        string        `json:"payer"`
+	SplitType    string        `json:"splitType"`
+	Timestamp    time.Time     `json:"timestamp"`
+}
+
+type Webhook struct {
+	CreatedAt   time.Time `json:"createdAt"`
+	Description string    `json:"description"`
+	Enabled     bool      `json:"enabled"`
+	Events      []string  `json:"events"`
+	ID          int       `json:"id"`
+	Secret      string    `json:"secret"`
+	URL         string    `json:"url"`
+}
+
+type WebhookDelivery struct {
+	Attempts       int                    `json:"attempts"`
+	CreatedAt      time.Time              `json:"createdAt"`
+	Error          string                 `json:"error"`
+	EventType      string                 `json:"eventType"`
+	ID             int                    `json:"id"`
+	LastAttemptAt  *time.Time             `json:"lastAttemptAt"`
+	NextAttemptAt  *time.Time             `json:"nextAttemptAt"`
+	Payload        map[string]interface{} `json:"payload"`
+	ResponseStatus *int                   `json:"responseStatus"`
+	Status         string                 `json:"status"`
+}
+
+type WebhookRequest struct {
+	Description *string  `json:"description"`
+	Enabled     *bool    `json:"enabled"`
+	Events      []string `json:"events"`
+	URL         *string  `json:"url"`
+}
+
+// GetCurrentAccount The account the session or personal access token belongs to
+func (c *Client) GetCurrentAccount(ctx context.Context) (*Account, error) {
+	var out Account
+	err := c.do(ctx, "GET", "/api/v1/account", nil, nil, &out)
+	if err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// MergeAccounts Administrators only: move everything from one account into another and delete it
+func (c *Client) MergeAccounts(ctx context.Context, body MergeRequest) (*MergeRequest, error) {
+	var out MergeRequest
+	err := c.do(ctx, "PUT", "/api/v1/admin/merge", nil, body, &out)
+	if err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// GetAnalyticsParams The query parameters of GetAnalytics
+type GetAnalyticsParams struct {
+	Bucket   string
+	From     string
+	To       string
+	GroupID  int
+	Category string
+}
+
+// GetAnalytics What the user spent over time, by category, group, contact and payer
+func (c *Client) GetAnalytics(ctx context.Context, params GetAnalyticsParams) (*Analytics, error) {
+	query := url.Values{}
+	if params.Bucket != "" {
+		query.Set("bucket", params.Bucket)
+	}
+	if params.From != "" {
+		query.Set("from", params.From)
+	}
+	if params.To != "" {
+		query.Set("to", params.To)
+	}
+	if params.GroupID != 0 {
+		query.Set("groupId", fmt.Sprint(params.GroupID))
+	}
+	if params.Category != "" {
+		query.Set("category", params.Category)
+	}
+	var out Analytics
+	err := c.do(ctx, "GET", "/api/v1/analytics", query, nil, &out)
+	if err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// GetBalancesParams The query parameters of GetBalances
+type GetBalancesParams struct {
+	GroupID int
+	Before  time.Time
+}
+
+// GetBalances What the user and every other account owe each other
+func (c *Client) GetBalances(ctx context.Context, params GetBalancesParams) ([]Balance, error) {
+	query := url.Values{}
+	if params.GroupID != 0 {
+		query.Set("groupId", fmt.Sprint(params.GroupID))
+	}
+	if !params.Before.IsZero() {
+		query.Set("before", params.Before.Format(time.RFC3339))
+	}
+	var out []Balance
+	err := c.do(ctx, "GET", "/api/v1/balances", query, nil, &out)
+	return out, err
+}
+
+// BlockUser Block a user
+func (c *Client) BlockUser(ctx context.Context, id string) (string, error) {
+	var out string
+	err := c.do(ctx, "PUT", "/api/v1/block/"+url.PathEscape(id), nil, nil, &out)
+	return out, err
+}
+
+// UnblockUser Unblock a user
+func (c *Client) UnblockUser(ctx context.Context, id string) (string, error) {
+	var out string
+	err := c.do(ctx, "DELETE", "/api/v1/block/"+url.PathEscape(id), nil, nil, &out)
+	return out, err
+}
+
+// GetBlocks Users the user has blocked, most recent first
+func (c *Client) GetBlocks(ctx context.Context) ([]Block, error) {
+	var out []Block
+	err := c.do(ctx, "GET", "/api/v1/blocks", nil, nil, &out)
+	return out, err
+}
+
+// GetBudget A budget and its status
+func (c *Client) GetBudget(ctx context.Context, id string) (*Budget, error) {
+	var out Budget
+	err := c.do(ctx, "GET", "/api/v1/budget/"+url.PathEscape(id), nil, nil, &out)
+	if err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// ModifyBudget Replace a budget
+func (c *Client) ModifyBudget(ctx context.Context, id string, body BudgetRequest) (*Budget, error) {
+	var out Budget
+	err := c.do(ctx, "PATCH", "/api/v1/budget/"+url.PathEscape(id), nil, body, &out)
+	if err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// DeleteBudget Delete a budget
+func (c *Client) DeleteBudget(ctx context.Context, id string) (int, error) {
+	var out int
+	err := c.do(ctx, "DELETE", "/api/v1/budget/"+url.PathEscape(id), nil, nil, &out)
+	return out, err
+}
+
+// GetBudgets The budgets of every group the user is a member of, with their status
+func (c *Client) GetBudgets(ctx context.Context) ([]Budget, error) {
+	var out []Budget
+	err := c.do(ctx, "GET", "/api/v1/budgets", nil, nil, &out)
+	return out, err
+}
+
+// LinkChatAccount Link the chat user a link was sent to to the user's account
+func (c *Client) LinkChatAccount(ctx context.Context, body ChatLinkRequest) (*ChatAccount, error) {
+	var out ChatAccount
+	err := c.do(ctx, "PUT", "/api/v1/chat-account", nil, body, &out)
+	if err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// PreviewChatLinkParams The query parameters of PreviewChatLink
+type PreviewChatLinkParams struct {
+	Code string
+}
+
+// PreviewChatLink Who a chat link links, for the user to confirm before linking it
+func (c *Client) PreviewChatLink(ctx context.Context, params PreviewChatLinkParams) (*ChatLinkPreview, error) {
+	query := url.Values{}
+	if params.Code != "" {
+		query.Set("code", params.Code)
+	}
+	var out ChatLinkPreview
+	err := c.do(ctx, "GET", "/api/v1/chat-account/preview", query, nil, &out)
+	if err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// UnlinkChatAccount Unlink a chat account
+func (c *Client) UnlinkChatAccount(ctx context.Context, id string) (int, error) {
+	var out int
+	err := c.do(ctx, "DELETE", "/api/v1/chat-account/"+url.PathEscape(id), nil, nil, &out)
+	return out, err
+}
+
+// GetChatAccounts The Slack and Discord users linked to the user's account
+func (c *Client) GetChatAccounts(ctx context.Context) ([]ChatAccount, error) {
+	var out []ChatAccount
+	err := c.do(ctx, "GET", "/api/v1/chat-accounts", nil, nil, &out)
+	return out, err
+}
+
+// DeleteComment Delete a comment the user wrote
+func (c *Client) DeleteComment(ctx context.Context, id string) (int, error) {
+	var out int
+	err := c.do(ctx, "DELETE", "/api/v1/comment/"+url.PathEscape(id), nil, nil, &out)
+	return out, err
+}
+
+// CancelContactRequest Withdraw a request the user sent
+func (c *Client) CancelContactRequest(ctx context.Context, id string) (*ContactRequest, error) {
+	var out ContactRequest
+	err := c.do(ctx, "DELETE", "/api/v1/contact-request/"+url.PathEscape(id), nil, nil, &out)
+	if err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// AcceptContactRequest Accept a request sent to the user, making the two users contacts
+func (c *Client) AcceptContactRequest(ctx context.Context, id string) (*ContactRequest, error) {
+	var out ContactRequest
+	err := c.do(ctx, "PUT", "/api/v1/contact-request/"+url.PathEscape(id)+"/accept", nil, nil, &out)
+	if err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// DeclineContactRequest Decline a request sent to the user
+func (c *Client) DeclineContactRequest(ctx context.Context, id string) (*ContactRequest, error) {
+	var out ContactRequest
+	err := c.do(ctx, "PUT", "/api/v1/contact-request/"+url.PathEscape(id)+"/decline", nil, nil, &out)
+	if err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// GetContactRequests Pending contact requests sent and received, newest first
+func (c *Client) GetContactRequests(ctx context.Context) ([]ContactRequest, error) {
+	var out []ContactRequest
+	err := c.do(ctx, "GET", "/api/v1/contact-requests", nil, nil, &out)
+	return out, err
+}
+
+// AddContact Send a contact request, or accept the one the other user already sent
+func (c *Client) AddContact(ctx context.Context, id string) (*ContactRequest, error) {
+	var out ContactRequest
+	err := c.do(ctx, "PUT", "/api/v1/contact/"+url.PathEscape(id), nil, nil, &out)
+	if err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// UpdateContact Set the nickname, notes, currency or default split kept for a contact
+func (c *Client) UpdateContact(ctx context.Context, id string, body ContactUpdate) (*Contact, error) {
+	var out Contact
+	err := c.do(ctx, "PATCH", "/api/v1/contact/"+url.PathEscape(id), nil, body, &out)
+	if err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// RemoveContact Remove a contact in both directions and withdraw pending requests between the two users
+func (c *Client) RemoveContact(ctx context.Context, id string) (string, error) {
+	var out string
+	err := c.do(ctx, "DELETE", "/api/v1/contact/"+url.PathEscape(id), nil, nil, &out)
+	return out, err
+}
+
+// GetAllContacts Established contacts, keyed by account ID
+func (c *Client) GetAllContacts(ctx context.Context) (map[string]Contact, error) {
+	var out map[string]Contact
+	err := c.do(ctx, "GET", "/api/v1/contacts", nil, nil, &out)
+	return out, err
+}
+
+// CreateGhost Make a placeholder for someone who hasn't signed up
+func (c *Client) CreateGhost(ctx context.Context, body GhostRequest) (*Ghost, error) {
+	var out Ghost
+	err := c.do(ctx, "PUT", "/api/v1/ghost", nil, body, &out)
+	if err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// DeleteGhost Delete a placeholder that isn't in any transaction
+func (c *Client) DeleteGhost(ctx context.Context, id string) (string, error) {
+	var out string
+	err := c.do(ctx, "DELETE", "/api/v1/ghost/"+url.PathEscape(id), nil, nil, &out)
+	return out, err
+}
+
+// MergeGhost Move a placeholder's transactions into a contact
+func (c *Client) MergeGhost(ctx context.Context, id string, contactID string) (string, error) {
+	var out string
+	err := c.do(ctx, "PUT", "/api/v1/ghost/"+url.PathEscape(id)+"/merge/"+url.PathEscape(contactID), nil, nil, &out)
+	return out, err
+}
+
+// GetGhosts Placeholders the user made
+func (c *Client) GetGhosts(ctx context.Context) ([]Ghost, error) {
+	var out []Ghost
+	err := c.do(ctx, "GET", "/api/v1/ghosts", nil, nil, &out)
+	return out, err
+}
+
+// CreateGroup Start a group with the user and some of their contacts
+func (c *Client) CreateGroup(ctx context.Context, body GroupRequest) (*Group, error) {
+	var out Group
+	err := c.do(ctx, "PUT", "/api/v1/group", nil, body, &out)
+	if err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// GetGroup A group the user is a member of
+func (c *Client) GetGroup(ctx context.Context, id string) (*Group, error) {
+	var out Group
+	err := c.do(ctx, "GET", "/api/v1/group/"+url.PathEscape(id), nil, nil, &out)
+	if err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// RenameGroup Rename a group
+func (c *Client) RenameGroup(ctx context.Context, id string, body GroupRequest) (*Group, error) {
+	var out Group
+	err := c.do(ctx, "PATCH", "/api/v1/group/"+url.PathEscape(id), nil, body, &out)
+	if err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// CreateBudget Give a group a budget
+func (c *Client) CreateBudget(ctx context.Context, id string, body BudgetRequest) (*Budget, error) {
+	var out Budget
+	err := c.do(ctx, "PUT", "/api/v1/group/"+url.PathEscape(id)+"/budget", nil, body, &out)
+	if err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// GetGroupBudgets The budgets of a group, with their status
+func (c *Client) GetGroupBudgets(ctx context.Context, id string) ([]Budget, error) {
+	var out []Budget
+	err := c.do(ctx, "GET", "/api/v1/group/"+url.PathEscape(id)+"/budgets", nil, nil, &out)
+	return out, err
+}
+
+// AddGroupMember Add one of the user's contacts to a group
+func (c *Client) AddGroupMember(ctx context.Context, id string, userID string) (*Group, error) {
+	var out Group
+	err := c.do(ctx, "PUT", "/api/v1/group/"+url.PathEscape(id)+"/member/"+url.PathEscape(userID), nil, nil, &out)
+	if err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// RemoveGroupMember Remove someone from a group, or leave it
+func (c *Client) RemoveGroupMember(ctx context.Context, id string, userID string) (string, error) {
+	var out string
+	err := c.do(ctx, "DELETE", "/api/v1/group/"+url.PathEscape(id)+"/member/"+url.PathEscape(userID), nil, nil, &out)
+	return out, err
+}
+
+// GetStatementParams The query parameters of GetStatement
+type GetStatementParams struct {
+	Month  string
+	Format string
+}
+
+// GetStatement The user's monthly statement for a group
+func (c *Client) GetStatement(ctx context.Context, id string, params GetStatementParams) (*Statement, error) {
+	query := url.Values{}
+	if params.Month != "" {
+		query.Set("month", params.Month)
+	}
+	if params.Format != "" {
+		query.Set("format", params.Format)
+	}
+	var out Statement
+	err := c.do(ctx, "GET", "/api/v1/group/"+url.PathEscape(id)+"/statement", query, nil, &out)
+	if err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// SubscribeToStatements Email the user their statement for the group on the first of every month
+func (c *Client) SubscribeToStatements(ctx context.Context, id string) (int, error) {
+	var out int
+	err := c.do(ctx, "PUT", "/api/v1/group/"+url.PathEscape(id)+"/statement-subscription", nil, nil, &out)
+	return out, err
+}
+
+// UnsubscribeFromStatements Stop emailing the user statements for the group
+func (c *Client) UnsubscribeFromStatements(ctx context.Context, id string) (int, error) {
+	var out int
+	err := c.do(ctx, "DELETE", "/api/v1/group/"+url.PathEscape(id)+"/statement-subscription", nil, nil, &out)
+	return out, err
+}
+
+// GetGroups The groups the user is a member of
+func (c *Client) GetGroups(ctx context.Context) ([]Group, error) {
+	var out []Group
+	err := c.do(ctx, "GET", "/api/v1/groups", nil, nil, &out)
+	return out, err
+}
+
+// GetIdentities Every login linked to the account
+func (c *Client) GetIdentities(ctx context.Context) ([]Identity, error) {
+	var out []Identity
+	err := c.do(ctx, "GET", "/api/v1/identities", nil, nil, &out)
+	return out, err
+}
+
+// UnlinkIdentity Remove a login from the account, the last one can't be removed. Only allowed from a browser session
+func (c *Client) UnlinkIdentity(ctx context.Context, provider string, subject string) (string, error) {
+	var out string
+	err := c.do(ctx, "DELETE", "/api/v1/identity/"+url.PathEscape(provider)+"/"+url.PathEscape(subject), nil, nil, &out)
+	return out, err
+}
+
+// InviteContact Invite someone by email
+func (c *Client) InviteContact(ctx context.Context, body InviteRequest) (*InviteResult, error) {
+	var out InviteResult
+	err := c.do(ctx, "PUT", "/api/v1/invitation", nil, body, &out)
+	if err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// RevokeInvitation Revoke an invitation
+func (c *Client) RevokeInvitation(ctx context.Context, id string) (string, error) {
+	var out string
+	err := c.do(ctx, "DELETE", "/api/v1/invitation/"+url.PathEscape(id), nil, nil, &out)
+	return out, err
+}
+
+// ResendInvitation Email a new link for an invitation, the old one stops working
+func (c *Client) ResendInvitation(ctx context.Context, id string) (*InviteResult, error) {
+	var out InviteResult
+	err := c.do(ctx, "PUT", "/api/v1/invitation/"+url.PathEscape(id)+"/resend", nil, nil, &out)
+	if err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// GetInvitations Invitations that weren't accepted or revoked, expired ones included
+func (c *Client) GetInvitations(ctx context.Context) ([]Invitation, error) {
+	var out []Invitation
+	err := c.do(ctx, "GET", "/api/v1/invitations", nil, nil, &out)
+	return out, err
+}
+
+// GetNotificationPreferences How the user is notified of each type of notification
+func (c *Client) GetNotificationPreferences(ctx context.Context) (*NotificationPreferences, error) {
+	var out NotificationPreferences
+	err := c.do(ctx, "GET", "/api/v1/notification-preferences", nil, nil, &out)
+	if err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// UpdateNotificationPreferences Change how the user is notified
+func (c *Client) UpdateNotificationPreferences(ctx context.Context, body NotificationPreferencesUpdate) (*NotificationPreferences, error) {
+	var out NotificationPreferences
+	err := c.do(ctx, "PATCH", "/api/v1/notification-preferences", nil, body, &out)
+	if err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// MarkNotificationRead Mark a notification read
+func (c *Client) MarkNotificationRead(ctx context.Context, id string) (string, error) {
+	var out string
+	err := c.do(ctx, "PUT", "/api/v1/notification/"+url.PathEscape(id)+"/read", nil, nil, &out)
+	return out, err
+}
+
+// GetNotificationsParams The query parameters of GetNotifications
+type GetNotificationsParams struct {
+	Unread bool
+	Limit  int
+	Before int
+}
+
+// GetNotifications The user's notification inbox, newest first
+func (c *Client) GetNotifications(ctx context.Context, params GetNotificationsParams) ([]Notification, error) {
+	query := url.Values{}
+	if params.Unread {
+		query.Set("unread", "true")
+	}
+	if params.Limit != 0 {
+		query.Set("limit", fmt.Sprint(params.Limit))
+	}
+	if params.Before != 0 {
+		query.Set("before", fmt.Sprint(params.Before))
+	}
+	var out []Notification
+	err := c.do(ctx, "GET", "/api/v1/notifications", query, nil, &out)
+	return out, err
+}
+
+// MarkAllNotificationsRead Mark every notification in the inbox read
+func (c *Client) MarkAllNotificationsRead(ctx context.Context) (int, error) {
+	var out int
+	err := c.do(ctx, "PUT", "/api/v1/notifications/read", nil, nil, &out)
+	return out, err
+}
+
+// SetPaymentHandle Add the payment handle of a kind, replacing the one the user had
+func (c *Client) SetPaymentHandle(ctx context.Context, body PaymentHandleRequest) (*PaymentHandle, error) {
+	var out PaymentHandle
+	err := c.do(ctx, "PUT", "/api/v1/payment-handle", nil, body, &out)
+	if err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// DeletePaymentHandle Remove a payment handle
+func (c *Client) DeletePaymentHandle(ctx context.Context, kind string) (string, error) {
+	var out string
+	err := c.do(ctx, "DELETE", "/api/v1/payment-handle/"+url.PathEscape(kind), nil, nil, &out)
+	return out, err
+}
+
+// GetPaymentHandles How the user can be paid by the people who owe them
+func (c *Client) GetPaymentHandles(ctx context.Context) ([]PaymentHandle, error) {
+	var out []PaymentHandle
+	err := c.do(ctx, "GET", "/api/v1/payment-handles", nil, nil, &out)
+	return out, err
+}
+
+// SaveReminderRule Create or replace the default reminder rule, or the rule for a contact
+func (c *Client) SaveReminderRule(ctx context.Context, body ReminderRuleRequest) (*ReminderRule, error) {
+	var out ReminderRule
+	err := c.do(ctx, "PUT", "/api/v1/reminder-rule", nil, body, &out)
+	if err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// DeleteReminderRule Delete a reminder rule
+func (c *Client) DeleteReminderRule(ctx context.Context, id string) (int, error) {
+	var out int
+	err := c.do(ctx, "DELETE", "/api/v1/reminder-rule/"+url.PathEscape(id), nil, nil, &out)
+	return out, err
+}
+
+// GetReminderRules The user's payment reminder rules, the default rule first
+func (c *Client) GetReminderRules(ctx context.Context) ([]ReminderRule, error) {
+	var out []ReminderRule
+	err := c.do(ctx, "GET", "/api/v1/reminder-rules", nil, nil, &out)
+	return out, err
+}
+
+// GetReminders Everyone who owes the user more than their reminder rule allows
+func (c *Client) GetReminders(ctx context.Context) ([]ReminderStatus, error) {
+	var out []ReminderStatus
+	err := c.do(ctx, "GET", "/api/v1/reminders", nil, nil, &out)
+	return out, err
+}
+
+// GetReminderHistoryParams The query parameters of GetReminderHistory
+type GetReminderHistoryParams struct {
+	ContactID string
+}
+
+// GetReminderHistory The reminders the user sent, newest first
+func (c *Client) GetReminderHistory(ctx context.Context, params GetReminderHistoryParams) ([]Reminder, error) {
+	query := url.Values{}
+	if params.ContactID != "" {
+		query.Set("contactId", params.ContactID)
+	}
+	var out []Reminder
+	err := c.do(ctx, "GET", "/api/v1/reminders/history", query, nil, &out)
+	return out, err
+}
+
+// SearchParams The query parameters of Search
+type SearchParams struct {
+	Q     string
+	Limit int
+	Type  string
+}
+
+// Search Find contacts and groups for autocomplete
+func (c *Client) Search(ctx context.Context, params SearchParams) ([]SearchResult, error) {
+	query := url.Values{}
+	if params.Q != "" {
+		query.Set("q", params.Q)
+	}
+	if params.Limit != 0 {
+		query.Set("limit", fmt.Sprint(params.Limit))
+	}
+	if params.Type != "" {
+		query.Set("type", params.Type)
+	}
+	var out []SearchResult
+	err := c.do(ctx, "GET", "/api/v1/search", query, nil, &out)
+	return out, err
+}
+
+// RevokeSession Log out a session, it stops working immediately. Only allowed from a browser session
+func (c *Client) RevokeSession(ctx context.Context, id string) (string, error) {
+	var out string
+	err := c.do(ctx, "DELETE", "/api/v1/session/"+url.PathEscape(id), nil, nil, &out)
+	return out, err
+}
+
+// GetSessions Browser sessions the account is logged in with
+func (c *Client) GetSessions(ctx context.Context) ([]Session, error) {
+	var out []Session
+	err := c.do(ctx, "GET", "/api/v1/sessions", nil, nil, &out)
+	return out, err
+}
+
+// RevokeOtherSessions Log out every session except the one making the request, only allowed from a browser session
+func (c *Client) RevokeOtherSessions(ctx context.Context) (int, error) {
+	var out int
+	err := c.do(ctx, "DELETE", "/api/v1/sessions", nil, nil, &out)
+	return out, err
+}
+
+// CreateSettlement Record a payment between the user and another account
+func (c *Client) CreateSettlement(ctx context.Context, body Settlement) (*Settlement, error) {
+	var out Settlement
+	err := c.do(ctx, "PUT", "/api/v1/settlement", nil, body, &out)
+	if err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// CreateShareLink Create a read-only link to the transactions of a group or a date range
+func (c *Client) CreateShareLink(ctx context.Context, body ShareLinkRequest) (*ShareLink, error) {
+	var out ShareLink
+	err := c.do(ctx, "PUT", "/api/v1/share-link", nil, body, &out)
+	if err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// RevokeShareLink Revoke a share link
+func (c *Client) RevokeShareLink(ctx context.Context, id string) (int, error) {
+	var out int
+	err := c.do(ctx, "DELETE", "/api/v1/share-link/"+url.PathEscape(id), nil, nil, &out)
+	return out, err
+}
+
+// GetShareLinks The user's share links, revoked and expired ones included
+func (c *Client) GetShareLinks(ctx context.Context) ([]ShareLink, error) {
+	var out []ShareLink
+	err := c.do(ctx, "GET", "/api/v1/share-links", nil, nil, &out)
+	return out, err
+}
+
+// GetShared What a share link shows, no session needed
+func (c *Client) GetShared(ctx context.Context, token string) (*Shared, error) {
+	var out Shared
+	err := c.do(ctx, "GET", "/api/v1/shared/"+url.PathEscape(token), nil, nil, &out)
+	if err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// GetStatementSubscriptions The groups the user gets monthly statements for by email
+func (c *Client) GetStatementSubscriptions(ctx context.Context) ([]StatementSubscription, error) {
+	var out []StatementSubscription
+	err := c.do(ctx, "GET", "/api/v1/statement-subscriptions", nil, nil, &out)
+	return out, err
+}
+
+// CreateToken Create a personal access token, only allowed from a browser session
+func (c *Client) CreateToken(ctx context.Context, body Token) (*Token, error) {
+	var out Token
+	err := c.do(ctx, "PUT", "/api/v1/token", nil, body, &out)
+	if err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// RevokeToken Revoke a personal access token, only allowed from a browser session
+func (c *Client) RevokeToken(ctx context.Context, id string) (int, error) {
+	var out int
+	err := c.do(ctx, "DELETE", "/api/v1/token/"+url.PathEscape(id), nil, nil, &out)
+	return out, err
+}
+
+// GetAllTokens The user's active personal access tokens
+func (c *Client) GetAllTokens(ctx context.Context) ([]Token, error) {
+	var out []Token
+	err := c.do(ctx, "GET", "/api/v1/tokens", nil, nil, &out)
+	return out, err
+}
+
+// CreateTransaction Record a new transaction
+func (c *Client) CreateTransaction(ctx context.Context, body Transaction) (*Transaction, error) {
+	var out Transaction
+	err := c.do(ctx, "PUT", "/api/v1/transaction", nil, body, &out)
+	if err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// GetTransaction A single transaction with its participants
+func (c *Client) GetTransaction(ctx context.Context, id string) (*Transaction, error) {
+	var out Transaction
+	err := c.do(ctx, "GET", "/api/v1/transaction/"+url.PathEscape(id), nil, nil, &out)
+	if err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// ModifyTransaction Replace a transaction
+func (c *Client) ModifyTransaction(ctx context.Context, id string, body Transaction) (*Transaction, error) {
+	var out Transaction
+	err := c.do(ctx, "PATCH", "/api/v1/transaction/"+url.PathEscape(id), nil, body, &out)
+	if err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// DeleteTransaction Delete a transaction the user is part of
+func (c *Client) DeleteTransaction(ctx context.Context, id string) (int, error) {
+	var out int
+	err := c.do(ctx, "DELETE", "/api/v1/transaction/"+url.PathEscape(id), nil, nil, &out)
+	return out, err
+}
+
+// CreateComment Comment on a transaction the user is part of
+func (c *Client) CreateComment(ctx context.Context, id string, body CommentRequest) (*Comment, error) {
+	var out Comment
+	err := c.do(ctx, "PUT", "/api/v1/transaction/"+url.PathEscape(id)+"/comment", nil, body, &out)
+	if err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// GetComments The comments on a transaction, oldest first
+func (c *Client) GetComments(ctx context.Context, id string) ([]Comment, error) {
+	var out []Comment
+	err := c.do(ctx, "GET", "/api/v1/transaction/"+url.PathEscape(id)+"/comments", nil, nil, &out)
+	return out, err
+}
+
+// GetAllTransactionsParams The query parameters of GetAllTransactions
+type GetAllTransactionsParams struct {
+	GroupID int
+}
+
+// GetAllTransactions Every transaction the user paid for or participates in, keyed by transaction ID
+func (c *Client) GetAllTransactions(ctx context.Context, params GetAllTransactionsParams) (map[string]Transaction, error) {
+	query := url.Values{}
+	if params.GroupID != 0 {
+		query.Set("groupId", fmt.Sprint(params.GroupID))
+	}
+	var out map[string]Transaction
+	err := c.do(ctx, "GET", "/api/v1/transactions", query, nil, &out)
+	return out, err
+}
+
+// CreateWebhook Register a URL to be sent events
+func (c *Client) CreateWebhook(ctx context.Context, body WebhookRequest) (*Webhook, error) {
+	var out Webhook
+	err := c.do(ctx, "PUT", "/api/v1/webhook", nil, body, &out)
+	if err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// UpdateWebhook Change a webhook, null fields are left unchanged
+func (c *Client) UpdateWebhook(ctx context.Context, id string, body WebhookRequest) (*Webhook, error) {
+	var out Webhook
+	err := c.do(ctx, "PATCH", "/api/v1/webhook/"+url.PathEscape(id), nil, body, &out)
+	if err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// DeleteWebhook Delete a webhook and its deliveries
+func (c *Client) DeleteWebhook(ctx context.Context, id string) (int, error) {
+	var out int
+	err := c.do(ctx, "DELETE", "/api/v1/webhook/"+url.PathEscape(id), nil, nil, &out)
+	return out, err
+}
+
+// GetWebhookDeliveries The delivery log of a webhook, the latest 100 newest first
+func (c *Client) GetWebhookDeliveries(ctx context.Context, id string) ([]WebhookDelivery, error) {
+	var out []WebhookDelivery
+	err := c.do(ctx, "GET", "/api/v1/webhook/"+url.PathEscape(id)+"/deliveries", nil, nil, &out)
+	return out, err
+}
+
+// PingWebhook Send a ping event to a webhook right away
+func (c *Client) PingWebhook(ctx context.Context, id string) (*WebhookDelivery, error) {
+	var out WebhookDelivery
+	err := c.do(ctx, "PUT", "/api/v1/webhook/"+url.PathEscape(id)+"/ping", nil, nil, &out)
+	if err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// GetWebhooks The user's webhooks
+func (c *Client) GetWebhooks(ctx context.Context) ([]Webhook, error) {
+	var out []Webhook
+	err := c.do(ctx, "GET", "/api/v1/webhooks", nil, nil, &out)
+	return out, err
+}
+
+// GetAccount The account of the logged in user
+func (c *Client) GetAccount(ctx context.Context) (*Account, error) {
+	var out Account
+	err := c.do(ctx, "GET", "/oauth/v1/account", nil, nil, &out)
+	if err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// Logout Expire the current session
+func (c *Client) Logout(ctx context.Context) (string, error) {
+	var out string
+	err := c.do(ctx, "POST", "/oauth/v1/logout", nil, nil, &out)
+	return out, err
+}
+
+// GetProviders The names of the identity providers users can log in with
+func (c *Client) GetProviders(ctx context.Context) ([]string, error) {
+	var out []string
+	err := c.do(ctx, "GET", "/oauth/v1/providers", nil, nil, &out)
+	return out, err
+}
+
+// RefreshSession Extend the lifetime of the current session
+func (c *Client) RefreshSession(ctx context.Context) (string, error) {
+	var out string
+	err := c.do(ctx, "GET", "/oauth/v1/refresh", nil, nil, &out)
+	return out, err
+}
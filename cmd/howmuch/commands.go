@@ -0,0 +1,1419 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"how-much-do-i-owe/client"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+func newFlagSet(name string, usage string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: howmuch %s %s\n", name, usage)
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+func runConfig(a *app, args []string) error {
+	fs := newFlagSet("config", "[-server URL] [-token TOKEN]")
+	server := fs.String("server", "", "server URL to save")
+	token := fs.String("token", "", "personal access token to save")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if *server == "" && *token == "" {
+		masked := ""
+		if len(a.cfg.Token) > len(tokenPrefix)+4 {
+			masked = a.cfg.Token[:len(tokenPrefix)+4] + "…"
+		}
+		return a.print.message(config{Server: a.cfg.Server, Token: masked}, "server: %s\ntoken:  %s", a.cfg.Server, masked)
+	}
+
+	// Only what is in the file is saved, not values from the environment
+	saved, err := loadConfigFile()
+	if err != nil {
+		return err
+	}
+	if *server != "" {
+		saved.Server = strings.TrimSuffix(*server, "/")
+	}
+	if *token != "" {
+		saved.Token = *token
+	}
+	path, err := saveConfig(saved)
+	if err != nil {
+		return err
+	}
+	return a.print.message(map[string]string{"path": path}, "saved %s", path)
+}
+
+func runAdd(a *app, args []string) error {
+	fs := newFlagSet("add", "-amount AMOUNT [-split equal|exact|percent|shares] -with WHO... | -share WHO=VALUE...")
+	amount := fs.Float64("amount", 0, "total amount of the expense, may be left out for exact splits")
+	split := fs.String("split", "", "equal, exact, percent or shares, defaults to the split set for the contact or equal")
+	var with, shares listFlag
+	fs.Var(&with, "with", "for equal splits, who shares the expense besides you: a contact's email or an account ID (repeatable)")
+	fs.Var(&shares, "share", "for other splits, WHO=VALUE where VALUE is a dollar amount, a percentage or a weight (repeatable)")
+	payer := fs.String("payer", "me", "who paid")
+	desc := fs.String("desc", "", "what the expense was for")
+	category := fs.String("category", "", "groceries, dining, housing, utilities, transport, travel, entertainment, shopping, health or other")
+	date := fs.String("date", "", "when it happened as YYYY-MM-DD, defaults to now")
+	excludeMe := fs.Bool("exclude-me", false, "for equal splits, don't add yourself as a participant")
+	group := fs.Int("group", 0, "the group the expense belongs to")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if err := a.requireLogin(); err != nil {
+		return err
+	}
+
+	trans := client.Transaction{Amount: *amount, SplitType: *split, Description: *desc, Category: *category}
+	if *group != 0 {
+		trans.GroupID = group
+	}
+	var err error
+	if trans.Payer, err = a.resolve(*payer); err != nil {
+		return err
+	}
+	if *date != "" {
+		if trans.Timestamp, err = time.ParseInLocation("2006-01-02", *date, time.Local); err != nil {
+			return fmt.Errorf("invalid date %q, use YYYY-MM-DD", *date)
+		}
+	}
+
+	if *split == "equal" || *split == "" {
+		if len(shares) > 0 {
+			return fmt.Errorf("-share is only used by exact, percent and shares splits, use -with")
+		}
+		if !*excludeMe {
+			with = append(listFlag{"me"}, with...)
+		}
+		seen := make(map[string]bool)
+		for _, who := range with {
+			id, err := a.resolve(who)
+			if err != nil {
+				return err
+			}
+			if !seen[id] {
+				seen[id] = true
+				trans.Participants = append(trans.Participants, client.Participant{ID: id})
+			}
+		}
+	} else {
+		if len(with) > 0 {
+			return fmt.Errorf("-with is only used by equal splits, use -share WHO=VALUE")
+		}
+		for _, share := range shares {
+			separator := strings.LastIndex(share, "=")
+			if separator < 0 {
+				return fmt.Errorf("invalid share %q, expected WHO=VALUE", share)
+			}
+			id, err := a.resolve(share[:separator])
+			if err != nil {
+				return err
+			}
+			value, err := strconv.ParseFloat(share[separator+1:], 64)
+			if err != nil {
+				return fmt.Errorf("invalid share %q: %w", share, err)
+			}
+			p := client.Participant{ID: id}
+			if *split == "exact" {
+				p.DollarShare = value
+			} else {
+				p.FractionalShare = int(value)
+			}
+			trans.Participants = append(trans.Participants, p)
+		}
+	}
+	if len(trans.Participants) == 0 {
+		return fmt.Errorf("nobody to split the expense with, use -with or -share")
+	}
+
+	created, err := a.client.CreateTransaction(a.ctx, trans)
+	if err != nil {
+		return err
+	}
+	return a.print.message(created, "added transaction %s for %s split between %d people", created.ID, money(created.Amount), len(created.Participants))
+}
+
+func runTransactions(a *app, args []string) error {
+	fs := newFlagSet("transactions", "[-group GROUP]")
+	group := fs.Int("group", 0, "only transactions in this group")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if err := a.requireLogin(); err != nil {
+		return err
+	}
+	me, err := a.self()
+	if err != nil {
+		return err
+	}
+	all, err := a.client.GetAllTransactions(a.ctx, client.GetAllTransactionsParams{GroupID: *group})
+	if err != nil {
+		return err
+	}
+
+	list := make([]client.Transaction, 0, len(all))
+	for _, trans := range all {
+		list = append(list, trans)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Timestamp.After(list[j].Timestamp) })
+
+	rows := make([][]string, 0, len(list))
+	for _, trans := range list {
+		payer := trans.Payer
+		yourShare := 0.0
+		for _, p := range trans.Participants {
+			if p.ID == trans.Payer {
+				payer = p.Name
+			}
+			if p.ID == me {
+				yourShare = p.DollarShare
+			}
+		}
+		if trans.Payer == me {
+			payer = "you"
+		}
+		rows = append(rows, []string{trans.ID, trans.Timestamp.Local().Format("2006-01-02"), trans.Description,
+			payer, money(trans.Amount), trans.SplitType, money(yourShare)})
+	}
+	return a.print.table(list, []string{"ID", "DATE", "DESCRIPTION", "PAID BY", "AMOUNT", "SPLIT", "YOUR SHARE"}, rows)
+}
+
+func runBalances(a *app, args []string) error {
+	fs := newFlagSet("balances", "")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if err := a.requireLogin(); err != nil {
+		return err
+	}
+	balances, err := a.client.GetBalances(a.ctx, client.GetBalancesParams{})
+	if err != nil {
+		return err
+	}
+
+	rows := make([][]string, 0, len(balances))
+	for _, b := range balances {
+		status := "owes you"
+		if b.Balance < 0 {
+			status = "you owe"
+		}
+		amount := b.Balance
+		if amount < 0 {
+			amount = -amount
+		}
+		rows = append(rows, []string{b.Name, b.Email, status, money(amount)})
+	}
+	return a.print.table(balances, []string{"NAME", "EMAIL", "", "AMOUNT"}, rows)
+}
+
+func runSettle(a *app, args []string) error {
+	fs := newFlagSet("settle", "-with WHO -amount AMOUNT [-received]")
+	with := fs.String("with", "", "the contact you paid, or who paid you with -received")
+	amount := fs.Float64("amount", 0, "how much changed hands")
+	received := fs.Bool("received", false, "they paid you instead of you paying them")
+	desc := fs.String("desc", "", "a note about the payment")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if err := a.requireLogin(); err != nil {
+		return err
+	}
+	if *with == "" || *amount <= 0 {
+		fs.Usage()
+		return fmt.Errorf("-with and a positive -amount are required")
+	}
+	other, err := a.resolve(*with)
+	if err != nil {
+		return err
+	}
+
+	settle := client.Settlement{To: other, Amount: *amount, Description: *desc}
+	if *received {
+		settle = client.Settlement{From: other, Amount: *amount, Description: *desc}
+	}
+	created, err := a.client.CreateSettlement(a.ctx, settle)
+	if err != nil {
+		return err
+	}
+	return a.print.message(created, "recorded settlement %s of %s", created.ID, money(created.Amount))
+}
+
+func runContacts(a *app, args []string) error {
+	fs := newFlagSet("contacts", "[list | requests | add ID | set ID|EMAIL [-nickname N] [-notes N] [-currency C] [-split S] | invite EMAIL | invitations | resend|revoke INVITATION | accept|decline|cancel REQUEST | remove ID|EMAIL | block|unblock ID|EMAIL | blocked]")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if err := a.requireLogin(); err != nil {
+		return err
+	}
+
+	switch fs.Arg(0) {
+	case "", "list":
+		if err := a.loadContacts(); err != nil {
+			return err
+		}
+		ids := make([]string, 0, len(a.contacts))
+		for id := range a.contacts {
+			ids = append(ids, id)
+		}
+		sort.Slice(ids, func(i, j int) bool { return a.contacts[ids[i]].Name < a.contacts[ids[j]].Name })
+		rows := make([][]string, 0, len(ids))
+		for _, id := range ids {
+			contact := a.contacts[id]
+			split := ""
+			if s := contact.DefaultSplit; s != nil {
+				split = formatSplit(*s)
+			}
+			rows = append(rows, []string{id, contact.Name, contact.Nickname, contact.Email, split,
+				contact.Since.Local().Format("2006-01-02")})
+		}
+		return a.print.table(a.contacts, []string{"ID", "NAME", "NICKNAME", "EMAIL", "SPLIT", "SINCE"}, rows)
+	case "set":
+		return setContact(a, fs.Args()[1:])
+	case "requests":
+		requests, err := a.client.GetContactRequests(a.ctx)
+		if err != nil {
+			return err
+		}
+		rows := make([][]string, 0, len(requests))
+		for _, request := range requests {
+			direction := "wants to add you"
+			if request.Direction == "outgoing" {
+				direction = "waiting for response"
+			}
+			rows = append(rows, []string{strconv.Itoa(request.ID), request.Name, request.Email, direction,
+				request.CreatedAt.Local().Format("2006-01-02 15:04")})
+		}
+		return a.print.table(requests, []string{"REQUEST", "NAME", "EMAIL", "STATUS", "SENT"}, rows)
+	case "add":
+		if fs.NArg() != 2 {
+			return fmt.Errorf("usage: howmuch contacts add ID")
+		}
+		request, err := a.client.AddContact(a.ctx, fs.Arg(1))
+		if err != nil {
+			return err
+		}
+		if request.Status == "accepted" {
+			return a.print.message(request, "you are now contacts with %s", request.Name)
+		}
+		return a.print.message(request, "contact request %d sent to %s", request.ID, request.Name)
+	case "invite", "resend":
+		if fs.NArg() != 2 {
+			return fmt.Errorf("usage: howmuch contacts invite EMAIL or contacts resend INVITATION")
+		}
+		var result *client.InviteResult
+		var err error
+		if fs.Arg(0) == "invite" {
+			result, err = a.client.InviteContact(a.ctx, client.InviteRequest{Email: fs.Arg(1)})
+		} else {
+			result, err = a.client.ResendInvitation(a.ctx, fs.Arg(1))
+		}
+		if err != nil {
+			return err
+		}
+		if request := result.ContactRequest; request != nil {
+			if request.Status == "accepted" {
+				return a.print.message(result, "you are now contacts with %s", request.Name)
+			}
+			return a.print.message(result, "%s already has an account, contact request %d sent", request.Email, request.ID)
+		}
+		return a.print.message(result, "invitation %d emailed to %s, it expires on %s", result.Invitation.ID,
+			result.Invitation.Email, result.Invitation.ExpiresAt.Local().Format("2006-01-02"))
+	case "invitations":
+		invitations, err := a.client.GetInvitations(a.ctx)
+		if err != nil {
+			return err
+		}
+		rows := make([][]string, 0, len(invitations))
+		for _, inv := range invitations {
+			expires := inv.ExpiresAt.Local().Format("2006-01-02")
+			if inv.ExpiresAt.Before(time.Now()) {
+				expires = "expired"
+			}
+			rows = append(rows, []string{strconv.Itoa(inv.ID), inv.Email, inv.LastSentAt.Local().Format("2006-01-02 15:04"), expires})
+		}
+		return a.print.table(invitations, []string{"INVITATION", "EMAIL", "SENT", "EXPIRES"}, rows)
+	case "revoke":
+		if fs.NArg() != 2 {
+			return fmt.Errorf("usage: howmuch contacts revoke INVITATION")
+		}
+		result, err := a.client.RevokeInvitation(a.ctx, fs.Arg(1))
+		if err != nil {
+			return err
+		}
+		return a.print.message(result, "invitation %s revoked", fs.Arg(1))
+	case "accept", "decline", "cancel":
+		if fs.NArg() != 2 {
+			return fmt.Errorf("usage: howmuch contacts %s REQUEST", fs.Arg(0))
+		}
+		answer := map[string]func(context.Context, string) (*client.ContactRequest, error){
+			"accept":  a.client.AcceptContactRequest,
+			"decline": a.client.DeclineContactRequest,
+			"cancel":  a.client.CancelContactRequest,
+		}[fs.Arg(0)]
+		request, err := answer(a.ctx, fs.Arg(1))
+		if err != nil {
+			return err
+		}
+		return a.print.message(request, "contact request %d from %s %s", request.ID, request.Name, request.Status)
+	case "remove", "block", "unblock":
+		if fs.NArg() != 2 {
+			return fmt.Errorf("usage: howmuch contacts %s ID|EMAIL", fs.Arg(0))
+		}
+		id, err := a.resolve(fs.Arg(1))
+		if err != nil {
+			return err
+		}
+		action := map[string]func(context.Context, string) (string, error){
+			"remove":  a.client.RemoveContact,
+			"block":   a.client.BlockUser,
+			"unblock": a.client.UnblockUser,
+		}[fs.Arg(0)]
+		result, err := action(a.ctx, id)
+		if err != nil {
+			return err
+		}
+		return a.print.message(result, "%sed %s", strings.TrimSuffix(fs.Arg(0), "e"), fs.Arg(1))
+	case "blocked":
+		blocks, err := a.client.GetBlocks(a.ctx)
+		if err != nil {
+			return err
+		}
+		rows := make([][]string, 0, len(blocks))
+		for _, b := range blocks {
+			rows = append(rows, []string{b.UserID, b.Name, b.Email, b.CreatedAt.Local().Format("2006-01-02")})
+		}
+		return a.print.table(blocks, []string{"ID", "NAME", "EMAIL", "BLOCKED"}, rows)
+	}
+	return fmt.Errorf("unknown contacts command %q", fs.Arg(0))
+}
+
+func runGhosts(a *app, args []string) error {
+	fs := newFlagSet("ghosts", "[list | add NAME [EMAIL] | invite GHOST [EMAIL] | merge GHOST CONTACT | remove GHOST]")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if err := a.requireLogin(); err != nil {
+		return err
+	}
+
+	switch fs.Arg(0) {
+	case "", "list":
+		ghosts, err := a.client.GetGhosts(a.ctx)
+		if err != nil {
+			return err
+		}
+		rows := make([][]string, 0, len(ghosts))
+		for _, g := range ghosts {
+			rows = append(rows, []string{g.ID, g.Name, g.Email, g.CreatedAt.Local().Format("2006-01-02")})
+		}
+		return a.print.table(ghosts, []string{"ID", "NAME", "EMAIL", "CREATED"}, rows)
+	case "add":
+		if fs.NArg() < 2 || fs.NArg() > 3 {
+			return fmt.Errorf("usage: howmuch ghosts add NAME [EMAIL]")
+		}
+		g, err := a.client.CreateGhost(a.ctx, client.GhostRequest{Name: fs.Arg(1), Email: fs.Arg(2)})
+		if err != nil {
+			return err
+		}
+		return a.print.message(g, "placeholder %s created for %s", g.ID, g.Name)
+	case "invite":
+		if fs.NArg() < 2 || fs.NArg() > 3 {
+			return fmt.Errorf("usage: howmuch ghosts invite GHOST [EMAIL]")
+		}
+		result, err := a.client.InviteContact(a.ctx, client.InviteRequest{GhostID: fs.Arg(1), Email: fs.Arg(2)})
+		if err != nil {
+			return err
+		}
+		if request := result.ContactRequest; request != nil {
+			if request.Status == "accepted" {
+				return a.print.message(result, "placeholder merged into %s", request.Name)
+			}
+			return a.print.message(result, "%s already has an account, contact request %d sent", request.Email, request.ID)
+		}
+		return a.print.message(result, "invitation %d emailed to %s", result.Invitation.ID, result.Invitation.Email)
+	case "merge":
+		if fs.NArg() != 3 {
+			return fmt.Errorf("usage: howmuch ghosts merge GHOST CONTACT")
+		}
+		contactID, err := a.resolve(fs.Arg(2))
+		if err != nil {
+			return err
+		}
+		result, err := a.client.MergeGhost(a.ctx, fs.Arg(1), contactID)
+		if err != nil {
+			return err
+		}
+		return a.print.message(result, "placeholder %s merged into %s", fs.Arg(1), fs.Arg(2))
+	case "remove":
+		if fs.NArg() != 2 {
+			return fmt.Errorf("usage: howmuch ghosts remove GHOST")
+		}
+		result, err := a.client.DeleteGhost(a.ctx, fs.Arg(1))
+		if err != nil {
+			return err
+		}
+		return a.print.message(result, "placeholder %s removed", fs.Arg(1))
+	}
+	return fmt.Errorf("unknown ghosts command %q", fs.Arg(0))
+}
+
+// setContact Changes what the user keeps about a contact, only the flags
+// that are given
+func setContact(a *app, args []string) error {
+	fs := newFlagSet("contacts set", "ID|EMAIL [-nickname N] [-notes N] [-currency C] [-split equal|percent:YOURS/THEIRS|shares:YOURS/THEIRS|none]")
+	if len(args) == 0 {
+		fs.Usage()
+		return fmt.Errorf("usage: howmuch contacts set ID|EMAIL [flags]")
+	}
+	id, err := a.resolve(args[0])
+	if err != nil {
+		return err
+	}
+	var update client.ContactUpdate
+	fs.Func("nickname", "what you call them", func(v string) error { update.Nickname = &v; return nil })
+	fs.Func("notes", "notes only you see", func(v string) error { update.Notes = &v; return nil })
+	fs.Func("currency", "ISO 4217 code you use with them, e.g. EUR", func(v string) error { update.Currency = &v; return nil })
+	fs.Func("split", "default split for expenses with just the two of you, e.g. percent:60/40, or none", func(v string) error {
+		split, err := parseSplit(v)
+		update.DefaultSplit = &split
+		return err
+	})
+	if err = fs.Parse(args[1:]); err != nil {
+		return err
+	}
+
+	updated, err := a.client.UpdateContact(a.ctx, id, update)
+	if err != nil {
+		return err
+	}
+	return a.print.message(updated, "updated %s", updated.Name)
+}
+
+// parseSplit Reads equal, none, or TYPE:YOURS/THEIRS
+func parseSplit(v string) (client.Split, error) {
+	if v == "none" {
+		return client.Split{}, nil
+	}
+	splitType, shares, found := strings.Cut(v, ":")
+	if !found {
+		return client.Split{SplitType: splitType}, nil
+	}
+	yours, theirs, found := strings.Cut(shares, "/")
+	if !found {
+		return client.Split{}, fmt.Errorf("invalid split %q, expected TYPE:YOURS/THEIRS", v)
+	}
+	split := client.Split{SplitType: splitType}
+	var err error
+	if split.YourShare, err = strconv.Atoi(yours); err != nil {
+		return client.Split{}, fmt.Errorf("invalid split %q: %w", v, err)
+	}
+	if split.TheirShare, err = strconv.Atoi(theirs); err != nil {
+		return client.Split{}, fmt.Errorf("invalid split %q: %w", v, err)
+	}
+	return split, nil
+}
+
+func formatSplit(s client.Split) string {
+	if s.SplitType == "equal" {
+		return s.SplitType
+	}
+	return fmt.Sprintf("%s:%d/%d", s.SplitType, s.YourShare, s.TheirShare)
+}
+
+func runGroups(a *app, args []string) error {
+	fs := newFlagSet("groups", "[list | create NAME [WHO...] | rename GROUP NAME | add GROUP WHO | remove GROUP WHO | leave GROUP]")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if err := a.requireLogin(); err != nil {
+		return err
+	}
+
+	switch fs.Arg(0) {
+	case "", "list":
+		groups, err := a.client.GetGroups(a.ctx)
+		if err != nil {
+			return err
+		}
+		rows := make([][]string, 0, len(groups))
+		for _, g := range groups {
+			names := make([]string, 0, len(g.Members))
+			for _, m := range g.Members {
+				names = append(names, m.Name)
+			}
+			rows = append(rows, []string{strconv.Itoa(g.ID), g.Name, strings.Join(names, ", ")})
+		}
+		return a.print.table(groups, []string{"GROUP", "NAME", "MEMBERS"}, rows)
+	case "create":
+		if fs.NArg() < 2 {
+			return fmt.Errorf("usage: howmuch groups create NAME [WHO...]")
+		}
+		req := client.GroupRequest{Name: fs.Arg(1)}
+		for _, who := range fs.Args()[2:] {
+			id, err := a.resolve(who)
+			if err != nil {
+				return err
+			}
+			req.Members = append(req.Members, id)
+		}
+		g, err := a.client.CreateGroup(a.ctx, req)
+		if err != nil {
+			return err
+		}
+		return a.print.message(g, "created group %d %s with %d members", g.ID, g.Name, len(g.Members))
+	case "rename":
+		if fs.NArg() != 3 {
+			return fmt.Errorf("usage: howmuch groups rename GROUP NAME")
+		}
+		g, err := a.client.RenameGroup(a.ctx, fs.Arg(1), client.GroupRequest{Name: fs.Arg(2)})
+		if err != nil {
+			return err
+		}
+		return a.print.message(g, "renamed group %d to %s", g.ID, g.Name)
+	case "add", "remove", "leave":
+		who := "me"
+		if fs.Arg(0) == "leave" {
+			if fs.NArg() != 2 {
+				return fmt.Errorf("usage: howmuch groups leave GROUP")
+			}
+		} else if fs.NArg() != 3 {
+			return fmt.Errorf("usage: howmuch groups %s GROUP WHO", fs.Arg(0))
+		} else {
+			who = fs.Arg(2)
+		}
+		id, err := a.resolve(who)
+		if err != nil {
+			return err
+		}
+		if fs.Arg(0) == "add" {
+			g, err := a.client.AddGroupMember(a.ctx, fs.Arg(1), id)
+			if err != nil {
+				return err
+			}
+			return a.print.message(g, "added %s to %s", who, g.Name)
+		}
+		result, err := a.client.RemoveGroupMember(a.ctx, fs.Arg(1), id)
+		if err != nil {
+			return err
+		}
+		return a.print.message(result, "removed %s from group %s", who, fs.Arg(1))
+	}
+	return fmt.Errorf("unknown groups command %q", fs.Arg(0))
+}
+
+func runNotifications(a *app, args []string) error {
+	fs := newFlagSet("notifications", "[list | read ID | read all | prefs | digest daily|weekly|off | timezone ZONE | set TYPE CHANNEL,...]")
+	unread := fs.Bool("unread", false, "list only notifications that haven't been read")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if err := a.requireLogin(); err != nil {
+		return err
+	}
+
+	switch fs.Arg(0) {
+	case "", "list":
+		notifications, err := a.client.GetNotifications(a.ctx, client.GetNotificationsParams{Unread: *unread})
+		if err != nil {
+			return err
+		}
+		rows := make([][]string, 0, len(notifications))
+		for _, n := range notifications {
+			read := ""
+			if n.ReadAt == nil {
+				read = "new"
+			}
+			rows = append(rows, []string{strconv.Itoa(n.ID), n.CreatedAt.Local().Format("2006-01-02 15:04"), read, n.Title, n.Body})
+		}
+		return a.print.table(notifications, []string{"ID", "WHEN", "", "TITLE", "DETAILS"}, rows)
+	case "read":
+		if fs.NArg() != 2 {
+			return fmt.Errorf("usage: howmuch notifications read ID|all")
+		}
+		if fs.Arg(1) == "all" {
+			count, err := a.client.MarkAllNotificationsRead(a.ctx)
+			if err != nil {
+				return err
+			}
+			return a.print.message(count, "marked %d notifications read", count)
+		}
+		result, err := a.client.MarkNotificationRead(a.ctx, fs.Arg(1))
+		if err != nil {
+			return err
+		}
+		return a.print.message(result, "marked notification %s read", fs.Arg(1))
+	case "prefs":
+		prefs, err := a.client.GetNotificationPreferences(a.ctx)
+		if err != nil {
+			return err
+		}
+		return printPreferences(a, prefs)
+	case "digest", "timezone":
+		if fs.NArg() != 2 {
+			return fmt.Errorf("usage: howmuch notifications %s VALUE", fs.Arg(0))
+		}
+		value := fs.Arg(1)
+		var update client.NotificationPreferencesUpdate
+		if fs.Arg(0) == "digest" {
+			if value == "off" {
+				value = ""
+			}
+			update.Digest = &value
+		} else {
+			update.TimeZone = &value
+		}
+		prefs, err := a.client.UpdateNotificationPreferences(a.ctx, update)
+		if err != nil {
+			return err
+		}
+		return printPreferences(a, prefs)
+	case "set":
+		if fs.NArg() != 3 {
+			return fmt.Errorf("usage: howmuch notifications set TYPE inbox,email,webhook|none")
+		}
+		pref := client.NotificationPreference{Type: fs.Arg(1)}
+		for _, channel := range strings.Split(fs.Arg(2), ",") {
+			switch channel {
+			case "inbox":
+				pref.Inbox = true
+			case "email":
+				pref.Email = true
+			case "webhook":
+				pref.Webhook = true
+			case "none":
+			default:
+				return fmt.Errorf("unknown channel %q, use inbox, email, webhook or none", channel)
+			}
+		}
+		prefs, err := a.client.UpdateNotificationPreferences(a.ctx, client.NotificationPreferencesUpdate{
+			Types: []client.NotificationPreference{pref},
+		})
+		if err != nil {
+			return err
+		}
+		return printPreferences(a, prefs)
+	}
+	return fmt.Errorf("unknown notifications command %q", fs.Arg(0))
+}
+
+func printPreferences(a *app, prefs *client.NotificationPreferences) error {
+	digest := prefs.Digest
+	if digest == "" {
+		digest = "off"
+	}
+	rows := [][]string{{"digest", digest, "", ""}, {"time zone", prefs.TimeZone, "", ""}}
+	yes := func(on bool) string {
+		if on {
+			return "yes"
+		}
+		return "-"
+	}
+	for _, p := range prefs.Types {
+		rows = append(rows, []string{p.Type, yes(p.Inbox), yes(p.Email), yes(p.Webhook)})
+	}
+	return a.print.table(prefs, []string{"TYPE", "INBOX", "EMAIL", "WEBHOOK"}, rows)
+}
+
+func runReminders(a *app, args []string) error {
+	fs := newFlagSet("reminders", "[list | history [WHO] | rules | set [WHO] -threshold AMOUNT [flags] | delete RULE]")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if err := a.requireLogin(); err != nil {
+		return err
+	}
+
+	switch fs.Arg(0) {
+	case "", "list":
+		statuses, err := a.client.GetReminders(a.ctx)
+		if err != nil {
+			return err
+		}
+		rows := make([][]string, 0, len(statuses))
+		for _, s := range statuses {
+			last, next := "never", "done"
+			if s.LastRemindedAt != nil {
+				last = s.LastRemindedAt.Local().Format("2006-01-02 15:04")
+			}
+			if s.NextReminderAt != nil {
+				next = s.NextReminderAt.Local().Format("2006-01-02")
+			}
+			rows = append(rows, []string{s.Name, fmt.Sprintf("%.2f", s.Amount), s.OverSince.Local().Format("2006-01-02"),
+				strconv.Itoa(s.Sent), last, next})
+		}
+		return a.print.table(statuses, []string{"WHO", "OWES", "SINCE", "SENT", "LAST REMINDED", "NEXT"}, rows)
+	case "history":
+		var params client.GetReminderHistoryParams
+		if fs.NArg() > 1 {
+			id, err := a.resolve(fs.Arg(1))
+			if err != nil {
+				return err
+			}
+			params.ContactID = id
+		}
+		reminders, err := a.client.GetReminderHistory(a.ctx, params)
+		if err != nil {
+			return err
+		}
+		rows := make([][]string, 0, len(reminders))
+		for _, r := range reminders {
+			rows = append(rows, []string{r.SentAt.Local().Format("2006-01-02 15:04"), r.Name, fmt.Sprintf("%.2f", r.Amount),
+				strconv.Itoa(r.Stage + 1)})
+		}
+		return a.print.table(reminders, []string{"SENT", "TO", "AMOUNT", "REMINDER"}, rows)
+	case "rules":
+		rules, err := a.client.GetReminderRules(a.ctx)
+		if err != nil {
+			return err
+		}
+		rows := make([][]string, 0, len(rules))
+		for _, r := range rules {
+			who := "everyone"
+			if r.ContactID != nil {
+				who = *r.ContactID
+			}
+			days := make([]string, len(r.Schedule))
+			for i, d := range r.Schedule {
+				days[i] = strconv.Itoa(d)
+			}
+			rows = append(rows, []string{strconv.Itoa(r.ID), who, fmt.Sprintf("%.2f", r.Threshold), strconv.Itoa(r.AfterDays),
+				strings.Join(days, ","), fmt.Sprintf("%d-%d", r.QuietStart, r.QuietEnd), strconv.FormatBool(r.Enabled)})
+		}
+		return a.print.table(rules, []string{"RULE", "FOR", "THRESHOLD", "AFTER DAYS", "SCHEDULE", "QUIET", "ENABLED"}, rows)
+	case "set":
+		return setReminderRule(a, fs.Args()[1:])
+	case "delete":
+		if fs.NArg() != 2 {
+			return fmt.Errorf("usage: howmuch reminders delete RULE")
+		}
+		id, err := a.client.DeleteReminderRule(a.ctx, fs.Arg(1))
+		if err != nil {
+			return err
+		}
+		return a.print.message(id, "deleted reminder rule %d", id)
+	}
+	return fmt.Errorf("unknown reminders command %q", fs.Arg(0))
+}
+
+func setReminderRule(a *app, args []string) error {
+	fs := newFlagSet("reminders set", "[WHO] -threshold AMOUNT [-after DAYS] [-schedule 0,7,21] [-quiet 21-9] [-off]")
+	var req client.ReminderRuleRequest
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		id, err := a.resolve(args[0])
+		if err != nil {
+			return err
+		}
+		req.ContactID = &id
+		args = args[1:]
+	}
+	fs.Float64Var(&req.Threshold, "threshold", 0, "remind people who owe you at least this much")
+	fs.IntVar(&req.AfterDays, "after", 0, "days they have to owe it for before the first reminder")
+	fs.Func("schedule", "days after the first reminder is due to send each one, e.g. 0,7,21", func(v string) error {
+		for _, days := range strings.Split(v, ",") {
+			d, err := strconv.Atoi(strings.TrimSpace(days))
+			if err != nil {
+				return err
+			}
+			req.Schedule = append(req.Schedule, d)
+		}
+		return nil
+	})
+	fs.Func("quiet", "hours not to send reminders in, in their time zone, e.g. 21-9", func(v string) error {
+		var start, end int
+		if _, err := fmt.Sscanf(v, "%d-%d", &start, &end); err != nil {
+			return fmt.Errorf("quiet hours look like 21-9")
+		}
+		req.QuietStart, req.QuietEnd = &start, &end
+		return nil
+	})
+	off := fs.Bool("off", false, "don't remind them, for a rule for one contact")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *off {
+		enabled := false
+		req.Enabled = &enabled
+	}
+
+	r, err := a.client.SaveReminderRule(a.ctx, req)
+	if err != nil {
+		return err
+	}
+	return a.print.message(r, "saved reminder rule %d", r.ID)
+}
+
+func runWebhooks(a *app, args []string) error {
+	fs := newFlagSet("webhooks", "[list | add URL [-events a,b] [-description TEXT] | enable ID | disable ID | delete ID | deliveries ID | ping ID]")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if err := a.requireLogin(); err != nil {
+		return err
+	}
+
+	switch fs.Arg(0) {
+	case "", "list":
+		webhooks, err := a.client.GetWebhooks(a.ctx)
+		if err != nil {
+			return err
+		}
+		rows := make([][]string, 0, len(webhooks))
+		for _, w := range webhooks {
+			rows = append(rows, []string{strconv.Itoa(w.ID), w.URL, strings.Join(w.Events, ","), strconv.FormatBool(w.Enabled),
+				w.Description})
+		}
+		return a.print.table(webhooks, []string{"ID", "URL", "EVENTS", "ENABLED", "DESCRIPTION"}, rows)
+	case "add":
+		return addWebhook(a, fs.Args()[1:])
+	case "enable", "disable":
+		if fs.NArg() != 2 {
+			return fmt.Errorf("usage: howmuch webhooks %s ID", fs.Arg(0))
+		}
+		enabled := fs.Arg(0) == "enable"
+		w, err := a.client.UpdateWebhook(a.ctx, fs.Arg(1), client.WebhookRequest{Enabled: &enabled})
+		if err != nil {
+			return err
+		}
+		return a.print.message(w, "webhook %d %sd", w.ID, fs.Arg(0))
+	case "delete":
+		if fs.NArg() != 2 {
+			return fmt.Errorf("usage: howmuch webhooks delete ID")
+		}
+		id, err := a.client.DeleteWebhook(a.ctx, fs.Arg(1))
+		if err != nil {
+			return err
+		}
+		return a.print.message(id, "deleted webhook %d", id)
+	case "deliveries":
+		if fs.NArg() != 2 {
+			return fmt.Errorf("usage: howmuch webhooks deliveries ID")
+		}
+		deliveries, err := a.client.GetWebhookDeliveries(a.ctx, fs.Arg(1))
+		if err != nil {
+			return err
+		}
+		rows := make([][]string, 0, len(deliveries))
+		for _, d := range deliveries {
+			rows = append(rows, deliveryRow(d))
+		}
+		return a.print.table(deliveries, []string{"ID", "CREATED", "EVENT", "STATUS", "ATTEMPTS", "RESPONSE"}, rows)
+	case "ping":
+		if fs.NArg() != 2 {
+			return fmt.Errorf("usage: howmuch webhooks ping ID")
+		}
+		d, err := a.client.PingWebhook(a.ctx, fs.Arg(1))
+		if err != nil {
+			return err
+		}
+		row := deliveryRow(*d)
+		return a.print.message(d, "ping %s: %s", d.Status, row[len(row)-1])
+	}
+	return fmt.Errorf("unknown webhooks command %q", fs.Arg(0))
+}
+
+func deliveryRow(d client.WebhookDelivery) []string {
+	response := d.Error
+	if d.ResponseStatus != nil && d.Error == "" {
+		response = strconv.Itoa(*d.ResponseStatus)
+	}
+	return []string{strconv.Itoa(d.ID), d.CreatedAt.Local().Format("2006-01-02 15:04"), d.EventType, d.Status,
+		strconv.Itoa(d.Attempts), response}
+}
+
+func addWebhook(a *app, args []string) error {
+	fs := newFlagSet("webhooks add", "URL [-events transaction.created,settlement.created] [-description TEXT]")
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+		return fmt.Errorf("usage: howmuch webhooks add URL [flags]")
+	}
+	req := client.WebhookRequest{URL: &args[0]}
+	fs.Func("events", "comma separated events to send, every event by default", func(v string) error {
+		for _, kind := range strings.Split(v, ",") {
+			req.Events = append(req.Events, strings.TrimSpace(kind))
+		}
+		return nil
+	})
+	description := fs.String("description", "", "what the webhook is for")
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
+	}
+	req.Description = description
+
+	w, err := a.client.CreateWebhook(a.ctx, req)
+	if err != nil {
+		return err
+	}
+	return a.print.message(w, "added webhook %d, check delivery signatures with this secret, it won't be shown again:\n%s",
+		w.ID, w.Secret)
+}
+
+func runChat(a *app, args []string) error {
+	fs := newFlagSet("chat", "[list | link LINK | unlink ID]")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if err := a.requireLogin(); err != nil {
+		return err
+	}
+
+	switch fs.Arg(0) {
+	case "", "list":
+		accounts, err := a.client.GetChatAccounts(a.ctx)
+		if err != nil {
+			return err
+		}
+		rows := make([][]string, 0, len(accounts))
+		for _, c := range accounts {
+			rows = append(rows, []string{strconv.Itoa(c.ID), c.Provider, c.ChatName, c.ChatUserID,
+				c.CreatedAt.Local().Format("2006-01-02")})
+		}
+		return a.print.table(accounts, []string{"ID", "SERVICE", "NAME", "CHAT USER", "LINKED"}, rows)
+	case "link":
+		if fs.NArg() != 2 {
+			return fmt.Errorf("usage: howmuch chat link LINK")
+		}
+		// The whole link from chat works as well as the code in it
+		code := fs.Arg(1)
+		if u, err := url.Parse(code); err == nil && u.Query().Get("chat-link") != "" {
+			code = u.Query().Get("chat-link")
+		}
+		c, err := a.client.LinkChatAccount(a.ctx, client.ChatLinkRequest{Code: code})
+		if err != nil {
+			return err
+		}
+		return a.print.message(c, "linked %s user %s, their commands now act as you", c.Provider, c.ChatName)
+	case "unlink":
+		if fs.NArg() != 2 {
+			return fmt.Errorf("usage: howmuch chat unlink ID")
+		}
+		id, err := a.client.UnlinkChatAccount(a.ctx, fs.Arg(1))
+		if err != nil {
+			return err
+		}
+		return a.print.message(id, "unlinked chat account %d", id)
+	}
+	return fmt.Errorf("unknown chat command %q", fs.Arg(0))
+}
+
+func runHandles(a *app, args []string) error {
+	fs := newFlagSet("handles", "[list | set KIND HANDLE [-name NAME] [-bic BIC] | delete KIND]")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if err := a.requireLogin(); err != nil {
+		return err
+	}
+
+	switch fs.Arg(0) {
+	case "", "list":
+		handles, err := a.client.GetPaymentHandles(a.ctx)
+		if err != nil {
+			return err
+		}
+		rows := make([][]string, 0, len(handles))
+		for _, h := range handles {
+			rows = append(rows, []string{h.Kind, h.Handle, h.Name, h.Bic})
+		}
+		return a.print.table(handles, []string{"KIND", "HANDLE", "NAME", "BIC"}, rows)
+	case "set":
+		return setHandle(a, fs.Args()[1:])
+	case "delete":
+		if fs.NArg() != 2 {
+			return fmt.Errorf("usage: howmuch handles delete KIND")
+		}
+		kind, err := a.client.DeletePaymentHandle(a.ctx, fs.Arg(1))
+		if err != nil {
+			return err
+		}
+		return a.print.message(kind, "removed your %s handle", kind)
+	}
+	return fmt.Errorf("unknown handles command %q", fs.Arg(0))
+}
+
+func setHandle(a *app, args []string) error {
+	fs := newFlagSet("handles set", "KIND HANDLE [-name NAME] [-bic BIC]")
+	if len(args) < 2 || strings.HasPrefix(args[0], "-") || strings.HasPrefix(args[1], "-") {
+		return fmt.Errorf("usage: howmuch handles set paypal|venmo|cashapp|sepa|upi HANDLE [flags]")
+	}
+	name := fs.String("name", "", "the account holder, SEPA transfers need it")
+	bic := fs.String("bic", "", "the BIC of a SEPA account")
+	if err := fs.Parse(args[2:]); err != nil {
+		return err
+	}
+
+	h, err := a.client.SetPaymentHandle(a.ctx, client.PaymentHandleRequest{Kind: args[0], Handle: args[1], Name: *name, Bic: *bic})
+	if err != nil {
+		return err
+	}
+	return a.print.message(h, "people who owe you get %s links to %s", h.Kind, h.Handle)
+}
+
+func runPay(a *app, args []string) error {
+	fs := newFlagSet("pay", "WHO")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if err := a.requireLogin(); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return fmt.Errorf("say who to pay")
+	}
+	other, err := a.resolve(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	balances, err := a.client.GetBalances(a.ctx, client.GetBalancesParams{})
+	if err != nil {
+		return err
+	}
+
+	for _, b := range balances {
+		if b.ID != other {
+			continue
+		}
+		if b.Balance >= 0 {
+			break
+		}
+		if len(b.PaymentLinks) == 0 {
+			return fmt.Errorf("you owe %s %s, they haven't set up a way to be paid", b.Name, money(-b.Balance))
+		}
+		rows := make([][]string, 0, len(b.PaymentLinks))
+		for _, link := range b.PaymentLinks {
+			// SEPA transfers have no link, their QR code is scanned
+			target := link.URL
+			if target == "" {
+				target = strings.TrimRight(a.cfg.Server, "/") + link.QRCode
+			}
+			rows = append(rows, []string{link.Kind, money(link.Amount), link.Currency, target})
+		}
+		return a.print.table(b.PaymentLinks, []string{"KIND", "AMOUNT", "CURRENCY", "LINK"}, rows)
+	}
+	return fmt.Errorf("you don't owe %s anything", fs.Arg(0))
+}
+
+func runShares(a *app, args []string) error {
+	fs := newFlagSet("shares", "[list | create [-group ID] [-from DATE -to DATE] [-title TEXT] [-emails] [-expires DATE] | revoke ID]")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if err := a.requireLogin(); err != nil {
+		return err
+	}
+
+	switch fs.Arg(0) {
+	case "", "list":
+		links, err := a.client.GetShareLinks(a.ctx)
+		if err != nil {
+			return err
+		}
+		rows := make([][]string, 0, len(links))
+		for _, l := range links {
+			scope := ""
+			if l.GroupID != nil {
+				scope = "group " + strconv.Itoa(*l.GroupID) + " "
+			}
+			if l.From != nil && l.To != nil {
+				scope += l.From.Local().Format("2006-01-02") + " to " + l.To.Local().Format("2006-01-02")
+			}
+			status := "until " + l.ExpiresAt.Local().Format("2006-01-02")
+			if l.RevokedAt != nil {
+				status = "revoked"
+			} else if l.ExpiresAt.Before(time.Now()) {
+				status = "expired"
+			}
+			rows = append(rows, []string{strconv.Itoa(l.ID), l.Title, strings.TrimSpace(scope), status, strconv.Itoa(l.Views)})
+		}
+		return a.print.table(links, []string{"ID", "TITLE", "SHARES", "WORKS", "VIEWS"}, rows)
+	case "create":
+		return createShareLink(a, fs.Args()[1:])
+	case "revoke":
+		if fs.NArg() != 2 {
+			return fmt.Errorf("usage: howmuch shares revoke ID")
+		}
+		id, err := a.client.RevokeShareLink(a.ctx, fs.Arg(1))
+		if err != nil {
+			return err
+		}
+		return a.print.message(id, "revoked share link %d, it no longer works", id)
+	}
+	return fmt.Errorf("unknown shares command %q", fs.Arg(0))
+}
+
+func createShareLink(a *app, args []string) error {
+	fs := newFlagSet("shares create", "[-group ID] [-from DATE -to DATE] [-title TEXT] [-emails] [-expires DATE]")
+	var req client.ShareLinkRequest
+	fs.Func("group", "share the transactions of this group", func(v string) error {
+		id, err := strconv.Atoi(v)
+		req.GroupID = &id
+		return err
+	})
+	date := func(field **time.Time) func(string) error {
+		return func(v string) error {
+			t, err := time.ParseInLocation("2006-01-02", v, time.Local)
+			*field = &t
+			return err
+		}
+	}
+	fs.Func("from", "share transactions from this date, YYYY-MM-DD", date(&req.From))
+	fs.Func("to", "share transactions before this date, YYYY-MM-DD", date(&req.To))
+	fs.Func("expires", "the link stops working on this date, in 30 days by default", date(&req.ExpiresAt))
+	fs.StringVar(&req.Title, "title", "", "what the page is called")
+	fs.BoolVar(&req.ShowEmails, "emails", false, "show the emails of the people in the transactions")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	l, err := a.client.CreateShareLink(a.ctx, req)
+	if err != nil {
+		return err
+	}
+	return a.print.message(l, "anyone with this link can see the transactions until %s, it won't be shown again:\n%s",
+		l.ExpiresAt.Local().Format("2006-01-02"), l.URL)
+}
+
+func runStatements(a *app, args []string) error {
+	fs := newFlagSet("statements", "[show GROUP [-month YYYY-MM] | subscriptions | subscribe GROUP | unsubscribe GROUP]")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if err := a.requireLogin(); err != nil {
+		return err
+	}
+
+	switch fs.Arg(0) {
+	case "show":
+		return showStatement(a, fs.Args()[1:])
+	case "", "subscriptions":
+		subscriptions, err := a.client.GetStatementSubscriptions(a.ctx)
+		if err != nil {
+			return err
+		}
+		rows := make([][]string, 0, len(subscriptions))
+		for _, s := range subscriptions {
+			lastSent := ""
+			if s.LastSent != nil {
+				lastSent = *s.LastSent
+			}
+			rows = append(rows, []string{strconv.Itoa(s.GroupID), s.Group, lastSent})
+		}
+		return a.print.table(subscriptions, []string{"GROUP", "NAME", "LAST SENT"}, rows)
+	case "subscribe", "unsubscribe":
+		if fs.NArg() != 2 {
+			return fmt.Errorf("usage: howmuch statements %s GROUP", fs.Arg(0))
+		}
+		if fs.Arg(0) == "subscribe" {
+			id, err := a.client.SubscribeToStatements(a.ctx, fs.Arg(1))
+			if err != nil {
+				return err
+			}
+			return a.print.message(id, "you'll get the statement of group %d by email on the first of every month", id)
+		}
+		id, err := a.client.UnsubscribeFromStatements(a.ctx, fs.Arg(1))
+		if err != nil {
+			return err
+		}
+		return a.print.message(id, "you'll no longer get statements of group %d by email", id)
+	}
+	return fmt.Errorf("unknown statements command %q", fs.Arg(0))
+}
+
+func showStatement(a *app, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: howmuch statements show GROUP [-month YYYY-MM]")
+	}
+	fs := newFlagSet("statements show", "GROUP [-month YYYY-MM]")
+	month := fs.String("month", "", "the month as YYYY-MM, defaults to last month")
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
+	}
+
+	s, err := a.client.GetStatement(a.ctx, args[0], client.GetStatementParams{Month: *month})
+	if err != nil {
+		return err
+	}
+	rows := [][]string{{"", "opening balance", "", "", money(s.OpeningBalance)}}
+	for _, l := range s.Lines {
+		description := l.Description
+		if l.SplitType == "settlement" {
+			description = strings.TrimSpace("settlement " + description)
+		} else if l.Category != "" {
+			description += " (" + l.Category + ")"
+		}
+		rows = append(rows, []string{l.Timestamp.Local().Format("2006-01-02"), description, l.PaidBy, money(l.Amount), money(l.Change)})
+	}
+	rows = append(rows, []string{"", "closing balance", "", "", money(s.ClosingBalance)})
+	for _, c := range s.Categories {
+		category := c.Category
+		if category == "" {
+			category = "uncategorized"
+		}
+		rows = append(rows, []string{"", "spent on " + category, "", money(c.Spent), "your share " + money(c.Share)})
+	}
+	return a.print.table(s, []string{"DATE", "DESCRIPTION", "PAID BY", "AMOUNT", "YOUR BALANCE"}, rows)
+}
+
+func runAnalytics(a *app, args []string) error {
+	fs := newFlagSet("analytics", "[-bucket week|month|year] [-from DATE] [-to DATE] [-group ID] [-category CATEGORY]")
+	var params client.GetAnalyticsParams
+	fs.StringVar(&params.Bucket, "bucket", "month", "add up by week, month or year")
+	fs.StringVar(&params.From, "from", "", "the first day as YYYY-MM-DD, defaults to 12 buckets before -to")
+	fs.StringVar(&params.To, "to", "", "the day after the last as YYYY-MM-DD, defaults to the end of this bucket")
+	fs.IntVar(&params.GroupID, "group", 0, "only expenses in this group")
+	fs.StringVar(&params.Category, "category", "", "only expenses in this category, or uncategorized")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if err := a.requireLogin(); err != nil {
+		return err
+	}
+
+	stats, err := a.client.GetAnalytics(a.ctx, params)
+	if err != nil {
+		return err
+	}
+	rows := [][]string{{"total", stats.From + " to " + stats.To, strconv.Itoa(stats.Expenses), money(stats.Share)},
+		{"average", "per expense, of " + money(stats.AverageExpense), "", money(stats.AverageShare)}}
+	for _, b := range stats.Buckets {
+		rows = append(rows, []string{stats.Bucket, b.Start, strconv.Itoa(b.Expenses), money(b.Share)})
+	}
+	for _, c := range stats.Categories {
+		category := c.Category
+		if category == "" {
+			category = "uncategorized"
+		}
+		rows = append(rows, []string{"category", category, strconv.Itoa(c.Expenses), money(c.Share)})
+	}
+	for _, g := range stats.Groups {
+		name := g.Name
+		if g.GroupID == nil {
+			name = "no group"
+		}
+		rows = append(rows, []string{"group", name, strconv.Itoa(g.Expenses), money(g.Share)})
+	}
+	for _, c := range stats.Contacts {
+		rows = append(rows, []string{"with", c.Name, strconv.Itoa(c.Expenses), money(c.Share)})
+	}
+	for _, p := range stats.TopPayers {
+		rows = append(rows, []string{"paid by", p.Name + " (" + money(p.Paid) + " in all)", strconv.Itoa(p.Expenses), money(p.Share)})
+	}
+	return a.print.table(stats, []string{"BY", "", "EXPENSES", "YOUR SHARE"}, rows)
+}
+
+func runBudgets(a *app, args []string) error {
+	fs := newFlagSet("budgets", "[list [-group ID] | create GROUP -amount N [flags] | delete ID]")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if err := a.requireLogin(); err != nil {
+		return err
+	}
+
+	switch fs.Arg(0) {
+	case "", "list":
+		lfs := newFlagSet("budgets list", "[-group ID]")
+		group := lfs.String("group", "", "only the budgets of this group")
+		var listArgs []string
+		if fs.NArg() > 0 {
+			listArgs = fs.Args()[1:]
+		}
+		if err := lfs.Parse(listArgs); err != nil {
+			return err
+		}
+		var budgets []client.Budget
+		var err error
+		if *group != "" {
+			budgets, err = a.client.GetGroupBudgets(a.ctx, *group)
+		} else {
+			budgets, err = a.client.GetBudgets(a.ctx)
+		}
+		if err != nil {
+			return err
+		}
+		rows := make([][]string, 0, len(budgets))
+		for _, b := range budgets {
+			name := b.Name
+			if name == "" && b.Category != nil {
+				name = *b.Category
+			} else if name == "" {
+				name = "everything"
+			}
+			period := "this month"
+			if b.Period == "range" {
+				period = b.PeriodStart.Local().Format("2006-01-02") + " to " + b.PeriodEnd.Local().Format("2006-01-02")
+			}
+			rows = append(rows, []string{strconv.Itoa(b.ID), b.Group, name, period, money(b.Amount), money(b.Spent),
+				money(b.Remaining), fmt.Sprintf("%.1f%%", b.Percent)})
+		}
+		return a.print.table(budgets, []string{"ID", "GROUP", "BUDGET", "PERIOD", "AMOUNT", "SPENT", "LEFT", "USED"}, rows)
+	case "create":
+		return createBudget(a, fs.Args()[1:])
+	case "delete":
+		if fs.NArg() != 2 {
+			return fmt.Errorf("usage: howmuch budgets delete ID")
+		}
+		id, err := a.client.DeleteBudget(a.ctx, fs.Arg(1))
+		if err != nil {
+			return err
+		}
+		return a.print.message(id, "deleted budget %d", id)
+	}
+	return fmt.Errorf("unknown budgets command %q", fs.Arg(0))
+}
+
+func createBudget(a *app, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: howmuch budgets create GROUP -amount N [-category CATEGORY] [-from DATE -to DATE]")
+	}
+	fs := newFlagSet("budgets create", "GROUP -amount N [-name TEXT] [-category CATEGORY] [-from DATE -to DATE] [-thresholds 80,100]")
+	var req client.BudgetRequest
+	fs.Float64Var(&req.Amount, "amount", 0, "how much the group means to spend")
+	fs.StringVar(&req.Name, "name", "", "what the budget is called")
+	fs.Func("category", "only count expenses in this category", func(v string) error {
+		req.Category = &v
+		return nil
+	})
+	date := func(field **time.Time) func(string) error {
+		return func(v string) error {
+			t, err := time.ParseInLocation("2006-01-02", v, time.Local)
+			*field = &t
+			return err
+		}
+	}
+	fs.Func("from", "for a trip, the first day, YYYY-MM-DD. Budgets are monthly otherwise", date(&req.From))
+	fs.Func("to", "for a trip, the day after the last, YYYY-MM-DD", date(&req.To))
+	fs.Func("thresholds", "percentages of the amount to alert members at, 80,100 by default", func(v string) error {
+		for _, percent := range strings.Split(v, ",") {
+			p, err := strconv.Atoi(strings.TrimSpace(percent))
+			if err != nil {
+				return err
+			}
+			req.Thresholds = append(req.Thresholds, p)
+		}
+		return nil
+	})
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
+	}
+	if req.From != nil || req.To != nil {
+		req.Period = "range"
+	}
+
+	b, err := a.client.CreateBudget(a.ctx, args[0], req)
+	if err != nil {
+		return err
+	}
+	return a.print.message(b, "created budget %d, %s of %s spent", b.ID, money(b.Spent), money(b.Amount))
+}
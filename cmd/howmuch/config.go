@@ -0,0 +1,82 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// config Where the CLI finds the server and which personal access token it
+// uses. Stored as JSON in the user's config directory, HOWMUCH_SERVER and
+// HOWMUCH_TOKEN override the file.
+type config struct {
+	Server string `json:"server"`
+	Token  string `json:"token"`
+}
+
+func configPath() (string, error) {
+	if path := os.Getenv("HOWMUCH_CONFIG"); path != "" {
+		return path, nil
+	}
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "howmuch", "config.json"), nil
+}
+
+// tokenPrefix Personal access tokens all start with this, only it and a few
+// characters after it are shown when printing the config
+const tokenPrefix = "hmdio_"
+
+// loadConfigFile The config file alone, without environment overrides
+func loadConfigFile() (config, error) {
+	var cfg config
+	path, err := configPath()
+	if err != nil {
+		return cfg, err
+	}
+	contents, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return cfg, err
+	}
+	if err == nil {
+		if err = json.Unmarshal(contents, &cfg); err != nil {
+			return cfg, fmt.Errorf("%s: %w", path, err)
+		}
+	}
+	return cfg, nil
+}
+
+func loadConfig() (config, error) {
+	cfg, err := loadConfigFile()
+	if err != nil {
+		return cfg, err
+	}
+	if server := os.Getenv("HOWMUCH_SERVER"); server != "" {
+		cfg.Server = server
+	}
+	if token := os.Getenv("HOWMUCH_TOKEN"); token != "" {
+		cfg.Token = token
+	}
+	return cfg, nil
+}
+
+func saveConfig(cfg config) (string, error) {
+	path, err := configPath()
+	if err != nil {
+		return "", err
+	}
+	if err = os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return "", err
+	}
+	contents, err := json.MarshalIndent(cfg, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	// The file holds a secret, keep it private to the user
+	return path, os.WriteFile(path, append(contents, '\n'), 0600)
+}
@@ -0,0 +1,179 @@
+// Command howmuch A command-line client for how much do i owe?
+//
+// It talks to the HTTP API with a personal access token, create one in the
+// web app (or with PUT /api/v1/token) and save it with
+//
+//	howmuch config -server https://example.com -token hmdio_...
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"how-much-do-i-owe/client"
+	"os"
+	"sort"
+	"strings"
+)
+
+type command struct {
+	summary string
+	run     func(a *app, args []string) error
+}
+
+var commands = map[string]command{
+	"config":        {"Show or save the server URL and token", runConfig},
+	"add":           {"Add an expense", runAdd},
+	"transactions":  {"List your transactions", runTransactions},
+	"balances":      {"Show who owes whom", runBalances},
+	"settle":        {"Record a payment between you and a contact", runSettle},
+	"contacts":      {"List, request, accept, remove and block contacts", runContacts},
+	"ghosts":        {"Placeholders for people who haven't signed up", runGhosts},
+	"groups":        {"List, create and change groups", runGroups},
+	"notifications": {"Read notifications and choose how you get them", runNotifications},
+	"reminders":     {"Remind people who owe you, and see who was reminded", runReminders},
+	"webhooks":      {"Send ledger events to your own URLs", runWebhooks},
+	"chat":          {"Link Slack and Discord users so their commands act as you", runChat},
+	"handles":       {"Set up how people who owe you can pay you", runHandles},
+	"pay":           {"Show links that pay what you owe a contact", runPay},
+	"shares":        {"Share read-only links to a group or date range", runShares},
+	"statements":    {"Show monthly statements of a group, or get them by email", runStatements},
+	"analytics":     {"See what you spent over time and with whom", runAnalytics},
+	"budgets":       {"Set group budgets and see what is left of them", runBudgets},
+}
+
+// app State shared by every command
+type app struct {
+	ctx    context.Context
+	cfg    config
+	client *client.Client
+	print  printer
+
+	me       string
+	contacts map[string]client.Contact
+}
+
+func main() {
+	if err := run(os.Args[1:]); err != nil && !errors.Is(err, flag.ErrHelp) {
+		fmt.Fprintln(os.Stderr, "howmuch:", err)
+		os.Exit(1)
+	}
+}
+
+func run(args []string) error {
+	cfg, err := loadConfig()
+	if err != nil {
+		return err
+	}
+
+	global := flag.NewFlagSet("howmuch", flag.ContinueOnError)
+	global.Usage = func() { printUsage(global) }
+	output := global.String("o", outputTable, "output format, table or json")
+	global.StringVar(&cfg.Server, "server", cfg.Server, "server URL, overrides the config file")
+	global.StringVar(&cfg.Token, "token", cfg.Token, "personal access token, overrides the config file")
+	if err = global.Parse(args); err != nil {
+		return err
+	}
+	if *output != outputTable && *output != outputJSON {
+		return fmt.Errorf("unknown output format %q", *output)
+	}
+	if global.NArg() == 0 {
+		printUsage(global)
+		return fmt.Errorf("no command given")
+	}
+	cmd, ok := commands[global.Arg(0)]
+	if !ok {
+		printUsage(global)
+		return fmt.Errorf("unknown command %q", global.Arg(0))
+	}
+
+	a := &app{ctx: context.Background(), cfg: cfg, print: printer{out: os.Stdout, format: *output}}
+	a.client = client.New(cfg.Server)
+	a.client.Token = cfg.Token
+	return cmd.run(a, global.Args()[1:])
+}
+
+func printUsage(global *flag.FlagSet) {
+	out := global.Output()
+	fmt.Fprintln(out, "Usage: howmuch [-o table|json] [-server URL] [-token TOKEN] <command> [arguments]")
+	fmt.Fprintln(out, "\nCommands:")
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(out, "  %-14s %s\n", name, commands[name].summary)
+	}
+	fmt.Fprintln(out, "\nRun howmuch <command> -h for the arguments of a command.")
+	fmt.Fprintln(out, "\nFlags:")
+	global.PrintDefaults()
+}
+
+// requireLogin Commands that talk to the server need somewhere to send
+// requests and a token to send with them
+func (a *app) requireLogin() error {
+	if a.cfg.Server == "" || a.cfg.Token == "" {
+		return fmt.Errorf("no server or token configured, run howmuch config -server URL -token TOKEN")
+	}
+	return nil
+}
+
+// resolve Turns "me", an email address of a contact, or an account ID into an account ID
+func (a *app) resolve(ref string) (string, error) {
+	if ref == "me" {
+		return a.self()
+	}
+	if !strings.Contains(ref, "@") {
+		return ref, nil
+	}
+	if err := a.loadContacts(); err != nil {
+		return "", err
+	}
+	for id, contact := range a.contacts {
+		if strings.EqualFold(contact.Email, ref) {
+			return id, nil
+		}
+	}
+	return "", fmt.Errorf("%s is not one of your contacts", ref)
+}
+
+func (a *app) self() (string, error) {
+	if a.me == "" {
+		account, err := a.client.GetCurrentAccount(a.ctx)
+		if err != nil {
+			return "", err
+		}
+		a.me = account.UserID
+	}
+	return a.me, nil
+}
+
+func (a *app) loadContacts() error {
+	if a.contacts != nil {
+		return nil
+	}
+	contacts, err := a.client.GetAllContacts(a.ctx)
+	if err != nil {
+		return err
+	}
+	a.contacts = contacts
+	return nil
+}
+
+// listFlag A flag that can be repeated or given as a comma separated list
+type listFlag []string
+
+func (l *listFlag) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *listFlag) Set(value string) error {
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			*l = append(*l, item)
+		}
+	}
+	return nil
+}
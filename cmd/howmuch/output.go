@@ -0,0 +1,53 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+)
+
+const (
+	outputTable = "table"
+	outputJSON  = "json"
+)
+
+// printer Writes command results either as an aligned table or as the raw
+// JSON the API returned, for piping into jq
+type printer struct {
+	out    io.Writer
+	format string
+}
+
+func (p printer) json(v interface{}) error {
+	encoder := json.NewEncoder(p.out)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(v)
+}
+
+// table Prints rows under a header. In JSON mode v is printed instead.
+func (p printer) table(v interface{}, header []string, rows [][]string) error {
+	if p.format == outputJSON {
+		return p.json(v)
+	}
+	w := tabwriter.NewWriter(p.out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, strings.Join(header, "\t"))
+	for _, row := range rows {
+		fmt.Fprintln(w, strings.Join(row, "\t"))
+	}
+	return w.Flush()
+}
+
+// message Prints a confirmation in table mode, or v in JSON mode
+func (p printer) message(v interface{}, format string, args ...interface{}) error {
+	if p.format == outputJSON {
+		return p.json(v)
+	}
+	_, err := fmt.Fprintf(p.out, format+"\n", args...)
+	return err
+}
+
+func money(amount float64) string {
+	return fmt.Sprintf("%.2f", amount)
+}
@@ -1,6 +1,7 @@
 package database
 
 import (
+	"errors"
 	"github.com/gin-gonic/gin"
 	"github.com/lib/pq"
 	"log"
@@ -22,3 +23,16 @@ func CheckDBErr(err *pq.Error, c *gin.Context) {
 		return
 	}
 }
+
+// RespondErr Answers a request that failed with err, which needn't come from
+// Postgres: a *pq.Error, even a wrapped one, is answered by CheckDBErr and
+// anything else with a 500
+func RespondErr(err error, c *gin.Context) {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		CheckDBErr(pqErr, c)
+		return
+	}
+	log.Println(err)
+	c.AbortWithStatusJSON(500, "The server was unable to complete the request")
+}
@@ -0,0 +1,34 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRespondErr(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	tests := []struct {
+		name string
+		err  error
+		want int
+	}{
+		{"unique violation", &pq.Error{Code: "23505"}, 400},
+		{"wrapped unique violation", fmt.Errorf("merging: %w", &pq.Error{Code: "23505"}), 400},
+		{"other database error", &pq.Error{Code: "08006"}, 503},
+		{"not from the database", errors.New("unable to queue the webhook"), 500},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			RespondErr(tt.err, c)
+			if w.Code != tt.want {
+				t.Errorf("got status %d, want %d", w.Code, tt.want)
+			}
+		})
+	}
+}
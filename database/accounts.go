@@ -0,0 +1,129 @@
+package database
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+)
+
+// Execer A *sql.DB or *sql.Tx
+type Execer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}
+
+// Querier A *sql.DB or *sql.Tx, for code that runs the same in a transaction
+// and outside one
+type Querier interface {
+	Execer
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// NewUserID A random internal ID for a new account
+func NewUserID() (string, error) {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(id), nil
+}
+
+// MergeAccount Moves every transaction, contact, login and token of the
+// account from into the account into, then deletes from. When both accounts
+// took part in the same transaction their shares are added together. Run it
+// in a transaction that has locked both accounts.
+func MergeAccount(ctx context.Context, tx Execer, from string, into string) error {
+	statements := []string{
+		`UPDATE transaction SET payer=$2 WHERE payer=$1`,
+		// Shares in transactions both accounts took part in are combined
+		`UPDATE transaction_participants keep SET dollar_share = keep.dollar_share + gone.dollar_share,
+    				fractional_share = keep.fractional_share + gone.fractional_share
+				FROM transaction_participants gone
+				WHERE keep.user_id=$2 AND gone.user_id=$1 AND keep.transaction_id = gone.transaction_id`,
+		`DELETE FROM transaction_participants gone USING transaction_participants keep
+				WHERE keep.user_id=$2 AND gone.user_id=$1 AND keep.transaction_id = gone.transaction_id`,
+		`UPDATE transaction_participants SET user_id=$2 WHERE user_id=$1`,
+		// Analytics of everyone who shares a transaction with the account that's
+		// kept are built again from the ledger when they next ask for them
+		`DELETE FROM analytics_state WHERE user_id IN ($1, $2) OR user_id IN (SELECT tp.user_id FROM transaction t
+				JOIN transaction_participants tp ON tp.transaction_id = t.id
+				WHERE t.payer=$2 OR EXISTS(SELECT 1 FROM transaction_participants o WHERE o.transaction_id = t.id AND o.user_id=$2))`,
+		// Contacts the accounts had with each other are dropped, the rest are
+		// moved over. Settings fill in what the contact that's kept left blank.
+		`INSERT INTO contact (user_id, contact_id, created_at, nickname, notes, currency, split_type, your_share, their_share)
+				SELECT $2, contact_id, created_at, nickname, notes, currency, split_type, your_share, their_share FROM contact
+				WHERE user_id=$1 AND contact_id<>$2 ON CONFLICT DO NOTHING`,
+		`INSERT INTO contact (user_id, contact_id, created_at, nickname, notes, currency, split_type, your_share, their_share)
+				SELECT user_id, $2, created_at, nickname, notes, currency, split_type, your_share, their_share FROM contact
+				WHERE contact_id=$1 AND user_id<>$2 ON CONFLICT DO NOTHING`,
+		`UPDATE contact keep SET nickname = COALESCE(NULLIF(keep.nickname, ''), gone.nickname),
+				notes = COALESCE(NULLIF(keep.notes, ''), gone.notes), currency = COALESCE(NULLIF(keep.currency, ''), gone.currency),
+				split_type = COALESCE(NULLIF(keep.split_type, ''), gone.split_type),
+				your_share = CASE WHEN keep.split_type = '' THEN gone.your_share ELSE keep.your_share END,
+				their_share = CASE WHEN keep.split_type = '' THEN gone.their_share ELSE keep.their_share END
+				FROM contact gone WHERE gone.user_id=$1 AND keep.user_id=$2 AND keep.contact_id = gone.contact_id`,
+		`UPDATE contact keep SET nickname = COALESCE(NULLIF(keep.nickname, ''), gone.nickname),
+				notes = COALESCE(NULLIF(keep.notes, ''), gone.notes), currency = COALESCE(NULLIF(keep.currency, ''), gone.currency),
+				split_type = COALESCE(NULLIF(keep.split_type, ''), gone.split_type),
+				your_share = CASE WHEN keep.split_type = '' THEN gone.your_share ELSE keep.your_share END,
+				their_share = CASE WHEN keep.split_type = '' THEN gone.their_share ELSE keep.their_share END
+				FROM contact gone WHERE gone.contact_id=$1 AND keep.contact_id=$2 AND keep.user_id = gone.user_id`,
+		`DELETE FROM contact WHERE user_id=$1 OR contact_id=$1`,
+		// Pending requests and blocks move over unless the other account has
+		// the same one already, the rest go with the account
+		`UPDATE contact_request r SET from_id=$2 WHERE from_id=$1 AND to_id<>$2 AND status='pending'
+				AND NOT EXISTS(SELECT 1 FROM contact_request k WHERE k.status='pending'
+					AND ((k.from_id=$2 AND k.to_id=r.to_id) OR (k.from_id=r.to_id AND k.to_id=$2)))`,
+		`UPDATE contact_request r SET to_id=$2 WHERE to_id=$1 AND from_id<>$2 AND status='pending'
+				AND NOT EXISTS(SELECT 1 FROM contact_request k WHERE k.status='pending'
+					AND ((k.to_id=$2 AND k.from_id=r.from_id) OR (k.to_id=r.from_id AND k.from_id=$2)))`,
+		`INSERT INTO contact_block (user_id, blocked_id, created_at) SELECT $2, blocked_id, created_at FROM contact_block
+				WHERE user_id=$1 AND blocked_id<>$2 ON CONFLICT DO NOTHING`,
+		`INSERT INTO contact_block (user_id, blocked_id, created_at) SELECT user_id, $2, created_at FROM contact_block
+				WHERE blocked_id=$1 AND user_id<>$2 ON CONFLICT DO NOTHING`,
+		`UPDATE invitation i SET inviter_id=$2 WHERE inviter_id=$1
+				AND (revoked_at IS NOT NULL OR accepted_at IS NOT NULL OR NOT EXISTS(SELECT 1 FROM invitation k
+					WHERE k.inviter_id=$2 AND k.email=i.email AND k.revoked_at IS NULL AND k.accepted_at IS NULL))`,
+		`UPDATE invitation SET accepted_by=$2 WHERE accepted_by=$1`,
+		`UPDATE ghost SET owner_id=$2 WHERE owner_id=$1 AND id<>$2`,
+		`INSERT INTO group_member (group_id, user_id, joined_at) SELECT group_id, $2, joined_at FROM group_member
+				WHERE user_id=$1 ON CONFLICT DO NOTHING`,
+		`UPDATE expense_group SET created_by=$2 WHERE created_by=$1`,
+		`UPDATE budget SET created_by=$2 WHERE created_by=$1`,
+		`UPDATE transaction_comment SET author_id=$2 WHERE author_id=$1`,
+		// Preferences and settings of the account that's kept win
+		`UPDATE notification SET user_id=$2 WHERE user_id=$1`,
+		`INSERT INTO notification_preference (user_id, type, inbox, email, webhook)
+				SELECT $2, type, inbox, email, webhook FROM notification_preference WHERE user_id=$1 ON CONFLICT DO NOTHING`,
+		`INSERT INTO notification_setting (user_id, digest, last_digest_at, time_zone)
+				SELECT $2, digest, last_digest_at, time_zone FROM notification_setting WHERE user_id=$1 ON CONFLICT DO NOTHING`,
+		`UPDATE reminder_rule r SET user_id=$2 WHERE user_id=$1 AND contact_id IS DISTINCT FROM $2
+				AND NOT EXISTS(SELECT 1 FROM reminder_rule k WHERE k.user_id=$2 AND k.contact_id IS NOT DISTINCT FROM r.contact_id)`,
+		`UPDATE reminder_rule r SET contact_id=$2 WHERE contact_id=$1 AND user_id<>$2
+				AND NOT EXISTS(SELECT 1 FROM reminder_rule k WHERE k.user_id=r.user_id AND k.contact_id=$2)`,
+		// Reminder state is worked out again from the balances on the next run
+		`DELETE FROM reminder_state WHERE creditor_id IN ($1, $2) OR debtor_id IN ($1, $2)`,
+		`UPDATE payment_reminder SET creditor_id=$2 WHERE creditor_id=$1`,
+		`UPDATE payment_reminder SET debtor_id=$2 WHERE debtor_id=$1`,
+		`UPDATE webhook SET user_id=$2 WHERE user_id=$1`,
+		`UPDATE chat_account SET user_id=$2 WHERE user_id=$1`,
+		`INSERT INTO payment_handle (user_id, kind, handle, name, bic, created_at)
+				SELECT $2, kind, handle, name, bic, created_at FROM payment_handle WHERE user_id=$1 ON CONFLICT DO NOTHING`,
+		`UPDATE share_link SET user_id=$2 WHERE user_id=$1`,
+		`INSERT INTO statement_subscription (user_id, group_id, last_sent, created_at)
+				SELECT $2, group_id, last_sent, created_at FROM statement_subscription WHERE user_id=$1 ON CONFLICT DO NOTHING`,
+		`UPDATE identity SET user_id=$2 WHERE user_id=$1`,
+		`UPDATE api_token SET user_id=$2 WHERE user_id=$1`,
+		`UPDATE email_login SET link_user_id=$2 WHERE link_user_id=$1`,
+		`UPDATE user_session SET user_id=$2 WHERE user_id=$1`,
+		`DELETE FROM account WHERE id=$1`,
+	}
+	for _, statement := range statements {
+		if _, err := tx.ExecContext(ctx, statement, from, into); err != nil {
+			return err
+		}
+	}
+	return nil
+}
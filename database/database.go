@@ -7,22 +7,24 @@ import (
 	"github.com/golang-migrate/migrate/v4"
 	_ "github.com/golang-migrate/migrate/v4/database/postgres"
 	_ "github.com/golang-migrate/migrate/v4/source/file"
+	"github.com/gorilla/sessions"
 	_ "github.com/lib/pq"
 	"log"
 	"net/http"
 	"os"
+	"time"
 )
 
 type DB struct {
-	Db           *sql.DB
-	SessionStore *pgstore.PGStore
+	Db *sql.DB
+	// SessionStore Postgres backed in the app, anything that keeps session
+	// data on the server works
+	SessionStore sessions.Store
 }
 
 // InitDBConnection Initialize a database connection using the environment variable DATABASE_URL
 // Returns type *sql.DB
 func InitDBConnection() *sql.DB {
-	fmt.Println(os.Getenv("DATABASE_URL"))
-
 	db, err := sql.Open("postgres", os.Getenv("DATABASE_URL"))
 	// if there is an error opening the connection, handle it
 	if err != nil {
@@ -33,7 +35,8 @@ func InitDBConnection() *sql.DB {
 	return db
 }
 
-func InitOauthStore() *pgstore.PGStore {
+// InitOauthStore The session store, sessions and their cookies last at most maxAge
+func InitOauthStore(maxAge time.Duration) *pgstore.PGStore {
 	var err error
 
 	SessionStore, err := pgstore.NewPGStore(os.Getenv("DATABASE_URL"), []byte(os.Getenv("DATABASE_SECRET")))
@@ -41,7 +44,7 @@ func InitOauthStore() *pgstore.PGStore {
 		panic(err)
 	}
 
-	SessionStore.MaxAge(1800)
+	SessionStore.MaxAge(int(maxAge.Seconds()))
 	SessionStore.Options.SameSite = http.SameSiteLaxMode
 	SessionStore.Options.HttpOnly = true
 	if os.Getenv("ENV") == "DEV" {
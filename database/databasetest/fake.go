@@ -0,0 +1,130 @@
+// Package databasetest A stand-in database for tests of code that runs a few
+// known queries, where there's no Postgres to run them against
+package databasetest
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"how-much-do-i-owe/database"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// Answer What the database responds to a query: the columns and rows of a
+// SELECT, nothing for any other statement
+type Answer struct {
+	Columns []string
+	Rows    [][]driver.Value
+}
+
+// Answerer Answers the queries a test expects, and fails it on others
+type Answerer func(t *testing.T, query string, args []driver.Value) Answer
+
+var (
+	fakeMu   sync.Mutex
+	fakeDBs  = map[string]*fakeConn{}
+	fakeOnce sync.Once
+)
+
+// New A database whose queries are answered by answer. Transactions begin
+// and commit without doing anything, and every statement affects one row.
+func New(t *testing.T, answer Answerer) *database.DB {
+	fakeOnce.Do(func() { sql.Register("databasetest", fakeDriver{}) })
+	fakeMu.Lock()
+	fakeDBs[t.Name()] = &fakeConn{t: t, answer: answer}
+	fakeMu.Unlock()
+	db, err := sql.Open("databasetest", t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		db.Close()
+		fakeMu.Lock()
+		delete(fakeDBs, t.Name())
+		fakeMu.Unlock()
+	})
+	return &database.DB{Db: db}
+}
+
+type fakeDriver struct{}
+
+func (fakeDriver) Open(name string) (driver.Conn, error) {
+	fakeMu.Lock()
+	defer fakeMu.Unlock()
+	conn, ok := fakeDBs[name]
+	if !ok {
+		return nil, fmt.Errorf("no fake database %q", name)
+	}
+	return conn, nil
+}
+
+type fakeConn struct {
+	t      *testing.T
+	answer Answerer
+}
+
+func (c *fakeConn) Prepare(query string) (driver.Stmt, error) {
+	return &fakeStmt{conn: c, query: query}, nil
+}
+
+func (c *fakeConn) Close() error { return nil }
+
+func (c *fakeConn) Begin() (driver.Tx, error) { return fakeTx{}, nil }
+
+type fakeTx struct{}
+
+func (fakeTx) Commit() error   { return nil }
+func (fakeTx) Rollback() error { return nil }
+
+type fakeStmt struct {
+	conn  *fakeConn
+	query string
+}
+
+func (s *fakeStmt) Close() error  { return nil }
+func (s *fakeStmt) NumInput() int { return -1 }
+
+func (s *fakeStmt) Exec(args []driver.Value) (driver.Result, error) {
+	s.conn.answer(s.conn.t, s.query, args)
+	return driver.RowsAffected(1), nil
+}
+
+func (s *fakeStmt) Query(args []driver.Value) (driver.Rows, error) {
+	a := s.conn.answer(s.conn.t, s.query, args)
+	return &fakeRows{columns: a.Columns, rows: a.Rows}, nil
+}
+
+type fakeRows struct {
+	columns []string
+	rows    [][]driver.Value
+}
+
+func (r *fakeRows) Columns() []string { return r.columns }
+func (r *fakeRows) Close() error      { return nil }
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if len(r.rows) == 0 {
+		return io.EOF
+	}
+	if len(r.rows[0]) != len(dest) {
+		return errors.New("the fake row has the wrong number of columns")
+	}
+	copy(dest, r.rows[0])
+	r.rows = r.rows[1:]
+	return nil
+}
+
+// Has If query contains every one of parts, ignoring whitespace differences
+func Has(query string, parts ...string) bool {
+	query = strings.Join(strings.Fields(query), " ")
+	for _, p := range parts {
+		if !strings.Contains(query, p) {
+			return false
+		}
+	}
+	return true
+}
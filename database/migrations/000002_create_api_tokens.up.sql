@@ -0,0 +1,14 @@
+CREATE TABLE IF NOT EXISTS api_token
+(
+    id           SERIAL PRIMARY KEY,
+    google_id    TEXT        NOT NULL REFERENCES account (google_id) ON DELETE CASCADE,
+    name         TEXT        NOT NULL,
+    token_hash   TEXT        NOT NULL UNIQUE,
+    scope        TEXT        NOT NULL CHECK (scope IN ('read', 'write')),
+    created_at   TIMESTAMPTZ NOT NULL DEFAULT now(),
+    expires_at   TIMESTAMPTZ,
+    last_used_at TIMESTAMPTZ,
+    revoked_at   TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS api_token_google_id_idx ON api_token (google_id);
@@ -0,0 +1,2 @@
+ALTER TABLE transaction
+    ADD COLUMN IF NOT EXISTS description TEXT NOT NULL DEFAULT '';
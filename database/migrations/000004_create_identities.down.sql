@@ -0,0 +1,20 @@
+ALTER TABLE account
+    ADD COLUMN IF NOT EXISTS access_token TEXT,
+    ADD COLUMN IF NOT EXISTS expires_in   TIMESTAMPTZ;
+
+UPDATE account
+SET access_token = identity.access_token,
+    expires_in   = identity.expires_in
+FROM identity
+WHERE identity.user_id = account.id
+  AND identity.provider = 'google';
+
+DROP TABLE IF EXISTS identity;
+
+ALTER INDEX IF EXISTS api_token_user_id_idx RENAME TO api_token_google_id_idx;
+ALTER TABLE api_token
+    RENAME COLUMN user_id TO google_id;
+ALTER TABLE transaction_participants
+    RENAME COLUMN user_id TO google_id;
+ALTER TABLE account
+    RENAME COLUMN id TO google_id;
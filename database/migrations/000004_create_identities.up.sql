@@ -0,0 +1,34 @@
+-- Accounts are keyed by an internal user ID instead of a Google ID. Existing
+-- accounts keep their Google ID as their user ID, renaming the columns keeps
+-- every foreign key pointing at them intact.
+ALTER TABLE account
+    RENAME COLUMN google_id TO id;
+ALTER TABLE transaction_participants
+    RENAME COLUMN google_id TO user_id;
+ALTER TABLE api_token
+    RENAME COLUMN google_id TO user_id;
+ALTER INDEX IF EXISTS api_token_google_id_idx RENAME TO api_token_user_id_idx;
+
+-- A login with an identity provider, many of them may belong to one account
+CREATE TABLE IF NOT EXISTS identity
+(
+    provider     TEXT        NOT NULL,
+    subject      TEXT        NOT NULL,
+    user_id      TEXT        NOT NULL REFERENCES account (id) ON DELETE CASCADE,
+    email        TEXT        NOT NULL DEFAULT '',
+    access_token TEXT        NOT NULL DEFAULT '',
+    expires_in   TIMESTAMPTZ,
+    created_at   TIMESTAMPTZ NOT NULL DEFAULT now(),
+    PRIMARY KEY (provider, subject)
+);
+
+CREATE INDEX IF NOT EXISTS identity_user_id_idx ON identity (user_id);
+
+INSERT INTO identity (provider, subject, user_id, email, access_token, expires_in)
+SELECT 'google', id, id, email, access_token, expires_in
+FROM account
+ON CONFLICT DO NOTHING;
+
+ALTER TABLE account
+    DROP COLUMN IF EXISTS access_token,
+    DROP COLUMN IF EXISTS expires_in;
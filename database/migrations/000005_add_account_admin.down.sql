@@ -0,0 +1,2 @@
+ALTER TABLE account
+    DROP COLUMN IF EXISTS is_admin;
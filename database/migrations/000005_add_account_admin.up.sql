@@ -0,0 +1,2 @@
+ALTER TABLE account
+    ADD COLUMN IF NOT EXISTS is_admin BOOLEAN NOT NULL DEFAULT false;
@@ -0,0 +1,15 @@
+-- Magic links that have been emailed. Only a hash of each link's nonce is
+-- stored, used_at makes every link single-use.
+CREATE TABLE IF NOT EXISTS email_login
+(
+    nonce_hash   TEXT PRIMARY KEY,
+    email        TEXT        NOT NULL,
+    link_user_id TEXT REFERENCES account (id) ON DELETE CASCADE,
+    requested_ip TEXT        NOT NULL DEFAULT '',
+    created_at   TIMESTAMPTZ NOT NULL DEFAULT now(),
+    expires_at   TIMESTAMPTZ NOT NULL,
+    used_at      TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS email_login_email_idx ON email_login (email, created_at);
+CREATE INDEX IF NOT EXISTS email_login_requested_ip_idx ON email_login (requested_ip, created_at);
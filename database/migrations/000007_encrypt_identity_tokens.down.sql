@@ -0,0 +1,4 @@
+ALTER TABLE identity DROP COLUMN IF EXISTS refresh_token;
+
+-- Encrypted tokens are no use to the previous version
+UPDATE identity SET access_token = '';
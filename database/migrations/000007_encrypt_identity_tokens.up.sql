@@ -0,0 +1,5 @@
+-- Access tokens were stored in plaintext. Rather than encrypt them here they
+-- are dropped, each login saves new ones encrypted.
+UPDATE identity SET access_token = '';
+
+ALTER TABLE identity ADD COLUMN IF NOT EXISTS refresh_token TEXT NOT NULL DEFAULT '';
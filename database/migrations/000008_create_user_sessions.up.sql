@@ -0,0 +1,16 @@
+-- Every login, so users can see where they're logged in and revoke it. The
+-- session cookie's data refers to a row here, which has to be active for the
+-- cookie to work.
+CREATE TABLE IF NOT EXISTS user_session
+(
+    id           TEXT PRIMARY KEY,
+    user_id      TEXT        NOT NULL REFERENCES account (id) ON DELETE CASCADE,
+    user_agent   TEXT        NOT NULL DEFAULT '',
+    ip           TEXT        NOT NULL DEFAULT '',
+    created_at   TIMESTAMPTZ NOT NULL DEFAULT now(),
+    last_seen_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    expires_at   TIMESTAMPTZ NOT NULL,
+    revoked_at   TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS user_session_user_id_idx ON user_session (user_id);
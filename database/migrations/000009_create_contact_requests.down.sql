@@ -0,0 +1,8 @@
+-- Pending requests go back to being one-sided contacts
+INSERT INTO contact (user_id, contact_id)
+SELECT from_id, to_id FROM contact_request WHERE status = 'pending';
+
+ALTER TABLE contact DROP COLUMN IF EXISTS created_at;
+
+DROP TABLE IF EXISTS contact_block;
+DROP TABLE IF EXISTS contact_request;
@@ -0,0 +1,39 @@
+-- A contact request used to be a contact row in one direction only, and
+-- contacts were rows in both directions. Requests now have their own table
+-- and contact only holds established contacts, still one row per direction.
+CREATE TABLE IF NOT EXISTS contact_request
+(
+    id           SERIAL PRIMARY KEY,
+    from_id      TEXT        NOT NULL REFERENCES account (id) ON DELETE CASCADE,
+    to_id        TEXT        NOT NULL REFERENCES account (id) ON DELETE CASCADE,
+    status       TEXT        NOT NULL DEFAULT 'pending'
+        CHECK (status IN ('pending', 'accepted', 'declined', 'cancelled')),
+    created_at   TIMESTAMPTZ NOT NULL DEFAULT now(),
+    responded_at TIMESTAMPTZ,
+    CHECK (from_id <> to_id)
+);
+
+-- Only one pending request at a time between the same two users
+CREATE UNIQUE INDEX IF NOT EXISTS contact_request_pending_idx ON contact_request (from_id, to_id) WHERE status = 'pending';
+CREATE INDEX IF NOT EXISTS contact_request_to_id_idx ON contact_request (to_id) WHERE status = 'pending';
+
+-- Users someone never wants to hear from
+CREATE TABLE IF NOT EXISTS contact_block
+(
+    user_id    TEXT        NOT NULL REFERENCES account (id) ON DELETE CASCADE,
+    blocked_id TEXT        NOT NULL REFERENCES account (id) ON DELETE CASCADE,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    PRIMARY KEY (user_id, blocked_id),
+    CHECK (user_id <> blocked_id)
+);
+
+ALTER TABLE contact ADD COLUMN IF NOT EXISTS created_at TIMESTAMPTZ NOT NULL DEFAULT now();
+
+INSERT INTO contact_request (from_id, to_id)
+SELECT DISTINCT sent.user_id, sent.contact_id
+FROM contact sent
+WHERE sent.user_id <> sent.contact_id
+  AND NOT EXISTS(SELECT 1 FROM contact back WHERE back.user_id = sent.contact_id AND back.contact_id = sent.user_id);
+
+DELETE FROM contact sent
+WHERE NOT EXISTS(SELECT 1 FROM contact back WHERE back.user_id = sent.contact_id AND back.contact_id = sent.user_id);
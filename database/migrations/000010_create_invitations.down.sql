@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS invitation_send;
+DROP TABLE IF EXISTS invitation;
@@ -0,0 +1,29 @@
+-- Contacts invited by email who don't have an account yet. Only a hash of the
+-- nonce in the emailed link is stored, resending replaces it.
+CREATE TABLE IF NOT EXISTS invitation
+(
+    id          SERIAL PRIMARY KEY,
+    inviter_id  TEXT        NOT NULL REFERENCES account (id) ON DELETE CASCADE,
+    email       TEXT        NOT NULL,
+    nonce_hash  TEXT        NOT NULL,
+    created_at  TIMESTAMPTZ NOT NULL DEFAULT now(),
+    expires_at  TIMESTAMPTZ NOT NULL,
+    revoked_at  TIMESTAMPTZ,
+    accepted_at TIMESTAMPTZ,
+    accepted_by TEXT REFERENCES account (id) ON DELETE SET NULL
+);
+
+-- One open invitation per inviter and address
+CREATE UNIQUE INDEX IF NOT EXISTS invitation_open_idx ON invitation (inviter_id, email)
+    WHERE revoked_at IS NULL AND accepted_at IS NULL;
+CREATE INDEX IF NOT EXISTS invitation_email_idx ON invitation (email)
+    WHERE revoked_at IS NULL AND accepted_at IS NULL;
+
+-- Every email sent for an invitation, for rate limiting
+CREATE TABLE IF NOT EXISTS invitation_send
+(
+    invitation_id INTEGER     NOT NULL REFERENCES invitation (id) ON DELETE CASCADE,
+    sent_at       TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS invitation_send_sent_at_idx ON invitation_send (invitation_id, sent_at);
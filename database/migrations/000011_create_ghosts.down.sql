@@ -0,0 +1,6 @@
+ALTER TABLE contact_request
+    DROP COLUMN IF EXISTS ghost_id;
+ALTER TABLE invitation
+    DROP COLUMN IF EXISTS ghost_id;
+DELETE FROM account WHERE id IN (SELECT id FROM ghost);
+DROP TABLE IF EXISTS ghost;
@@ -0,0 +1,33 @@
+-- Placeholders for people who haven't signed up. A ghost has an account row
+-- like anyone else, so transactions and balances need no special case, but
+-- no identity to log in with. Only its owner can put it in transactions.
+CREATE TABLE IF NOT EXISTS ghost
+(
+    id         TEXT PRIMARY KEY REFERENCES account (id) ON DELETE CASCADE,
+    owner_id   TEXT        NOT NULL REFERENCES account (id) ON DELETE CASCADE,
+    email      TEXT        NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    CHECK (id <> owner_id)
+);
+
+CREATE INDEX IF NOT EXISTS ghost_owner_id_idx ON ghost (owner_id);
+CREATE INDEX IF NOT EXISTS ghost_email_idx ON ghost (lower(email)) WHERE email <> '';
+
+-- Ghost accounts have no email of their own, so any unique email constraint
+-- only applies to accounts that have one
+DO
+$$
+    BEGIN
+        IF EXISTS(SELECT 1 FROM pg_constraint WHERE conname = 'account_email_key') THEN
+            ALTER TABLE account DROP CONSTRAINT account_email_key;
+            CREATE UNIQUE INDEX account_email_key ON account (email) WHERE email <> '';
+        END IF;
+    END
+$$;
+
+-- Accepting an invitation or request sent for a ghost moves the ghost's
+-- history into the account that accepted
+ALTER TABLE invitation
+    ADD COLUMN IF NOT EXISTS ghost_id TEXT REFERENCES ghost (id) ON DELETE SET NULL;
+ALTER TABLE contact_request
+    ADD COLUMN IF NOT EXISTS ghost_id TEXT REFERENCES ghost (id) ON DELETE SET NULL;
@@ -0,0 +1,7 @@
+ALTER TABLE contact
+    DROP COLUMN IF EXISTS nickname,
+    DROP COLUMN IF EXISTS notes,
+    DROP COLUMN IF EXISTS currency,
+    DROP COLUMN IF EXISTS split_type,
+    DROP COLUMN IF EXISTS your_share,
+    DROP COLUMN IF EXISTS their_share;
@@ -0,0 +1,12 @@
+-- What a user keeps about each of their contacts, only they see it. The
+-- contact row in their direction holds it.
+ALTER TABLE contact
+    ADD COLUMN IF NOT EXISTS nickname    TEXT    NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS notes       TEXT    NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS currency    TEXT    NOT NULL DEFAULT ''
+        CHECK (currency = '' OR currency ~ '^[A-Z]{3}$'),
+    -- How transactions with just the two of them are split when no split is given
+    ADD COLUMN IF NOT EXISTS split_type  TEXT    NOT NULL DEFAULT ''
+        CHECK (split_type IN ('', 'equal', 'percent', 'shares')),
+    ADD COLUMN IF NOT EXISTS your_share  INTEGER NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS their_share INTEGER NOT NULL DEFAULT 0;
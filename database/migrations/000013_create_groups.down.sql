@@ -0,0 +1,6 @@
+DROP INDEX IF EXISTS transaction_payer_idx;
+DROP INDEX IF EXISTS transaction_participants_user_id_idx;
+ALTER TABLE transaction
+    DROP COLUMN IF EXISTS group_id;
+DROP TABLE IF EXISTS group_member;
+DROP TABLE IF EXISTS expense_group;
@@ -0,0 +1,27 @@
+-- Groups of people who share expenses, like housemates or a trip. A
+-- transaction may belong to one group, and then only has group members in it.
+CREATE TABLE IF NOT EXISTS expense_group
+(
+    id         SERIAL PRIMARY KEY,
+    name       TEXT        NOT NULL,
+    created_by TEXT        REFERENCES account (id) ON DELETE SET NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE TABLE IF NOT EXISTS group_member
+(
+    group_id  INTEGER     NOT NULL REFERENCES expense_group (id) ON DELETE CASCADE,
+    user_id   TEXT        NOT NULL REFERENCES account (id) ON DELETE CASCADE,
+    joined_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    PRIMARY KEY (group_id, user_id)
+);
+
+CREATE INDEX IF NOT EXISTS group_member_user_id_idx ON group_member (user_id);
+
+ALTER TABLE transaction
+    ADD COLUMN IF NOT EXISTS group_id INTEGER REFERENCES expense_group (id) ON DELETE SET NULL;
+
+CREATE INDEX IF NOT EXISTS transaction_group_id_idx ON transaction (group_id) WHERE group_id IS NOT NULL;
+-- Search ranks contacts by the transactions shared with them
+CREATE INDEX IF NOT EXISTS transaction_participants_user_id_idx ON transaction_participants (user_id);
+CREATE INDEX IF NOT EXISTS transaction_payer_idx ON transaction (payer);
@@ -0,0 +1,11 @@
+-- Notes on a transaction, visible to its payer and participants
+CREATE TABLE IF NOT EXISTS transaction_comment
+(
+    id             SERIAL PRIMARY KEY,
+    transaction_id INTEGER     NOT NULL REFERENCES transaction (id) ON DELETE CASCADE,
+    author_id      TEXT        REFERENCES account (id) ON DELETE SET NULL,
+    body           TEXT        NOT NULL CHECK (length(body) BETWEEN 1 AND 2000),
+    created_at     TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS transaction_comment_transaction_id_idx ON transaction_comment (transaction_id, created_at);
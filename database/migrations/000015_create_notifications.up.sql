@@ -0,0 +1,46 @@
+-- Everything a user is told about. The inbox shows the rows with inbox set,
+-- email and webhook track delivery through those channels: '' when the
+-- channel is off for this notification, 'digest' while waiting for the next
+-- digest email.
+CREATE TABLE IF NOT EXISTS notification
+(
+    id         SERIAL PRIMARY KEY,
+    user_id    TEXT        NOT NULL REFERENCES account (id) ON DELETE CASCADE,
+    type       TEXT        NOT NULL,
+    title      TEXT        NOT NULL,
+    body       TEXT        NOT NULL DEFAULT '',
+    link       TEXT        NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    read_at    TIMESTAMPTZ,
+    inbox      BOOLEAN     NOT NULL,
+    email      TEXT        NOT NULL DEFAULT ''
+        CHECK (email IN ('', 'pending', 'digest', 'sent', 'failed')),
+    webhook    TEXT        NOT NULL DEFAULT ''
+        CHECK (webhook IN ('', 'pending', 'sent', 'failed'))
+);
+
+CREATE INDEX IF NOT EXISTS notification_inbox_idx ON notification (user_id, created_at DESC) WHERE inbox;
+CREATE INDEX IF NOT EXISTS notification_email_idx ON notification (user_id) WHERE email IN ('pending', 'digest');
+CREATE INDEX IF NOT EXISTS notification_webhook_idx ON notification (id) WHERE webhook = 'pending';
+
+-- Which channels a user wants for each type of notification. Types without a
+-- row use the defaults: inbox and email, no webhook.
+CREATE TABLE IF NOT EXISTS notification_preference
+(
+    user_id TEXT    NOT NULL REFERENCES account (id) ON DELETE CASCADE,
+    type    TEXT    NOT NULL,
+    inbox   BOOLEAN NOT NULL,
+    email   BOOLEAN NOT NULL,
+    webhook BOOLEAN NOT NULL,
+    PRIMARY KEY (user_id, type)
+);
+
+-- Digest collects email into one message a day or a week instead of sending
+-- each notification straight away
+CREATE TABLE IF NOT EXISTS notification_setting
+(
+    user_id        TEXT PRIMARY KEY REFERENCES account (id) ON DELETE CASCADE,
+    digest         TEXT NOT NULL DEFAULT '' CHECK (digest IN ('', 'daily', 'weekly')),
+    webhook_url    TEXT NOT NULL DEFAULT '',
+    last_digest_at TIMESTAMPTZ
+);
@@ -0,0 +1,5 @@
+ALTER TABLE notification_setting
+    DROP COLUMN IF EXISTS time_zone;
+DROP TABLE IF EXISTS payment_reminder;
+DROP TABLE IF EXISTS reminder_state;
+DROP TABLE IF EXISTS reminder_rule;
@@ -0,0 +1,52 @@
+-- When to remind people who owe the user money. The rule without a contact is
+-- the user's default, a rule for a contact replaces it for that contact. The
+-- first reminder goes out once the balance has been at least threshold for
+-- after_days, the next ones schedule days after that. Nothing is sent
+-- between quiet_start and quiet_end, hours in the recipient's time zone.
+CREATE TABLE IF NOT EXISTS reminder_rule
+(
+    id          SERIAL         PRIMARY KEY,
+    user_id     TEXT           NOT NULL REFERENCES account (id) ON DELETE CASCADE,
+    contact_id  TEXT           REFERENCES account (id) ON DELETE CASCADE,
+    threshold   NUMERIC(12, 2) NOT NULL CHECK (threshold > 0),
+    after_days  INTEGER        NOT NULL CHECK (after_days >= 0),
+    schedule    INTEGER[]      NOT NULL DEFAULT '{0,7,21}',
+    quiet_start SMALLINT       NOT NULL DEFAULT 21 CHECK (quiet_start BETWEEN 0 AND 23),
+    quiet_end   SMALLINT       NOT NULL DEFAULT 9 CHECK (quiet_end BETWEEN 0 AND 23),
+    enabled     BOOLEAN        NOT NULL DEFAULT true,
+    created_at  TIMESTAMPTZ    NOT NULL DEFAULT now()
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS reminder_rule_default_idx ON reminder_rule (user_id) WHERE contact_id IS NULL;
+CREATE UNIQUE INDEX IF NOT EXISTS reminder_rule_contact_idx ON reminder_rule (user_id, contact_id) WHERE contact_id IS NOT NULL;
+
+-- Debts that are over the threshold of a rule, what they were on the last
+-- check, since when, and how many reminders were sent for them. A row is
+-- removed once the balance drops under the threshold, which ends its
+-- reminders.
+CREATE TABLE IF NOT EXISTS reminder_state
+(
+    creditor_id TEXT           NOT NULL REFERENCES account (id) ON DELETE CASCADE,
+    debtor_id   TEXT           NOT NULL REFERENCES account (id) ON DELETE CASCADE,
+    amount      NUMERIC(12, 2) NOT NULL,
+    over_since  TIMESTAMPTZ    NOT NULL DEFAULT now(),
+    sent        INTEGER        NOT NULL DEFAULT 0,
+    PRIMARY KEY (creditor_id, debtor_id)
+);
+
+-- Every reminder that was sent
+CREATE TABLE IF NOT EXISTS payment_reminder
+(
+    id          SERIAL PRIMARY KEY,
+    creditor_id TEXT           NOT NULL REFERENCES account (id) ON DELETE CASCADE,
+    debtor_id   TEXT           NOT NULL REFERENCES account (id) ON DELETE CASCADE,
+    amount      NUMERIC(12, 2) NOT NULL,
+    stage       INTEGER        NOT NULL,
+    sent_at     TIMESTAMPTZ    NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS payment_reminder_creditor_idx ON payment_reminder (creditor_id, debtor_id, sent_at DESC);
+
+-- Quiet hours are in the time zone of the person being reminded
+ALTER TABLE notification_setting
+    ADD COLUMN IF NOT EXISTS time_zone TEXT NOT NULL DEFAULT 'UTC';
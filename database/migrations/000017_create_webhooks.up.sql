@@ -0,0 +1,38 @@
+-- URLs that get a signed POST when something happens in the ledger of their
+-- user. The signing secret is encrypted like identity tokens.
+CREATE TABLE IF NOT EXISTS webhook
+(
+    id          SERIAL PRIMARY KEY,
+    user_id     TEXT        NOT NULL REFERENCES account (id) ON DELETE CASCADE,
+    url         TEXT        NOT NULL,
+    description TEXT        NOT NULL DEFAULT '',
+    events      TEXT[]      NOT NULL,
+    secret      TEXT        NOT NULL DEFAULT '',
+    enabled     BOOLEAN     NOT NULL DEFAULT true,
+    created_at  TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS webhook_user_id_idx ON webhook (user_id);
+
+-- The queue of webhook deliveries, kept afterwards as their log. Pending
+-- deliveries are tried at next_attempt_at until one succeeds or they run out
+-- of attempts.
+CREATE TABLE IF NOT EXISTS webhook_delivery
+(
+    id              BIGSERIAL PRIMARY KEY,
+    webhook_id      INTEGER     NOT NULL REFERENCES webhook (id) ON DELETE CASCADE,
+    event_type      TEXT        NOT NULL,
+    payload         JSONB       NOT NULL,
+    status          TEXT        NOT NULL DEFAULT 'pending'
+        CHECK (status IN ('pending', 'succeeded', 'failed')),
+    attempts        INTEGER     NOT NULL DEFAULT 0,
+    next_attempt_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    last_attempt_at TIMESTAMPTZ,
+    response_status INTEGER,
+    response_body   TEXT        NOT NULL DEFAULT '',
+    error           TEXT        NOT NULL DEFAULT '',
+    created_at      TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS webhook_delivery_due_idx ON webhook_delivery (next_attempt_at) WHERE status = 'pending';
+CREATE INDEX IF NOT EXISTS webhook_delivery_webhook_id_idx ON webhook_delivery (webhook_id, created_at DESC);
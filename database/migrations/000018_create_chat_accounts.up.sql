@@ -0,0 +1,15 @@
+-- Slack and Discord users linked to an account, so their slash commands act
+-- as it. Discord user IDs are global, their team_id is empty.
+CREATE TABLE IF NOT EXISTS chat_account
+(
+    id           SERIAL PRIMARY KEY,
+    user_id      TEXT        NOT NULL REFERENCES account (id) ON DELETE CASCADE,
+    provider     TEXT        NOT NULL CHECK (provider IN ('slack', 'discord')),
+    team_id      TEXT        NOT NULL DEFAULT '',
+    chat_user_id TEXT        NOT NULL,
+    chat_name    TEXT        NOT NULL DEFAULT '',
+    created_at   TIMESTAMPTZ NOT NULL DEFAULT now(),
+    UNIQUE (provider, team_id, chat_user_id)
+);
+
+CREATE INDEX IF NOT EXISTS chat_account_user_id_idx ON chat_account (user_id);
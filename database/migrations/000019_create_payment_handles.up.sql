@@ -0,0 +1,14 @@
+-- How a user can be paid, one handle for each kind of payment. People who owe
+-- them get links that pre-fill the amount for these. Handle is the PayPal.me
+-- or Venmo username, the $Cashtag without the $, the IBAN for SEPA transfers
+-- or the UPI ID. SEPA transfers need the name of the account holder.
+CREATE TABLE IF NOT EXISTS payment_handle
+(
+    user_id    TEXT        NOT NULL REFERENCES account (id) ON DELETE CASCADE,
+    kind       TEXT        NOT NULL CHECK (kind IN ('paypal', 'venmo', 'cashapp', 'sepa', 'upi')),
+    handle     TEXT        NOT NULL,
+    name       TEXT        NOT NULL DEFAULT '',
+    bic        TEXT        NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    PRIMARY KEY (user_id, kind)
+);
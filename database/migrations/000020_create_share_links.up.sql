@@ -0,0 +1,25 @@
+-- Read-only links to the transactions of a group or a date range, for people
+-- without an account. Only the hash of the token in the link is kept. A link
+-- to a group may be narrowed to a date range, a link without a group shows
+-- the transactions of its owner in the range. Emails are only shown when
+-- show_emails is set.
+CREATE TABLE IF NOT EXISTS share_link
+(
+    id             SERIAL PRIMARY KEY,
+    user_id        TEXT        NOT NULL REFERENCES account (id) ON DELETE CASCADE,
+    token_hash     TEXT        NOT NULL UNIQUE,
+    title          TEXT        NOT NULL DEFAULT '',
+    group_id       INTEGER     REFERENCES expense_group (id) ON DELETE CASCADE,
+    starts_at      TIMESTAMPTZ,
+    ends_at        TIMESTAMPTZ,
+    show_emails    BOOLEAN     NOT NULL DEFAULT false,
+    expires_at     TIMESTAMPTZ NOT NULL,
+    revoked_at     TIMESTAMPTZ,
+    views          INTEGER     NOT NULL DEFAULT 0,
+    last_viewed_at TIMESTAMPTZ,
+    created_at     TIMESTAMPTZ NOT NULL DEFAULT now(),
+    CHECK (group_id IS NOT NULL OR (starts_at IS NOT NULL AND ends_at IS NOT NULL)),
+    CHECK (starts_at IS NULL OR ends_at IS NULL OR starts_at < ends_at)
+);
+
+CREATE INDEX IF NOT EXISTS share_link_user_id_idx ON share_link (user_id);
@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS transaction_timestamp_idx;
+
+ALTER TABLE transaction
+    DROP COLUMN IF EXISTS category;
@@ -0,0 +1,7 @@
+-- What an expense was for, empty when it wasn't said. Settlements have none.
+ALTER TABLE transaction
+    ADD COLUMN IF NOT EXISTS category TEXT NOT NULL DEFAULT ''
+        CHECK (category IN ('', 'groceries', 'dining', 'housing', 'utilities', 'transport', 'travel',
+                            'entertainment', 'shopping', 'health', 'other'));
+
+CREATE INDEX IF NOT EXISTS transaction_timestamp_idx ON transaction (timestamp);
@@ -0,0 +1,11 @@
+-- Groups a user gets their monthly statement for by email, on the first of
+-- the month in their time zone. Last sent is the month of the last statement
+-- they were sent, e.g. 2024-03, so none is sent twice.
+CREATE TABLE IF NOT EXISTS statement_subscription
+(
+    user_id    TEXT        NOT NULL REFERENCES account (id) ON DELETE CASCADE,
+    group_id   INTEGER     NOT NULL REFERENCES expense_group (id) ON DELETE CASCADE,
+    last_sent  TEXT,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    PRIMARY KEY (user_id, group_id)
+);
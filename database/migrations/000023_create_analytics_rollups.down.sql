@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS contact_spending_rollup;
+DROP TABLE IF EXISTS spending_rollup;
+DROP TABLE IF EXISTS analytics_state;
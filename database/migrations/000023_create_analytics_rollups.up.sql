@@ -0,0 +1,42 @@
+-- Rollups of what users spent, by day in their time zone, so analytics don't
+-- add up the whole ledger on every request. Only users with a row in
+-- analytics_state have rollups. Their rollups are refreshed with every change
+-- to their transactions, and rebuilt from scratch when the row is missing or
+-- its time zone is no longer theirs.
+CREATE TABLE IF NOT EXISTS analytics_state
+(
+    user_id   TEXT        NOT NULL PRIMARY KEY REFERENCES account (id) ON DELETE CASCADE,
+    time_zone TEXT        NOT NULL,
+    built_at  TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+-- The user's share of the expenses they took part in, settlements left out.
+-- Total is what the expenses came to, for the average expense size.
+CREATE TABLE IF NOT EXISTS spending_rollup
+(
+    user_id  TEXT          NOT NULL REFERENCES account (id) ON DELETE CASCADE,
+    day      DATE          NOT NULL,
+    category TEXT          NOT NULL,
+    group_id INTEGER,
+    payer_id TEXT          NOT NULL,
+    expenses INTEGER       NOT NULL,
+    share    NUMERIC(14, 2) NOT NULL,
+    total    NUMERIC(14, 2) NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS spending_rollup_user_day_idx ON spending_rollup (user_id, day);
+
+-- The same shares once for every other account in each expense, paying or
+-- taking part
+CREATE TABLE IF NOT EXISTS contact_spending_rollup
+(
+    user_id    TEXT          NOT NULL REFERENCES account (id) ON DELETE CASCADE,
+    day        DATE          NOT NULL,
+    category   TEXT          NOT NULL,
+    group_id   INTEGER,
+    contact_id TEXT          NOT NULL,
+    expenses   INTEGER       NOT NULL,
+    share      NUMERIC(14, 2) NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS contact_spending_rollup_user_day_idx ON contact_spending_rollup (user_id, day);
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS transaction_group_timestamp_idx;
+DROP TABLE IF EXISTS budget_alert;
+DROP TABLE IF EXISTS budget;
@@ -0,0 +1,38 @@
+-- How much a group means to spend, on one category or on everything when
+-- category is null. A monthly budget starts over on the first of every month
+-- in its time zone, a range budget covers starts_at up to ends_at, e.g. a
+-- trip. Members are notified when spending reaches each of the thresholds,
+-- percentages of the amount.
+CREATE TABLE IF NOT EXISTS budget
+(
+    id         SERIAL PRIMARY KEY,
+    group_id   INTEGER        NOT NULL REFERENCES expense_group (id) ON DELETE CASCADE,
+    name       TEXT           NOT NULL DEFAULT '',
+    category   TEXT,
+    amount     NUMERIC(14, 2) NOT NULL CHECK (amount > 0),
+    period     TEXT           NOT NULL CHECK (period IN ('monthly', 'range')),
+    starts_at  TIMESTAMPTZ,
+    ends_at    TIMESTAMPTZ,
+    time_zone  TEXT           NOT NULL DEFAULT 'UTC',
+    thresholds INTEGER[]      NOT NULL DEFAULT '{80,100}',
+    created_by TEXT           REFERENCES account (id) ON DELETE SET NULL,
+    created_at TIMESTAMPTZ    NOT NULL DEFAULT now(),
+    CHECK ((period = 'monthly' AND starts_at IS NULL AND ends_at IS NULL)
+        OR (period = 'range' AND starts_at IS NOT NULL AND ends_at > starts_at))
+);
+
+CREATE INDEX IF NOT EXISTS budget_group_idx ON budget (group_id);
+
+-- The thresholds members were alerted about in each period of a budget, so
+-- each alert goes out once
+CREATE TABLE IF NOT EXISTS budget_alert
+(
+    budget_id    INTEGER        NOT NULL REFERENCES budget (id) ON DELETE CASCADE,
+    period_start TIMESTAMPTZ    NOT NULL,
+    threshold    INTEGER        NOT NULL,
+    spent        NUMERIC(14, 2) NOT NULL,
+    sent_at      TIMESTAMPTZ    NOT NULL DEFAULT now(),
+    PRIMARY KEY (budget_id, period_start, threshold)
+);
+
+CREATE INDEX IF NOT EXISTS transaction_group_timestamp_idx ON transaction (group_id, timestamp);
@@ -0,0 +1,2 @@
+ALTER TABLE identity
+    DROP COLUMN IF EXISTS email_verified;
@@ -0,0 +1,8 @@
+-- If the provider vouched for an identity's email address the last time it
+-- was used to log in. Invitations only hand a placeholder's history to an
+-- account with a verified address the invitation was sent to. Email logins
+-- prove the address, other identities are verified again at their next login.
+ALTER TABLE identity
+    ADD COLUMN IF NOT EXISTS email_verified BOOLEAN NOT NULL DEFAULT false;
+
+UPDATE identity SET email_verified = true WHERE provider = 'email';
@@ -0,0 +1,2 @@
+ALTER TABLE webhook_delivery
+    ADD COLUMN IF NOT EXISTS response_body TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,5 @@
+-- Webhook deliveries no longer keep what the receiver responded with, only
+-- its status. A URL is the user's to choose, so responses could be from
+-- services on the server's own network.
+ALTER TABLE webhook_delivery
+    DROP COLUMN IF EXISTS response_body;
@@ -0,0 +1,4 @@
+ALTER TABLE notification_setting
+    ADD COLUMN IF NOT EXISTS webhook_url TEXT NOT NULL DEFAULT '';
+
+CREATE INDEX IF NOT EXISTS notification_webhook_idx ON notification (id) WHERE webhook = 'pending';
@@ -0,0 +1,9 @@
+-- The webhook channel of notifications is sent through the user's webhooks,
+-- which sign every delivery, as notification.created events. The separate
+-- unsigned URL is gone, notifications still waiting for it aren't sent.
+UPDATE notification SET webhook = 'failed' WHERE webhook = 'pending';
+
+DROP INDEX IF EXISTS notification_webhook_idx;
+
+ALTER TABLE notification_setting
+    DROP COLUMN IF EXISTS webhook_url;
@@ -0,0 +1,5 @@
+UPDATE notification SET email = 'failed' WHERE email = 'sending';
+
+ALTER TABLE notification
+    DROP CONSTRAINT IF EXISTS notification_email_check,
+    ADD CONSTRAINT notification_email_check CHECK (email IN ('', 'pending', 'digest', 'sent', 'failed'));
@@ -0,0 +1,7 @@
+-- Notification emails are claimed as 'sending' before they're sent, and each
+-- is marked sent or failed on its own right after, so nothing already mailed
+-- goes back to 'pending' and out again. One left 'sending' by a server that
+-- stopped mid-send isn't retried, it may have been delivered.
+ALTER TABLE notification
+    DROP CONSTRAINT IF EXISTS notification_email_check,
+    ADD CONSTRAINT notification_email_check CHECK (email IN ('', 'pending', 'digest', 'sending', 'sent', 'failed'));
@@ -0,0 +1,100 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"time"
+)
+
+// The kinds of event sent to clients
+const (
+	TransactionCreated   = "transaction.created"
+	TransactionUpdated   = "transaction.updated"
+	TransactionDeleted   = "transaction.deleted"
+	SettlementCreated    = "settlement.created"
+	CommentCreated       = "comment.created"
+	CommentDeleted       = "comment.deleted"
+	ContactRequestSent   = "contact-request.created"
+	ContactRequestClosed = "contact-request.updated"
+	NotificationCreated  = "notification.created"
+)
+
+// Event Something that changed for the users in Users. Data is what the API
+// would return for the thing that changed, clients that get an event with
+// Truncated set have to fetch it themselves.
+type Event struct {
+	Type      string          `json:"type"`
+	Data      json.RawMessage `json:"data,omitempty"`
+	Truncated bool            `json:"truncated,omitempty"`
+	Users     []string        `json:"users"`
+	Time      time.Time       `json:"time"`
+}
+
+// Bus Fans events out to the streams of the users they are for
+type Bus interface {
+	Publish(ctx context.Context, event Event) error
+	// Subscribe The events for userID until unsubscribe is called. The
+	// channel is closed when the subscriber falls too far behind, it should
+	// reconnect and fetch what it missed.
+	Subscribe(userID string) (events <-chan Event, unsubscribe func())
+}
+
+// DefaultBus The bus the app uses, set up by ConfigEvents
+var DefaultBus Bus = NewLocal()
+
+// ConfigEvents Chooses how events reach other server instances
+//
+//   - EVENTS=local keeps them in this process, which is enough for a single
+//     instance and for development
+//   - otherwise they go through Postgres LISTEN/NOTIFY on DATABASE_URL, so
+//     every instance sees every event
+func ConfigEvents() error {
+	if os.Getenv("EVENTS") == "local" {
+		DefaultBus = NewLocal()
+		fmt.Println("Live events are only delivered within this server")
+		return nil
+	}
+	bus, err := NewPostgres(os.Getenv("DATABASE_URL"))
+	if err != nil {
+		return err
+	}
+	DefaultBus = bus
+	fmt.Println("Live events are delivered through Postgres")
+	return nil
+}
+
+// Publish Sends an event of kind about data to every user in users with
+// DefaultBus. Events are best effort, they are never worth failing a
+// request over, so errors are only logged.
+func Publish(kind string, data interface{}, users ...string) {
+	event := Event{Type: kind, Users: unique(users), Time: time.Now()}
+	if len(event.Users) == 0 {
+		return
+	}
+	payload, err := json.Marshal(data)
+	if err != nil {
+		log.Printf("events: unable to encode %s: %v", kind, err)
+		return
+	}
+	event.Data = payload
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err = DefaultBus.Publish(ctx, event); err != nil {
+		log.Printf("events: unable to publish %s: %v", kind, err)
+	}
+}
+
+func unique(users []string) []string {
+	seen := make(map[string]bool, len(users))
+	result := make([]string, 0, len(users))
+	for _, user := range users {
+		if user != "" && !seen[user] {
+			seen[user] = true
+			result = append(result, user)
+		}
+	}
+	return result
+}
@@ -0,0 +1,43 @@
+package events
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestPublish(t *testing.T) {
+	bus := NewLocal()
+	previous := DefaultBus
+	DefaultBus = bus
+	t.Cleanup(func() { DefaultBus = previous })
+	alice, _ := bus.Subscribe("alice")
+	bob, _ := bus.Subscribe("bob")
+
+	Publish(CommentCreated, map[string]int{"id": 3}, "alice", "", "bob", "alice")
+	for name, events := range map[string]<-chan Event{"alice": alice, "bob": bob} {
+		got, _ := received(events)
+		if len(got) != 1 {
+			t.Fatalf("%s got %d events, want one", name, len(got))
+		}
+		if string(got[0].Data) != `{"id":3}` || !reflect.DeepEqual(got[0].Users, []string{"alice", "bob"}) || got[0].Time.IsZero() {
+			t.Errorf("%s got %+v", name, got[0])
+		}
+	}
+
+	// Nobody to tell, and data that can't be sent, publish nothing
+	Publish(CommentDeleted, 3, "")
+	Publish(CommentDeleted, func() {}, "alice")
+	if got, _ := received(alice); len(got) != 0 {
+		t.Errorf("got %+v, want nothing", got)
+	}
+}
+
+func TestUnique(t *testing.T) {
+	got := unique([]string{"b", "a", "", "b", "c", "a"})
+	if want := []string{"b", "a", "c"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if got := unique(nil); got == nil || len(got) != 0 {
+		t.Errorf("got %#v, want an empty list", got)
+	}
+}
@@ -0,0 +1,84 @@
+package events
+
+import (
+	"context"
+	"sync"
+)
+
+// bufferSize How many events a stream may fall behind before it is dropped
+const bufferSize = 64
+
+type subscriber struct {
+	events chan Event
+	closed bool
+}
+
+// Local Delivers events to the streams open on this server only
+type Local struct {
+	mu          sync.Mutex
+	subscribers map[string]map[*subscriber]bool
+}
+
+func NewLocal() *Local {
+	return &Local{subscribers: make(map[string]map[*subscriber]bool)}
+}
+
+func (l *Local) Publish(_ context.Context, event Event) error {
+	l.deliver(event)
+	return nil
+}
+
+// deliver Never waits on a slow stream, one that has a full buffer is closed
+// instead so it reconnects and catches up
+func (l *Local) deliver(event Event) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, user := range event.Users {
+		for sub := range l.subscribers[user] {
+			select {
+			case sub.events <- event:
+			default:
+				l.remove(user, sub)
+			}
+		}
+	}
+}
+
+func (l *Local) Subscribe(userID string) (<-chan Event, func()) {
+	sub := &subscriber{events: make(chan Event, bufferSize)}
+	l.mu.Lock()
+	if l.subscribers[userID] == nil {
+		l.subscribers[userID] = make(map[*subscriber]bool)
+	}
+	l.subscribers[userID][sub] = true
+	l.mu.Unlock()
+
+	return sub.events, func() {
+		l.mu.Lock()
+		l.remove(userID, sub)
+		l.mu.Unlock()
+	}
+}
+
+// remove Must be called with mu held
+func (l *Local) remove(userID string, sub *subscriber) {
+	if sub.closed {
+		return
+	}
+	sub.closed = true
+	close(sub.events)
+	delete(l.subscribers[userID], sub)
+	if len(l.subscribers[userID]) == 0 {
+		delete(l.subscribers, userID)
+	}
+}
+
+func (l *Local) closeAll() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for user, subs := range l.subscribers {
+		for sub := range subs {
+			l.remove(user, sub)
+		}
+	}
+}
@@ -0,0 +1,92 @@
+package events
+
+import (
+	"context"
+	"testing"
+)
+
+// received The events waiting in events, and whether it was closed
+func received(events <-chan Event) (got []Event, closed bool) {
+	for {
+		select {
+		case event, ok := <-events:
+			if !ok {
+				return got, true
+			}
+			got = append(got, event)
+		default:
+			return got, false
+		}
+	}
+}
+
+func TestLocalFanOut(t *testing.T) {
+	bus := NewLocal()
+	first, unsubscribeFirst := bus.Subscribe("alice")
+	second, _ := bus.Subscribe("alice")
+	bob, _ := bus.Subscribe("bob")
+	carol, _ := bus.Subscribe("carol")
+
+	if err := bus.Publish(context.Background(), Event{Type: TransactionCreated, Users: []string{"alice", "bob"}}); err != nil {
+		t.Fatal(err)
+	}
+	for name, events := range map[string]<-chan Event{"alice's first stream": first, "alice's second stream": second, "bob": bob} {
+		if got, closed := received(events); len(got) != 1 || got[0].Type != TransactionCreated || closed {
+			t.Errorf("%s got %v, closed %v, want the event", name, got, closed)
+		}
+	}
+	if got, _ := received(carol); len(got) != 0 {
+		t.Errorf("carol got %v, the event wasn't for her", got)
+	}
+
+	unsubscribeFirst()
+	unsubscribeFirst()
+	_ = bus.Publish(context.Background(), Event{Type: TransactionDeleted, Users: []string{"alice"}})
+	if got, closed := received(first); len(got) != 0 || !closed {
+		t.Errorf("a stream that unsubscribed got %v, closed %v", got, closed)
+	}
+	if got, _ := received(second); len(got) != 1 || got[0].Type != TransactionDeleted {
+		t.Errorf("the other stream got %v, want the event", got)
+	}
+}
+
+// TestLocalDropsSlowSubscriber A stream that stops reading is closed once its
+// buffer is full, without holding up anyone else
+func TestLocalDropsSlowSubscriber(t *testing.T) {
+	bus := NewLocal()
+	slow, unsubscribeSlow := bus.Subscribe("alice")
+	fast, _ := bus.Subscribe("alice")
+
+	var fastGot int
+	for i := 0; i <= bufferSize; i++ {
+		_ = bus.Publish(context.Background(), Event{Type: CommentCreated, Users: []string{"alice"}})
+		got, _ := received(fast)
+		fastGot += len(got)
+	}
+	if fastGot != bufferSize+1 {
+		t.Errorf("the stream that keeps up got %d events, want %d", fastGot, bufferSize+1)
+	}
+	if got, closed := received(slow); len(got) != bufferSize || !closed {
+		t.Errorf("the slow stream got %d events, closed %v, want %d and closed", len(got), closed, bufferSize)
+	}
+
+	// Unsubscribing after being dropped is fine, and later events still arrive
+	unsubscribeSlow()
+	_ = bus.Publish(context.Background(), Event{Type: CommentDeleted, Users: []string{"alice"}})
+	if got, closed := received(fast); len(got) != 1 || closed {
+		t.Errorf("the stream that keeps up got %v, closed %v", got, closed)
+	}
+}
+
+func TestLocalCloseAll(t *testing.T) {
+	bus := NewLocal()
+	alice, _ := bus.Subscribe("alice")
+	bob, unsubscribeBob := bus.Subscribe("bob")
+	bus.closeAll()
+	unsubscribeBob()
+	for _, events := range []<-chan Event{alice, bob} {
+		if _, closed := received(events); !closed {
+			t.Error("a stream is still open")
+		}
+	}
+}
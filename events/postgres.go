@@ -0,0 +1,92 @@
+package events
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"github.com/lib/pq"
+	"log"
+	"time"
+)
+
+const (
+	channel = "events"
+	// maxPayload NOTIFY payloads must be shorter than 8000 bytes
+	maxPayload = 7900
+)
+
+// Postgres Sends events through NOTIFY so every server instance listening on
+// the same database hands them to its own streams
+type Postgres struct {
+	db       *sql.DB
+	listener *pq.Listener
+	local    *Local
+}
+
+func NewPostgres(url string) (*Postgres, error) {
+	db, err := sql.Open("postgres", url)
+	if err != nil {
+		return nil, err
+	}
+	listener := pq.NewListener(url, time.Second, time.Minute, func(event pq.ListenerEventType, err error) {
+		if err != nil {
+			log.Printf("events: listener: %v", err)
+		}
+	})
+	if err = listener.Listen(channel); err != nil {
+		_ = listener.Close()
+		_ = db.Close()
+		return nil, err
+	}
+	p := &Postgres{db: db, listener: listener, local: NewLocal()}
+	go p.listen()
+	return p, nil
+}
+
+// Publish The event comes back to this instance through its own listener,
+// like it does on every other one
+func (p *Postgres) Publish(ctx context.Context, event Event) error {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	if len(payload) > maxPayload {
+		event.Data = nil
+		event.Truncated = true
+		if payload, err = json.Marshal(event); err != nil {
+			return err
+		}
+	}
+	_, err = p.db.ExecContext(ctx, "SELECT pg_notify($1, $2)", channel, string(payload))
+	return err
+}
+
+func (p *Postgres) Subscribe(userID string) (<-chan Event, func()) {
+	return p.local.Subscribe(userID)
+}
+
+func (p *Postgres) listen() {
+	for notification := range p.listener.Notify {
+		// A nil notification means the connection was re-established, events
+		// sent in between are lost so every stream is closed to make its
+		// client reconnect and catch up
+		if notification == nil {
+			p.local.closeAll()
+			continue
+		}
+		var event Event
+		if err := json.Unmarshal([]byte(notification.Extra), &event); err != nil {
+			log.Printf("events: unable to decode notification: %v", err)
+			continue
+		}
+		p.local.deliver(event)
+	}
+}
+
+func (p *Postgres) Close() error {
+	err := p.listener.Close()
+	if dbErr := p.db.Close(); err == nil {
+		err = dbErr
+	}
+	return err
+}
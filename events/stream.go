@@ -0,0 +1,68 @@
+package events
+
+import (
+	"github.com/gin-gonic/gin"
+	"how-much-do-i-owe/database"
+	"io"
+	"time"
+)
+
+const (
+	// heartbeat Often enough that proxies don't close an idle stream
+	heartbeat = 25 * time.Second
+	// maxStream Streams are closed after this long so the client reconnects
+	// and its session is checked again
+	maxStream = 30 * time.Minute
+)
+
+// Routes All the routes created by the package nested in
+// api/v1/*
+func Routes(r *gin.RouterGroup, db *database.DB) {
+	r.GET("/events", stream())
+}
+
+// stream Server-sent events for everything that changes for the user. Each
+// message is named after the event type and carries its data as JSON.
+func stream() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.GetString("UserID")
+		events, unsubscribe := DefaultBus.Subscribe(userID)
+		defer unsubscribe()
+
+		c.Header("Content-Type", "text/event-stream")
+		c.Header("Cache-Control", "no-cache")
+		c.Header("Connection", "keep-alive")
+		// Stops nginx and the like from buffering the stream
+		c.Header("X-Accel-Buffering", "no")
+		c.Status(200)
+		// Tells the client how long to wait before reconnecting
+		_, _ = io.WriteString(c.Writer, "retry: 3000\n\n")
+		c.Writer.Flush()
+
+		ticker := time.NewTicker(heartbeat)
+		defer ticker.Stop()
+		deadline := time.NewTimer(maxStream)
+		defer deadline.Stop()
+		c.Stream(func(w io.Writer) bool {
+			select {
+			case event, open := <-events:
+				if !open {
+					return false
+				}
+				if event.Truncated {
+					c.SSEvent(event.Type, gin.H{"truncated": true})
+				} else {
+					c.SSEvent(event.Type, event.Data)
+				}
+				return true
+			case <-ticker.C:
+				_, _ = io.WriteString(w, ": heartbeat\n\n")
+				return true
+			case <-deadline.C:
+				return false
+			case <-c.Request.Context().Done():
+				return false
+			}
+		})
+	}
+}
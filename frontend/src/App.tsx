@@ -1,15 +1,23 @@
 import React, {useEffect, useState} from 'react';
 import './app.scss';
 import CreateTransaction from "./hooks/CreateTransaction";
+import {csrfHeaders} from "./csrf";
 
 function App() {
     const [user, setUser] = useState<string | null>(null)
     const [loadingContacts, setLoadingContacts] = useState<boolean>(false)
     const [contacts, setContacts] = useState<any | null>(null)
+    const [contactRequests, setContactRequests] = useState<any[] | null>(null)
     const [transactions, setTransactions] = useState<any | null>(null)
     const [loadingTransactions, setLoadingTransactions] = useState<boolean>(false)
+    const [notifications, setNotifications] = useState<any[]>([])
 
+    const [providers, setProviders] = useState<string[]>(["google"])
     const [error, setError] = useState<string | null>(null)
+    const [loginEmail, setLoginEmail] = useState<string>("")
+    const [loginEmailSent, setLoginEmailSent] = useState<string | null>(null)
+    const [inviteEmail, setInviteEmail] = useState<string>("")
+    const [inviteSent, setInviteSent] = useState<string | null>(null)
 
     useEffect(() => {
         // Refresh session every 10 minutes
@@ -20,6 +28,19 @@ function App() {
             setUser(JSON.parse(localStorage.getItem("user") || ""))
         });
 
+        //Fetch the ways a user can log in
+        fetch("/oauth/v1/providers")
+            .then((res) => {
+                if (res.ok) {
+                    return res.json()
+                }
+            })
+            .then((result) => {
+                if (result) {
+                    setProviders(result)
+                }
+            })
+
         //Fetch user from api
         fetch("/oauth/v1/account")
             .then((res) => {
@@ -31,6 +52,10 @@ function App() {
                 (result) => {
                     setUser(result);
                     localStorage.setItem("user", JSON.stringify(result))
+                    // Sessions from before CSRF tokens existed get one here
+                    if (result) {
+                        fetch("/oauth/v1/csrf")
+                    }
                 }, (error) => {
                     setUser(null)
                     localStorage.removeItem("user")
@@ -39,6 +64,102 @@ function App() {
             )
     }, [])
 
+    useEffect(() => {
+        if (!user) {
+            return
+        }
+        // Keep what's on screen up to date with changes made by other people.
+        // EventSource reconnects by itself when the stream is closed.
+        const stream = new EventSource("/api/v1/events")
+        for (const type of ["transaction.created", "transaction.updated", "transaction.deleted", "settlement.created"]) {
+            stream.addEventListener(type, () => getTransactions())
+        }
+        for (const type of ["contact-request.created", "contact-request.updated"]) {
+            stream.addEventListener(type, () => {
+                getContacts()
+                getContactRequests()
+            })
+        }
+        stream.addEventListener("notification.created", () => getNotifications())
+        getNotifications()
+        return () => stream.close()
+    }, [user])
+
+    useEffect(() => {
+        // Slack and Discord commands send people who haven't linked their
+        // chat account here with a chat-link code
+        const params = new URLSearchParams(window.location.search)
+        const code = params.get("chat-link")
+        if (!user || !code) {
+            return
+        }
+        window.history.replaceState(null, "", window.location.pathname)
+        // Links can be forwarded, so show whose chat account it is first
+        fetch("/api/v1/chat-account/preview?code=" + encodeURIComponent(code))
+            .then((res) => res.json().then((preview) => {
+                if (!res.ok) {
+                    setError(preview)
+                    return
+                }
+                const where = preview.provider === "slack"
+                    ? `the Slack workspace ${preview.teamName || preview.teamId}`
+                    : "Discord"
+                if (!window.confirm(`Link ${preview.chatName} on ${where} to your account? Their commands will act as you.`)) {
+                    return
+                }
+                return fetch("/api/v1/chat-account", {
+                    method: "PUT",
+                    headers: {"Content-Type": "application/json", ...csrfHeaders()},
+                    body: JSON.stringify({code})
+                })
+                    .then((res) => res.json().then((result) => {
+                        if (!res.ok) {
+                            setError(result)
+                        }
+                    }))
+            }))
+    }, [user])
+
+    useEffect(() => {
+        // Invitation emails link here with the invitation's token. Nothing
+        // happens until the user has seen what accepting it brings.
+        const params = new URLSearchParams(window.location.search)
+        const token = params.get("invitation")
+        if (!user || !token) {
+            return
+        }
+        window.history.replaceState(null, "", window.location.pathname)
+        fetch("/oauth/v1/invitation/preview?token=" + encodeURIComponent(token))
+            .then((res) => res.json().then((preview) => {
+                if (!res.ok) {
+                    setError(preview)
+                    return
+                }
+                let question = `Accept the invitation from ${preview.inviter} (${preview.inviterEmail}) to ${preview.email}?`
+                if (preview.ghost && preview.claimsGhost) {
+                    question += ` Their placeholder "${preview.ghost}" and its transactions become yours, with a balance of ${preview.balance.toFixed(2)} owed to them.`
+                } else if (preview.ghost) {
+                    question += ` Their placeholder "${preview.ghost}" stays with them, since your account doesn't have a verified login for ${preview.email}.`
+                }
+                if (!window.confirm(question)) {
+                    return
+                }
+                return fetch("/oauth/v1/invitation", {
+                    method: "POST",
+                    headers: {"Content-Type": "application/json", ...csrfHeaders()},
+                    body: JSON.stringify({token})
+                })
+                    .then((res) => res.json().then((result) => {
+                        if (!res.ok) {
+                            setError(result)
+                            return
+                        }
+                        getContacts()
+                        getContactRequests()
+                    }))
+            }))
+    }, [user])
+
     function refreshSession() {
         fetch("/oauth/v1/refresh")
             .then((res) => {
@@ -48,6 +169,21 @@ function App() {
             })
     }
 
+    function requestLoginEmail(e: React.FormEvent) {
+        e.preventDefault()
+        fetch("/oauth/v1/email", {
+            method: "PUT",
+            headers: {"Content-Type": "application/json", ...csrfHeaders()},
+            body: JSON.stringify({email: loginEmail})
+        })
+            .then((res) => res.json())
+            .then((result) => {
+                setLoginEmailSent(result)
+            }, (error) => {
+                setError(error);
+            })
+    }
+
     function getContacts() {
         setLoadingContacts(true)
         fetch("/api/v1/contacts")
@@ -66,6 +202,84 @@ function App() {
                 }
             )
     }
+    function getContactRequests() {
+        fetch("/api/v1/contact-requests")
+            .then((res) => {
+                if (res.ok) {
+                    return res.json()
+                }
+            })
+            .then(
+                (result) => {
+                    setContactRequests(result)
+                }, (error) => {
+                    setContactRequests(null)
+                    setError(error);
+                }
+            )
+    }
+
+    function answerContactRequest(id: number, method: string, action: string) {
+        fetch("/api/v1/contact-request/" + id + action, {
+            method: method,
+            headers: csrfHeaders()
+        })
+            .then((res) => {
+                if (res.ok) {
+                    getContacts()
+                    getContactRequests()
+                }
+            })
+    }
+
+    function invite(e: React.FormEvent) {
+        e.preventDefault()
+        fetch("/api/v1/invitation", {
+            method: "PUT",
+            headers: {"Content-Type": "application/json", ...csrfHeaders()},
+            body: JSON.stringify({email: inviteEmail})
+        })
+            .then((res) => res.json())
+            .then((result) => {
+                if (result.contactRequest) {
+                    setInviteSent("Contact request sent to " + result.contactRequest.name)
+                    getContactRequests()
+                } else if (result.invitation) {
+                    setInviteSent("Invitation emailed to " + result.invitation.email)
+                } else {
+                    setInviteSent(result)
+                }
+            }, (error) => {
+                setError(error);
+            })
+    }
+
+    function getNotifications() {
+        fetch("/api/v1/notifications?unread=true")
+            .then((res) => {
+                if (res.ok) {
+                    return res.json()
+                }
+            })
+            .then((result) => {
+                if (result) {
+                    setNotifications(result)
+                }
+            })
+    }
+
+    function markNotificationRead(id: number) {
+        fetch("/api/v1/notification/" + id + "/read", {
+            method: "PUT",
+            headers: csrfHeaders()
+        })
+            .then((res) => {
+                if (res.ok) {
+                    getNotifications()
+                }
+            })
+    }
+
     function getTransactions() {
         setLoadingContacts(true)
         fetch("/api/v1/transactions")
@@ -92,16 +306,33 @@ function App() {
                         {contacts != null && Object.keys(contacts).map((key) => {
                             return (
                                 <div key={key}>
-                                    <div>{contacts[key].name}</div>
+                                    <div>{contacts[key].name}{contacts[key].ghost && " (not signed up)"}</div>
                                     <div>{contacts[key].email}</div>
-                                    {contacts[key].sent && contacts[key].received && (
-                                        <div>FRIENDS!</div>
-                                    )}
-                                    {contacts[key].sent && !contacts[key].received && (
-                                        <div>Waiting for response</div>
-                                    )}
-                                    {!contacts[key].sent && contacts[key].received && (
-                                        <div>Respond to contact request</div>
+                                </div>
+                            )
+                        })}
+                        {contactRequests != null && contactRequests.map((request: any) => {
+                            return (
+                                <div key={request.id}>
+                                    <div>{request.name}</div>
+                                    <div>{request.email}</div>
+                                    <div>{new Date(request.createdAt).toLocaleString()}</div>
+                                    {request.direction === "incoming" ? (
+                                        <div>
+                                            <button onClick={() => answerContactRequest(request.id, "PUT", "/accept")}>
+                                                Accept
+                                            </button>
+                                            <button onClick={() => answerContactRequest(request.id, "PUT", "/decline")}>
+                                                Decline
+                                            </button>
+                                        </div>
+                                    ) : (
+                                        <div>
+                                            Waiting for response
+                                            <button onClick={() => answerContactRequest(request.id, "DELETE", "")}>
+                                                Cancel
+                                            </button>
+                                        </div>
                                     )}
                                 </div>
                             )
@@ -113,8 +344,30 @@ function App() {
                                 </div>
                             )
                         })}
+                        <form onSubmit={invite}>
+                            <input type="email" placeholder="Friend's email address" value={inviteEmail}
+                                   onChange={(e) => setInviteEmail(e.target.value)}/>
+                            <button type="submit">Add contact</button>
+                        </form>
+                        {inviteSent && (
+                            <div>{inviteSent}</div>
+                        )}
+                        {notifications.map((notification: any) => {
+                            return (
+                                <div key={notification.id}>
+                                    <div>{notification.title}</div>
+                                    <div>{notification.body}</div>
+                                    <button onClick={() => markNotificationRead(notification.id)}>
+                                        Mark read
+                                    </button>
+                                </div>
+                            )
+                        })}
                         <CreateTransaction contacts={contacts}/>
-                        <button onClick={() => getContacts()}>
+                        <button onClick={() => {
+                            getContacts()
+                            getContactRequests()
+                        }}>
                             Get Contacts!
                         </button>
                         <button onClick={() => getTransactions()}>
@@ -128,12 +381,21 @@ function App() {
                     <h2>
                         A digital ledger to keep track of how much your friends owe you.
                     </h2>
-                    <label className="spotify-login-button">
-                        <a href={"./oauth/v1/login"}>
-                            <img src={"/Spotify_Icon_RGB_White.png"}/>
-                            Login with Google
-                        </a>
-                    </label>
+                    {providers.map((provider) => (
+                        <label className="spotify-login-button" key={provider}>
+                            <a href={"./oauth/v1/login/" + provider}>
+                                Login with {provider === "github" ? "GitHub" : provider.charAt(0).toUpperCase() + provider.slice(1)}
+                            </a>
+                        </label>
+                    ))}
+                    <form onSubmit={requestLoginEmail}>
+                        <input type="email" placeholder="Email address" value={loginEmail}
+                               onChange={(e) => setLoginEmail(e.target.value)}/>
+                        <button type="submit">Email me a login link</button>
+                    </form>
+                    {loginEmailSent && (
+                        <div>{loginEmailSent}</div>
+                    )}
                 </div>
             )}
         </div>
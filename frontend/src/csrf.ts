@@ -0,0 +1,6 @@
+// The server rejects requests that change something unless they carry the
+// session's CSRF token, which it leaves in the csrf_token cookie at login
+export function csrfHeaders(): Record<string, string> {
+    const match = document.cookie.match(/(?:^|;\s*)csrf_token=([^;]*)/)
+    return match ? {"X-CSRF-Token": decodeURIComponent(match[1])} : {}
+}
@@ -1,17 +1,12 @@
 import React, {useEffect, useReducer, useState} from 'react';
 import Select from "react-dropdown-select";
+import {csrfHeaders} from "../csrf";
 
 export default function CreateTransaction(props: any) {
     const [submittingForm, setSubmittingForm] = useState<boolean>(false)
     const [error, setError] = useState<string | null>(null)
-    const [options, setOptions] = useState<any>([{
-        id: 1,
-        name: "Leanne Graham"
-        },
-        {
-            id:  2,
-            name: "Ervin Howell"
-        }])
+    const [options, setOptions] = useState<any[]>([])
+    const [query, setQuery] = useState<string>("")
     const [transaction, updateTransaction] = useReducer((prev: any, next: any) => {
         const newTrans = {...prev, ...next}
         const decimalRegex = new RegExp('^\\d+(\.)\\d{0,2}$')
@@ -29,20 +24,48 @@ export default function CreateTransaction(props: any) {
         participants: [],
         timestamp: Date.now()
     })
+    // Ask the server for matching contacts and groups, waiting for a pause in typing
     useEffect(() => {
-        console.log(props.contacts)
-        let opts = Object.keys(props.contacts).map((key) => {
-            if(props.contacts[key].sent && props.contacts[key].received){
-                return {id: key, name: props.contacts[key].name}
-            }
-        })
-        setOptions(opts)
-    }, [props.contacts])
+        const timeout = setTimeout(() => {
+            fetch("/api/v1/search?limit=10&q=" + encodeURIComponent(query))
+                .then((res) => {
+                    if (res.ok) {
+                        return res.json()
+                    }
+                })
+                .then((result) => {
+                    if (result) {
+                        setOptions(result.map((r: any) => ({
+                            ...r,
+                            key: r.type + ":" + r.id,
+                            label: (r.nickname || r.name) + (r.type === "group" ? " (group)" : "")
+                        })))
+                    }
+                }, (error) => {
+                    setError(error)
+                })
+        }, 150)
+        return () => clearTimeout(timeout)
+    }, [query, props.contacts])
+
+    // Picking a group puts all its members in the transaction
+    function selectParticipants(values: any[]) {
+        const group = values.find((v) => v.type === "group")
+        if (group) {
+            updateTransaction({
+                groupId: Number(group.id),
+                participants: group.members.map((id: string) => ({id: id, key: "contact:" + id, label: id}))
+            })
+            return
+        }
+        updateTransaction({participants: values.map((v) => ({id: v.id, key: v.key, label: v.label}))})
+    }
 
     function submitForm() {
         setSubmittingForm(true)
         fetch("/api/v1/transaction", {
             method: "PUT",
+            headers: {"Content-Type": "application/json", ...csrfHeaders()},
             body: JSON.stringify(transaction)
         })
             .then((res) => {
@@ -73,9 +96,9 @@ export default function CreateTransaction(props: any) {
         <form onSubmit={(event) => event.preventDefault()}>
             <label>
                 Participants
-                <Select multi={true} values={transaction.participants} options={options} labelField="name" valueField="id" onChange={(values) => {
-                    updateTransaction({participants: values})
-                }} />
+                <input placeholder="Find people or groups" value={query} onChange={(e) => setQuery(e.target.value)}/>
+                <Select multi={true} searchable={false} values={transaction.participants} options={options}
+                        labelField="label" valueField="key" onChange={(values) => selectParticipants(values)} />
             </label>
             <label>
                 Amount
@@ -0,0 +1,46 @@
+package mail
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// LogSender Doesn't deliver anything. Messages are written to files in Dir, or
+// to the log when Dir is empty. Only meant for development, the messages
+// include whatever login links they carry, so outside of ENV=DEV only the
+// recipient and subject are logged.
+type LogSender struct {
+	Dir  string
+	From string
+}
+
+func (s *LogSender) Send(ctx context.Context, msg Message) error {
+	contents, err := format(s.From, msg)
+	if err != nil {
+		return err
+	}
+	if s.Dir == "" {
+		if os.Getenv("ENV") != "DEV" {
+			logf("to %s: %s (set ENV=DEV or MAIL_DIR to see the message)", msg.To, msg.Subject)
+			return nil
+		}
+		logf("to %s: %s\n%s", msg.To, msg.Subject, msg.Text)
+		return nil
+	}
+
+	if err = os.MkdirAll(s.Dir, 0700); err != nil {
+		return err
+	}
+	recipient := strings.NewReplacer("@", "_at_", "/", "_", "\\", "_").Replace(msg.To)
+	name := fmt.Sprintf("%s-%s.eml", time.Now().Format("20060102T150405.000000000"), recipient)
+	path := filepath.Join(s.Dir, name)
+	if err = os.WriteFile(path, contents, 0600); err != nil {
+		return err
+	}
+	logf("wrote message to %s", path)
+	return nil
+}
@@ -0,0 +1,130 @@
+package mail
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"mime"
+	"mime/multipart"
+	"net/textproto"
+	"os"
+	"time"
+)
+
+// Message An email to a single recipient. HTML is optional, when it's set
+// the message is sent with both parts so any client can show it.
+type Message struct {
+	To      string
+	Subject string
+	Text    string
+	HTML    string
+}
+
+// Sender Delivers email
+type Sender interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// DefaultSender The sender the app uses, set up by ConfigMail
+var DefaultSender Sender = &LogSender{}
+
+// ConfigMail Chooses how email is delivered based on the environment
+//
+//   - MAIL_SMTP_ADDR (host:port) sends through an SMTP server, with MAIL_FROM as
+//     the sender and optionally MAIL_SMTP_USERNAME and MAIL_SMTP_PASSWORD
+//   - MAIL_DIR writes every message to a file in that directory
+//   - otherwise messages are only written to the log, which is meant for development
+func ConfigMail() {
+	from := os.Getenv("MAIL_FROM")
+	if from == "" {
+		from = "how much do i owe? <no-reply@" + hostname() + ">"
+	}
+	switch {
+	case os.Getenv("MAIL_SMTP_ADDR") != "":
+		DefaultSender = &SMTPSender{
+			Addr:     os.Getenv("MAIL_SMTP_ADDR"),
+			From:     from,
+			Username: os.Getenv("MAIL_SMTP_USERNAME"),
+			Password: os.Getenv("MAIL_SMTP_PASSWORD"),
+		}
+		fmt.Println("Sending email through", os.Getenv("MAIL_SMTP_ADDR"))
+	case os.Getenv("MAIL_DIR") != "":
+		DefaultSender = &LogSender{Dir: os.Getenv("MAIL_DIR"), From: from}
+		fmt.Println("Writing email to", os.Getenv("MAIL_DIR"))
+	default:
+		DefaultSender = &LogSender{From: from}
+		fmt.Println("No mail server configured, email will only be logged")
+	}
+}
+
+// Send Delivers a message with DefaultSender
+func Send(ctx context.Context, msg Message) error {
+	return DefaultSender.Send(ctx, msg)
+}
+
+// Link An absolute link to path on this site, for emails
+func Link(path string) string {
+	if os.Getenv("ENV") == "DEV" {
+		return "http://localhost:5000" + path
+	}
+	return "https://" + os.Getenv("HOST") + path
+}
+
+func hostname() string {
+	if host := os.Getenv("HOST"); host != "" {
+		return host
+	}
+	return "localhost"
+}
+
+// format Renders a message as RFC 5322 text, ready for SMTP or an .eml file
+func format(from string, msg Message) ([]byte, error) {
+	var buf bytes.Buffer
+	headers := textproto.MIMEHeader{}
+	headers.Set("From", from)
+	headers.Set("To", msg.To)
+	headers.Set("Subject", mime.QEncoding.Encode("utf-8", msg.Subject))
+	headers.Set("Date", time.Now().Format(time.RFC1123Z))
+	headers.Set("MIME-Version", "1.0")
+
+	if msg.HTML == "" {
+		headers.Set("Content-Type", "text/plain; charset=utf-8")
+		writeHeaders(&buf, headers)
+		buf.WriteString(msg.Text)
+		return buf.Bytes(), nil
+	}
+
+	var body bytes.Buffer
+	parts := multipart.NewWriter(&body)
+	for _, part := range []struct{ contentType, content string }{
+		{"text/plain; charset=utf-8", msg.Text},
+		{"text/html; charset=utf-8", msg.HTML},
+	} {
+		w, err := parts.CreatePart(textproto.MIMEHeader{"Content-Type": {part.contentType}})
+		if err != nil {
+			return nil, err
+		}
+		if _, err = w.Write([]byte(part.content)); err != nil {
+			return nil, err
+		}
+	}
+	if err := parts.Close(); err != nil {
+		return nil, err
+	}
+	headers.Set("Content-Type", "multipart/alternative; boundary="+parts.Boundary())
+	writeHeaders(&buf, headers)
+	buf.Write(body.Bytes())
+	return buf.Bytes(), nil
+}
+
+func writeHeaders(buf *bytes.Buffer, headers textproto.MIMEHeader) {
+	for _, key := range []string{"From", "To", "Subject", "Date", "MIME-Version", "Content-Type"} {
+		fmt.Fprintf(buf, "%s: %s\r\n", key, headers.Get(key))
+	}
+	buf.WriteString("\r\n")
+}
+
+func logf(format string, args ...interface{}) {
+	log.Printf("mail: "+format, args...)
+}
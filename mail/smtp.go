@@ -0,0 +1,50 @@
+package mail
+
+import (
+	"context"
+	"net"
+	"net/mail"
+	"net/smtp"
+)
+
+// SMTPSender Sends through an SMTP server. STARTTLS is used when the server
+// offers it, and credentials are only sent over TLS or to localhost, which
+// makes a local SMTP sink like MailHog work without any setup.
+type SMTPSender struct {
+	// Addr host:port of the SMTP server
+	Addr     string
+	From     string
+	Username string
+	Password string
+}
+
+func (s *SMTPSender) Send(ctx context.Context, msg Message) error {
+	from, err := mail.ParseAddress(s.From)
+	if err != nil {
+		return err
+	}
+	to, err := mail.ParseAddress(msg.To)
+	if err != nil {
+		return err
+	}
+	contents, err := format(s.From, msg)
+	if err != nil {
+		return err
+	}
+
+	var auth smtp.Auth
+	if s.Username != "" {
+		host, _, err := net.SplitHostPort(s.Addr)
+		if err != nil {
+			return err
+		}
+		auth = smtp.PlainAuth("", s.Username, s.Password, host)
+	}
+
+	// smtp.SendMail doesn't take a context, so the best we can do is not start
+	// sending once it's done
+	if err = ctx.Err(); err != nil {
+		return err
+	}
+	return smtp.SendMail(s.Addr, auth, from.Address, []string{to.Address}, contents)
+}
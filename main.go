@@ -1,16 +1,39 @@
 package main
 
 import (
+	"context"
+	"fmt"
 	"github.com/gin-contrib/gzip"
 	"github.com/gin-gonic/contrib/static"
 	"github.com/gin-gonic/gin"
+	"how-much-do-i-owe/api/analytics"
+	"how-much-do-i-owe/api/budgets"
+	"how-much-do-i-owe/api/chat"
 	"how-much-do-i-owe/api/contacts"
+	"how-much-do-i-owe/api/groups"
+	"how-much-do-i-owe/api/openapi"
+	"how-much-do-i-owe/api/payments"
+	"how-much-do-i-owe/api/reminders"
+	"how-much-do-i-owe/api/search"
+	"how-much-do-i-owe/api/shares"
+	"how-much-do-i-owe/api/statements"
+	"how-much-do-i-owe/api/tokens"
 	"how-much-do-i-owe/api/transactions"
 	"how-much-do-i-owe/authentication"
 	"how-much-do-i-owe/database"
+	"how-much-do-i-owe/events"
+	"how-much-do-i-owe/mail"
+	"how-much-do-i-owe/notifications"
+	"how-much-do-i-owe/scheduler"
+	"how-much-do-i-owe/secrets"
+	"how-much-do-i-owe/webhooks"
+	"log"
 	"net/http"
 	"os"
+	"strings"
 	"time"
+	// Time zones for quiet hours work without the zoneinfo files of the host
+	_ "time/tzdata"
 )
 
 func forceSSL() gin.HandlerFunc {
@@ -26,30 +49,99 @@ func forceSSL() gin.HandlerFunc {
 
 func HasValidSession(dbConnection *database.DB) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		session, err := dbConnection.SessionStore.Get(c.Request, "session")
+		// Scripts authenticate with a personal access token instead of a cookie
+		if header := c.GetHeader("Authorization"); header != "" {
+			rawToken := strings.TrimPrefix(header, "Bearer ")
+			if rawToken == header {
+				c.AbortWithStatusJSON(401, "Authorization header must be a Bearer token")
+				return
+			}
+			userID, scope, err := tokens.Authenticate(dbConnection, rawToken)
+			if err != nil {
+				c.AbortWithStatusJSON(401, "Invalid, expired or revoked API token")
+				return
+			}
+			if !tokens.AllowsMethod(scope, c.Request.Method) {
+				c.AbortWithStatusJSON(403, "This API token is read-only")
+				return
+			}
+			c.Set("UserID", userID)
+			c.Set("AuthMethod", "token")
+			c.Next()
+			return
+		}
+
+		userID, sessionID, err := authentication.CheckSession(c, dbConnection)
+		if err == authentication.ErrNoSession {
+			c.AbortWithStatusJSON(401, "Active Session Required")
+			return
+		}
 		if err != nil {
 			c.AbortWithStatusJSON(500, "The server was unable to retrieve this session")
 			return
 		}
-		googleID := session.Values["GoogleID"]
-		c.Set("GoogleID", googleID)
+		c.Set("UserID", userID)
+		c.Set("SessionID", sessionID)
+		c.Set("AuthMethod", "session")
 		c.Next()
 	}
 }
 
+// trustedProxies The proxies in TRUSTED_PROXIES, a comma separated list of
+// addresses or CIDR ranges, e.g. "10.0.0.0/8". The client address is only
+// taken from X-Forwarded-For when a request comes through one of them, so
+// clients can't pick the address rate limits and sessions see. Without it
+// the address of the connection is used.
+func trustedProxies() []string {
+	var proxies []string
+	for _, p := range strings.Split(os.Getenv("TRUSTED_PROXIES"), ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			proxies = append(proxies, p)
+		}
+	}
+	return proxies
+}
+
 func createServer(dbConnection *database.DB) *gin.Engine {
 	r := gin.Default()
-	r.Use(gzip.Gzip(gzip.DefaultCompression))
+	if err := r.SetTrustedProxies(trustedProxies()); err != nil {
+		log.Fatal("Invalid TRUSTED_PROXIES: ", err)
+	}
+	// The event stream has to reach the client as it's written
+	r.Use(gzip.Gzip(gzip.DefaultCompression, gzip.WithExcludedPaths([]string{"/api/v1/events"})))
 	if os.Getenv("ENV") != "DEV" {
 		r.Use(forceSSL())
 	}
+	// Every route that changes something, cookie sessions need a CSRF token
+	r.Use(authentication.CSRFProtect(dbConnection))
 
 	authentication.Routes(r.Group("oauth/v1"), dbConnection)
+	openapi.Routes(r.Group("api"))
+	chat.HookRoutes(r.Group("api/v1/chat"), dbConnection)
+	shares.PublicRoutes(r.Group(""), dbConnection)
 
 	v1 := r.Group("api/v1")
 	v1.Use(HasValidSession(dbConnection))
+	authentication.AccountRoutes(v1, dbConnection)
 	transactions.Routes(v1, dbConnection)
 	contacts.Routes(v1, dbConnection)
+	groups.Routes(v1, dbConnection)
+	search.Routes(v1, dbConnection)
+	tokens.Routes(v1, dbConnection)
+	events.Routes(v1, dbConnection)
+	notifications.Routes(v1, dbConnection)
+	reminders.Routes(v1, dbConnection)
+	webhooks.Routes(v1, dbConnection)
+	chat.Routes(v1, dbConnection)
+	payments.Routes(v1, dbConnection)
+	shares.Routes(v1, dbConnection)
+	statements.Routes(v1, dbConnection)
+	analytics.Routes(v1, dbConnection)
+	budgets.Routes(v1, dbConnection)
+
+	admin := v1.Group("admin")
+	admin.Use(authentication.RequireAdmin(dbConnection))
+	authentication.AdminRoutes(admin, dbConnection)
 	r.Use(static.Serve("/", static.LocalFile("./frontend/build", true)))
 
 	return r
@@ -58,14 +150,37 @@ func createServer(dbConnection *database.DB) *gin.Engine {
 func main() {
 	database.PerformMigrations("file://database/migrations")
 	authentication.ConfigOauth()
+	mail.ConfigMail()
+	if err := secrets.ConfigKeys(); err != nil {
+		log.Fatal(err)
+	}
+	if err := events.ConfigEvents(); err != nil {
+		log.Fatal("Unable to listen for events: ", err)
+	}
+	if err := chat.ConfigChat(); err != nil {
+		log.Fatal(err)
+	}
 	db := database.InitDBConnection()
 	defer db.Close()
 
-	SStore := database.InitOauthStore()
+	SStore := database.InitOauthStore(authentication.SessionLifetime)
 	// Run a background goroutine to clean up expired sessions from the database.
 	defer SStore.StopCleanup(SStore.Cleanup(time.Minute * 5))
 	dbConnection := &database.DB{Db: db, SessionStore: SStore}
 
+	if rotated, err := authentication.RotateTokenKeys(context.Background(), dbConnection); err != nil {
+		log.Fatal("Unable to re-encrypt stored tokens: ", err)
+	} else if rotated > 0 {
+		fmt.Println("Re-encrypted the tokens of", rotated, "logins with the current key")
+	}
+	if rotated, err := webhooks.RotateKeys(context.Background(), dbConnection); err != nil {
+		log.Fatal("Unable to re-encrypt webhook secrets: ", err)
+	} else if rotated > 0 {
+		fmt.Println("Re-encrypted the secrets of", rotated, "webhooks with the current key")
+	}
+
+	defer scheduler.Start(dbConnection, notifications.Job, reminders.Job, webhooks.Job, statements.Job, budgets.Job)()
+
 	r := createServer(dbConnection)
 
 	_ = r.Run()
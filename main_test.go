@@ -0,0 +1,95 @@
+package main
+
+import (
+	"encoding/json"
+	"github.com/gin-gonic/gin"
+	"how-much-do-i-owe/api/openapi"
+	"how-much-do-i-owe/database"
+	"net/http/httptest"
+	"regexp"
+	"sort"
+	"strings"
+	"testing"
+)
+
+var pathParam = regexp.MustCompile(`:([A-Za-z_]+)`)
+
+// TestRoutesMatchOpenAPISpec Fails when a route is registered without being
+// described in api/openapi/openapi.json, or the other way around
+func TestRoutesMatchOpenAPISpec(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := createServer(&database.DB{})
+
+	routes := make(map[string]bool)
+	for _, route := range r.Routes() {
+		path := pathParam.ReplaceAllString(route.Path, "{$1}")
+		routes[route.Method+" "+path] = true
+	}
+
+	var spec struct {
+		Paths map[string]map[string]json.RawMessage `json:"paths"`
+	}
+	if err := json.Unmarshal(openapi.Spec, &spec); err != nil {
+		t.Fatalf("openapi.json is not valid JSON: %v", err)
+	}
+	documented := make(map[string]bool)
+	for path, item := range spec.Paths {
+		for method := range item {
+			if method == "parameters" {
+				continue
+			}
+			documented[strings.ToUpper(method)+" "+path] = true
+		}
+	}
+
+	var missing, stale []string
+	for route := range routes {
+		if !documented[route] {
+			missing = append(missing, route)
+		}
+	}
+	for route := range documented {
+		if !routes[route] {
+			stale = append(stale, route)
+		}
+	}
+	sort.Strings(missing)
+	sort.Strings(stale)
+	for _, route := range missing {
+		t.Errorf("route %s is not described in openapi.json", route)
+	}
+	for _, route := range stale {
+		t.Errorf("openapi.json describes %s but no such route is registered", route)
+	}
+}
+
+func TestClientIP(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	t.Setenv("ENV", "DEV")
+	tests := []struct {
+		name    string
+		proxies string
+		remote  string
+		want    string
+	}{
+		{"no proxies trusted", "", "203.0.113.7:4000", "203.0.113.7"},
+		{"from a trusted proxy", "203.0.113.0/24", "203.0.113.7:4000", "198.51.100.2"},
+		{"from an untrusted proxy", "10.0.0.0/8", "203.0.113.7:4000", "203.0.113.7"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("TRUSTED_PROXIES", tt.proxies)
+			r := createServer(&database.DB{})
+			r.GET("/client-ip", func(c *gin.Context) { c.String(200, c.ClientIP()) })
+
+			req := httptest.NewRequest("GET", "/client-ip", nil)
+			req.RemoteAddr = tt.remote
+			req.Header.Set("X-Forwarded-For", "198.51.100.2")
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+			if got := w.Body.String(); got != tt.want {
+				t.Errorf("got client IP %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,15 @@
+// Package money Converts amounts to and from cents. Shares and sums are
+// worked out in cents, so they add up without floating point errors.
+package money
+
+import "math"
+
+// ToCents An amount rounded to whole cents
+func ToCents(amount float64) int64 {
+	return int64(math.Round(amount * 100))
+}
+
+// FromCents The amount of a number of cents
+func FromCents(cents int64) float64 {
+	return float64(cents) / 100
+}
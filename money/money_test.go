@@ -0,0 +1,25 @@
+package money
+
+import "testing"
+
+func TestCents(t *testing.T) {
+	tests := []struct {
+		amount float64
+		cents  int64
+	}{
+		{0, 0},
+		{19.99, 1999},
+		// 0.29 * 100 is 28.999999999999996
+		{0.29, 29},
+		{10.004, 1000},
+		{-2.5, -250},
+	}
+	for _, tt := range tests {
+		if got := ToCents(tt.amount); got != tt.cents {
+			t.Errorf("ToCents(%v) = %d, want %d", tt.amount, got, tt.cents)
+		}
+		if got := FromCents(ToCents(tt.amount)); got != FromCents(tt.cents) {
+			t.Errorf("FromCents(%d) = %v", tt.cents, got)
+		}
+	}
+}
@@ -0,0 +1,196 @@
+package notifications
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"how-much-do-i-owe/database"
+	"how-much-do-i-owe/mail"
+	"how-much-do-i-owe/scheduler"
+	"log"
+	"strings"
+	"time"
+)
+
+// JobName The scheduler job that delivers notifications
+const JobName = "notifications"
+
+// batchSize How many notifications are claimed at once
+const batchSize = 50
+
+// Job Sends pending email, and digests that are due. Notify
+// wakes it up so nothing waits for the next tick.
+var Job = scheduler.Job{Name: JobName, Every: time.Minute, Run: deliver}
+
+func deliver(ctx context.Context, db *database.DB) error {
+	// Keep going while there are full batches left
+	for {
+		sent, err := sendEmails(ctx, db.Db)
+		if err != nil {
+			return err
+		}
+		if sent < batchSize {
+			break
+		}
+	}
+	return sendDigests(ctx, db.Db)
+}
+
+// footer Ends every email, so people know how to get fewer of them
+func footer() string {
+	return "\n\n--\nChoose which notifications you get by email in your settings: " + mail.Link("/") + "\n"
+}
+
+// sendEmails Sends a batch of notifications that were waiting for an email
+// and returns how many there were. The batch is claimed as sending first, and
+// each notification is marked on its own once its email went out or failed,
+// so a database error never sends one twice.
+func sendEmails(ctx context.Context, db *sql.DB) (int, error) {
+	queryRows, err := db.QueryContext(ctx, `UPDATE notification n SET email=$2 FROM account a
+								WHERE a.id = n.user_id AND n.id IN (
+									SELECT id FROM notification WHERE email='pending' ORDER BY id LIMIT $1 FOR UPDATE SKIP LOCKED)
+								RETURNING n.id, a.email, n.title, n.body, n.link`, batchSize, stateSending)
+	if err != nil {
+		return 0, err
+	}
+	type pending struct {
+		id                    int
+		to, title, body, link string
+	}
+	var batch []pending
+	for queryRows.Next() {
+		var p pending
+		if err = queryRows.Scan(&p.id, &p.to, &p.title, &p.body, &p.link); err != nil {
+			queryRows.Close()
+			return 0, err
+		}
+		batch = append(batch, p)
+	}
+	queryRows.Close()
+	if err = queryRows.Err(); err != nil {
+		return 0, err
+	}
+
+	for _, p := range batch {
+		state := stateSent
+		text := p.body
+		if p.link != "" {
+			text += "\n\n" + mail.Link(p.link)
+		}
+		if p.to == "" {
+			state = stateFailed
+		} else if err = mail.Send(ctx, mail.Message{To: p.to, Subject: p.title, Text: text + footer()}); err != nil {
+			log.Printf("notifications: unable to email notification %d: %v", p.id, err)
+			state = stateFailed
+		}
+		if _, err = db.ExecContext(ctx, "UPDATE notification SET email=$2 WHERE id=$1", p.id, state); err != nil {
+			return 0, err
+		}
+	}
+	return len(batch), nil
+}
+
+// sendDigests Emails every user whose digest is due all the notifications
+// collected for it. When a user turned their digest off, what was collected
+// is sent right away.
+func sendDigests(ctx context.Context, db *sql.DB) error {
+	queryRows, err := db.QueryContext(ctx, `SELECT s.user_id FROM notification_setting s
+			WHERE EXISTS(SELECT 1 FROM notification n WHERE n.user_id = s.user_id AND n.email='digest')
+			  AND (s.digest = '' OR COALESCE(s.last_digest_at,
+			      (SELECT min(created_at) FROM notification n WHERE n.user_id = s.user_id AND n.email='digest'))
+			      + CASE s.digest WHEN 'weekly' THEN interval '7 days' ELSE interval '1 day' END <= now())`)
+	if err != nil {
+		return err
+	}
+	var users []string
+	for queryRows.Next() {
+		var user string
+		if err = queryRows.Scan(&user); err != nil {
+			queryRows.Close()
+			return err
+		}
+		users = append(users, user)
+	}
+	queryRows.Close()
+	if err = queryRows.Err(); err != nil {
+		return err
+	}
+
+	for _, user := range users {
+		if err = sendDigest(ctx, db, user); err != nil {
+			// The notifications stay collected and go out with the next try
+			log.Printf("notifications: unable to send the digest of %s: %v", user, err)
+		}
+	}
+	return nil
+}
+
+func sendDigest(ctx context.Context, db *sql.DB, userID string) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var to, digest string
+	err = tx.QueryRowContext(ctx, `SELECT a.email, s.digest FROM notification_setting s JOIN account a ON a.id = s.user_id
+										WHERE s.user_id=$1 FOR UPDATE OF s`, userID).Scan(&to, &digest)
+	if err != nil {
+		return err
+	}
+	queryRows, err := tx.QueryContext(ctx, `SELECT id, title, body, created_at FROM notification
+								WHERE user_id=$1 AND email='digest' ORDER BY id FOR UPDATE`, userID)
+	if err != nil {
+		return err
+	}
+	var ids []int
+	var text strings.Builder
+	for queryRows.Next() {
+		var id int
+		var title, body string
+		var createdAt time.Time
+		if err = queryRows.Scan(&id, &title, &body, &createdAt); err != nil {
+			queryRows.Close()
+			return err
+		}
+		ids = append(ids, id)
+		fmt.Fprintf(&text, "%s  %s\n", createdAt.UTC().Format("Jan 2 15:04"), title)
+		if body != "" {
+			fmt.Fprintf(&text, "    %s\n", body)
+		}
+	}
+	queryRows.Close()
+	if err = queryRows.Err(); err != nil {
+		return err
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+
+	state := stateSent
+	if to == "" {
+		state = stateFailed
+	} else {
+		period := "daily"
+		if digest == digestWeekly {
+			period = "weekly"
+		}
+		err = mail.Send(ctx, mail.Message{
+			To:      to,
+			Subject: fmt.Sprintf("Your %s summary: %d new notifications", period, len(ids)),
+			Text:    "Here's what happened on how much do i owe?\n\n" + text.String() + "\n" + mail.Link("/") + footer(),
+		})
+		if err != nil {
+			return err
+		}
+	}
+	for _, id := range ids {
+		if _, err = tx.ExecContext(ctx, "UPDATE notification SET email=$2 WHERE id=$1", id, state); err != nil {
+			return err
+		}
+	}
+	if _, err = tx.ExecContext(ctx, "UPDATE notification_setting SET last_digest_at=now() WHERE user_id=$1", userID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
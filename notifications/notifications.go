@@ -0,0 +1,254 @@
+package notifications
+
+import (
+	"database/sql"
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+	"how-much-do-i-owe/database"
+	"how-much-do-i-owe/events"
+	"how-much-do-i-owe/mail"
+	"how-much-do-i-owe/scheduler"
+	"how-much-do-i-owe/webhooks"
+	"log"
+	"strconv"
+	"time"
+)
+
+// Types of notification. Users choose the channels for each of them.
+// ShareDisputed and RecurringPosted can be configured already, but nothing
+// sends them until shares can be disputed and expenses can recur.
+const (
+	TransactionAdded   = "transaction.added"
+	ShareDisputed      = "share.disputed"
+	SettlementReceived = "settlement.received"
+	ContactRequest     = "contact.request"
+	RecurringPosted    = "recurring.posted"
+	PaymentReminder    = "payment.reminder"
+	BudgetAlert        = "budget.alert"
+)
+
+// Types Every type of notification, in the order they are shown in preferences
+var Types = []string{TransactionAdded, ShareDisputed, SettlementReceived, ContactRequest, RecurringPosted, PaymentReminder, BudgetAlert}
+
+// Delivery states of the email and webhook channels of a notification
+const (
+	stateOff     = ""
+	statePending = "pending"
+	stateDigest  = "digest"
+	stateSending = "sending"
+	stateSent    = "sent"
+	stateFailed  = "failed"
+
+	defaultLimit = 50
+	maxLimit     = 200
+)
+
+// Notification Something a user is told about. Link is a path in the app that
+// shows what it's about.
+type Notification struct {
+	ID        int        `json:"id"`
+	UserID    string     `json:"-"`
+	Type      string     `json:"type"`
+	Title     string     `json:"title"`
+	Body      string     `json:"body"`
+	Link      string     `json:"link"`
+	CreatedAt time.Time  `json:"createdAt"`
+	ReadAt    *time.Time `json:"readAt"`
+}
+
+// Routes All the routes created by the package nested in
+// api/v1/*
+func Routes(r *gin.RouterGroup, db *database.DB) {
+	r.GET("/notifications", getNotifications(db))
+	r.PUT("/notifications/read", markAllRead(db))
+	r.PUT("/notification/:id/read", markRead(db))
+	r.GET("/notification-preferences", getPreferences(db))
+	r.PATCH("/notification-preferences", updatePreferences(db))
+}
+
+// Notify Records a notification for n.UserID through the channels they chose
+// for its type. Email is delivered in the background by Job, and the webhook
+// channel by the user's webhooks that subscribe to notification.created.
+// Like events, notifications never fail the request that caused them, so
+// errors are only logged.
+func Notify(db database.Querier, n Notification) {
+	announce, err := notify(db, &n)
+	if err != nil {
+		log.Printf("notifications: unable to record %s for %s: %v", n.Type, n.UserID, err)
+		return
+	}
+	announce()
+}
+
+// Record Like Notify, but returns the error, for callers that record what the
+// notification is about in the same transaction and mustn't keep one without
+// the other. Call announce once the transaction is committed, it tells the
+// user's open pages and wakes the email job, which mustn't happen for a
+// notification that's rolled back.
+func Record(db database.Querier, n Notification) (announce func(), err error) {
+	return notify(db, &n)
+}
+
+// notify Stores n, and returns what tells everyone about it once it's
+// committed
+func notify(db database.Querier, n *Notification) (func(), error) {
+	nothing := func() {}
+	var ghost, hasEmail, inbox, email, webhook bool
+	var digest string
+	err := db.QueryRow(`SELECT EXISTS(SELECT 1 FROM ghost WHERE id=a.id), a.email <> '',
+       			COALESCE(p.inbox, true), COALESCE(p.email, true), COALESCE(p.webhook, false),
+       			COALESCE(s.digest, '')
+			FROM account a
+			LEFT JOIN notification_preference p ON p.user_id = a.id AND p.type=$2
+			LEFT JOIN notification_setting s ON s.user_id = a.id
+			WHERE a.id=$1`, n.UserID, n.Type).Scan(&ghost, &hasEmail, &inbox, &email, &webhook, &digest)
+	// Placeholders can't log in or read email
+	if err == sql.ErrNoRows || ghost {
+		return nothing, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	emailState, webhookState := stateOff, stateOff
+	if email && hasEmail {
+		emailState = statePending
+		if digest != "" {
+			emailState = stateDigest
+		}
+	}
+	if webhook {
+		webhookState = stateSent
+	}
+	if !inbox && emailState == stateOff && webhookState == stateOff {
+		return nothing, nil
+	}
+
+	err = db.QueryRow(`INSERT INTO notification (user_id, type, title, body, link, inbox, email, webhook)
+							VALUES ($1, $2, $3, $4, $5, $6, $7, $8) RETURNING id, created_at`,
+		n.UserID, n.Type, n.Title, n.Body, n.Link, inbox, emailState, webhookState).Scan(&n.ID, &n.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	if webhook {
+		if err = webhooks.Enqueue(db, webhooks.NotificationCreated, newWebhookPayload(*n), n.UserID); err != nil {
+			return nil, err
+		}
+	}
+	created := *n
+	return func() {
+		if inbox {
+			events.Publish(events.NotificationCreated, created, created.UserID)
+		}
+		if emailState == statePending {
+			scheduler.Wake(JobName)
+		}
+	}, nil
+}
+
+// webhookPayload The data of the notification.created event the webhook
+// channel sends, with the link made absolute
+type webhookPayload struct {
+	ID        int       `json:"id"`
+	Type      string    `json:"type"`
+	Title     string    `json:"title"`
+	Body      string    `json:"body"`
+	Link      string    `json:"link"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+func newWebhookPayload(n Notification) webhookPayload {
+	p := webhookPayload{ID: n.ID, Type: n.Type, Title: n.Title, Body: n.Body, CreatedAt: n.CreatedAt}
+	if n.Link != "" {
+		p.Link = mail.Link(n.Link)
+	}
+	return p
+}
+
+// getNotifications The user's inbox, newest first. Pages further back start
+// before the ID of the last notification of the previous page.
+func getNotifications(db *database.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.GetString("UserID")
+		limit := defaultLimit
+		if c.Query("limit") != "" {
+			var err error
+			if limit, err = strconv.Atoi(c.Query("limit")); err != nil || limit < 1 {
+				c.JSON(400, "limit must be a positive number")
+				return
+			}
+			if limit > maxLimit {
+				limit = maxLimit
+			}
+		}
+		var before *int
+		if c.Query("before") != "" {
+			id, err := strconv.Atoi(c.Query("before"))
+			if err != nil {
+				c.JSON(400, "Invalid notification ID")
+				return
+			}
+			before = &id
+		}
+		unread := c.Query("unread") == "true"
+
+		queryRows, err := db.Db.Query(`SELECT id, type, title, body, link, created_at, read_at FROM notification
+				WHERE user_id=$1 AND inbox AND ($2::integer IS NULL OR id < $2) AND (NOT $3 OR read_at IS NULL)
+				ORDER BY id DESC LIMIT $4`, userID, before, unread, limit)
+		if err != nil {
+			database.CheckDBErr(err.(*pq.Error), c)
+			return
+		}
+		defer queryRows.Close()
+
+		notifications := []Notification{}
+		for queryRows.Next() {
+			var n Notification
+			err = queryRows.Scan(&n.ID, &n.Type, &n.Title, &n.Body, &n.Link, &n.CreatedAt, &n.ReadAt)
+			if err != nil {
+				c.AbortWithStatusJSON(500, "The server was unable to get notifications")
+				return
+			}
+			notifications = append(notifications, n)
+		}
+
+		c.JSON(200, notifications)
+	}
+}
+
+func markRead(db *database.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.JSON(400, "Invalid notification ID")
+			return
+		}
+		result, err := db.Db.Exec("UPDATE notification SET read_at=COALESCE(read_at, now()) WHERE id=$1 AND user_id=$2 AND inbox",
+			id, c.GetString("UserID"))
+		if err != nil {
+			database.CheckDBErr(err.(*pq.Error), c)
+			return
+		}
+		if found, _ := result.RowsAffected(); found == 0 {
+			c.AbortWithStatusJSON(404, "Notification not found")
+			return
+		}
+
+		c.JSON(201, "Notification marked read")
+	}
+}
+
+// markAllRead Responds with how many notifications were unread
+func markAllRead(db *database.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		result, err := db.Db.Exec("UPDATE notification SET read_at=now() WHERE user_id=$1 AND inbox AND read_at IS NULL",
+			c.GetString("UserID"))
+		if err != nil {
+			database.CheckDBErr(err.(*pq.Error), c)
+			return
+		}
+		read, _ := result.RowsAffected()
+
+		c.JSON(201, read)
+	}
+}
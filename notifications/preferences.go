@@ -0,0 +1,160 @@
+package notifications
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+	"how-much-do-i-owe/database"
+	"net/http"
+	"time"
+)
+
+const (
+	digestOff    = ""
+	digestDaily  = "daily"
+	digestWeekly = "weekly"
+)
+
+// preference The channels a user wants for one type of notification
+type preference struct {
+	Type    string `json:"type"`
+	Inbox   bool   `json:"inbox"`
+	Email   bool   `json:"email"`
+	Webhook bool   `json:"webhook"`
+}
+
+// preferences How a user is notified. Digest is daily, weekly or empty to
+// send every email straight away. Notifications sent to the webhook go to the
+// user's webhooks that subscribe to notification.created, signed like every
+// webhook delivery. TimeZone is an IANA name like Europe/Paris, reminders
+// keep to quiet hours in it.
+type preferences struct {
+	Digest   string       `json:"digest"`
+	TimeZone string       `json:"timeZone"`
+	Types    []preference `json:"types"`
+}
+
+// preferencesUpdate Null fields are left unchanged, and so are the types that
+// aren't listed
+type preferencesUpdate struct {
+	Digest   *string      `json:"digest"`
+	TimeZone *string      `json:"timeZone"`
+	Types    []preference `json:"types"`
+}
+
+func loadPreferences(db database.Querier, userID string) (preferences, error) {
+	prefs := preferences{Types: []preference{}}
+	err := db.QueryRow(`SELECT COALESCE(max(digest), ''), COALESCE(max(time_zone), 'UTC')
+							FROM notification_setting WHERE user_id=$1`,
+		userID).Scan(&prefs.Digest, &prefs.TimeZone)
+	if err != nil {
+		return prefs, err
+	}
+
+	chosen := make(map[string]preference)
+	queryRows, err := db.Query("SELECT type, inbox, email, webhook FROM notification_preference WHERE user_id=$1", userID)
+	if err != nil {
+		return prefs, err
+	}
+	defer queryRows.Close()
+	for queryRows.Next() {
+		var p preference
+		if err = queryRows.Scan(&p.Type, &p.Inbox, &p.Email, &p.Webhook); err != nil {
+			return prefs, err
+		}
+		chosen[p.Type] = p
+	}
+	for _, kind := range Types {
+		p, ok := chosen[kind]
+		if !ok {
+			p = preference{Type: kind, Inbox: true, Email: true}
+		}
+		prefs.Types = append(prefs.Types, p)
+	}
+	return prefs, queryRows.Err()
+}
+
+func getPreferences(db *database.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		prefs, err := loadPreferences(db.Db, c.GetString("UserID"))
+		if err != nil {
+			database.CheckDBErr(err.(*pq.Error), c)
+			return
+		}
+		c.JSON(200, prefs)
+	}
+}
+
+func knownType(kind string) bool {
+	for _, t := range Types {
+		if t == kind {
+			return true
+		}
+	}
+	return false
+}
+
+func updatePreferences(db *database.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.GetString("UserID")
+		var req preferencesUpdate
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if req.Digest != nil && *req.Digest != digestOff && *req.Digest != digestDaily && *req.Digest != digestWeekly {
+			c.JSON(http.StatusBadRequest, "digest must be daily, weekly or empty")
+			return
+		}
+		if req.TimeZone != nil {
+			if _, err := time.LoadLocation(*req.TimeZone); err != nil || *req.TimeZone == "" || *req.TimeZone == "Local" {
+				c.JSON(http.StatusBadRequest, "timeZone must be an IANA time zone like Europe/Paris")
+				return
+			}
+		}
+		for _, p := range req.Types {
+			if !knownType(p.Type) {
+				c.JSON(http.StatusBadRequest, "Unknown notification type "+p.Type)
+				return
+			}
+		}
+
+		tx, err := db.Db.Begin()
+		if err != nil {
+			database.CheckDBErr(err.(*pq.Error), c)
+			return
+		}
+		defer tx.Rollback()
+
+		if req.Digest != nil || req.TimeZone != nil {
+			_, err = tx.Exec(`INSERT INTO notification_setting (user_id, digest, time_zone)
+									VALUES ($1, COALESCE($2, ''), COALESCE($3, 'UTC'))
+									ON CONFLICT (user_id) DO UPDATE SET digest = COALESCE($2, notification_setting.digest),
+									    time_zone = COALESCE($3, notification_setting.time_zone)`,
+				userID, req.Digest, req.TimeZone)
+			if err != nil {
+				database.CheckDBErr(err.(*pq.Error), c)
+				return
+			}
+		}
+		for _, p := range req.Types {
+			_, err = tx.Exec(`INSERT INTO notification_preference (user_id, type, inbox, email, webhook) VALUES ($1, $2, $3, $4, $5)
+									ON CONFLICT (user_id, type) DO UPDATE SET inbox=$3, email=$4, webhook=$5`,
+				userID, p.Type, p.Inbox, p.Email, p.Webhook)
+			if err != nil {
+				database.CheckDBErr(err.(*pq.Error), c)
+				return
+			}
+		}
+		prefs, err := loadPreferences(tx, userID)
+		if err != nil {
+			database.CheckDBErr(err.(*pq.Error), c)
+			return
+		}
+		if err = tx.Commit(); err != nil {
+			database.CheckDBErr(err.(*pq.Error), c)
+			return
+		}
+
+		c.JSON(200, prefs)
+	}
+}
@@ -0,0 +1,188 @@
+// Package pdf Writes simple PDF documents: pages of text in Helvetica and
+// straight lines, which is all statements need. Text is encoded as
+// WinAnsiEncoding, characters it doesn't have are written as ?.
+package pdf
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// A4 page size and margins, in points
+const (
+	PageWidth  = 595.0
+	PageHeight = 842.0
+	Margin     = 50.0
+)
+
+// Document A PDF being drawn. Positions are in points from the top left of
+// the page, like on screen.
+type Document struct {
+	title string
+	pages []*bytes.Buffer
+}
+
+// New A document with one empty page
+func New(title string) *Document {
+	d := &Document{title: title}
+	d.AddPage()
+	return d
+}
+
+// AddPage Starts a new page, everything is drawn on the last one
+func (d *Document) AddPage() {
+	d.pages = append(d.pages, &bytes.Buffer{})
+}
+
+func (d *Document) page() *bytes.Buffer {
+	return d.pages[len(d.pages)-1]
+}
+
+func font(bold bool) string {
+	if bold {
+		return "F2"
+	}
+	return "F1"
+}
+
+// Text Draws s with its baseline at x, y
+func (d *Document) Text(x, y, size float64, bold bool, s string) {
+	fmt.Fprintf(d.page(), "BT /%s %s Tf %s %s Td (%s) Tj ET\n", font(bold), num(size), num(x), num(PageHeight-y), escape(s))
+}
+
+// TextRight Draws s so it ends at x, for columns of amounts
+func (d *Document) TextRight(x, y, size float64, bold bool, s string) {
+	d.Text(x-Width(s, size, bold), y, size, bold, s)
+}
+
+// Line Draws a thin line from x1, y1 to x2, y2
+func (d *Document) Line(x1, y1, x2, y2 float64) {
+	fmt.Fprintf(d.page(), "0.5 w %s %s m %s %s l S\n", num(x1), num(PageHeight-y1), num(x2), num(PageHeight-y2))
+}
+
+// Width How wide s is in points when drawn at size
+func Width(s string, size float64, bold bool) float64 {
+	widths := &helvetica
+	if bold {
+		widths = &helveticaBold
+	}
+	var total int
+	for _, b := range encode(s) {
+		if b >= 32 && b <= 126 {
+			total += widths[b-32]
+		} else {
+			total += 556
+		}
+	}
+	return float64(total) * size / 1000
+}
+
+// Truncate Cuts s short with ... so it's at most width points wide
+func Truncate(s string, width, size float64, bold bool) string {
+	if Width(s, size, bold) <= width {
+		return s
+	}
+	runes := []rune(s)
+	for len(runes) > 0 && Width(string(runes)+"...", size, bold) > width {
+		runes = runes[:len(runes)-1]
+	}
+	return string(runes) + "..."
+}
+
+// Bytes The finished document
+func (d *Document) Bytes() []byte {
+	var out bytes.Buffer
+	var offsets []int
+	object := func(body string) {
+		offsets = append(offsets, out.Len())
+		fmt.Fprintf(&out, "%d 0 obj\n%s\nendobj\n", len(offsets), body)
+	}
+
+	// Objects 1 to 4 are the catalog, the page tree, the fonts, and 5 the
+	// document information. Each page is followed by its content.
+	out.WriteString("%PDF-1.4\n%\xe2\xe3\xcf\xd3\n")
+	kids := make([]string, len(d.pages))
+	for i := range d.pages {
+		kids[i] = fmt.Sprintf("%d 0 R", 6+2*i)
+	}
+	object("<< /Type /Catalog /Pages 2 0 R >>")
+	object(fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(d.pages)))
+	object("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding /WinAnsiEncoding >>")
+	object("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica-Bold /Encoding /WinAnsiEncoding >>")
+	object(fmt.Sprintf("<< /Title (%s) /Producer (how much do i owe?) >>", escape(d.title)))
+	for i, content := range d.pages {
+		object(fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %s %s] "+
+			"/Resources << /Font << /F1 3 0 R /F2 4 0 R >> >> /Contents %d 0 R >>", num(PageWidth), num(PageHeight), 7+2*i))
+		object(fmt.Sprintf("<< /Length %d >>\nstream\n%sendstream", content.Len(), content.String()))
+	}
+
+	xref := out.Len()
+	fmt.Fprintf(&out, "xref\n0 %d\n0000000000 65535 f \n", len(offsets)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&out, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&out, "trailer\n<< /Size %d /Root 1 0 R /Info 5 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(offsets)+1, xref)
+	return out.Bytes()
+}
+
+func num(f float64) string {
+	return strings.TrimRight(strings.TrimRight(fmt.Sprintf("%.2f", f), "0"), ".")
+}
+
+// encode s in WinAnsiEncoding, which matches Latin-1 for the characters
+// statements use
+func encode(s string) []byte {
+	out := make([]byte, 0, len(s))
+	for _, r := range s {
+		switch {
+		case r == '€':
+			out = append(out, 0x80)
+		case r == '–' || r == '—':
+			out = append(out, '-')
+		case r == '’' || r == '‘':
+			out = append(out, '\'')
+		case r == '·':
+			out = append(out, 0xB7)
+		case r >= 32 && r <= 126, r >= 0xA0 && r <= 0xFF:
+			out = append(out, byte(r))
+		default:
+			out = append(out, '?')
+		}
+	}
+	return out
+}
+
+// escape s as the contents of a PDF string
+func escape(s string) string {
+	var out strings.Builder
+	for _, b := range encode(s) {
+		switch b {
+		case '\\', '(', ')':
+			out.WriteByte('\\')
+			out.WriteByte(b)
+		default:
+			out.WriteByte(b)
+		}
+	}
+	return out.String()
+}
+
+// Widths of the printable ASCII characters from space to ~, in thousandths
+// of the font size, from the Adobe font metrics
+var (
+	helvetica = [95]int{
+		278, 278, 355, 556, 556, 889, 667, 191, 333, 333, 389, 584, 278, 333, 278, 278,
+		556, 556, 556, 556, 556, 556, 556, 556, 556, 556, 278, 278, 584, 584, 584, 556,
+		1015, 667, 667, 722, 722, 667, 611, 778, 722, 278, 500, 667, 556, 833, 722, 778,
+		667, 778, 722, 667, 611, 722, 667, 944, 667, 667, 611, 278, 278, 278, 469, 556,
+		333, 556, 556, 500, 556, 556, 278, 556, 556, 222, 222, 500, 222, 833, 556, 556,
+		556, 556, 333, 500, 278, 556, 500, 722, 500, 500, 500, 334, 260, 334, 584}
+	helveticaBold = [95]int{
+		278, 333, 474, 556, 556, 889, 722, 238, 333, 333, 389, 584, 278, 333, 278, 278,
+		556, 556, 556, 556, 556, 556, 556, 556, 556, 556, 333, 333, 584, 584, 584, 611,
+		975, 722, 722, 722, 722, 667, 611, 778, 722, 278, 556, 722, 611, 833, 722, 778,
+		667, 778, 722, 667, 611, 722, 667, 944, 667, 667, 611, 333, 278, 333, 584, 556,
+		333, 556, 611, 556, 611, 556, 333, 611, 611, 278, 278, 556, 278, 889, 611, 611,
+		611, 611, 389, 556, 333, 611, 556, 778, 556, 556, 500, 389, 280, 389, 584}
+)
@@ -0,0 +1,71 @@
+package pdf
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strconv"
+	"testing"
+)
+
+func TestXref(t *testing.T) {
+	d := New("Statement (March)")
+	d.Text(Margin, 80, 12, true, "Groceries € 12.50")
+	d.AddPage()
+	d.TextRight(PageWidth-Margin, 80, 10, false, "a) b\\ c")
+	d.Line(Margin, 90, PageWidth-Margin, 90)
+	out := d.Bytes()
+
+	startxref := regexp.MustCompile(`startxref\n(\d+)\n%%EOF\n$`).FindSubmatch(out)
+	if startxref == nil {
+		t.Fatal("no startxref at the end")
+	}
+	xref, _ := strconv.Atoi(string(startxref[1]))
+	if !bytes.HasPrefix(out[xref:], []byte("xref\n0 10\n")) {
+		t.Fatalf("startxref %d doesn't point at an xref with 10 entries", xref)
+	}
+	entries := regexp.MustCompile(`(\d{10}) 00000 n \n`).FindAllSubmatch(out[xref:], -1)
+	if len(entries) != 9 {
+		t.Fatalf("got %d objects in the xref, want 9", len(entries))
+	}
+	for i, entry := range entries {
+		offset, _ := strconv.Atoi(string(entry[1]))
+		if want := fmt.Sprintf("%d 0 obj\n", i+1); !bytes.HasPrefix(out[offset:], []byte(want)) {
+			t.Errorf("object %d isn't at offset %d", i+1, offset)
+		}
+	}
+	for _, want := range []string{"/Title (Statement \\(March\\))", "(Groceries \x80 12.50) Tj", "(a\\) b\\\\ c) Tj", "/Count 2"} {
+		if !bytes.Contains(out, []byte(want)) {
+			t.Errorf("the document doesn't contain %q", want)
+		}
+	}
+}
+
+func TestStreamLength(t *testing.T) {
+	d := New("")
+	d.Text(Margin, Margin, 10, false, "Hello")
+	out := d.Bytes()
+	m := regexp.MustCompile(`(?s)/Length (\d+) >>\nstream\n(.*?)endstream`).FindSubmatch(out)
+	if m == nil {
+		t.Fatal("no content stream")
+	}
+	if n, _ := strconv.Atoi(string(m[1])); n != len(m[2]) {
+		t.Errorf("the stream is %d bytes but its length says %d", len(m[2]), n)
+	}
+}
+
+func TestWidth(t *testing.T) {
+	if w := Width("Hi", 10, false); w != 9.44 {
+		t.Errorf("Hi is %v points wide, want 9.44", w)
+	}
+	if w := Width("Hi", 10, true); w != 10 {
+		t.Errorf("Hi in bold is %v points wide, want 10", w)
+	}
+	s := Truncate("A rather long description of dinner", 60, 10, false)
+	if Width(s, 10, false) > 60 || s[len(s)-3:] != "..." {
+		t.Errorf("%q wasn't truncated to 60 points", s)
+	}
+	if Truncate("Short", 60, 10, false) != "Short" {
+		t.Error("short text shouldn't be truncated")
+	}
+}
@@ -0,0 +1,503 @@
+// Package qr Encodes text as a QR code (ISO/IEC 18004) and draws it as a PNG
+// or SVG. Text is always encoded in byte mode with the medium error
+// correction level, which is what payment apps expect of the links and EPC
+// payloads they scan.
+package qr
+
+import (
+	"errors"
+)
+
+// ErrTooLong The text doesn't fit in the largest QR code
+var ErrTooLong = errors.New("qr: the text is too long for a QR code")
+
+// Error correction of level M, per version starting at 1: the error
+// correction codewords in every block and the number of blocks
+var (
+	eccPerBlock = [41]int{-1,
+		10, 16, 26, 18, 24, 16, 18, 22, 22, 26, 30, 22, 22, 24, 24, 28, 28, 26, 26, 26,
+		26, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28}
+	eccBlocks = [41]int{-1,
+		1, 1, 1, 2, 2, 4, 4, 4, 5, 5, 5, 8, 9, 9, 10, 10, 11, 13, 14, 16,
+		17, 17, 18, 20, 21, 23, 25, 26, 28, 29, 31, 33, 35, 37, 38, 40, 43, 45, 47, 49}
+)
+
+const (
+	// levelM The format bits of the medium error correction level
+	levelM = 0
+	// byteMode The mode indicator of byte mode
+	byteMode = 0x4
+	// quietZone The light border around a code, in modules
+	quietZone = 4
+)
+
+// Code A QR code, Size modules wide and high
+type Code struct {
+	Size     int
+	version  int
+	mask     int
+	modules  [][]bool
+	function [][]bool
+}
+
+// Encode The smallest QR code that holds text
+func Encode(text string) (*Code, error) {
+	data := []byte(text)
+	version := 1
+	for ; version <= 40; version++ {
+		if 4+countBits(version)+8*len(data) <= 8*dataCodewords(version) {
+			break
+		}
+	}
+	if version > 40 {
+		return nil, ErrTooLong
+	}
+
+	var bits bitBuffer
+	bits.append(byteMode, 4)
+	bits.append(len(data), countBits(version))
+	for _, b := range data {
+		bits.append(int(b), 8)
+	}
+	capacity := 8 * dataCodewords(version)
+	terminator := capacity - len(bits)
+	if terminator > 4 {
+		terminator = 4
+	}
+	bits.append(0, terminator)
+	bits.append(0, (8-len(bits)%8)%8)
+	for pad := 0xEC; len(bits) < capacity; pad ^= 0xEC ^ 0x11 {
+		bits.append(pad, 8)
+	}
+
+	c := &Code{Size: 4*version + 17, version: version}
+	c.modules = grid(c.Size)
+	c.function = grid(c.Size)
+	c.drawFunctionPatterns()
+	c.drawCodewords(c.interleave(bits.bytes()))
+
+	// The mask with the lowest penalty is kept, it makes the code easiest to read
+	best, lowest := 0, -1
+	for mask := 0; mask < 8; mask++ {
+		c.applyMask(mask)
+		c.drawFormatBits(mask)
+		if penalty := c.penalty(); lowest < 0 || penalty < lowest {
+			best, lowest = mask, penalty
+		}
+		c.applyMask(mask)
+	}
+	c.applyMask(best)
+	c.drawFormatBits(best)
+	c.mask = best
+	return c, nil
+}
+
+// Dark If the module at column x and row y is dark
+func (c *Code) Dark(x, y int) bool {
+	return x >= 0 && y >= 0 && x < c.Size && y < c.Size && c.modules[y][x]
+}
+
+func grid(size int) [][]bool {
+	g := make([][]bool, size)
+	for i := range g {
+		g[i] = make([]bool, size)
+	}
+	return g
+}
+
+// countBits How many bits the length of byte mode data takes
+func countBits(version int) int {
+	if version < 10 {
+		return 8
+	}
+	return 16
+}
+
+// rawModules The modules of a version that hold data and error correction,
+// everything but the function patterns and format and version information
+func rawModules(version int) int {
+	n := (16*version+128)*version + 64
+	if version >= 2 {
+		align := version/7 + 2
+		n -= (25*align-10)*align - 55
+		if version >= 7 {
+			n -= 36
+		}
+	}
+	return n
+}
+
+// dataCodewords How many bytes of data a version holds
+func dataCodewords(version int) int {
+	return rawModules(version)/8 - eccPerBlock[version]*eccBlocks[version]
+}
+
+// alignmentPositions The rows and columns alignment patterns are centred on
+func alignmentPositions(version int) []int {
+	if version == 1 {
+		return nil
+	}
+	count := version/7 + 2
+	step := 26
+	if version != 32 {
+		step = (version*4 + count*2 + 1) / (count*2 - 2) * 2
+	}
+	positions := make([]int, count)
+	positions[0] = 6
+	for i, pos := count-1, 4*version+17-7; i >= 1; i, pos = i-1, pos-step {
+		positions[i] = pos
+	}
+	return positions
+}
+
+func (c *Code) set(x, y int, dark bool) {
+	c.modules[y][x] = dark
+	c.function[y][x] = true
+}
+
+func (c *Code) drawFunctionPatterns() {
+	for i := 0; i < c.Size; i++ {
+		c.set(6, i, i%2 == 0)
+		c.set(i, 6, i%2 == 0)
+	}
+	c.drawFinder(3, 3)
+	c.drawFinder(c.Size-4, 3)
+	c.drawFinder(3, c.Size-4)
+
+	positions := alignmentPositions(c.version)
+	last := len(positions) - 1
+	for i, x := range positions {
+		for j, y := range positions {
+			// The corners with finder patterns have no alignment pattern
+			if (i == 0 && j == 0) || (i == 0 && j == last) || (i == last && j == 0) {
+				continue
+			}
+			c.drawAlignment(x, y)
+		}
+	}
+
+	// Reserve the format bits, they're drawn once the mask is chosen
+	c.drawFormatBits(0)
+	c.drawVersion()
+}
+
+// drawFinder Draws a finder pattern centred on x, y with its light separator
+func (c *Code) drawFinder(x, y int) {
+	for dy := -4; dy <= 4; dy++ {
+		for dx := -4; dx <= 4; dx++ {
+			xx, yy := x+dx, y+dy
+			if xx < 0 || yy < 0 || xx >= c.Size || yy >= c.Size {
+				continue
+			}
+			dist := max(abs(dx), abs(dy))
+			c.set(xx, yy, dist != 2 && dist != 4)
+		}
+	}
+}
+
+func (c *Code) drawAlignment(x, y int) {
+	for dy := -2; dy <= 2; dy++ {
+		for dx := -2; dx <= 2; dx++ {
+			c.set(x+dx, y+dy, max(abs(dx), abs(dy)) != 1)
+		}
+	}
+}
+
+// formatBits The error correction level and mask with their BCH code
+func formatBits(mask int) int {
+	data := levelM<<3 | mask
+	rem := data
+	for i := 0; i < 10; i++ {
+		rem = (rem << 1) ^ ((rem >> 9) * 0x537)
+	}
+	return (data<<10 | rem) ^ 0x5412
+}
+
+// versionBits The version with its BCH code, only versions 7 and up have it
+func versionBits(version int) int {
+	rem := version
+	for i := 0; i < 12; i++ {
+		rem = (rem << 1) ^ ((rem >> 11) * 0x1F25)
+	}
+	return version<<12 | rem
+}
+
+func bit(x, i int) bool {
+	return (x>>uint(i))&1 != 0
+}
+
+func (c *Code) drawFormatBits(mask int) {
+	bits := formatBits(mask)
+	// Next to the top left finder
+	for i := 0; i <= 5; i++ {
+		c.set(8, i, bit(bits, i))
+	}
+	c.set(8, 7, bit(bits, 6))
+	c.set(8, 8, bit(bits, 7))
+	c.set(7, 8, bit(bits, 8))
+	for i := 9; i < 15; i++ {
+		c.set(14-i, 8, bit(bits, i))
+	}
+	// Next to the other two
+	for i := 0; i < 8; i++ {
+		c.set(c.Size-1-i, 8, bit(bits, i))
+	}
+	for i := 8; i < 15; i++ {
+		c.set(8, c.Size-15+i, bit(bits, i))
+	}
+	c.set(8, c.Size-8, true)
+}
+
+func (c *Code) drawVersion() {
+	if c.version < 7 {
+		return
+	}
+	bits := versionBits(c.version)
+	for i := 0; i < 18; i++ {
+		a, b := c.Size-11+i%3, i/3
+		c.set(a, b, bit(bits, i))
+		c.set(b, a, bit(bits, i))
+	}
+}
+
+// interleave Splits data into blocks, adds the error correction of each and
+// interleaves them in the order they're drawn
+func (c *Code) interleave(data []byte) []byte {
+	blocks, ecc := eccBlocks[c.version], eccPerBlock[c.version]
+	raw := rawModules(c.version) / 8
+	short := blocks - raw%blocks
+	shortLen := raw / blocks
+	divisor := rsDivisor(ecc)
+
+	all := make([][]byte, blocks)
+	k := 0
+	for i := range all {
+		n := shortLen - ecc
+		if i >= short {
+			n++
+		}
+		block := append([]byte(nil), data[k:k+n]...)
+		k += n
+		remainder := rsRemainder(block, divisor)
+		if i < short {
+			// Short blocks are padded so every block is the same length
+			block = append(block, 0)
+		}
+		all[i] = append(block, remainder...)
+	}
+
+	result := make([]byte, 0, raw)
+	for i := range all[0] {
+		for j, block := range all {
+			if i != shortLen-ecc || j >= short {
+				result = append(result, block[i])
+			}
+		}
+	}
+	return result
+}
+
+// drawCodewords Draws data in the zigzag of two columns wide strips from the
+// bottom right, skipping function patterns
+func (c *Code) drawCodewords(data []byte) {
+	i := 0
+	for right := c.Size - 1; right >= 1; right -= 2 {
+		if right == 6 {
+			// The vertical timing pattern
+			right = 5
+		}
+		upward := (right+1)&2 == 0
+		for vert := 0; vert < c.Size; vert++ {
+			for j := 0; j < 2; j++ {
+				x, y := right-j, vert
+				if upward {
+					y = c.Size - 1 - vert
+				}
+				if !c.function[y][x] && i < len(data)*8 {
+					c.modules[y][x] = bit(int(data[i>>3]), 7-i&7)
+					i++
+				}
+			}
+		}
+	}
+}
+
+// applyMask Inverts the data modules the mask selects, applying it twice
+// undoes it
+func (c *Code) applyMask(mask int) {
+	for y := 0; y < c.Size; y++ {
+		for x := 0; x < c.Size; x++ {
+			var invert bool
+			switch mask {
+			case 0:
+				invert = (x+y)%2 == 0
+			case 1:
+				invert = y%2 == 0
+			case 2:
+				invert = x%3 == 0
+			case 3:
+				invert = (x+y)%3 == 0
+			case 4:
+				invert = (x/3+y/2)%2 == 0
+			case 5:
+				invert = x*y%2+x*y%3 == 0
+			case 6:
+				invert = (x*y%2+x*y%3)%2 == 0
+			case 7:
+				invert = ((x+y)%2+x*y%3)%2 == 0
+			}
+			if invert && !c.function[y][x] {
+				c.modules[y][x] = !c.modules[y][x]
+			}
+		}
+	}
+}
+
+// finderLike Dark, light, dark, dark, dark, light, dark with four light
+// modules on one side, which readers could take for a finder pattern
+var finderLike = [][]bool{
+	{true, false, true, true, true, false, true, false, false, false, false},
+	{false, false, false, false, true, false, true, true, true, false, true},
+}
+
+// penalty How hard the code is to read, by the four rules of the standard
+func (c *Code) penalty() int {
+	penalty := 0
+	line := make([]bool, c.Size)
+	for _, vertical := range []bool{false, true} {
+		for a := 0; a < c.Size; a++ {
+			for b := range line {
+				if vertical {
+					line[b] = c.modules[b][a]
+				} else {
+					line[b] = c.modules[a][b]
+				}
+			}
+			// Runs of five or more modules of the same colour
+			run := 1
+			for b := 1; b <= c.Size; b++ {
+				if b < c.Size && line[b] == line[b-1] {
+					run++
+					continue
+				}
+				if run >= 5 {
+					penalty += run - 2
+				}
+				run = 1
+			}
+			// Patterns that look like finders
+			for b := 0; b+len(finderLike[0]) <= c.Size; b++ {
+				for _, pattern := range finderLike {
+					matches := true
+					for k, dark := range pattern {
+						if line[b+k] != dark {
+							matches = false
+							break
+						}
+					}
+					if matches {
+						penalty += 40
+					}
+				}
+			}
+		}
+	}
+
+	// Two by two blocks of the same colour
+	dark := 0
+	for y := 0; y < c.Size; y++ {
+		for x := 0; x < c.Size; x++ {
+			if c.modules[y][x] {
+				dark++
+			}
+			if x > 0 && y > 0 {
+				m := c.modules[y][x]
+				if m == c.modules[y-1][x] && m == c.modules[y][x-1] && m == c.modules[y-1][x-1] {
+					penalty += 3
+				}
+			}
+		}
+	}
+
+	// How far the share of dark modules is from half, in steps of 5%
+	total := c.Size * c.Size
+	penalty += abs(dark*20-total*10) / total * 10
+	return penalty
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
+
+func max(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+// bitBuffer Bits, most significant first
+type bitBuffer []bool
+
+func (b *bitBuffer) append(value int, n int) {
+	for i := n - 1; i >= 0; i-- {
+		*b = append(*b, bit(value, i))
+	}
+}
+
+func (b bitBuffer) bytes() []byte {
+	result := make([]byte, len(b)/8)
+	for i, set := range b {
+		if set {
+			result[i>>3] |= 1 << uint(7-i&7)
+		}
+	}
+	return result
+}
+
+// rsDivisor The generator polynomial of Reed-Solomon codes with degree
+// error correction codewords, highest coefficient left out
+func rsDivisor(degree int) []byte {
+	result := make([]byte, degree)
+	result[degree-1] = 1
+	root := byte(1)
+	for i := 0; i < degree; i++ {
+		for j := range result {
+			result[j] = gfMultiply(result[j], root)
+			if j+1 < degree {
+				result[j] ^= result[j+1]
+			}
+		}
+		root = gfMultiply(root, 0x02)
+	}
+	return result
+}
+
+// rsRemainder The error correction codewords of data
+func rsRemainder(data []byte, divisor []byte) []byte {
+	result := make([]byte, len(divisor))
+	for _, b := range data {
+		factor := b ^ result[0]
+		copy(result, result[1:])
+		result[len(result)-1] = 0
+		for i, d := range divisor {
+			result[i] ^= gfMultiply(d, factor)
+		}
+	}
+	return result
+}
+
+// gfMultiply Multiplies in GF(2^8) modulo x^8 + x^4 + x^3 + x^2 + 1
+func gfMultiply(x, y byte) byte {
+	var z int
+	for i := 7; i >= 0; i-- {
+		z = (z << 1) ^ ((z >> 7) * 0x11D)
+		if bit(int(y), i) {
+			z ^= int(x)
+		}
+	}
+	return byte(z)
+}
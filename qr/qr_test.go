@@ -0,0 +1,169 @@
+package qr
+
+import (
+	"bytes"
+	"how-much-do-i-owe/qr/qrtest"
+	"image/png"
+	"strings"
+	"testing"
+)
+
+func TestCapacity(t *testing.T) {
+	// Data codewords of level M from the standard
+	tests := map[int]int{1: 16, 2: 28, 7: 124, 10: 216, 13: 334, 20: 669, 32: 1541, 40: 2334}
+	for version, want := range tests {
+		if got := dataCodewords(version); got != want {
+			t.Errorf("version %d holds %d codewords, want %d", version, got, want)
+		}
+	}
+}
+
+func TestFormatAndVersionBits(t *testing.T) {
+	if got := formatBits(0); got != 0b101010000010010 {
+		t.Errorf("format bits of mask 0 are %015b", got)
+	}
+	if got := formatBits(7); got != 0b100101010100000 {
+		t.Errorf("format bits of mask 7 are %015b", got)
+	}
+	if got := versionBits(7); got != 0b000111110010010100 {
+		t.Errorf("version bits of version 7 are %018b", got)
+	}
+}
+
+// TestErrorCorrection Every block of codewords is a multiple of the
+// generator polynomial, so it evaluates to zero at each of its roots
+func TestErrorCorrection(t *testing.T) {
+	data := []byte("BCD\n002\n1\nSCT\nBFSWDE33BER\nAlice Example\nDE89370400440532013000\nEUR24.5")
+	for _, degree := range []int{10, 18, 28} {
+		codeword := append(append([]byte(nil), data...), rsRemainder(data, rsDivisor(degree))...)
+		root := byte(1)
+		for i := 0; i < degree; i++ {
+			var value byte
+			for _, b := range codeword {
+				value = gfMultiply(value, root) ^ b
+			}
+			if value != 0 {
+				t.Errorf("degree %d: the codeword isn't zero at root %d", degree, i)
+			}
+			root = gfMultiply(root, 0x02)
+		}
+	}
+}
+
+func TestEncode(t *testing.T) {
+	tests := []struct {
+		text    string
+		version int
+	}{
+		{"", 1},
+		{"https://paypal.me", 2},
+		{"https://venmo.com/alice?txn=pay&amount=12.50&note=how+much+do+i+owe", 5},
+		{strings.Repeat("x", 2331), 40},
+	}
+	for _, test := range tests {
+		c, err := Encode(test.text)
+		if err != nil {
+			t.Fatalf("%d bytes: %v", len(test.text), err)
+		}
+		if c.version != test.version || c.Size != 4*test.version+17 {
+			t.Errorf("%d bytes went in version %d, want %d", len(test.text), c.version, test.version)
+		}
+		// The top left finder pattern and the dark module are always there
+		if !c.Dark(0, 0) || !c.Dark(6, 6) || c.Dark(7, 7) || !c.Dark(8, c.Size-8) {
+			t.Errorf("%d bytes: the function patterns are missing", len(test.text))
+		}
+	}
+	if _, err := Encode(strings.Repeat("x", 2332)); err != ErrTooLong {
+		t.Errorf("text that doesn't fit should fail, got %v", err)
+	}
+}
+
+func TestImages(t *testing.T) {
+	c, err := Encode("upi://pay?pa=alice@upi&am=10.00&cu=INR")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := c.PNG(4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	img, err := png.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if width := (c.Size + 8) * 4; img.Bounds().Dx() != width {
+		t.Errorf("the image is %d pixels wide, want %d", img.Bounds().Dx(), width)
+	}
+	if r, _, _, _ := img.At(16, 16).RGBA(); r != 0 {
+		t.Error("the corner of the finder pattern should be black")
+	}
+	if !strings.HasPrefix(c.SVG(), "<svg") || !strings.Contains(c.SVG(), "M4,4h1v1h-1z") {
+		t.Error("the SVG is missing the finder pattern")
+	}
+}
+
+// decodePNG Reads back the PNG of c drawn at scale
+func decodePNG(t *testing.T, c *Code, scale int) string {
+	t.Helper()
+	data, err := c.PNG(scale)
+	if err != nil {
+		t.Fatal(err)
+	}
+	img, err := png.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	text, err := qrtest.Decode(img)
+	if err != nil {
+		t.Fatalf("version %d with mask %d: %v", c.version, c.mask, err)
+	}
+	return text
+}
+
+// roundTrips Texts of every version the encoder picks for a few kinds of
+// data: with one block and with many, with and without version information
+// and with both lengths of character count
+var roundTrips = []string{
+	"",
+	"BCD\n002\n1\nSCT\nBFSWDE33BER\nAlice Example\nDE89370400440532013000\nEUR24.50\n\n\nhow much do i owe: Dinner",
+	"upi://pay?pa=alice%40upi&pn=Alice%20Example&am=1500.00&cu=INR&tn=how%20much%20do%20i%20owe%3A%20Rent",
+	"Zoë, Łukasz und Jürgen schulden 12,50 € für 🍕",
+	strings.Repeat("how much do i owe? ", 8),
+	strings.Repeat("0123456789", 22),
+	strings.Repeat("ab", 200),
+	strings.Repeat("x", 2331),
+}
+
+func TestRoundTrip(t *testing.T) {
+	for _, text := range roundTrips {
+		c, err := Encode(text)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, scale := range []int{1, 8} {
+			if got := decodePNG(t, c, scale); got != text {
+				t.Errorf("version %d at scale %d reads %q, want %q", c.version, scale, got, text)
+			}
+		}
+	}
+}
+
+// TestRoundTripEveryMask Redraws codes with each mask, the encoder would
+// only use the ones it finds easiest to read
+func TestRoundTripEveryMask(t *testing.T) {
+	for _, text := range roundTrips[1:4] {
+		c, err := Encode(text)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for mask := 0; mask < 8; mask++ {
+			c.applyMask(c.mask)
+			c.applyMask(mask)
+			c.drawFormatBits(mask)
+			c.mask = mask
+			if got := decodePNG(t, c, 2); got != text {
+				t.Errorf("mask %d reads %q, want %q", mask, got, text)
+			}
+		}
+	}
+}
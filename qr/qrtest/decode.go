@@ -0,0 +1,422 @@
+// Package qrtest Reads QR codes back, for tests of code that draws them. It
+// follows the tables and reading order of the standard rather than package
+// qr, so a mistake in the encoder doesn't cancel itself out here. It only
+// reads what the encoder writes: upright images with whole pixels per
+// module, a quiet zone of four modules and no damage to correct.
+package qrtest
+
+import (
+	"errors"
+	"fmt"
+	"image"
+)
+
+// quietZone The light border around a code, in modules
+const quietZone = 4
+
+// alignment The centres of the alignment patterns of every version, table E.1
+// of ISO/IEC 18004
+var alignment = [41][]int{nil, nil,
+	{6, 18}, {6, 22}, {6, 26}, {6, 30}, {6, 34},
+	{6, 22, 38}, {6, 24, 42}, {6, 26, 46}, {6, 28, 50}, {6, 30, 54}, {6, 32, 58}, {6, 34, 62},
+	{6, 26, 46, 66}, {6, 26, 48, 70}, {6, 26, 50, 74}, {6, 30, 54, 78}, {6, 30, 56, 82}, {6, 30, 58, 86}, {6, 34, 62, 90},
+	{6, 28, 50, 72, 94}, {6, 26, 50, 74, 98}, {6, 30, 54, 78, 102}, {6, 28, 54, 80, 106},
+	{6, 32, 58, 84, 110}, {6, 30, 58, 86, 114}, {6, 34, 62, 90, 118},
+	{6, 26, 50, 74, 98, 122}, {6, 30, 54, 78, 102, 126}, {6, 26, 52, 78, 104, 130},
+	{6, 30, 56, 82, 108, 134}, {6, 34, 60, 86, 112, 138}, {6, 30, 58, 86, 114, 142}, {6, 34, 62, 90, 118, 146},
+	{6, 30, 54, 78, 102, 126, 150}, {6, 24, 50, 76, 102, 128, 154}, {6, 28, 54, 80, 106, 132, 158},
+	{6, 32, 58, 84, 110, 136, 162}, {6, 26, 54, 82, 110, 138, 166}, {6, 30, 58, 86, 114, 142, 170},
+}
+
+// blockGroup Blocks of the same length: how many, and their data codewords
+type blockGroup struct {
+	count, data int
+}
+
+// levelM The error correction codewords per block and the blocks of every
+// version at the medium level, table 9 of ISO/IEC 18004
+var levelM = [41]struct {
+	ecc    int
+	groups []blockGroup
+}{{},
+	{10, []blockGroup{{1, 16}}}, {16, []blockGroup{{1, 28}}}, {26, []blockGroup{{1, 44}}},
+	{18, []blockGroup{{2, 32}}}, {24, []blockGroup{{2, 43}}}, {16, []blockGroup{{4, 27}}},
+	{18, []blockGroup{{4, 31}}}, {22, []blockGroup{{2, 38}, {2, 39}}}, {22, []blockGroup{{3, 36}, {2, 37}}},
+	{26, []blockGroup{{4, 43}, {1, 44}}}, {30, []blockGroup{{1, 50}, {4, 51}}}, {22, []blockGroup{{6, 36}, {2, 37}}},
+	{22, []blockGroup{{8, 37}, {1, 38}}}, {24, []blockGroup{{4, 40}, {5, 41}}}, {24, []blockGroup{{5, 41}, {5, 42}}},
+	{28, []blockGroup{{7, 45}, {3, 46}}}, {28, []blockGroup{{10, 46}, {1, 47}}}, {26, []blockGroup{{9, 43}, {4, 44}}},
+	{26, []blockGroup{{3, 44}, {11, 45}}}, {26, []blockGroup{{3, 41}, {13, 42}}}, {26, []blockGroup{{17, 42}}},
+	{28, []blockGroup{{17, 46}}}, {28, []blockGroup{{4, 47}, {14, 48}}}, {28, []blockGroup{{6, 45}, {14, 46}}},
+	{28, []blockGroup{{8, 47}, {13, 48}}}, {28, []blockGroup{{19, 46}, {4, 47}}}, {28, []blockGroup{{22, 45}, {3, 46}}},
+	{28, []blockGroup{{3, 45}, {23, 46}}}, {28, []blockGroup{{21, 45}, {7, 46}}}, {28, []blockGroup{{19, 47}, {10, 48}}},
+	{28, []blockGroup{{2, 46}, {29, 47}}}, {28, []blockGroup{{10, 46}, {23, 47}}}, {28, []blockGroup{{14, 46}, {21, 47}}},
+	{28, []blockGroup{{14, 46}, {23, 47}}}, {28, []blockGroup{{12, 47}, {26, 48}}}, {28, []blockGroup{{6, 47}, {34, 48}}},
+	{28, []blockGroup{{29, 46}, {14, 47}}}, {28, []blockGroup{{13, 46}, {32, 47}}}, {28, []blockGroup{{40, 47}, {7, 48}}},
+	{28, []blockGroup{{18, 47}, {31, 48}}},
+}
+
+// symbol The modules of a code, dark or light, by row and column
+type symbol struct {
+	size    int
+	version int
+	dark    [][]bool
+}
+
+// Decode The text of the QR code in img. It fails unless every part of the
+// code is exactly as the standard has it.
+func Decode(img image.Image) (string, error) {
+	s, err := sample(img)
+	if err != nil {
+		return "", err
+	}
+	if err = s.checkVersion(); err != nil {
+		return "", err
+	}
+	mask, err := s.format()
+	if err != nil {
+		return "", err
+	}
+	data, err := s.deinterleave(s.codewords(mask))
+	if err != nil {
+		return "", err
+	}
+	return parse(data, s.version)
+}
+
+// sample Reads the modules of img. The scale is found from the top left
+// finder pattern, which starts after the quiet zone.
+func sample(img image.Image) (*symbol, error) {
+	b := img.Bounds()
+	dark := func(x, y int) bool {
+		r, g, bl, _ := img.At(b.Min.X+x, b.Min.Y+y).RGBA()
+		return r+g+bl < 3*0x8000
+	}
+	start := 0
+	for start < b.Dx() && start < b.Dy() && !dark(start, start) {
+		start++
+	}
+	if start == 0 || start%quietZone != 0 {
+		return nil, fmt.Errorf("the quiet zone is %d pixels wide", start)
+	}
+	scale := start / quietZone
+	if b.Dx() != b.Dy() || b.Dx()%scale != 0 {
+		return nil, fmt.Errorf("a %dx%d image doesn't hold whole modules of %d pixels", b.Dx(), b.Dy(), scale)
+	}
+	size := b.Dx()/scale - 2*quietZone
+	if size < 21 || size > 177 || (size-17)%4 != 0 {
+		return nil, fmt.Errorf("%d modules isn't the size of any version", size)
+	}
+
+	s := &symbol{size: size, version: (size - 17) / 4, dark: make([][]bool, size)}
+	for row := range s.dark {
+		s.dark[row] = make([]bool, size)
+		for col := range s.dark[row] {
+			s.dark[row][col] = dark((col+quietZone)*scale+scale/2, (row+quietZone)*scale+scale/2)
+		}
+	}
+	// Everything outside the symbol has to be light
+	for y := 0; y < b.Dy(); y++ {
+		for x := 0; x < b.Dx(); x++ {
+			col, row := x/scale-quietZone, y/scale-quietZone
+			if (col < 0 || row < 0 || col >= size || row >= size) && dark(x, y) {
+				return nil, fmt.Errorf("pixel %d,%d of the quiet zone is dark", x, y)
+			}
+		}
+	}
+	return s, nil
+}
+
+// remainder The remainder of the polynomial value over GF(2) divided by
+// generator, whose highest term is bit degree
+func remainder(value, generator, degree int) int {
+	for bit := 31; bit >= degree; bit-- {
+		if value&(1<<uint(bit)) != 0 {
+			value ^= generator << uint(bit-degree)
+		}
+	}
+	return value
+}
+
+// checkVersion Checks the two copies of the version information, which
+// versions 7 and up have next to the top right and bottom left finders
+func (s *symbol) checkVersion() error {
+	if s.version < 7 {
+		return nil
+	}
+	var right, below int
+	for i := 17; i >= 0; i-- {
+		row, col := i/3, s.size-11+i%3
+		right = right<<1 | bit(s.dark[row][col])
+		below = below<<1 | bit(s.dark[col][row])
+	}
+	for _, info := range []int{right, below} {
+		if info>>12 != s.version || remainder(info, 0x1F25, 12) != 0 {
+			return fmt.Errorf("version information %018b doesn't say version %d", info, s.version)
+		}
+	}
+	return nil
+}
+
+// format The mask from the two copies of the format information, which have
+// to agree and be at the medium error correction level
+func (s *symbol) format() (int, error) {
+	var first, second int
+	// Around the top left finder, most significant bit first
+	for col := 0; col <= 5; col++ {
+		first = first<<1 | bit(s.dark[8][col])
+	}
+	first = first<<1 | bit(s.dark[8][7])
+	first = first<<1 | bit(s.dark[8][8])
+	first = first<<1 | bit(s.dark[7][8])
+	for row := 5; row >= 0; row-- {
+		first = first<<1 | bit(s.dark[row][8])
+	}
+	// Right of the bottom left finder and below the top right one
+	for row := s.size - 1; row >= s.size-7; row-- {
+		second = second<<1 | bit(s.dark[row][8])
+	}
+	for col := s.size - 8; col < s.size; col++ {
+		second = second<<1 | bit(s.dark[8][col])
+	}
+
+	if first != second {
+		return 0, fmt.Errorf("the format information %015b and its copy %015b differ", first, second)
+	}
+	info := first ^ 0x5412
+	if remainder(info, 0x537, 10) != 0 {
+		return 0, fmt.Errorf("the format information %015b is damaged", first)
+	}
+	if level := info >> 13; level != 0 {
+		return 0, fmt.Errorf("the error correction level is %02b, not M", level)
+	}
+	if !s.dark[s.size-8][8] {
+		return 0, errors.New("the dark module is light")
+	}
+	return info >> 10 & 7, nil
+}
+
+// function Which modules aren't data: the finder patterns with their
+// separators, the format and version information, the timing patterns and
+// the alignment patterns
+func (s *symbol) function() [][]bool {
+	f := make([][]bool, s.size)
+	for row := range f {
+		f[row] = make([]bool, s.size)
+	}
+	fill := func(row, col, rows, cols int) {
+		for r := row; r < row+rows; r++ {
+			for c := col; c < col+cols; c++ {
+				f[r][c] = true
+			}
+		}
+	}
+	fill(0, 0, 9, 9)
+	fill(0, s.size-8, 9, 8)
+	fill(s.size-8, 0, 8, 9)
+	fill(6, 0, 1, s.size)
+	fill(0, 6, s.size, 1)
+	if s.version >= 7 {
+		fill(0, s.size-11, 6, 3)
+		fill(s.size-11, 0, 3, 6)
+	}
+	centres := alignment[s.version]
+	last := len(centres) - 1
+	for i, row := range centres {
+		for j, col := range centres {
+			// The corners with finders have none
+			if (i == 0 && j == 0) || (i == 0 && j == last) || (i == last && j == 0) {
+				continue
+			}
+			fill(row-2, col-2, 5, 5)
+		}
+	}
+	return f
+}
+
+// masked If the mask inverts the module at row i and column j, table 10 of
+// ISO/IEC 18004
+func masked(mask, i, j int) bool {
+	switch mask {
+	case 0:
+		return (i+j)%2 == 0
+	case 1:
+		return i%2 == 0
+	case 2:
+		return j%3 == 0
+	case 3:
+		return (i+j)%3 == 0
+	case 4:
+		return (i/2+j/3)%2 == 0
+	case 5:
+		return i*j%2+i*j%3 == 0
+	case 6:
+		return (i*j%2+i*j%3)%2 == 0
+	default:
+		return (i*j%3+(i+j)%2)%2 == 0
+	}
+}
+
+// codewords The unmasked codewords, read in pairs of columns from the bottom
+// right, going up and down in turn. Remainder bits that don't make up a
+// whole codeword are left out.
+func (s *symbol) codewords(mask int) []byte {
+	function := s.function()
+	var result []byte
+	var current, bits int
+	up := true
+	for right := s.size - 1; right > 0; right -= 2 {
+		if right == 6 {
+			right--
+		}
+		for n := 0; n < s.size; n++ {
+			row := n
+			if up {
+				row = s.size - 1 - n
+			}
+			for col := right; col > right-2; col-- {
+				if function[row][col] {
+					continue
+				}
+				dark := s.dark[row][col] != masked(mask, row, col)
+				current = current<<1 | bit(dark)
+				if bits++; bits == 8 {
+					result = append(result, byte(current))
+					current, bits = 0, 0
+				}
+			}
+		}
+		up = !up
+	}
+	return result
+}
+
+// deinterleave Splits the codewords into their blocks, checks the error
+// correction of each, and returns the data codewords in order
+func (s *symbol) deinterleave(codewords []byte) ([]byte, error) {
+	table := levelM[s.version]
+	var blocks [][]byte
+	var dataLengths []int
+	total := 0
+	for _, g := range table.groups {
+		for i := 0; i < g.count; i++ {
+			blocks = append(blocks, nil)
+			dataLengths = append(dataLengths, g.data)
+			total += g.data + table.ecc
+		}
+	}
+	if total != len(codewords) {
+		return nil, fmt.Errorf("version %d has room for %d codewords, the table says %d", s.version, len(codewords), total)
+	}
+
+	next := 0
+	longest := dataLengths[len(dataLengths)-1]
+	for i := 0; i < longest+table.ecc; i++ {
+		for b := range blocks {
+			if i < longest && i >= dataLengths[b] {
+				continue
+			}
+			blocks[b] = append(blocks[b], codewords[next])
+			next++
+		}
+	}
+
+	var data []byte
+	for b, block := range blocks {
+		// Data codewords and error correction make a multiple of the
+		// generator, so the block is zero at each of its roots
+		for i := 0; i < table.ecc; i++ {
+			if evaluate(block, exp[i]) != 0 {
+				return nil, fmt.Errorf("block %d fails its error correction at root %d", b, i)
+			}
+		}
+		data = append(data, block[:dataLengths[b]]...)
+	}
+	return data, nil
+}
+
+// exp, logarithm Powers of 2 in GF(2^8) modulo x^8 + x^4 + x^3 + x^2 + 1 and
+// their inverse
+var exp, logarithm = func() ([510]byte, [256]int) {
+	var e [510]byte
+	var l [256]int
+	x := 1
+	for i := 0; i < 255; i++ {
+		e[i], e[i+255] = byte(x), byte(x)
+		l[x] = i
+		if x <<= 1; x >= 256 {
+			x ^= 0x11D
+		}
+	}
+	return e, l
+}()
+
+func multiply(a, b byte) byte {
+	if a == 0 || b == 0 {
+		return 0
+	}
+	return exp[logarithm[a]+logarithm[b]]
+}
+
+// evaluate The polynomial with coefficients p, highest first, at x
+func evaluate(p []byte, x byte) byte {
+	var result byte
+	for _, c := range p {
+		result = multiply(result, x) ^ c
+	}
+	return result
+}
+
+// parse The text of the data codewords. Only byte mode segments are read,
+// and what follows the terminator has to be the standard's padding.
+func parse(data []byte, version int) (string, error) {
+	pos := 0
+	read := func(n int) int {
+		value := 0
+		for i := 0; i < n; i++ {
+			value = value<<1 | int(data[pos/8]>>uint(7-pos%8)&1)
+			pos++
+		}
+		return value
+	}
+	countBits := 8
+	if version >= 10 {
+		countBits = 16
+	}
+
+	var text []byte
+	for len(data)*8-pos >= 4 {
+		mode := read(4)
+		if mode == 0 {
+			break
+		}
+		if mode != 0x4 {
+			return "", fmt.Errorf("segment in mode %04b, not byte mode", mode)
+		}
+		if len(data)*8-pos < countBits {
+			return "", errors.New("the data ends in the middle of a character count")
+		}
+		count := read(countBits)
+		if len(data)*8-pos < 8*count {
+			return "", fmt.Errorf("%d bytes don't fit in what's left of the data", count)
+		}
+		for i := 0; i < count; i++ {
+			text = append(text, byte(read(8)))
+		}
+	}
+	if pos%8 != 0 && read(8-pos%8) != 0 {
+		return "", errors.New("the last codeword with data isn't padded with zeroes")
+	}
+	for i, pad := pos/8, byte(0xEC); i < len(data); i, pad = i+1, pad^0xEC^0x11 {
+		if data[i] != pad {
+			return "", fmt.Errorf("pad codeword %d is %#x, not %#x", i, data[i], pad)
+		}
+	}
+	return string(text), nil
+}
+
+func bit(dark bool) int {
+	if dark {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,100 @@
+package scheduler
+
+import (
+	"context"
+	"how-much-do-i-owe/database"
+	"log"
+	"sync"
+	"time"
+)
+
+// Job Work that runs in the background every so often. When several servers
+// share a database only one of them runs a job at a time.
+type Job struct {
+	// Name Identifies the job in the log and for Wake
+	Name  string
+	Every time.Duration
+	Run   func(ctx context.Context, db *database.DB) error
+}
+
+var (
+	mu    sync.Mutex
+	wakes = make(map[string]chan struct{})
+)
+
+// Start Runs each job until stop is called, which waits for runs in progress
+// to finish
+func Start(db *database.DB, jobs ...Job) (stop func()) {
+	ctx, cancel := context.WithCancel(context.Background())
+	var running sync.WaitGroup
+	for _, job := range jobs {
+		wake := make(chan struct{}, 1)
+		mu.Lock()
+		wakes[job.Name] = wake
+		mu.Unlock()
+
+		running.Add(1)
+		go func(job Job) {
+			defer running.Done()
+			ticker := time.NewTicker(job.Every)
+			defer ticker.Stop()
+			for {
+				run(ctx, db, job)
+				select {
+				case <-ctx.Done():
+					return
+				case <-ticker.C:
+				case <-wake:
+				}
+			}
+		}(job)
+	}
+	return func() {
+		cancel()
+		running.Wait()
+	}
+}
+
+// Wake Runs a job now instead of at its next tick, for work that shouldn't
+// wait. Does nothing when the job isn't running on this server.
+func Wake(name string) {
+	mu.Lock()
+	wake := wakes[name]
+	mu.Unlock()
+	if wake == nil {
+		return
+	}
+	select {
+	case wake <- struct{}{}:
+	default:
+	}
+}
+
+// run Runs a job once if no other server is running it, which is decided by a
+// Postgres advisory lock held on one connection for the length of the run
+func run(ctx context.Context, db *database.DB, job Job) {
+	conn, err := db.Db.Conn(ctx)
+	if err != nil {
+		log.Printf("scheduler: %s: %v", job.Name, err)
+		return
+	}
+	defer conn.Close()
+
+	var locked bool
+	if err = conn.QueryRowContext(ctx, "SELECT pg_try_advisory_lock(hashtext($1))", job.Name).Scan(&locked); err != nil {
+		log.Printf("scheduler: %s: %v", job.Name, err)
+		return
+	}
+	if !locked {
+		return
+	}
+	defer func() {
+		// The lock goes with the connection, so it has to be released on a
+		// context that isn't cancelled yet
+		_, _ = conn.ExecContext(context.Background(), "SELECT pg_advisory_unlock(hashtext($1))", job.Name)
+	}()
+
+	if err = job.Run(ctx, db); err != nil && ctx.Err() == nil {
+		log.Printf("scheduler: %s: %v", job.Name, err)
+	}
+}
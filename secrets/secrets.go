@@ -0,0 +1,171 @@
+package secrets
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// prefix Marks a value encrypted by a Keyring, followed by the key ID
+const prefix = "enc:v1:"
+
+// Keyring Encrypts values stored in the database with AES-256-GCM. Every value
+// records the ID of the key that encrypted it, so a key is rotated by making a
+// new key current and keeping the old one until everything is re-encrypted.
+type Keyring struct {
+	current string
+	aeads   map[string]cipher.AEAD
+}
+
+// Default The keyring the app uses, set up by ConfigKeys
+var Default *Keyring
+
+// ConfigKeys Sets up Default from the environment
+//
+//   - ENCRYPTION_KEYS is a comma separated list of id:key pairs, each key 32
+//     bytes encoded as base64. The first is used to encrypt, the rest only to
+//     decrypt values that haven't been rotated yet, e.g. "2:bmV3...,1:b2xk..."
+//   - otherwise a key is derived from DATABASE_SECRET
+func ConfigKeys() error {
+	var err error
+	if spec := os.Getenv("ENCRYPTION_KEYS"); spec != "" {
+		Default, err = ParseKeys(spec)
+		return err
+	}
+	if os.Getenv("DATABASE_SECRET") == "" {
+		return errors.New("set ENCRYPTION_KEYS or DATABASE_SECRET to encrypt stored tokens")
+	}
+	fmt.Println("ENCRYPTION_KEYS isn't set, deriving an encryption key from DATABASE_SECRET")
+	key := sha256.Sum256([]byte("how-much-do-i-owe encryption key:" + os.Getenv("DATABASE_SECRET")))
+	Default, err = NewKeyring("db", map[string][]byte{"db": key[:]})
+	return err
+}
+
+// ParseKeys A keyring from the ENCRYPTION_KEYS format, the first key is current
+func ParseKeys(spec string) (*Keyring, error) {
+	keys := map[string][]byte{}
+	current := ""
+	for _, pair := range strings.Split(spec, ",") {
+		id, encoded, ok := strings.Cut(strings.TrimSpace(pair), ":")
+		if !ok || id == "" {
+			return nil, fmt.Errorf("encryption keys must be id:key pairs")
+		}
+		key, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("encryption key %q isn't valid base64", id)
+		}
+		if _, exists := keys[id]; exists {
+			return nil, fmt.Errorf("encryption key %q is listed twice", id)
+		}
+		keys[id] = key
+		if current == "" {
+			current = id
+		}
+	}
+	return NewKeyring(current, keys)
+}
+
+// NewKeyring A keyring that encrypts with the key current and decrypts with any of keys
+func NewKeyring(current string, keys map[string][]byte) (*Keyring, error) {
+	if _, ok := keys[current]; !ok {
+		return nil, fmt.Errorf("no encryption key %q", current)
+	}
+	k := &Keyring{current: current, aeads: map[string]cipher.AEAD{}}
+	for id, key := range keys {
+		if strings.Contains(id, ":") {
+			return nil, fmt.Errorf("encryption key ID %q can't contain ':'", id)
+		}
+		if len(key) != 32 {
+			return nil, fmt.Errorf("encryption key %q must be 32 bytes, not %d", id, len(key))
+		}
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return nil, err
+		}
+		if k.aeads[id], err = cipher.NewGCM(block); err != nil {
+			return nil, err
+		}
+	}
+	return k, nil
+}
+
+// Encrypt Encrypts plaintext with the current key. The same context has to be
+// given to decrypt it, which stops a value being copied to another row.
+// Nothing to encrypt stays empty.
+func (k *Keyring) Encrypt(plaintext string, context string) (string, error) {
+	if plaintext == "" {
+		return "", nil
+	}
+	aead := k.aeads[k.current]
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := aead.Seal(nonce, nonce, []byte(plaintext), []byte(context))
+	return prefix + k.current + ":" + base64.RawURLEncoding.EncodeToString(sealed), nil
+}
+
+// Decrypt Reverses Encrypt with whichever key the value was encrypted with
+func (k *Keyring) Decrypt(value string, context string) (string, error) {
+	if value == "" {
+		return "", nil
+	}
+	id, sealed, err := split(value)
+	if err != nil {
+		return "", err
+	}
+	aead, ok := k.aeads[id]
+	if !ok {
+		return "", fmt.Errorf("value was encrypted with key %q, which isn't configured", id)
+	}
+	if len(sealed) < aead.NonceSize() {
+		return "", errors.New("encrypted value is too short")
+	}
+	plaintext, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], []byte(context))
+	if err != nil {
+		return "", errors.New("encrypted value can't be decrypted, it was modified or the context is wrong")
+	}
+	return string(plaintext), nil
+}
+
+// Current If value is empty or already encrypted with the current key
+func (k *Keyring) Current(value string) bool {
+	if value == "" {
+		return true
+	}
+	id, _, err := split(value)
+	return err == nil && id == k.current
+}
+
+// Rotate Re-encrypts value with the current key if it isn't already
+func (k *Keyring) Rotate(value string, context string) (string, error) {
+	if k.Current(value) {
+		return value, nil
+	}
+	plaintext, err := k.Decrypt(value, context)
+	if err != nil {
+		return "", err
+	}
+	return k.Encrypt(plaintext, context)
+}
+
+func split(value string) (string, []byte, error) {
+	if !strings.HasPrefix(value, prefix) {
+		return "", nil, errors.New("value isn't encrypted")
+	}
+	id, encoded, ok := strings.Cut(strings.TrimPrefix(value, prefix), ":")
+	if !ok {
+		return "", nil, errors.New("malformed encrypted value")
+	}
+	sealed, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return "", nil, errors.New("malformed encrypted value")
+	}
+	return id, sealed, nil
+}
@@ -0,0 +1,167 @@
+package secrets
+
+import (
+	"bytes"
+	"encoding/base64"
+	"strings"
+	"testing"
+)
+
+var (
+	oldKey = bytes.Repeat([]byte{1}, 32)
+	newKey = bytes.Repeat([]byte{2}, 32)
+)
+
+func newTestKeyring(t *testing.T, current string) *Keyring {
+	k, err := NewKeyring(current, map[string][]byte{"old": oldKey, "new": newKey})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return k
+}
+
+func TestEncryptRoundTrip(t *testing.T) {
+	k := newTestKeyring(t, "new")
+	tests := []struct {
+		name      string
+		plaintext string
+	}{
+		{"empty", ""},
+		{"token", "ya29.a0AfH6SMBx"},
+		{"unicode", "clé secrète ✓"},
+		{"long", strings.Repeat("x", 4096)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			value, err := k.Encrypt(tt.plaintext, "identity:google:1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.plaintext != "" && (!strings.HasPrefix(value, prefix+"new:") || strings.Contains(value, tt.plaintext)) {
+				t.Errorf("got %q, want it encrypted with key new", value)
+			}
+			got, err := k.Decrypt(value, "identity:google:1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.plaintext {
+				t.Errorf("got %q, want %q", got, tt.plaintext)
+			}
+		})
+	}
+
+	first, _ := k.Encrypt("same", "c")
+	second, _ := k.Encrypt("same", "c")
+	if first == second {
+		t.Error("encrypting the same value twice gave the same ciphertext")
+	}
+}
+
+func TestDecryptFails(t *testing.T) {
+	k := newTestKeyring(t, "new")
+	value, err := k.Encrypt("refresh-token", "identity:google:1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, sealed, err := split(value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tampered := append([]byte{}, sealed...)
+	tampered[len(tampered)-1] ^= 1
+	otherKey, err := NewKeyring("new", map[string][]byte{"new": oldKey})
+	if err != nil {
+		t.Fatal(err)
+	}
+	unknownKey, err := NewKeyring("other", map[string][]byte{"other": newKey})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		keyring *Keyring
+		value   string
+		context string
+	}{
+		{"wrong key", otherKey, value, "identity:google:1"},
+		{"key not configured", unknownKey, value, "identity:google:1"},
+		{"wrong context", k, value, "identity:google:2"},
+		{"tampered ciphertext", k, prefix + id + ":" + base64.RawURLEncoding.EncodeToString(tampered), "identity:google:1"},
+		{"truncated", k, prefix + id + ":" + base64.RawURLEncoding.EncodeToString(sealed[:4]), "identity:google:1"},
+		{"not encrypted", k, "refresh-token", "identity:google:1"},
+		{"no key ID", k, prefix + "abc", "identity:google:1"},
+		{"bad base64", k, prefix + id + ":!!!", "identity:google:1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got, err := tt.keyring.Decrypt(tt.value, tt.context); err == nil {
+				t.Errorf("decrypted %q, want an error", got)
+			}
+		})
+	}
+}
+
+func TestRotate(t *testing.T) {
+	old := newTestKeyring(t, "old")
+	rotated := newTestKeyring(t, "new")
+
+	value, err := old.Encrypt("access-token", "identity:github:7")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !old.Current(value) || rotated.Current(value) {
+		t.Fatalf("Current(%q) is wrong before rotating", value)
+	}
+
+	value, err = rotated.Rotate(value, "identity:github:7")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(value, prefix+"new:") || !rotated.Current(value) {
+		t.Errorf("got %q, want it encrypted with key new", value)
+	}
+	if got, err := rotated.Decrypt(value, "identity:github:7"); err != nil || got != "access-token" {
+		t.Errorf("got %q, %v after rotating", got, err)
+	}
+	if again, err := rotated.Rotate(value, "identity:github:7"); err != nil || again != value {
+		t.Errorf("rotating a current value changed it to %q, %v", again, err)
+	}
+
+	stale, _ := old.Encrypt("access-token", "identity:github:7")
+	if _, err = rotated.Rotate(stale, "identity:github:8"); err == nil {
+		t.Error("rotated a value with the wrong context")
+	}
+	if !rotated.Current("") {
+		t.Error("an empty value needs no rotation")
+	}
+}
+
+func TestParseKeys(t *testing.T) {
+	encode := base64.StdEncoding.EncodeToString
+	tests := []struct {
+		name    string
+		spec    string
+		current string
+		wantErr bool
+	}{
+		{"one key", "1:" + encode(newKey), "1", false},
+		{"first is current", "2:" + encode(newKey) + ", 1:" + encode(oldKey), "2", false},
+		{"no ID", encode(newKey), "", true},
+		{"empty ID", ":" + encode(newKey), "", true},
+		{"bad base64", "1:not base64!", "", true},
+		{"short key", "1:" + encode([]byte("short")), "", true},
+		{"listed twice", "1:" + encode(newKey) + ",1:" + encode(oldKey), "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			k, err := ParseKeys(tt.spec)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, want error %v", err, tt.wantErr)
+			}
+			if err == nil && k.current != tt.current {
+				t.Errorf("current key is %q, want %q", k.current, tt.current)
+			}
+		})
+	}
+}
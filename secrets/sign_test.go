@@ -0,0 +1,68 @@
+package secrets
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+type testClaims struct {
+	Email   string `json:"email"`
+	Expires int64  `json:"exp"`
+}
+
+func TestSignVerify(t *testing.T) {
+	key := []byte("signing key")
+	token, err := Sign(key, testClaims{Email: "alice@example.com", Expires: 1700000000})
+	if err != nil {
+		t.Fatal(err)
+	}
+	payload, sig, _ := strings.Cut(token, ".")
+	flipped := []byte(payload)
+	flipped[0] ^= 1
+
+	tests := []struct {
+		name    string
+		key     []byte
+		token   string
+		wantErr error
+	}{
+		{"valid", key, token, nil},
+		{"wrong key", []byte("other key"), token, ErrBadSignature},
+		{"purpose key", SigningKey("email-login"), token, ErrBadSignature},
+		{"modified claims", key, string(flipped) + "." + sig, ErrBadSignature},
+		{"forged signature", key, payload + "." + strings.Repeat("A", len(sig)), ErrBadSignature},
+		{"no signature", key, payload, errors.New("malformed token")},
+		{"bad signature encoding", key, payload + ".!!!", errors.New("malformed token")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var claims testClaims
+			err := Verify(tt.key, tt.token, &claims)
+			if tt.wantErr == nil {
+				if err != nil {
+					t.Fatal(err)
+				}
+				if claims.Email != "alice@example.com" || claims.Expires != 1700000000 {
+					t.Errorf("got claims %+v", claims)
+				}
+				return
+			}
+			if err == nil || err.Error() != tt.wantErr.Error() {
+				t.Errorf("got %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestSigningKey(t *testing.T) {
+	t.Setenv("SIGNING_SECRET", "secret")
+	if string(SigningKey("chat-link")) == string(SigningKey("email-login")) {
+		t.Error("two purposes got the same key")
+	}
+	first := SigningKey("chat-link")
+	t.Setenv("SIGNING_SECRET", "rotated")
+	if string(first) == string(SigningKey("chat-link")) {
+		t.Error("another secret gave the same key")
+	}
+}
@@ -0,0 +1,24 @@
+package secrets
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+)
+
+// NewToken A random bearer token of 32 bytes, URL safe base64 after prefix
+func NewToken(prefix string) (string, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", err
+	}
+	return prefix + base64.RawURLEncoding.EncodeToString(secret), nil
+}
+
+// HashToken What is stored of a bearer token, so the database alone can't be
+// used to make requests with it
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,23 @@
+package secrets
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestNewToken(t *testing.T) {
+	a, err := NewToken("hmdio_")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := NewToken("hmdio_")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(a, "hmdio_") || len(a) != len("hmdio_")+43 || a == b {
+		t.Errorf("got tokens %q and %q", a, b)
+	}
+	if HashToken(a) != HashToken(a) || HashToken(a) == HashToken(b) || strings.Contains(HashToken(a), a) {
+		t.Error("a token has to hash the same every time and differently from others")
+	}
+}
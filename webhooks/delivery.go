@@ -0,0 +1,365 @@
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"how-much-do-i-owe/database"
+	"how-much-do-i-owe/scheduler"
+	"how-much-do-i-owe/secrets"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// JobName The scheduler job that delivers webhooks
+const JobName = "webhooks"
+
+const (
+	statusPending   = "pending"
+	statusSucceeded = "succeeded"
+	statusFailed    = "failed"
+
+	// batchSize How many deliveries are claimed at once
+	batchSize = 50
+	// maxAttempts Tries before a delivery is given up on, about 2 days with backoff
+	maxAttempts = 10
+	// firstRetry Wait after the first failed attempt, doubled after each one
+	firstRetry = 30 * time.Second
+	maxRetry   = 6 * time.Hour
+	// lease How long a claimed delivery is left alone, in case the server
+	// stops before its attempt is recorded. It outlasts a batch whose every
+	// attempt times out, so nothing is sent twice while it's being sent.
+	lease = 10 * time.Minute
+	// maxError How much of an error is kept in the delivery log
+	maxError = 200
+)
+
+// Job Sends the deliveries that are due. Enqueue wakes it up so nothing
+// waits for the next tick.
+var Job = scheduler.Job{Name: JobName, Every: 30 * time.Second, Run: deliver}
+
+// delivery An attempt, or attempts, to send an event to a webhook
+type delivery struct {
+	ID             int64           `json:"id"`
+	EventType      string          `json:"eventType"`
+	Payload        json.RawMessage `json:"payload"`
+	Status         string          `json:"status"`
+	Attempts       int             `json:"attempts"`
+	NextAttemptAt  *time.Time      `json:"nextAttemptAt"`
+	LastAttemptAt  *time.Time      `json:"lastAttemptAt"`
+	ResponseStatus *int            `json:"responseStatus"`
+	Error          string          `json:"error"`
+	CreatedAt      time.Time       `json:"createdAt"`
+}
+
+// envelope What is POSTed to a webhook. ID is the delivery's, it stays the
+// same across retries so receivers can drop duplicates.
+type envelope struct {
+	ID        int64           `json:"id"`
+	Type      string          `json:"type"`
+	CreatedAt time.Time       `json:"createdAt"`
+	Data      json.RawMessage `json:"data"`
+}
+
+// target Where a delivery goes
+type target struct {
+	webhookID int
+	url       string
+	secret    string
+}
+
+// result What came of one attempt. Status is 0 when there was no response.
+// What the response said isn't kept, the URL is the user's to choose and it
+// mustn't be a way to read what the server can reach.
+type result struct {
+	status int
+	err    error
+}
+
+func (r result) ok() bool {
+	return r.err == nil && r.status >= 200 && r.status <= 299
+}
+
+// Signature The X-Webhook-Signature of body sent at timestamp, seconds since
+// the epoch. Receivers compute it with their secret and compare.
+func Signature(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10) + "."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// backoff The wait before the next attempt after attempts failed ones
+func backoff(attempts int) time.Duration {
+	wait := firstRetry
+	for i := 1; i < attempts && wait < maxRetry; i++ {
+		wait *= 2
+	}
+	if wait > maxRetry {
+		wait = maxRetry
+	}
+	return wait
+}
+
+func deliver(ctx context.Context, db *database.DB) error {
+	// Keep going while there are full batches left
+	for {
+		sent, err := sendDue(ctx, db.Db)
+		if err != nil {
+			return err
+		}
+		if sent < batchSize {
+			return nil
+		}
+	}
+}
+
+// sendDue Claims a batch of due deliveries, attempts them and records how it
+// went. Deliveries to disabled webhooks wait until they are enabled again.
+func sendDue(ctx context.Context, db *sql.DB) (int, error) {
+	queryRows, err := db.QueryContext(ctx, `WITH due AS (
+			SELECT d.id FROM webhook_delivery d JOIN webhook w ON w.id = d.webhook_id
+			WHERE d.status='pending' AND d.next_attempt_at <= now() AND w.enabled
+			ORDER BY d.next_attempt_at LIMIT $1 FOR UPDATE OF d SKIP LOCKED
+		), claimed AS (
+			UPDATE webhook_delivery d SET next_attempt_at = now() + $2 * interval '1 second' FROM due WHERE d.id = due.id
+			RETURNING d.id, d.webhook_id, d.event_type, d.payload, d.created_at, d.attempts
+		)
+		SELECT c.id, c.event_type, c.payload, c.created_at, c.attempts, w.id, w.url, w.secret
+		FROM claimed c JOIN webhook w ON w.id = c.webhook_id ORDER BY c.id`, batchSize, lease.Seconds())
+	if err != nil {
+		return 0, err
+	}
+	type claimed struct {
+		env      envelope
+		attempts int
+		to       target
+	}
+	var batch []claimed
+	for queryRows.Next() {
+		var d claimed
+		var payload []byte
+		err = queryRows.Scan(&d.env.ID, &d.env.Type, &payload, &d.env.CreatedAt, &d.attempts, &d.to.webhookID, &d.to.url, &d.to.secret)
+		if err != nil {
+			queryRows.Close()
+			return 0, err
+		}
+		d.env.Data = payload
+		batch = append(batch, d)
+	}
+	queryRows.Close()
+	if err = queryRows.Err(); err != nil {
+		return 0, err
+	}
+
+	for _, d := range batch {
+		r := send(ctx, d.to, d.env)
+		status, retry := outcome(r, d.attempts+1)
+		if err = record(db, d.env.ID, r, status, retry); err != nil {
+			return 0, err
+		}
+	}
+	return len(batch), nil
+}
+
+// outcome The status of a delivery after its attempts'th attempt had result r,
+// and when it's tried again if it's still pending. This replaces the lease
+// sendDue claimed it with.
+func outcome(r result, attempts int) (string, time.Duration) {
+	if r.ok() {
+		return statusSucceeded, 0
+	}
+	if attempts >= maxAttempts {
+		return statusFailed, 0
+	}
+	return statusPending, backoff(attempts)
+}
+
+// record Saves the result of an attempt on a delivery, retrying it after
+// retry when it's still pending
+func record(db database.Querier, id int64, r result, status string, retry time.Duration) error {
+	var responseStatus *int
+	if r.status != 0 {
+		responseStatus = &r.status
+	}
+	errorText := ""
+	if r.err != nil {
+		errorText = r.err.Error()
+	} else if !r.ok() {
+		errorText = fmt.Sprintf("responded with %d", r.status)
+	}
+	if len(errorText) > maxError {
+		errorText = strings.ToValidUTF8(errorText[:maxError], "")
+	}
+	_, err := db.Exec(`UPDATE webhook_delivery SET status=$2, attempts=attempts+1, last_attempt_at=now(),
+                            next_attempt_at=now() + $3 * interval '1 second', response_status=$4, error=$5
+                            WHERE id=$1`,
+		id, status, retry.Seconds(), responseStatus, errorText)
+	return err
+}
+
+// send POSTs env to a webhook, signed with its secret. Any 2xx response counts
+// as delivered.
+func send(ctx context.Context, to target, env envelope) result {
+	secret, err := secrets.Default.Decrypt(to.secret, secretContext(to.webhookID))
+	if err != nil {
+		return result{err: fmt.Errorf("unable to read the signing secret")}
+	}
+	body, err := json.Marshal(env)
+	if err != nil {
+		return result{err: err}
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, to.url, bytes.NewReader(body))
+	if err != nil {
+		return result{err: err}
+	}
+	timestamp := time.Now().Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "how-much-do-i-owe webhooks")
+	req.Header.Set("X-Webhook-Id", strconv.FormatInt(env.ID, 10))
+	req.Header.Set("X-Webhook-Event", env.Type)
+	req.Header.Set("X-Webhook-Timestamp", strconv.FormatInt(timestamp, 10))
+	req.Header.Set("X-Webhook-Signature", Signature(secret, timestamp, body))
+	res, err := Client.Do(req)
+	if err != nil {
+		return result{err: err}
+	}
+	res.Body.Close()
+	return result{status: res.StatusCode}
+}
+
+const deliveryQuery = `SELECT id, event_type, payload, status, attempts, next_attempt_at, last_attempt_at, response_status,
+       error, created_at FROM webhook_delivery`
+
+func scanDelivery(row interface{ Scan(...interface{}) error }) (delivery, error) {
+	var d delivery
+	var payload []byte
+	var nextAttemptAt time.Time
+	err := row.Scan(&d.ID, &d.EventType, &payload, &d.Status, &d.Attempts, &nextAttemptAt, &d.LastAttemptAt,
+		&d.ResponseStatus, &d.Error, &d.CreatedAt)
+	d.Payload = payload
+	if d.Status == statusPending {
+		d.NextAttemptAt = &nextAttemptAt
+	}
+	return d, err
+}
+
+// getDeliveries The delivery log of a webhook, the latest 100 deliveries
+// newest first
+func getDeliveries(db *database.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, ok := webhookParam(c, db.Db)
+		if !ok {
+			return
+		}
+		queryRows, err := db.Db.Query(deliveryQuery+" WHERE webhook_id=$1 ORDER BY id DESC LIMIT 100", id)
+		if err != nil {
+			database.RespondErr(err, c)
+			return
+		}
+		defer queryRows.Close()
+
+		deliveries := []delivery{}
+		for queryRows.Next() {
+			d, err := scanDelivery(queryRows)
+			if err != nil {
+				c.AbortWithStatusJSON(500, "The server was unable to get deliveries")
+				return
+			}
+			deliveries = append(deliveries, d)
+		}
+
+		c.JSON(200, deliveries)
+	}
+}
+
+// pingWebhook Sends a ping to a webhook right away, even a disabled one, and
+// responds with how it went. Pings go in the delivery log but aren't retried.
+func pingWebhook(db *database.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, ok := webhookParam(c, db.Db)
+		if !ok {
+			return
+		}
+		to := target{webhookID: id}
+		env := envelope{Type: Ping, Data: json.RawMessage(`{"webhookId":` + strconv.Itoa(id) + `}`)}
+		err := db.Db.QueryRow("SELECT url, secret FROM webhook WHERE id=$1", id).Scan(&to.url, &to.secret)
+		if err != nil {
+			database.RespondErr(err, c)
+			return
+		}
+		// Claimed like any delivery, so the job leaves it alone while it's sent
+		err = db.Db.QueryRow(`INSERT INTO webhook_delivery (webhook_id, event_type, payload, next_attempt_at)
+								VALUES ($1, $2, $3, now() + $4 * interval '1 second') RETURNING id, created_at`,
+			id, Ping, string(env.Data), lease.Seconds()).Scan(&env.ID, &env.CreatedAt)
+		if err != nil {
+			database.RespondErr(err, c)
+			return
+		}
+
+		r := send(c.Request.Context(), to, env)
+		status := statusFailed
+		if r.ok() {
+			status = statusSucceeded
+		}
+		if err = record(db.Db, env.ID, r, status, 0); err != nil {
+			database.RespondErr(err, c)
+			return
+		}
+		d, err := scanDelivery(db.Db.QueryRow(deliveryQuery+" WHERE id=$1", env.ID))
+		if err != nil {
+			database.RespondErr(err, c)
+			return
+		}
+
+		c.JSON(201, d)
+	}
+}
+
+// RotateKeys Re-encrypts every webhook secret that isn't encrypted with the
+// current key, so old keys can be removed. Returns how many webhooks changed.
+func RotateKeys(ctx context.Context, db *database.DB) (int, error) {
+	rows, err := db.Db.QueryContext(ctx, "SELECT id, secret FROM webhook")
+	if err != nil {
+		return 0, err
+	}
+	type stale struct {
+		id     int
+		secret string
+	}
+	var rotate []stale
+	for rows.Next() {
+		var row stale
+		if err = rows.Scan(&row.id, &row.secret); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		if !secrets.Default.Current(row.secret) {
+			rotate = append(rotate, row)
+		}
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return 0, err
+	}
+
+	for _, row := range rotate {
+		secret, err := secrets.Default.Rotate(row.secret, secretContext(row.id))
+		if err != nil {
+			return 0, fmt.Errorf("webhook %d: %s", row.id, err.Error())
+		}
+		_, err = db.Db.ExecContext(ctx, "UPDATE webhook SET secret=$1 WHERE id=$2 AND secret=$3", secret, row.id, row.secret)
+		if err != nil {
+			return 0, err
+		}
+	}
+	return len(rotate), nil
+}
@@ -0,0 +1,92 @@
+package webhooks
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestSignature(t *testing.T) {
+	tests := []struct {
+		name      string
+		secret    string
+		timestamp int64
+		body      string
+		want      string
+	}{
+		{"payload", "whsec_test", 1700000000, `{"id":1}`,
+			"sha256=2f441ba4b3b2d50d28a9ab9d9fd8880376ecd1eb5d0435401553f5d8d0a5dcf8"},
+		{"later timestamp", "whsec_test", 1700000001, `{"id":1}`,
+			"sha256=5d1660afdffdc0e7e0b80abba2da86ffcbe766a26364d961d8c2c43416778b2a"},
+		{"empty", "", 0, "",
+			"sha256=b849d5a581847b281957065739df36df2463d1977ea8d6e1e4e6cf33fadc68c3"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Signature(tt.secret, tt.timestamp, []byte(tt.body)); got != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+
+	if Signature("other", 1700000000, []byte(`{"id":1}`)) == tests[0].want {
+		t.Error("a different secret made the same signature")
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	tests := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{0, 30 * time.Second},
+		{1, 30 * time.Second},
+		{2, time.Minute},
+		{3, 2 * time.Minute},
+		{5, 8 * time.Minute},
+		{9, 128 * time.Minute},
+		{10, 256 * time.Minute},
+		{11, 6 * time.Hour},
+		{100, 6 * time.Hour},
+	}
+	for _, tt := range tests {
+		if got := backoff(tt.attempts); got != tt.want {
+			t.Errorf("backoff(%d) = %v, want %v", tt.attempts, got, tt.want)
+		}
+	}
+}
+
+func TestOutcome(t *testing.T) {
+	failed := errors.New("connection refused")
+	tests := []struct {
+		name       string
+		r          result
+		attempts   int
+		wantStatus string
+		wantRetry  time.Duration
+	}{
+		{"succeeded", result{status: 204}, 1, statusSucceeded, 0},
+		{"succeeded on the last attempt", result{status: 200}, maxAttempts, statusSucceeded, 0},
+		{"error status", result{status: 500}, 1, statusPending, firstRetry},
+		{"redirect", result{status: 302}, 2, statusPending, 2 * firstRetry},
+		{"no response", result{err: failed}, 3, statusPending, 4 * firstRetry},
+		{"status with an error", result{status: 200, err: failed}, 1, statusPending, firstRetry},
+		{"out of attempts", result{status: 500}, maxAttempts, statusFailed, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, retry := outcome(tt.r, tt.attempts)
+			if status != tt.wantStatus || retry != tt.wantRetry {
+				t.Errorf("got %s after %v, want %s after %v", status, retry, tt.wantStatus, tt.wantRetry)
+			}
+		})
+	}
+}
+
+// TestLease A claimed batch must be attempted and recorded before its lease
+// runs out, or another instance claims and sends it again
+func TestLease(t *testing.T) {
+	if worst := batchSize * Client.Timeout; lease <= worst {
+		t.Errorf("lease %v is shorter than a batch that times out, %v", lease, worst)
+	}
+}
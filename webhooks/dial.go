@@ -0,0 +1,89 @@
+package webhooks
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"os"
+	"syscall"
+	"time"
+)
+
+// errPrivateAddress A webhook URL resolved to an address on the server's own
+// network, which users mustn't be able to reach through it
+var errPrivateAddress = errors.New("the URL's address isn't a public one")
+
+// reserved Ranges that aren't loopback, private or link-local to the net
+// package but aren't on the public internet either
+var reserved = parseCIDRs(
+	"0.0.0.0/8",     // "this" network
+	"100.64.0.0/10", // carrier-grade NAT, and some clouds' metadata services
+	"192.0.0.0/24",  // IETF protocol assignments
+	"198.18.0.0/15", // benchmarking
+	"240.0.0.0/4",   // reserved, and broadcast
+	"64:ff9b::/96",  // NAT64, which can reach any IPv4 address
+	"2001:db8::/32", // documentation
+)
+
+// Client Sends requests for users' URLs. The address a URL resolves to is
+// checked when connecting, after any DNS lookup, so a name can't point at the
+// server's own network. Redirects count as the response, and no proxy is
+// used since it would connect on the client's behalf.
+var Client = &http.Client{
+	Timeout: 10 * time.Second,
+	// A redirect counts as a response, the URL should be changed instead
+	CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+	Transport: &http.Transport{
+		Proxy: nil,
+		DialContext: (&net.Dialer{
+			Timeout: 5 * time.Second,
+			Control: publicOnly,
+		}).DialContext,
+		TLSHandshakeTimeout: 5 * time.Second,
+		MaxIdleConns:        100,
+		IdleConnTimeout:     90 * time.Second,
+	},
+}
+
+// publicOnly Refuses connections to addresses that aren't public. In
+// development they are allowed, to try webhooks out locally.
+func publicOnly(network string, address string, _ syscall.RawConn) error {
+	if os.Getenv("ENV") == "DEV" {
+		return nil
+	}
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	if ip := net.ParseIP(host); ip == nil || !Public(ip) {
+		return errPrivateAddress
+	}
+	return nil
+}
+
+// Public If ip is on the public internet, rather than loopback, private,
+// link-local like the metadata services of clouds, multicast or reserved
+func Public(ip net.IP) bool {
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() || ip.IsLinkLocalUnicast() ||
+		ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() || ip.IsMulticast() {
+		return false
+	}
+	for _, r := range reserved {
+		if r.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+func parseCIDRs(cidrs ...string) []*net.IPNet {
+	nets := make([]*net.IPNet, len(cidrs))
+	for i, cidr := range cidrs {
+		_, n, err := net.ParseCIDR(cidr)
+		if err != nil {
+			panic(err)
+		}
+		nets[i] = n
+	}
+	return nets
+}
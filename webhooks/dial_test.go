@@ -0,0 +1,96 @@
+package webhooks
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestPublic(t *testing.T) {
+	tests := []struct {
+		ip   string
+		want bool
+	}{
+		{"93.184.216.34", true},
+		{"2606:2800:220:1:248:1893:25c8:1946", true},
+		{"127.0.0.1", false},
+		{"::1", false},
+		{"10.1.2.3", false},
+		{"172.16.0.1", false},
+		{"192.168.1.1", false},
+		{"169.254.169.254", false},
+		{"100.100.100.200", false},
+		{"0.0.0.0", false},
+		{"::", false},
+		{"fd00:ec2::254", false},
+		{"fe80::1", false},
+		{"::ffff:127.0.0.1", false},
+		{"::ffff:10.0.0.1", false},
+		{"64:ff9b::a00:1", false},
+		{"224.0.0.1", false},
+		{"255.255.255.255", false},
+	}
+	for _, tt := range tests {
+		if got := Public(net.ParseIP(tt.ip)); got != tt.want {
+			t.Errorf("Public(%s) = %v, want %v", tt.ip, got, tt.want)
+		}
+	}
+}
+
+func TestValidURL(t *testing.T) {
+	t.Setenv("ENV", "")
+	tests := []struct {
+		url  string
+		want bool
+	}{
+		{"https://example.com/hook", true},
+		{"https://93.184.216.34/hook", true},
+		{"http://example.com/hook", false},
+		{"https://localhost/hook", false},
+		{"https://127.0.0.1:8080/hook", false},
+		{"https://[::1]/hook", false},
+		{"https://169.254.169.254/latest/meta-data", false},
+		{"https:///hook", false},
+		{"ftp://example.com", false},
+	}
+	for _, tt := range tests {
+		if got := validURL(tt.url); got != tt.want {
+			t.Errorf("validURL(%q) = %v, want %v", tt.url, got, tt.want)
+		}
+	}
+}
+
+func TestClientRefusesLocalAddresses(t *testing.T) {
+	t.Setenv("ENV", "")
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("the request reached a loopback address")
+	}))
+	defer server.Close()
+
+	_, err := Client.Get(server.URL)
+	if !errors.Is(err, errPrivateAddress) {
+		t.Errorf("got %v, want %v", err, errPrivateAddress)
+	}
+}
+
+func TestClientDoesNotFollowRedirects(t *testing.T) {
+	t.Setenv("ENV", "DEV")
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			t.Error("the redirect was followed")
+		}
+		http.Redirect(w, r, "/elsewhere", http.StatusFound)
+	}))
+	defer server.Close()
+
+	res, err := Client.Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusFound {
+		t.Errorf("got status %d, want %d", res.StatusCode, http.StatusFound)
+	}
+}
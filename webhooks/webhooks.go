@@ -0,0 +1,336 @@
+package webhooks
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+	"how-much-do-i-owe/database"
+	"how-much-do-i-owe/scheduler"
+	"how-much-do-i-owe/secrets"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Types of event a webhook can subscribe to. NotificationCreated is the
+// webhook channel of notifications, sent for the types the user chose it for.
+const (
+	TransactionCreated  = "transaction.created"
+	TransactionUpdated  = "transaction.updated"
+	TransactionDeleted  = "transaction.deleted"
+	SettlementCreated   = "settlement.created"
+	ContactAccepted     = "contact.accepted"
+	NotificationCreated = "notification.created"
+	// Ping Only sent by the test endpoint, every webhook gets it
+	Ping = "ping"
+)
+
+// Types Every type of event a webhook can subscribe to
+var Types = []string{TransactionCreated, TransactionUpdated, TransactionDeleted, SettlementCreated, ContactAccepted,
+	NotificationCreated}
+
+// SecretPrefix Starts every signing secret, so they are easy to spot
+const SecretPrefix = "whsec_"
+
+const maxWebhooks = 10
+
+type webhook struct {
+	ID          int       `json:"id"`
+	URL         string    `json:"url"`
+	Description string    `json:"description"`
+	Events      []string  `json:"events"`
+	Enabled     bool      `json:"enabled"`
+	CreatedAt   time.Time `json:"createdAt"`
+	// Secret Signs every delivery, only returned once when the webhook is created
+	Secret string `json:"secret,omitempty"`
+}
+
+// webhookRequest Creates a webhook, or changes one. Null fields are left
+// unchanged, or get their defaults for a new webhook.
+type webhookRequest struct {
+	URL         *string  `json:"url"`
+	Description *string  `json:"description"`
+	Events      []string `json:"events"`
+	Enabled     *bool    `json:"enabled"`
+}
+
+// Routes All the routes created by the package nested in
+// api/v1/*
+func Routes(r *gin.RouterGroup, db *database.DB) {
+	r.GET("/webhooks", getWebhooks(db))
+	r.PUT("/webhook", createWebhook(db))
+	r.PATCH("/webhook/:id", updateWebhook(db))
+	r.DELETE("/webhook/:id", deleteWebhook(db))
+	r.GET("/webhook/:id/deliveries", getDeliveries(db))
+	r.PUT("/webhook/:id/ping", pingWebhook(db))
+}
+
+// Enqueue Queues a delivery of an event of kind about data to every enabled
+// webhook of users that subscribed to it. The queue is in the database, so
+// pass the transaction that makes the change the event is about: the
+// delivery is queued if and only if the change is committed. The job is woken
+// right away and polls again later, so it picks up deliveries whose
+// transaction was committed after it looked.
+func Enqueue(db database.Querier, kind string, data interface{}, users ...string) error {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	result, err := db.Exec(`INSERT INTO webhook_delivery (webhook_id, event_type, payload)
+							SELECT id, $1, $2 FROM webhook WHERE user_id = ANY($3) AND enabled AND $1 = ANY(events)`,
+		kind, string(payload), pq.Array(users))
+	if err != nil {
+		return err
+	}
+	if queued, _ := result.RowsAffected(); queued > 0 {
+		scheduler.Wake(JobName)
+	}
+	return nil
+}
+
+const webhookQuery = `SELECT id, url, description, events, enabled, created_at FROM webhook`
+
+func scanWebhook(row interface{ Scan(...interface{}) error }) (webhook, error) {
+	var w webhook
+	err := row.Scan(&w.ID, &w.URL, &w.Description, pq.Array(&w.Events), &w.Enabled, &w.CreatedAt)
+	return w, err
+}
+
+// webhookParam The webhook in the URL, if it belongs to the user
+func webhookParam(c *gin.Context, db database.Querier) (int, bool) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(400, "Invalid webhook ID")
+		return 0, false
+	}
+	var mine bool
+	err = db.QueryRow("SELECT EXISTS(SELECT 1 FROM webhook WHERE id=$1 AND user_id=$2)", id, c.GetString("UserID")).Scan(&mine)
+	if err != nil {
+		database.CheckDBErr(err.(*pq.Error), c)
+		return 0, false
+	}
+	if !mine {
+		c.AbortWithStatusJSON(404, "Webhook not found")
+		return 0, false
+	}
+	return id, true
+}
+
+func getWebhooks(db *database.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		queryRows, err := db.Db.Query(webhookQuery+" WHERE user_id=$1 ORDER BY id", c.GetString("UserID"))
+		if err != nil {
+			database.CheckDBErr(err.(*pq.Error), c)
+			return
+		}
+		defer queryRows.Close()
+
+		webhooks := []webhook{}
+		for queryRows.Next() {
+			w, err := scanWebhook(queryRows)
+			if err != nil {
+				c.AbortWithStatusJSON(500, "The server was unable to get webhooks")
+				return
+			}
+			webhooks = append(webhooks, w)
+		}
+
+		c.JSON(200, webhooks)
+	}
+}
+
+// validURL Webhooks are only sent over HTTPS, plain HTTP and local addresses
+// are allowed in development to try them out locally. Names are checked
+// again for what they resolve to when each delivery connects.
+func validURL(raw string) bool {
+	u, err := url.Parse(raw)
+	if err != nil || u.Hostname() == "" || len(raw) > 2000 {
+		return false
+	}
+	if os.Getenv("ENV") == "DEV" {
+		return u.Scheme == "https" || u.Scheme == "http"
+	}
+	if ip := net.ParseIP(u.Hostname()); (ip != nil && !Public(ip)) || strings.EqualFold(u.Hostname(), "localhost") {
+		return false
+	}
+	return u.Scheme == "https"
+}
+
+// validRequest Responds when a request has a field that isn't valid
+func validRequest(c *gin.Context, req *webhookRequest) bool {
+	if req.URL != nil && !validURL(*req.URL) {
+		c.JSON(http.StatusBadRequest, "url must be an https URL of a public address")
+		return false
+	}
+	if req.Description != nil {
+		trimmed := strings.TrimSpace(*req.Description)
+		req.Description = &trimmed
+		if len(trimmed) > 200 {
+			c.JSON(http.StatusBadRequest, "description must be at most 200 characters")
+			return false
+		}
+	}
+	for _, kind := range req.Events {
+		known := false
+		for _, t := range Types {
+			known = known || t == kind
+		}
+		if !known {
+			c.JSON(http.StatusBadRequest, "Unknown event type "+kind)
+			return false
+		}
+	}
+	return true
+}
+
+// newSecret A random signing secret
+func newSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return SecretPrefix + base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// secretContext Binds an encrypted secret to its webhook
+func secretContext(id int) string {
+	return "webhook:" + strconv.Itoa(id)
+}
+
+// createWebhook Registers a URL for the events in the request, every type of
+// event when it lists none. The response has the signing secret, which
+// can't be seen again.
+func createWebhook(db *database.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.GetString("UserID")
+		var req webhookRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if req.URL == nil {
+			c.JSON(http.StatusBadRequest, "A webhook needs a url")
+			return
+		}
+		if !validRequest(c, &req) {
+			return
+		}
+		if len(req.Events) == 0 {
+			req.Events = Types
+		}
+		description, enabled := "", true
+		if req.Description != nil {
+			description = *req.Description
+		}
+		if req.Enabled != nil {
+			enabled = *req.Enabled
+		}
+		secret, err := newSecret()
+		if err != nil {
+			c.AbortWithStatusJSON(500, "The server was unable to create a webhook")
+			return
+		}
+
+		tx, err := db.Db.Begin()
+		if err != nil {
+			database.CheckDBErr(err.(*pq.Error), c)
+			return
+		}
+		defer tx.Rollback()
+
+		var count int
+		if err = tx.QueryRow("SELECT count(*) FROM webhook WHERE user_id=$1", userID).Scan(&count); err != nil {
+			database.CheckDBErr(err.(*pq.Error), c)
+			return
+		}
+		if count >= maxWebhooks {
+			c.AbortWithStatusJSON(409, "You already have 10 webhooks, delete one first")
+			return
+		}
+		var id int
+		err = tx.QueryRow("INSERT INTO webhook (user_id, url, description, events, enabled) VALUES ($1, $2, $3, $4, $5) RETURNING id",
+			userID, *req.URL, description, pq.Array(req.Events), enabled).Scan(&id)
+		if err != nil {
+			database.CheckDBErr(err.(*pq.Error), c)
+			return
+		}
+		encrypted, err := secrets.Default.Encrypt(secret, secretContext(id))
+		if err != nil {
+			c.AbortWithStatusJSON(500, "The server was unable to create a webhook")
+			return
+		}
+		if _, err = tx.Exec("UPDATE webhook SET secret=$2 WHERE id=$1", id, encrypted); err != nil {
+			database.CheckDBErr(err.(*pq.Error), c)
+			return
+		}
+		w, err := scanWebhook(tx.QueryRow(webhookQuery+" WHERE id=$1", id))
+		if err != nil {
+			database.CheckDBErr(err.(*pq.Error), c)
+			return
+		}
+		if err = tx.Commit(); err != nil {
+			database.CheckDBErr(err.(*pq.Error), c)
+			return
+		}
+		w.Secret = secret
+
+		c.JSON(201, w)
+	}
+}
+
+func updateWebhook(db *database.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, ok := webhookParam(c, db.Db)
+		if !ok {
+			return
+		}
+		var req webhookRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if !validRequest(c, &req) {
+			return
+		}
+		var events interface{}
+		if req.Events != nil {
+			events = pq.Array(req.Events)
+		}
+		_, err := db.Db.Exec(`UPDATE webhook SET url=COALESCE($2, url), description=COALESCE($3, description),
+                   					events=COALESCE($4, events), enabled=COALESCE($5, enabled) WHERE id=$1`,
+			id, req.URL, req.Description, events, req.Enabled)
+		if err != nil {
+			database.CheckDBErr(err.(*pq.Error), c)
+			return
+		}
+		w, err := scanWebhook(db.Db.QueryRow(webhookQuery+" WHERE id=$1", id))
+		if err != nil {
+			database.CheckDBErr(err.(*pq.Error), c)
+			return
+		}
+
+		c.JSON(200, w)
+	}
+}
+
+// deleteWebhook Deletes a webhook along with its queued deliveries and log
+func deleteWebhook(db *database.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, ok := webhookParam(c, db.Db)
+		if !ok {
+			return
+		}
+		if _, err := db.Db.Exec("DELETE FROM webhook WHERE id=$1", id); err != nil {
+			database.CheckDBErr(err.(*pq.Error), c)
+			return
+		}
+
+		c.JSON(201, id)
+	}
+}